@@ -30,9 +30,11 @@ import (
 	"backend/internal/repository"
 	"backend/internal/router"
 	"backend/internal/service"
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -80,7 +82,7 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	fileRepo := repository.NewFileRepository(db)
 	codeRepo := repository.NewCodeRepository(rdb)
-	refreshTokenRepo := repository.NewRefreshTokenRepository(rdb)
+	sessionRepo := repository.NewSessionRepository(rdb)
 	rateLimitRepo := repository.NewRateLimitRepository(rdb)
 	accessTokenBlacklistRepo := repository.NewAccessTokenBlacklistRepository(rdb)
 	deviceRepo := repository.NewDeviceRepository(db)
@@ -92,6 +94,15 @@ func main() {
 	blockListRepo := repository.NewBlockListRepository(db)
 	friendBanRepo := repository.NewFriendBanRepository(db)
 	chatRoomRepo := repository.NewChatRoomRepository(db)
+	chatMsgRepo := repository.NewChatMessageRepository(db)
+	chatPendingRepo := repository.NewChatPendingRepository(rdb)
+	chatReadRepo := repository.NewChatReadStateRepository(db)
+	chatMemberRepo := repository.NewChatRoomMemberRepository(db)
+	presenceRepo := repository.NewPresenceRepository(rdb)
+	chatRateLimitRepo := repository.NewChatRateLimitRepository(rdb)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	webAuthnRepo := repository.NewWebAuthnCredentialRepository(db)
+	loginAttemptRepo := repository.NewLoginAttemptRepository(rdb)
 
 	// 初始化服务层
 	securityCfg := config.GetSecurityConfig()
@@ -99,22 +110,53 @@ func main() {
 	smtpCfg := config.GetSMTPConfig()
 	log.Printf("启动时SMTP配置: host=%s port=%d username=%s from=%s password_set=%t", smtpCfg.Host, smtpCfg.Port, smtpCfg.Username, smtpCfg.From, smtpCfg.Password != "")
 	mailSvc := service.NewMailService(smtpCfg)
-	jwtSvc := service.NewJwtService(securityCfg)
+	jwtSvc, err := service.NewJwtService(securityCfg)
+	if err != nil {
+		log.Fatalf("JWT服务初始化失败: %v", err)
+	}
 	fileStorageSvc := service.NewFileStorageService(fileStorageCfg)
-	userService := service.NewUserService(userRepo, deviceRepo, codeRepo, refreshTokenRepo, rateLimitRepo, accessTokenBlacklistRepo, mailSvc, jwtSvc, securityCfg)
-	fileService := service.NewFileService(fileRepo, fileStorageSvc)
+	passwordHasher := service.NewPasswordHasher(securityCfg)
 	adminLogService := service.NewAdminLogService(adminLogRepo)
 	userActionLogService := service.NewUserActionLogService(userActionLogRepo)
+	twoFactorService := service.NewTwoFactorService(twoFactorRepo, userRepo, userActionLogService, securityCfg)
+	webAuthnService := service.NewWebAuthnService(webAuthnRepo, userRepo, codeRepo, userActionLogService, config.GetWebAuthnConfig())
+	deviceService := service.NewDeviceService(deviceRepo, sessionRepo, userActionLogService)
+	loginGuard := service.NewLoginGuard(loginAttemptRepo, userRepo, mailSvc, userActionLogService, config.GetLoginLockoutConfig())
+	userService := service.NewUserService(userRepo, deviceRepo, codeRepo, sessionRepo, rateLimitRepo, accessTokenBlacklistRepo, mailSvc, jwtSvc, passwordHasher, twoFactorService, webAuthnService, loginGuard, securityCfg)
+	fileService := service.NewFileService(fileRepo, fileStorageSvc, chatMsgRepo)
 	adminCfg := config.GetAdminConfig()
+	// 聊天分发器：多实例部署时使用 Redis pub/sub
+	chatCfg := config.GetChatConfig()
+	var chatBroker service.ChatBroker
+	if chatCfg.Broker == "redis" {
+		chatBroker = service.NewRedisChatBroker(rdb, chatCfg.RedisChannel)
+	} else {
+		chatBroker = service.NewLocalChatBroker()
+	}
+	defer chatBroker.Close()
+	chatPolicy := service.NewChatPolicy(userRepo, blockListRepo, accessTokenBlacklistRepo, sessionRepo, chatBroker)
 	// 好友系统服务：每日请求上限100，好友上限500
-	friendService := service.NewFriendService(friendReqRepo, friendshipRepo, blockListRepo, friendBanRepo, userRepo, rateLimitRepo, mailSvc, userActionLogService, 100, 500, chatRoomRepo)
+	friendService := service.NewFriendService(friendReqRepo, friendshipRepo, blockListRepo, friendBanRepo, userRepo, rateLimitRepo, mailSvc, userActionLogService, 100, 500, chatRoomRepo, chatPolicy)
+	chatService := service.NewChatService(chatRoomRepo, chatMsgRepo, chatReadRepo, chatMemberRepo, userRepo, fileRepo, chatBroker, chatPolicy, time.Duration(chatCfg.RecallWindowSeconds)*time.Second)
+	chatGroupService := service.NewChatGroupService(chatRoomRepo, chatMemberRepo, friendshipRepo, chatBroker)
+	presenceService := service.NewPresenceService(presenceRepo, friendshipRepo, chatBroker)
+	// 实例异常退出时其连接不会主动断开，由各实例定期清理过期连接并通知好友离线
+	go presenceService.RunSweeper(context.Background(), service.PresenceSweepInterval)
+	chatRateLimiter := service.NewChatRateLimiter(chatRateLimitRepo, userActionLogService, chatCfg)
 
 	// 初始化处理器层
 	userHandler := handler.NewUserHandler(userService, userActionLogService)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService)
+	passkeyHandler := handler.NewPasskeyHandler(webAuthnService, userService, userActionLogService)
+	deviceHandler := handler.NewDeviceHandler(deviceService)
 	fileHandler := handler.NewFileHandler(fileService)
-	adminHandler := handler.NewAdminHandler(*adminCfg, jwtSvc, userService, adminLogService, userActionLogService, fileService, friendBanRepo)
-	friendHandler := handler.NewFriendHandler(friendService)
-	wsHandler := handler.NewWSHandler(jwtSvc, friendshipRepo, chatRoomRepo)
+	adminHandler := handler.NewAdminHandler(*adminCfg, jwtSvc, userService, adminLogService, userActionLogService, fileService, friendBanRepo, chatPolicy, deviceService)
+	friendHandler := handler.NewFriendHandler(friendService, presenceService)
+	chatHandler := handler.NewChatHandler(chatService, chatGroupService)
+	// 聊天投递核心，WebSocket 与 SSE/REST 传输共用
+	chatHub := handler.NewChatHub(jwtSvc, friendshipRepo, chatRoomRepo, chatMsgRepo, chatPendingRepo, chatService, presenceService, chatPolicy, chatBroker, chatRateLimiter, chatCfg.SendQueueSize, chatCfg.SlowConsumerPolicy)
+	wsHandler := handler.NewWSHandler(chatHub)
+	chatStreamHandler := handler.NewChatStreamHandler(chatHub)
 
 	// 验证文件存储配置
 	if err := fileStorageCfg.ValidateConfigs(); err != nil {
@@ -122,7 +164,7 @@ func main() {
 	}
 
 	// 设置路由
-	r := router.SetupRoutes(userHandler, fileHandler, adminHandler, friendHandler, wsHandler, jwtSvc, accessTokenBlacklistRepo)
+	r := router.SetupRoutes(userHandler, twoFactorHandler, passkeyHandler, deviceHandler, fileHandler, adminHandler, friendHandler, chatHandler, wsHandler, chatStreamHandler, chatHub, jwtSvc, accessTokenBlacklistRepo, sessionRepo)
 
 	// 启动管理面板服务器
 	go startPanelServer()
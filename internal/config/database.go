@@ -58,7 +58,7 @@ func InitDatabase() (*gorm.DB, error) {
 
 // AutoMigrate 自动迁移数据库模型
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&model.User{},
 		&model.File{}, // 添加文件模型
 		&model.UserDevice{},
@@ -71,7 +71,34 @@ func AutoMigrate(db *gorm.DB) error {
 		&model.BlockList{},
 		&model.FriendBan{},
 		&model.ChatRoom{},
-	)
+		&model.ChatMessage{},
+		&model.ChatReadState{},
+		&model.ChatRoomMember{},
+		&model.ChatMessageEdit{},
+		&model.ChatMessageHidden{},
+		&model.ChatMessageAttachment{},
+		&model.UserTOTP{},
+		&model.UserRecoveryCode{},
+		&model.WebAuthnCredential{},
+	); err != nil {
+		return err
+	}
+	// 旧的一对一房间唯一索引不区分房间类型，已由部分索引 uidx_chat_direct_pair 替代
+	if err := db.Exec("DROP INDEX IF EXISTS uidx_chat_pair").Error; err != nil {
+		return err
+	}
+	// 聊天消息全文检索：由内容生成 tsvector 列（编辑、撤回后自动更新）并建立 GIN 索引
+	// simple 分词配置不切分中文，先由 chat_search_text 在中日韩字符及全角标点两侧插入空格，使每个字成为独立词元，
+	// 查询时按短语（相邻词元）匹配，句中的词同样可以命中；中日韩字符在 C 与 UTF-8 区域下均被解析为词，不依赖数据库的 LC_CTYPE
+	if err := db.Exec(`CREATE OR REPLACE FUNCTION chat_search_text(t text) RETURNS text
+		LANGUAGE sql IMMUTABLE PARALLEL SAFE
+		AS $$ SELECT regexp_replace(coalesce(t, ''), '([\u3000-\u303f\u3040-\u30ff\u3400-\u4dbf\u4e00-\u9fff\uac00-\ud7af\uf900-\ufaff\uff00-\uffef])', ' \1 ', 'g') $$`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec("ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', chat_search_text(content))) STORED").Error; err != nil {
+		return err
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_chat_msg_search ON chat_messages USING GIN (search_vector)").Error
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -40,6 +41,71 @@ type SecurityConfig struct {
 	JwtSecret                      string
 	JwtAccessTokenExpiresInMinutes int
 	JwtRefreshTokenExpiresInDays   int
+	// JwtSigningAlgorithm JWT签名算法：HS256（共享密钥 JwtSecret）、RS256 或 EdDSA
+	JwtSigningAlgorithm string
+	// JwtKeysFile RS256/EdDSA 模式下的密钥清单文件（JSON），列出各密钥的 kid、PEM 私钥路径与启用时间
+	JwtKeysFile string
+	// PasswordHashAlgorithm 新密码使用的哈希算法：argon2id 或 bcrypt
+	PasswordHashAlgorithm string
+	// argon2id 参数：内存（KiB）、迭代次数、并行度
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	// BcryptCost bcrypt 计算成本
+	BcryptCost int
+	// TOTPIssuer 验证器应用中显示的发行方名称
+	TOTPIssuer string
+	// EmailChangeUndoHours 邮箱修改生效后，原邮箱可撤销修改的时长（小时）
+	EmailChangeUndoHours int
+}
+
+// WebAuthnConfig 通行密钥（WebAuthn）依赖方配置
+type WebAuthnConfig struct {
+	// RPID 依赖方ID，须为前端页面域名或其可注册的上级域名
+	RPID string
+	// RPName 认证器提示中显示的名称
+	RPName string
+	// Origins 允许发起注册与登录的前端源，如 https://app.example.com
+	Origins []string
+	// TimeoutSeconds 挑战有效期（秒）
+	TimeoutSeconds int
+}
+
+// LoginLockoutConfig 密码登录失败的退避与锁定配置
+// 账户（按用户名）与来源IP分别计数：达到退避阈值后每次失败的等待时间翻倍，达到锁定阈值后临时锁定
+type LoginLockoutConfig struct {
+	// FailureWindowMinutes 距最近一次失败超过该时长后失败计数清零
+	FailureWindowMinutes int
+	AccountBackoffAfter  int
+	AccountLockoutAfter  int
+	IPBackoffAfter       int
+	IPLockoutAfter       int
+	// BackoffBaseSeconds 首次退避的等待时长，之后每次失败翻倍，不超过 BackoffMaxSeconds
+	BackoffBaseSeconds int
+	BackoffMaxSeconds  int
+	// LockoutMinutes 锁定时长
+	LockoutMinutes int
+}
+
+// ChatConfig 聊天相关配置
+type ChatConfig struct {
+	// Broker 消息分发方式：local（进程内，单实例）或 redis（pub/sub，多实例）
+	Broker string
+	// RedisChannel Redis 分发使用的频道名
+	RedisChannel string
+	// RecallWindowSeconds 消息发出后允许撤回的时长（秒）
+	RecallWindowSeconds int
+	// SendQueueSize 每个 WebSocket 连接发送队列的容量（帧数）
+	SendQueueSize int
+	// SlowConsumerPolicy 发送队列已满时的处理：disconnect（断开慢连接）或 drop（丢弃新帧）
+	SlowConsumerPolicy string
+	// 令牌桶限流：用户维度限制该用户全部连接上行的帧（ack/read 除外），房间维度限制单个用户在单个房间内的消息
+	UserRatePerSecond float64
+	UserRateBurst     int
+	RoomRatePerSecond float64
+	RoomRateBurst     int
+	// RateAbuseThreshold 单个用户一分钟内超限达到该次数即断开（各连接与 REST 请求合计）
+	RateAbuseThreshold int
 }
 
 // GetRedisConfig 获取Redis配置
@@ -80,11 +146,87 @@ func GetSecurityConfig() *SecurityConfig {
 	maxRequests, _ := strconv.Atoi(getEnv("MAX_IP_REQUESTS_PER_DAY", "10"))
 	accessTokenExpires, _ := strconv.Atoi(getEnv("JWT_ACCESS_TOKEN_EXPIRES_IN_MINUTES", "30"))
 	refreshTokenExpires, _ := strconv.Atoi(getEnv("JWT_REFRESH_TOKEN_EXPIRES_IN_DAYS", "7"))
+	argon2Memory, _ := strconv.Atoi(getEnv("PASSWORD_ARGON2_MEMORY_KIB", "65536"))
+	argon2Iterations, _ := strconv.Atoi(getEnv("PASSWORD_ARGON2_ITERATIONS", "3"))
+	argon2Parallelism, _ := strconv.Atoi(getEnv("PASSWORD_ARGON2_PARALLELISM", "2"))
+	bcryptCost, _ := strconv.Atoi(getEnv("PASSWORD_BCRYPT_COST", "12"))
+	emailChangeUndoHours, _ := strconv.Atoi(getEnv("EMAIL_CHANGE_UNDO_HOURS", "72"))
 	return &SecurityConfig{
 		MaxRequestsPerIPPerDay:         maxRequests,
 		JwtSecret:                      getEnv("JWT_SECRET", "a-very-secret-key-that-should-be-changed"),
+		JwtSigningAlgorithm:            getEnv("JWT_SIGNING_ALGORITHM", "HS256"),
+		JwtKeysFile:                    getEnv("JWT_KEYS_FILE", ""),
 		JwtAccessTokenExpiresInMinutes: accessTokenExpires,
 		JwtRefreshTokenExpiresInDays:   refreshTokenExpires,
+		PasswordHashAlgorithm:          getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2MemoryKiB:                argon2Memory,
+		Argon2Iterations:               argon2Iterations,
+		Argon2Parallelism:              argon2Parallelism,
+		BcryptCost:                     bcryptCost,
+		TOTPIssuer:                     getEnv("TOTP_ISSUER", "Backend"),
+		EmailChangeUndoHours:           emailChangeUndoHours,
+	}
+}
+
+// GetWebAuthnConfig 获取通行密钥配置
+func GetWebAuthnConfig() *WebAuthnConfig {
+	timeout, _ := strconv.Atoi(getEnv("WEBAUTHN_TIMEOUT_SECONDS", "300"))
+	var origins []string
+	for _, o := range strings.Split(getEnv("WEBAUTHN_ORIGINS", "http://localhost:8080"), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return &WebAuthnConfig{
+		RPID:           getEnv("WEBAUTHN_RP_ID", "localhost"),
+		RPName:         getEnv("WEBAUTHN_RP_NAME", "Backend"),
+		Origins:        origins,
+		TimeoutSeconds: timeout,
+	}
+}
+
+// GetLoginLockoutConfig 获取登录失败锁定配置
+func GetLoginLockoutConfig() *LoginLockoutConfig {
+	window, _ := strconv.Atoi(getEnv("LOGIN_FAILURE_WINDOW_MINUTES", "30"))
+	accountBackoff, _ := strconv.Atoi(getEnv("LOGIN_ACCOUNT_BACKOFF_AFTER", "3"))
+	accountLockout, _ := strconv.Atoi(getEnv("LOGIN_ACCOUNT_LOCKOUT_AFTER", "10"))
+	ipBackoff, _ := strconv.Atoi(getEnv("LOGIN_IP_BACKOFF_AFTER", "10"))
+	ipLockout, _ := strconv.Atoi(getEnv("LOGIN_IP_LOCKOUT_AFTER", "50"))
+	backoffBase, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_BASE_SECONDS", "1"))
+	backoffMax, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_MAX_SECONDS", "300"))
+	lockout, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_MINUTES", "15"))
+	return &LoginLockoutConfig{
+		FailureWindowMinutes: window,
+		AccountBackoffAfter:  accountBackoff,
+		AccountLockoutAfter:  accountLockout,
+		IPBackoffAfter:       ipBackoff,
+		IPLockoutAfter:       ipLockout,
+		BackoffBaseSeconds:   backoffBase,
+		BackoffMaxSeconds:    backoffMax,
+		LockoutMinutes:       lockout,
+	}
+}
+
+// GetChatConfig 获取聊天配置
+func GetChatConfig() *ChatConfig {
+	recallWindow, _ := strconv.Atoi(getEnv("CHAT_RECALL_WINDOW_SECONDS", "120"))
+	sendQueueSize, _ := strconv.Atoi(getEnv("CHAT_SEND_QUEUE_SIZE", "256"))
+	userRate, _ := strconv.ParseFloat(getEnv("CHAT_RATE_USER_PER_SECOND", "5"), 64)
+	userBurst, _ := strconv.Atoi(getEnv("CHAT_RATE_USER_BURST", "20"))
+	roomRate, _ := strconv.ParseFloat(getEnv("CHAT_RATE_ROOM_PER_SECOND", "2"), 64)
+	roomBurst, _ := strconv.Atoi(getEnv("CHAT_RATE_ROOM_BURST", "10"))
+	abuseThreshold, _ := strconv.Atoi(getEnv("CHAT_RATE_ABUSE_THRESHOLD", "20"))
+	return &ChatConfig{
+		Broker:              getEnv("CHAT_BROKER", "local"),
+		RedisChannel:        getEnv("CHAT_REDIS_CHANNEL", "chat:deliver"),
+		RecallWindowSeconds: recallWindow,
+		SendQueueSize:       sendQueueSize,
+		SlowConsumerPolicy:  getEnv("CHAT_SLOW_CONSUMER_POLICY", "disconnect"),
+		UserRatePerSecond:   userRate,
+		UserRateBurst:       userBurst,
+		RoomRatePerSecond:   roomRate,
+		RoomRateBurst:       roomBurst,
+		RateAbuseThreshold:  abuseThreshold,
 	}
 }
 
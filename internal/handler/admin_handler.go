@@ -25,6 +25,8 @@ type AdminHandler struct {
 	userActionLogService service.UserActionLogService
 	fileService service.FileService
 	friendBanRepo repository.FriendBanRepository
+	chatPolicy service.ChatPolicy
+	deviceService service.DeviceService
 }
 
 // AdminSetFriendBan 管理员：设置用户好友功能封禁
@@ -393,6 +395,50 @@ func (h *AdminHandler) UpdateUserPassword(c *gin.Context) {
     response.SuccessResponse(c, http.StatusOK, "用户密码更新成功", nil)
 }
 
+// ClearUserLoginLockout 管理员解除用户因密码错误产生的登录锁定
+// @Summary 管理员解除用户登录锁定
+// @Description 清除用户账户的失败登录计数、退避与临时锁定，来源IP的计数不受影响
+// @Tags admin-users
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200 {object} response.ResponseData
+// @Failure 400 {object} response.ResponseData
+// @Failure 404 {object} response.ResponseData
+// @Router /admin/users/{id}/login-lockout [delete]
+func (h *AdminHandler) ClearUserLoginLockout(c *gin.Context) {
+    userID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "无效的用户ID格式", err.Error())
+        return
+    }
+
+    if err := h.userService.ClearLoginLockout(c.Request.Context(), userID); err != nil {
+        if err.Error() == "用户不存在" {
+            response.ErrorResponse(c, http.StatusNotFound, "用户不存在", nil)
+            return
+        }
+        response.ErrorResponse(c, http.StatusInternalServerError, "解除登录锁定失败", err.Error())
+        return
+    }
+
+    // 管理员操作日志
+    if adminUsername, exists := c.Get("admin_username"); exists {
+        detailsBytes, _ := json.Marshal(map[string]any{
+            "target_user_id": userID.String(),
+        })
+        _ = h.adminLogService.Create(c.Request.Context(), &model.AdminActionLog{
+            AdminUsername: adminUsername.(string),
+            Action:        "clear_user_login_lockout",
+            TargetUserID:  &userID,
+            Details:       string(detailsBytes),
+            IPAddress:     c.ClientIP(),
+            UserAgent:     c.GetHeader("User-Agent"),
+        })
+    }
+
+    response.SuccessResponse(c, http.StatusOK, "登录锁定已解除", nil)
+}
+
 // AdminRefreshToken 刷新管理员Token
 // @Summary 刷新管理员Token
 // @Tags admin-auth
@@ -416,7 +462,7 @@ func (h *AdminHandler) AdminRefreshToken(c *gin.Context) {
 }
 
 // NewAdminHandler 创建管理员处理器实例
-func NewAdminHandler(adminConfig config.AdminConfig, jwtService service.JwtService, userService service.UserService, adminLogService service.AdminLogService, userActionLogService service.UserActionLogService, fileService service.FileService, friendBanRepo repository.FriendBanRepository) *AdminHandler {
+func NewAdminHandler(adminConfig config.AdminConfig, jwtService service.JwtService, userService service.UserService, adminLogService service.AdminLogService, userActionLogService service.UserActionLogService, fileService service.FileService, friendBanRepo repository.FriendBanRepository, chatPolicy service.ChatPolicy, deviceService service.DeviceService) *AdminHandler {
     return &AdminHandler{
         adminConfig: adminConfig,
         jwtService:  jwtService,
@@ -425,6 +471,8 @@ func NewAdminHandler(adminConfig config.AdminConfig, jwtService service.JwtServi
         userActionLogService: userActionLogService,
         fileService: fileService,
         friendBanRepo: friendBanRepo,
+        chatPolicy: chatPolicy,
+        deviceService: deviceService,
     }
 }
 
@@ -550,6 +598,11 @@ func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
 		return
 	}
 
+	// 封禁或停用后立即断开该用户的聊天连接
+	if req.Status != "active" {
+		_ = h.chatPolicy.Disconnect(c.Request.Context(), userID, model.ChatErrAccountDisabled, "账户已被封禁或停用")
+	}
+
     // 自动记录管理员操作日志：更新用户状态
     if adminUsername, exists := c.Get("admin_username"); exists {
         detailsObj := map[string]any{
@@ -608,6 +661,7 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		response.ErrorResponse(c, http.StatusInternalServerError, "删除用户失败", err.Error())
 		return
 	}
+	_ = h.chatPolicy.Disconnect(c.Request.Context(), userID, model.ChatErrAccountDisabled, "账户已被删除")
 
     // 自动记录管理员操作日志：删除用户
     if adminUsername, exists := c.Get("admin_username"); exists {
@@ -745,3 +799,127 @@ func (h *AdminHandler) ListUserActionLogs(c *gin.Context) {
         "limit": limit,
     })
 }
+
+// AdminListUserDevices 管理员：列出用户设备
+// @Summary 管理员列出用户设备
+// @Tags admin-users
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200 {object} response.ResponseData{data=[]model.DeviceResponse}
+// @Failure 400 {object} response.ResponseData
+// @Router /admin/users/{id}/devices [get]
+func (h *AdminHandler) AdminListUserDevices(c *gin.Context) {
+    userID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "无效的用户ID格式", err.Error())
+        return
+    }
+    devices, err := h.deviceService.ListDevices(c.Request.Context(), userID)
+    if err != nil {
+        response.ErrorResponse(c, http.StatusInternalServerError, "获取设备列表失败", err.Error())
+        return
+    }
+    response.SuccessResponse(c, http.StatusOK, "获取成功", devices)
+}
+
+// AdminUpdateUserDevice 管理员：更新用户设备（重命名或取消信任）
+// @Summary 管理员更新用户设备
+// @Description 取消信任会撤销该设备上的全部登录会话
+// @Tags admin-users
+// @Accept json
+// @Produce json
+// @Param id path string true "用户ID"
+// @Param device_id path string true "设备ID"
+// @Param request body model.UpdateDeviceRequest true "更新内容"
+// @Success 200 {object} response.ResponseData{data=model.DeviceResponse}
+// @Failure 400 {object} response.ResponseData
+// @Failure 404 {object} response.ResponseData
+// @Router /admin/users/{id}/devices/{device_id} [patch]
+func (h *AdminHandler) AdminUpdateUserDevice(c *gin.Context) {
+    userID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "无效的用户ID格式", err.Error())
+        return
+    }
+    deviceID, err := uuid.Parse(c.Param("device_id"))
+    if err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "无效的设备ID格式", err.Error())
+        return
+    }
+    var req model.UpdateDeviceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+        return
+    }
+    device, err := h.deviceService.UpdateDevice(c.Request.Context(), userID, deviceID, &req)
+    if err != nil {
+        writeDeviceError(c, err, "更新设备失败")
+        return
+    }
+
+    // 管理员操作日志
+    if adminUsername, exists := c.Get("admin_username"); exists {
+        detailsBytes, _ := json.Marshal(map[string]any{
+            "target_user_id": userID.String(),
+            "device_id":      deviceID.String(),
+            "request":        req,
+        })
+        _ = h.adminLogService.Create(c.Request.Context(), &model.AdminActionLog{
+            AdminUsername: adminUsername.(string),
+            Action:        "update_user_device",
+            TargetUserID:  &userID,
+            Details:       string(detailsBytes),
+            IPAddress:     c.ClientIP(),
+            UserAgent:     c.GetHeader("User-Agent"),
+        })
+    }
+
+    response.SuccessResponse(c, http.StatusOK, "更新成功", device)
+}
+
+// AdminDeleteUserDevice 管理员：移除用户设备并撤销其上的会话
+// @Summary 管理员移除用户设备
+// @Tags admin-users
+// @Produce json
+// @Param id path string true "用户ID"
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} response.ResponseData{data=model.RevokeDeviceResponse}
+// @Failure 400 {object} response.ResponseData
+// @Failure 404 {object} response.ResponseData
+// @Router /admin/users/{id}/devices/{device_id} [delete]
+func (h *AdminHandler) AdminDeleteUserDevice(c *gin.Context) {
+    userID, err := uuid.Parse(c.Param("id"))
+    if err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "无效的用户ID格式", err.Error())
+        return
+    }
+    deviceID, err := uuid.Parse(c.Param("device_id"))
+    if err != nil {
+        response.ErrorResponse(c, http.StatusBadRequest, "无效的设备ID格式", err.Error())
+        return
+    }
+    n, err := h.deviceService.RevokeDevice(c.Request.Context(), userID, deviceID)
+    if err != nil {
+        writeDeviceError(c, err, "移除设备失败")
+        return
+    }
+
+    // 管理员操作日志
+    if adminUsername, exists := c.Get("admin_username"); exists {
+        detailsBytes, _ := json.Marshal(map[string]any{
+            "target_user_id":   userID.String(),
+            "device_id":        deviceID.String(),
+            "revoked_sessions": n,
+        })
+        _ = h.adminLogService.Create(c.Request.Context(), &model.AdminActionLog{
+            AdminUsername: adminUsername.(string),
+            Action:        "revoke_user_device",
+            TargetUserID:  &userID,
+            Details:       string(detailsBytes),
+            IPAddress:     c.ClientIP(),
+            UserAgent:     c.GetHeader("User-Agent"),
+        })
+    }
+
+    response.SuccessResponse(c, http.StatusOK, "移除成功", model.RevokeDeviceResponse{RevokedSessions: n})
+}
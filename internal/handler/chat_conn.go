@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 发送队列溢出策略
+const (
+	chatOverflowDisconnect = "disconnect" // 断开慢连接，未确认的消息在重连后补发
+	chatOverflowDrop       = "drop"       // 丢弃新帧，连接保持
+)
+
+// defaultSendQueueSize 每个连接发送队列的默认容量（帧数）
+const defaultSendQueueSize = 256
+
+// chatWriteTimeout 单帧写超时，超时视为连接失效
+const chatWriteTimeout = 10 * time.Second
+
+// chatOutbound 发送队列中的一帧；close 为 true 时写完该帧后关闭连接
+type chatOutbound struct {
+	data  []byte
+	close bool
+}
+
+// chatQueueMetrics 发送队列累计指标（进程内）
+type chatQueueMetrics struct {
+	dropped         atomic.Int64 // 因队列已满被丢弃的帧数
+	slowDisconnects atomic.Int64 // 因队列已满被断开的连接数
+}
+
+// chatConn 与传输方式无关的聊天连接（WebSocket 或 SSE）
+// id 全局唯一，用于跨实例投递时排除发送方自身连接
+// 所有数据帧经有界队列由传输层的写协程写出，投递方从不阻塞在慢连接上
+type chatConn struct {
+	id     string
+	userID uuid.UUID
+	// 建立连接使用的 access token 及其所属会话，心跳时复查是否被撤销
+	token     string
+	sessionID uuid.UUID
+	// 发送队列与关闭信号；send 不关闭，写协程在 done 关闭后退出
+	// REST 请求使用的临时连接没有发送队列（send 为 nil）
+	send      chan chatOutbound
+	done      chan struct{}
+	closeOnce sync.Once
+	// closeFn 关闭底层传输，使读循环或事件流返回
+	closeFn func()
+	// dropOnOverflow 队列已满时丢弃新帧而不是断开连接
+	dropOnOverflow bool
+	metrics        *chatQueueMetrics
+	// 正在输入节流：roomID -> 上次转发 start 的时间
+	typingMu   sync.Mutex
+	typingSent map[uuid.UUID]time.Time
+}
+
+func newChatConn(userID, sessionID uuid.UUID, token string, queueSize int, dropOnOverflow bool, metrics *chatQueueMetrics, closeFn func()) *chatConn {
+	return &chatConn{
+		id:             uuid.NewString(),
+		userID:         userID,
+		token:          token,
+		sessionID:      sessionID,
+		send:           make(chan chatOutbound, queueSize),
+		done:           make(chan struct{}),
+		closeFn:        closeFn,
+		dropOnOverflow: dropOnOverflow,
+		metrics:        metrics,
+	}
+}
+
+// newDetachedConn 单次 REST 请求使用的临时连接，不登记、不接收投递
+func newDetachedConn(userID uuid.UUID, token string) *chatConn {
+	return &chatConn{
+		id:     uuid.NewString(),
+		userID: userID,
+		token:  token,
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue 非阻塞地把一帧放入发送队列，队列已满时按溢出策略处理
+func (c *chatConn) enqueue(data []byte) bool {
+	return c.push(chatOutbound{data: data})
+}
+
+// enqueueClose 放入最后一帧并在写出后关闭连接；data 为空时仅在已排队的帧写完后关闭
+// 队列已满时直接关闭
+func (c *chatConn) enqueueClose(data []byte) {
+	c.push(chatOutbound{data: data, close: true})
+}
+
+// enqueueWait 阻塞直到帧进入队列，用于补发等需要完整送达的批量写入
+func (c *chatConn) enqueueWait(ctx context.Context, data []byte) bool {
+	if c.send == nil {
+		return false
+	}
+	select {
+	case c.send <- chatOutbound{data: data}:
+		return true
+	case <-c.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *chatConn) push(item chatOutbound) bool {
+	if c.send == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- item:
+		return true
+	default:
+	}
+	if c.dropOnOverflow && !item.close {
+		c.metrics.dropped.Add(1)
+		return false
+	}
+	if !item.close {
+		c.metrics.slowDisconnects.Add(1)
+	}
+	c.shutdown()
+	return false
+}
+
+// shutdown 关闭连接，读循环或事件流随之返回并完成注销
+func (c *chatConn) shutdown() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.closeFn != nil {
+			c.closeFn()
+		}
+	})
+}
+
+// queueDepth 当前排队的帧数
+func (c *chatConn) queueDepth() int {
+	return len(c.send)
+}
+
+// allowTyping 判断本连接在房间内的输入状态是否需要转发，并记录转发时间
+// start 在节流间隔内重复出现时丢弃；stop 仅在此前转发过 start 时转发一次
+func (c *chatConn) allowTyping(roomID uuid.UUID, state string, now time.Time) bool {
+	c.typingMu.Lock()
+	defer c.typingMu.Unlock()
+	last, typing := c.typingSent[roomID]
+	if state == model.ChatTypingStop {
+		delete(c.typingSent, roomID)
+		return typing
+	}
+	if typing && now.Sub(last) < typingThrottle {
+		return false
+	}
+	if c.typingSent == nil {
+		c.typingSent = make(map[uuid.UUID]time.Time)
+	}
+	c.typingSent[roomID] = now
+	return true
+}
+
+// clearTyping 发送消息后清除房间内的输入状态，接收方收到消息即视为停止输入
+func (c *chatConn) clearTyping(roomID uuid.UUID) {
+	c.typingMu.Lock()
+	defer c.typingMu.Unlock()
+	delete(c.typingSent, roomID)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestChatConnOverflowDropKeepsConnection(t *testing.T) {
+	var metrics chatQueueMetrics
+	closed := 0
+	conn := newChatConn(uuid.New(), uuid.Nil, "", 2, true, &metrics, func() { closed++ })
+
+	for i := 0; i < 2; i++ {
+		if !conn.enqueue([]byte("frame")) {
+			t.Fatalf("第 %d 帧未入队", i+1)
+		}
+	}
+	// 队列已满：新帧被丢弃并计数，连接保持
+	if conn.enqueue([]byte("overflow")) {
+		t.Fatal("队列已满时帧不应入队")
+	}
+	if metrics.dropped.Load() != 1 || metrics.slowDisconnects.Load() != 0 || closed != 0 {
+		t.Fatalf("dropped=%d disconnects=%d closed=%d", metrics.dropped.Load(), metrics.slowDisconnects.Load(), closed)
+	}
+	if depth := conn.queueDepth(); depth != 2 {
+		t.Fatalf("queueDepth = %d", depth)
+	}
+	// 写协程消费后可继续入队
+	<-conn.send
+	if !conn.enqueue([]byte("next")) {
+		t.Fatal("消费后应可继续入队")
+	}
+}
+
+func TestChatConnOverflowDisconnect(t *testing.T) {
+	var metrics chatQueueMetrics
+	closed := 0
+	conn := newChatConn(uuid.New(), uuid.Nil, "", 1, false, &metrics, func() { closed++ })
+
+	conn.enqueue([]byte("frame"))
+	if conn.enqueue([]byte("overflow")) {
+		t.Fatal("队列已满时帧不应入队")
+	}
+	// 慢连接被断开，未确认的消息在重连后补发
+	select {
+	case <-conn.done:
+	default:
+		t.Fatal("队列溢出后连接应关闭")
+	}
+	if metrics.slowDisconnects.Load() != 1 || metrics.dropped.Load() != 0 || closed != 1 {
+		t.Fatalf("dropped=%d disconnects=%d closed=%d", metrics.dropped.Load(), metrics.slowDisconnects.Load(), closed)
+	}
+	// 关闭后不再入队，也不会重复关闭
+	if conn.enqueue([]byte("late")) {
+		t.Fatal("关闭后不应入队")
+	}
+	conn.enqueueClose(nil)
+	if closed != 1 {
+		t.Fatalf("closeFn 调用了 %d 次", closed)
+	}
+}
+
+func TestChatHubSlowConsumerDoesNotBlockOthers(t *testing.T) {
+	hub := newTestHub(t, service.NewLocalChatBroker())
+	hub.queueSize = 1
+	slowUser, fastUser := uuid.New(), uuid.New()
+	slow := newTestConn(hub, slowUser)
+	fast := newTestConn(hub, fastUser)
+
+	// slow 从不消费；投递在其队列写满后立即返回，fast 照常收到每一帧
+	for i := 0; i < 3; i++ {
+		hub.deliver(&service.ChatDelivery{UserIDs: []uuid.UUID{slowUser, fastUser}, Payload: json.RawMessage(`{}`)})
+		expectFrame(t, fast)
+	}
+	select {
+	case <-slow.done:
+	default:
+		t.Fatal("慢连接应被断开")
+	}
+	select {
+	case <-fast.done:
+		t.Fatal("正常连接不应被断开")
+	default:
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin/stats/chat", nil)
+	hub.GetQueueStats(c)
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Data["slow_consumer_disconnects"] != float64(1) || resp.Data["overflow_policy"] != chatOverflowDisconnect || resp.Data["connections"] != float64(2) {
+		t.Fatalf("队列统计 = %v", resp.Data)
+	}
+}
+
+func TestChatConnTypingThrottle(t *testing.T) {
+	conn := newChatConn(uuid.New(), uuid.Nil, "", 1, false, &chatQueueMetrics{}, nil)
+	room, other := uuid.New(), uuid.New()
+	now := time.Now()
+
+	steps := []struct {
+		name  string
+		room  uuid.UUID
+		state string
+		at    time.Duration
+		want  bool
+	}{
+		{"未输入时 stop 不转发", room, model.ChatTypingStop, 0, false},
+		{"首个 start", room, model.ChatTypingStart, 0, true},
+		{"节流间隔内的 start", room, model.ChatTypingStart, typingThrottle - time.Millisecond, false},
+		{"其他房间不受影响", other, model.ChatTypingStart, time.Second, true},
+		{"超过节流间隔的 start", room, model.ChatTypingStart, typingThrottle, true},
+		{"stop 转发一次", room, model.ChatTypingStop, typingThrottle + time.Second, true},
+		{"重复 stop", room, model.ChatTypingStop, typingThrottle + time.Second, false},
+		{"stop 后立即 start", room, model.ChatTypingStart, typingThrottle + time.Second, true},
+	}
+	for _, s := range steps {
+		if got := conn.allowTyping(s.room, s.state, now.Add(s.at)); got != s.want {
+			t.Fatalf("%s: allowTyping = %v", s.name, got)
+		}
+	}
+	// 发送消息后清除输入状态
+	conn.clearTyping(other)
+	if conn.allowTyping(other, model.ChatTypingStop, now.Add(2*time.Second)) {
+		t.Fatal("发送消息后 stop 不应再转发")
+	}
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/response"
+	"backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateGroup 创建群聊
+// @Summary 创建群聊
+// @Description 创建者成为群主；member_ids 中的用户必须均为创建者的好友。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param body body model.CreateChatGroupRequest true "群聊信息"
+// @Success 201 {object} response.ResponseData{data=model.ChatRoom}
+// @Router /chat/groups [post]
+func (h *ChatHandler) CreateGroup(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.CreateChatGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	memberIDs, ok := parseUUIDList(c, req.MemberIDs)
+	if !ok {
+		return
+	}
+	room, err := h.groupSvc.CreateGroup(c.Request.Context(), claims.UserID, req.Name, memberIDs)
+	if err != nil {
+		writeGroupError(c, err, "创建群聊失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusCreated, "群聊已创建", room)
+}
+
+// ListGroupMembers 群成员列表
+// @Summary 获取群成员列表
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "房间ID"
+// @Success 200 {object} response.ResponseData{data=[]model.ChatRoomMember}
+// @Router /chat/groups/{id}/members [get]
+func (h *ChatHandler) ListGroupMembers(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	list, err := h.groupSvc.ListMembers(c.Request.Context(), claims.UserID, roomID)
+	if err != nil {
+		writeGroupError(c, err, "获取群成员失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "ok", list)
+}
+
+// InviteGroupMembers 邀请成员
+// @Summary 邀请成员加入群聊
+// @Description 仅群主或管理员可邀请，被邀请人必须为邀请人的好友；已是成员的用户忽略，不计入人数上限。成功后向全部成员推送 member 事件。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "房间ID"
+// @Param body body model.InviteChatGroupRequest true "被邀请用户"
+// @Router /chat/groups/{id}/members [post]
+func (h *ChatHandler) InviteGroupMembers(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req model.InviteChatGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	userIDs, ok := parseUUIDList(c, req.UserIDs)
+	if !ok {
+		return
+	}
+	if err := h.groupSvc.Invite(c.Request.Context(), claims.UserID, roomID, userIDs); err != nil {
+		writeGroupError(c, err, "邀请成员失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "已邀请", gin.H{"room_id": roomID})
+}
+
+// KickGroupMember 移出成员
+// @Summary 移出群成员
+// @Description 群主可移出任何成员；管理员只能移出普通成员。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Param id path string true "房间ID"
+// @Param user_id path string true "用户ID"
+// @Router /chat/groups/{id}/members/{user_id} [delete]
+func (h *ChatHandler) KickGroupMember(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	userID, ok := parseUUID(c, c.Param("user_id"))
+	if !ok {
+		return
+	}
+	if err := h.groupSvc.Kick(c.Request.Context(), claims.UserID, roomID, userID); err != nil {
+		writeGroupError(c, err, "移出成员失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "已移出", gin.H{"room_id": roomID, "user_id": userID})
+}
+
+// UpdateGroupMemberRole 设置成员角色
+// @Summary 设置群成员角色
+// @Description 仅群主可设置，role 取值 admin/member。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Accept json
+// @Param id path string true "房间ID"
+// @Param user_id path string true "用户ID"
+// @Param body body model.UpdateChatMemberRoleRequest true "角色"
+// @Router /chat/groups/{id}/members/{user_id}/role [put]
+func (h *ChatHandler) UpdateGroupMemberRole(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	userID, ok := parseUUID(c, c.Param("user_id"))
+	if !ok {
+		return
+	}
+	var req model.UpdateChatMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	if err := h.groupSvc.UpdateMemberRole(c.Request.Context(), claims.UserID, roomID, userID, req.Role); err != nil {
+		writeGroupError(c, err, "设置成员角色失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "角色已更新", gin.H{"room_id": roomID, "user_id": userID, "role": req.Role})
+}
+
+// LeaveGroup 退出群聊
+// @Summary 退出群聊
+// @Description 群主需先转让群组；群主为唯一成员时退出即解散。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Param id path string true "房间ID"
+// @Router /chat/groups/{id}/leave [post]
+func (h *ChatHandler) LeaveGroup(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.groupSvc.Leave(c.Request.Context(), claims.UserID, roomID); err != nil {
+		writeGroupError(c, err, "退出群聊失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "已退出群聊", gin.H{"room_id": roomID})
+}
+
+// TransferGroup 转让群主
+// @Summary 转让群主
+// @Description 仅群主可转让，目标必须为群成员；原群主降为管理员。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Accept json
+// @Param id path string true "房间ID"
+// @Param body body model.TransferChatGroupRequest true "新群主"
+// @Router /chat/groups/{id}/transfer [post]
+func (h *ChatHandler) TransferGroup(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req model.TransferChatGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	newOwnerID, ok := parseUUID(c, req.UserID)
+	if !ok {
+		return
+	}
+	if err := h.groupSvc.TransferOwnership(c.Request.Context(), claims.UserID, roomID, newOwnerID); err != nil {
+		writeGroupError(c, err, "转让群主失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "群主已转让", gin.H{"room_id": roomID, "owner_id": newOwnerID})
+}
+
+// chatClaims 读取当前用户的 Token 声明，失败时已写入响应
+func chatClaims(c *gin.Context) (*service.JWTClaims, bool) {
+	payload, ok := c.Get(middleware.AuthorizationPayloadKey)
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return nil, false
+	}
+	claims, ok := payload.(*service.JWTClaims)
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "授权信息错误", nil)
+		return nil, false
+	}
+	return claims, true
+}
+
+// parseUUIDList 解析UUID列表参数
+func parseUUIDList(c *gin.Context, raw []string) ([]uuid.UUID, bool) {
+	ids := make([]uuid.UUID, 0, len(raw))
+	for _, s := range raw {
+		id, ok := parseUUID(c, s)
+		if !ok {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// writeGroupError 群聊业务错误映射
+func writeGroupError(c *gin.Context, err error, fallback string) {
+	msg := err.Error()
+	switch msg {
+	case "群聊不存在", "该用户不是群成员":
+		response.ErrorResponse(c, http.StatusNotFound, msg, nil)
+	case "你不是该群成员", "仅群主或管理员可邀请成员", "无权移出该成员", "仅群主可转让群组", "仅群主可设置管理员":
+		response.ErrorResponse(c, http.StatusForbidden, msg, nil)
+	case "群名称不能为空", "群名称长度不能超过50字符", "群成员数已达上限", "只能邀请好友加入群聊",
+		"请指定被邀请的用户", "不能移出自己，请使用退出群聊", "群主需先转让群组", "不能转让给自己",
+		"无效的成员角色", "不能修改群主的角色":
+		response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	default:
+		response.ErrorResponse(c, http.StatusInternalServerError, fallback, msg)
+	}
+}
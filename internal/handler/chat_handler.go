@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/model"
+	"backend/internal/response"
+	"backend/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ChatHandler 聊天相关 REST 接口（历史消息、会话列表、群聊管理等）
+
+type ChatHandler struct {
+	chatSvc  service.ChatService
+	groupSvc service.ChatGroupService
+}
+
+func NewChatHandler(chatSvc service.ChatService, groupSvc service.ChatGroupService) *ChatHandler {
+	return &ChatHandler{chatSvc: chatSvc, groupSvc: groupSvc}
+}
+
+// ListMessages 获取房间历史消息
+// @Summary 获取聊天房间历史消息
+// @Description 游标分页：before=<消息ID> 向前翻页，after=<消息ID> 获取更新的消息，二者最多指定其一；不指定时返回最新消息。结果按时间正序排列。仅房间参与者可调用。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "房间ID"
+// @Param before query string false "游标：获取该消息之前的消息"
+// @Param after query string false "游标：获取该消息之后的消息"
+// @Param limit query int false "每页数量（最大100）" default(20)
+// @Success 200 {object} response.ResponseData{data=model.ChatMessageListResponse}
+// @Failure 400 {object} response.ResponseData
+// @Failure 403 {object} response.ResponseData
+// @Failure 404 {object} response.ResponseData
+// @Router /chat/rooms/{id}/messages [get]
+func (h *ChatHandler) ListMessages(c *gin.Context) {
+	payload, ok := c.Get(middleware.AuthorizationPayloadKey)
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return
+	}
+	claims, ok := payload.(*service.JWTClaims)
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "授权信息错误", nil)
+		return
+	}
+
+	roomID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	before, ok := parseOptionalUUID(c, c.Query("before"))
+	if !ok {
+		return
+	}
+	after, ok := parseOptionalUUID(c, c.Query("after"))
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	res, err := h.chatSvc.ListMessages(c.Request.Context(), claims.UserID, roomID, before, after, limit)
+	if err != nil {
+		msg := err.Error()
+		switch msg {
+		case "聊天房间不存在":
+			response.ErrorResponse(c, http.StatusNotFound, msg, nil)
+		case "无权访问该聊天房间":
+			response.ErrorResponse(c, http.StatusForbidden, msg, nil)
+		case "before 与 after 不能同时指定", "游标消息不存在":
+			response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+		default:
+			response.ErrorResponse(c, http.StatusInternalServerError, "获取历史消息失败", msg)
+		}
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "ok", res)
+}
+
+// ListRooms 获取会话列表
+// @Summary 获取会话列表
+// @Description 列出当前用户参与的聊天房间，包含最后一条消息、未读数与对方资料，按最近活跃时间倒序。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param limit query int false "每页数量（最大100）" default(20)
+// @Success 200 {object} response.ResponseData{data=model.ChatRoomListResponse}
+// @Router /chat/rooms [get]
+func (h *ChatHandler) ListRooms(c *gin.Context) {
+	payload, ok := c.Get(middleware.AuthorizationPayloadKey)
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "未授权", nil)
+		return
+	}
+	claims, ok := payload.(*service.JWTClaims)
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "授权信息错误", nil)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	res, err := h.chatSvc.ListRooms(c.Request.Context(), claims.UserID, page, limit)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "获取会话列表失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "ok", res)
+}
+
+// SearchMessages 搜索聊天记录
+// @Summary 搜索聊天记录
+// @Description 在当前用户参与的有效房间内按关键词全文检索消息（不区分大小写，英文等按整词匹配，中日韩文字按连续字符匹配，无需分词；多个关键词以空格分隔，须全部命中），可按好友（一对一会话）、房间与时间范围筛选；已撤回及自己删除的消息不返回。结果按时间倒序，snippet 为已转义的命中片段，关键词以 <mark> 包裹。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param q query string true "关键词"
+// @Param peer_id query string false "好友用户ID"
+// @Param room_id query string false "房间ID"
+// @Param from query string false "开始时间（RFC3339）"
+// @Param to query string false "结束时间（RFC3339）"
+// @Param page query int false "页码" default(1)
+// @Param limit query int false "每页数量（最大50）" default(20)
+// @Success 200 {object} response.ResponseData{data=model.ChatSearchResponse}
+// @Failure 400 {object} response.ResponseData
+// @Router /chat/search [get]
+func (h *ChatHandler) SearchMessages(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.ChatSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "参数绑定失败", err.Error())
+		return
+	}
+	res, err := h.chatSvc.SearchMessages(c.Request.Context(), claims.UserID, &req)
+	if err != nil {
+		msg := err.Error()
+		switch msg {
+		case "搜索关键词不能为空", "开始时间不能晚于结束时间", "无效的用户ID", "无效的房间ID":
+			response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+		default:
+			response.ErrorResponse(c, http.StatusInternalServerError, "搜索聊天记录失败", msg)
+		}
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "ok", res)
+}
+
+// EditMessage 编辑消息
+// @Summary 编辑消息
+// @Description 只能编辑自己发送且未撤回的消息；编辑前的内容保留在编辑历史中，房间参与者会收到 edit 事件。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "消息ID"
+// @Param body body model.EditChatMessageRequest true "新内容"
+// @Success 200 {object} response.ResponseData{data=model.ChatMessage}
+// @Failure 403 {object} response.ResponseData "非本人消息、房间已关闭、存在拉黑关系或账户不可用"
+// @Router /chat/messages/{id} [patch]
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	messageID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req model.EditChatMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	msg, err := h.chatSvc.EditMessage(c.Request.Context(), claims.UserID, messageID, req.Content)
+	if err != nil {
+		writeMessageError(c, err, "编辑消息失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "消息已编辑", msg)
+}
+
+// RecallMessage 撤回消息
+// @Summary 撤回消息
+// @Description 只能撤回自己发送的消息，且须在撤回时限内（CHAT_RECALL_WINDOW_SECONDS）；撤回后消息保留为墓碑，房间参与者会收到 recall 事件。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "消息ID"
+// @Success 200 {object} response.ResponseData{data=model.ChatMessage}
+// @Failure 403 {object} response.ResponseData "非本人消息、房间已关闭、存在拉黑关系或账户不可用"
+// @Router /chat/messages/{id}/recall [post]
+func (h *ChatHandler) RecallMessage(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	messageID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	msg, err := h.chatSvc.RecallMessage(c.Request.Context(), claims.UserID, messageID)
+	if err != nil {
+		writeMessageError(c, err, "撤回消息失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "消息已撤回", msg)
+}
+
+// DeleteMessage 仅对自己删除消息
+// @Summary 删除消息（仅自己）
+// @Description 消息对当前用户隐藏，其他参与者不受影响；自己的其他设备会收到 delete 事件。
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "消息ID"
+// @Router /chat/messages/{id} [delete]
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	messageID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.chatSvc.HideMessage(c.Request.Context(), claims.UserID, messageID); err != nil {
+		writeMessageError(c, err, "删除消息失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "消息已删除", gin.H{"id": messageID})
+}
+
+// ListMessageEdits 消息编辑历史
+// @Summary 获取消息编辑历史
+// @Tags chat
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "消息ID"
+// @Success 200 {object} response.ResponseData{data=[]model.ChatMessageEdit}
+// @Router /chat/messages/{id}/edits [get]
+func (h *ChatHandler) ListMessageEdits(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	messageID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	list, err := h.chatSvc.ListMessageEdits(c.Request.Context(), claims.UserID, messageID)
+	if err != nil {
+		writeMessageError(c, err, "获取编辑历史失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "ok", list)
+}
+
+// writeMessageError 消息操作业务错误映射
+func writeMessageError(c *gin.Context, err error, fallback string) {
+	msg := err.Error()
+	switch msg {
+	case "消息不存在", "聊天房间不存在":
+		response.ErrorResponse(c, http.StatusNotFound, msg, nil)
+	case "无权访问该聊天房间", "只能操作自己发送的消息", "聊天房间已关闭",
+		"对方已将你拉黑", "请先取消对该用户的拉黑", "账户已被封禁", "账户未激活", "用户不存在":
+		response.ErrorResponse(c, http.StatusForbidden, msg, nil)
+	case "消息内容不能为空", "消息内容过长", "消息已撤回", "已超过可撤回时间":
+		response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	default:
+		response.ErrorResponse(c, http.StatusInternalServerError, fallback, msg)
+	}
+}
+
+// parseOptionalUUID 解析可选的UUID参数，空字符串返回 nil
+func parseOptionalUUID(c *gin.Context, s string) (*uuid.UUID, bool) {
+	if s == "" {
+		return nil, true
+	}
+	id, ok := parseUUID(c, s)
+	if !ok {
+		return nil, false
+	}
+	return &id, true
+}
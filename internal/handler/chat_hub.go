@@ -0,0 +1,734 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/response"
+	"backend/internal/service"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// pendingFlushLimit 建立连接时单次补发的未确认消息上限
+const pendingFlushLimit = 500
+
+// chatHeartbeatInterval 连接心跳间隔：续期在线状态并复查 token
+const chatHeartbeatInterval = 30 * time.Second
+
+const (
+	// typingTTL 转发的正在输入状态的有效期
+	typingTTL = 6 * time.Second
+	// typingThrottle 同一连接在同一房间内转发 start 的最小间隔，需小于 typingTTL 以便持续输入时状态不中断
+	typingThrottle = 3 * time.Second
+)
+
+// ChatHub 与传输方式无关的聊天投递核心，WebSocket 与 SSE/REST 共用
+// 负责鉴权、连接登记、帧的路由与授权、未确认消息补发，以及把 ChatBroker 的投递写入本实例上的连接
+// 本实例只持有自己的连接；消息经 ChatBroker 分发，多实例部署时由 Redis pub/sub 送达其他实例上的连接
+// 每条消息在转发前写入接收方的未确认队列，客户端 ack 后移除；连接建立时补发仍未确认的消息
+type ChatHub struct {
+	mu sync.RWMutex
+	// 本实例在线连接：userID -> set(conns)
+	conns       map[uuid.UUID]map[*chatConn]struct{}
+	jwtSvc      service.JwtService
+	friendRepo  repository.FriendshipRepository
+	roomRepo    repository.ChatRoomRepository
+	msgRepo     repository.ChatMessageRepository
+	pendingRepo repository.ChatPendingRepository
+	chatSvc     service.ChatService
+	presenceSvc service.PresenceService
+	policy      service.ChatPolicy
+	broker      service.ChatBroker
+	limiter     service.ChatRateLimiter
+	// 每个连接的发送队列容量及溢出策略
+	queueSize      int
+	dropOnOverflow bool
+	metrics        chatQueueMetrics
+}
+
+func NewChatHub(jwtSvc service.JwtService, friendRepo repository.FriendshipRepository, roomRepo repository.ChatRoomRepository, msgRepo repository.ChatMessageRepository, pendingRepo repository.ChatPendingRepository, chatSvc service.ChatService, presenceSvc service.PresenceService, policy service.ChatPolicy, broker service.ChatBroker, limiter service.ChatRateLimiter, queueSize int, overflowPolicy string) *ChatHub {
+	if queueSize <= 0 {
+		queueSize = defaultSendQueueSize
+	}
+	h := &ChatHub{
+		conns:       make(map[uuid.UUID]map[*chatConn]struct{}),
+		jwtSvc:      jwtSvc,
+		friendRepo:  friendRepo,
+		roomRepo:    roomRepo,
+		msgRepo:     msgRepo,
+		pendingRepo: pendingRepo,
+		chatSvc:     chatSvc,
+		presenceSvc: presenceSvc,
+		policy:      policy,
+		broker:      broker,
+		limiter:     limiter,
+		// 未知策略按 disconnect 处理：消息已进入未确认队列，重连后可补发
+		queueSize:      queueSize,
+		dropOnOverflow: overflowPolicy == chatOverflowDrop,
+	}
+	if err := broker.Subscribe(h.deliver); err != nil {
+		log.Printf("聊天分发器订阅失败: %v", err)
+	}
+	return h
+}
+
+// authenticate 校验请求携带的 access token 与账户状态，失败时直接写 HTTP 响应
+// 浏览器 WebSocket 与 EventSource 无法自定义 Authorization 头，支持 query 参数 token 作为兜底
+// 兼容非浏览器客户端：优先从 Authorization: Bearer <token> 读取
+func (h *ChatHub) authenticate(c *gin.Context) (string, *service.JWTClaims, bool) {
+	var token string
+	if auth := c.GetHeader("Authorization"); auth != "" {
+		lower := strings.ToLower(auth)
+		if strings.HasPrefix(lower, "bearer ") && len(auth) > 7 {
+			token = strings.TrimSpace(auth[7:])
+		}
+	}
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "未授权"})
+		return "", nil, false
+	}
+	claims, err := h.jwtSvc.ValidateAccessToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Token 无效"})
+		return "", nil, false
+	}
+	// 与 AuthMiddleware 一致：仅接受未撤销的 access token，且账户须处于可用状态
+	if err := h.policy.AuthorizeConnect(c.Request.Context(), token, claims); err != nil {
+		switch msg := err.Error(); msg {
+		case "必须使用access token", "token已被撤销":
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": msg})
+		case "账户已被封禁", "账户未激活", "用户不存在":
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": msg})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "连接鉴权失败"})
+		}
+		return "", nil, false
+	}
+	return token, claims, true
+}
+
+// open 创建并登记长连接，登记在线状态
+func (h *ChatHub) open(ctx context.Context, userID, sessionID uuid.UUID, token string, closeFn func()) *chatConn {
+	conn := newChatConn(userID, sessionID, token, h.queueSize, h.dropOnOverflow, &h.metrics, closeFn)
+	h.register(conn)
+	if err := h.presenceSvc.Connect(ctx, userID, conn.id); err != nil {
+		log.Printf("登记在线状态失败: %v", err)
+	}
+	return conn
+}
+
+// close 注销连接并移除在线状态；已排队的帧（如最后的错误帧）写完后再关闭
+func (h *ChatHub) close(conn *chatConn) {
+	h.unregister(conn)
+	// 请求上下文可能已取消，使用独立上下文确保离线状态写入
+	if err := h.presenceSvc.Disconnect(context.Background(), conn.userID, conn.id); err != nil {
+		log.Printf("移除在线状态失败: %v", err)
+	}
+	conn.enqueueClose(nil)
+}
+
+// heartbeat 续期在线状态并复查 token 与会话；已撤销时下发 token_revoked 并关闭连接，返回 false
+func (h *ChatHub) heartbeat(conn *chatConn) bool {
+	if err := h.presenceSvc.Heartbeat(context.Background(), conn.userID, conn.id); err != nil {
+		log.Printf("续期在线状态失败: %v", err)
+	}
+	// 退出登录、撤销会话等操作会使 token 失效，已建立的连接随之断开
+	if err := h.policy.CheckToken(context.Background(), conn.token, conn.sessionID); err != nil && err.Error() == "token已被撤销" {
+		h.closeWithError(conn, newFrameError(model.ChatErrTokenRevoked, err.Error()))
+		return false
+	}
+	return true
+}
+
+// process 处理长连接上收到的一帧并把回执或错误帧写回该连接
+// 返回 false 表示连接应结束（账户不可用或持续超限）
+func (h *ChatHub) process(ctx context.Context, conn *chatConn, data []byte) bool {
+	frame, ferr := decodeFrame(data)
+	var ack *model.ChatAckPayload
+	if ferr == nil {
+		ack, ferr = h.handleFrame(ctx, conn, frame)
+	}
+	if ferr == nil {
+		if ack != nil {
+			// 回执给发送连接，id 与客户端帧一致
+			h.writeFrame(conn, model.ChatFrameAck, frame.ID, ack)
+		}
+		return true
+	}
+	var id string
+	if frame != nil {
+		id = frame.ID
+	}
+	// 持续超限的连接直接断开
+	if h.rateLimitAbuse(ctx, conn, ferr) {
+		h.disconnectAbusive(ctx, conn)
+		return false
+	}
+	h.writeError(conn, id, ferr)
+	// 账户已不可用时不再保留连接
+	return ferr.code != model.ChatErrAccountDisabled
+}
+
+// rateLimitAbuse 记录限流违规，返回该连接所属用户是否已持续超限
+func (h *ChatHub) rateLimitAbuse(ctx context.Context, conn *chatConn, ferr *frameError) bool {
+	return ferr.code == model.ChatErrRateLimited && h.limiter.RecordViolation(ctx, conn.userID, conn.id, ferr.scope)
+}
+
+// disconnectAbusive 断开持续超限的连接
+// REST 请求的临时连接没有可断开的传输，改为断开该用户在所有实例上的连接
+func (h *ChatHub) disconnectAbusive(ctx context.Context, conn *chatConn) {
+	const msg = "发送过于频繁，连接已断开"
+	if conn.send != nil {
+		h.closeWithError(conn, newFrameError(model.ChatErrRateLimited, msg))
+		return
+	}
+	if err := h.policy.Disconnect(ctx, conn.userID, model.ChatErrRateLimited, msg); err != nil {
+		log.Printf("断开持续超限用户的聊天连接失败: %v", err)
+	}
+}
+
+// lookupConn 返回本实例上属于 userID 的长连接，不存在时返回 nil
+func (h *ChatHub) lookupConn(userID uuid.UUID, connID string) *chatConn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for conn := range h.conns[userID] {
+		if conn.id == connID {
+			return conn
+		}
+	}
+	return nil
+}
+
+// handleFrame 按帧类型分派处理，除 ack/read 外每一帧先消耗用户维度的令牌
+// 仅 message 帧返回回执，由传输层回给发送方
+func (h *ChatHub) handleFrame(ctx context.Context, conn *chatConn, frame *model.ChatFrame) (*model.ChatAckPayload, *frameError) {
+	if consumesUserToken(frame.Type) {
+		if ok, wait := h.limiter.AllowUser(ctx, conn.userID); !ok {
+			return nil, newRateLimitError("user", wait)
+		}
+	}
+	switch frame.Type {
+	case model.ChatFrameMessage:
+		var p model.ChatMessagePayload
+		if ferr := decodePayload(frame, &p); ferr != nil {
+			return nil, ferr
+		}
+		return h.handleMessage(ctx, conn, &p)
+	case model.ChatFrameAck:
+		var p model.ChatAckPayload
+		if ferr := decodePayload(frame, &p); ferr != nil {
+			return nil, ferr
+		}
+		return nil, h.handleAck(ctx, conn, &p)
+	case model.ChatFrameTyping:
+		var p model.ChatTypingPayload
+		if ferr := decodePayload(frame, &p); ferr != nil {
+			return nil, ferr
+		}
+		return nil, h.handleTyping(ctx, conn, &p)
+	case model.ChatFrameRead:
+		var p model.ChatReadPayload
+		if ferr := decodePayload(frame, &p); ferr != nil {
+			return nil, ferr
+		}
+		return nil, h.handleRead(ctx, conn, &p)
+	case model.ChatFramePresence:
+		var p model.ChatPresencePayload
+		if ferr := decodePayload(frame, &p); ferr != nil {
+			return nil, ferr
+		}
+		return nil, h.handlePresence(ctx, conn, &p)
+	default:
+		// error 仅由服务端下发
+		return nil, newFrameError(model.ChatErrUnsupportedType, "不支持的帧类型")
+	}
+}
+
+// consumesUserToken ack 与 read 是对已收消息的确认，频率随收到的消息量增长，
+// 计入用户令牌会让活跃房间中的正常客户端因回执被限流甚至断开
+func consumesUserToken(frameType model.ChatFrameType) bool {
+	return frameType != model.ChatFrameAck && frameType != model.ChatFrameRead
+}
+
+// handleMessage 持久化消息并转发给房间其他参与者及自己的其他连接，返回给发送方的回执
+func (h *ChatHub) handleMessage(ctx context.Context, conn *chatConn, p *model.ChatMessagePayload) (*model.ChatAckPayload, *frameError) {
+	fileIDs, ferr := validateMessagePayload(p)
+	if ferr != nil {
+		return nil, ferr
+	}
+	userID := conn.userID
+
+	var room *model.ChatRoom
+	var memberIDs []uuid.UUID
+	if p.RoomID != "" {
+		// 依据 room_id 发送（一对一或群聊），校验房间有效且自己为参与者
+		rid, ferr := parseUUIDField(p.RoomID, "room_id")
+		if ferr != nil {
+			return nil, ferr
+		}
+		room, memberIDs, ferr = h.resolveRoom(ctx, userID, rid)
+		if ferr != nil {
+			return nil, ferr
+		}
+	} else {
+		// 依据 to_user_id 发送：先校验好友，再获取/创建一对一房间
+		toID, ferr := parseUUIDField(p.ToUserID, "to_user_id")
+		if ferr != nil {
+			return nil, ferr
+		}
+		ok, err := h.friendRepo.Exists(userID, toID)
+		if err != nil {
+			return nil, newFrameError(model.ChatErrInternal, "校验好友关系失败")
+		}
+		if !ok {
+			return nil, newFrameError(model.ChatErrNotFriends, "对方不是你的好友")
+		}
+		room, err = h.roomRepo.GetOrCreateByUsers(userID, toID)
+		if err != nil {
+			return nil, newFrameError(model.ChatErrInternal, "获取聊天房间失败")
+		}
+		if room.Status != "active" {
+			return nil, newFrameError(model.ChatErrRoomNotFound, "聊天房间已关闭")
+		}
+		memberIDs = []uuid.UUID{room.UserAID, room.UserBID}
+	}
+	if err := h.policy.AuthorizeSend(ctx, userID, room); err != nil {
+		return nil, policyFrameError(err)
+	}
+	// 群聊中拉黑了发送方的成员不接收该消息
+	memberIDs, err := h.policy.FilterRecipients(ctx, userID, room, memberIDs)
+	if err != nil {
+		return nil, policyFrameError(err)
+	}
+	if ok, wait := h.limiter.AllowRoom(ctx, userID, room.ID); !ok {
+		return nil, newRateLimitError("room", wait)
+	}
+	var attachments []model.ChatAttachment
+	if len(fileIDs) > 0 {
+		var err error
+		attachments, err = h.chatSvc.ResolveAttachments(ctx, userID, fileIDs)
+		if err != nil {
+			return nil, chatServiceFrameError(err, "校验附件失败")
+		}
+	}
+
+	// 先持久化再转发，保证离线端/其他设备可通过历史接口补齐
+	record := &model.ChatMessage{
+		RoomID:      room.ID,
+		SenderID:    userID,
+		Content:     p.Content,
+		Attachments: attachments,
+	}
+	if err := h.msgRepo.Create(record); err != nil {
+		return nil, newFrameError(model.ChatErrInternal, "消息保存失败")
+	}
+	conn.clearTyping(room.ID)
+	// 写入其他参与者的未确认队列，离线或投递失败时在下次连接补发
+	for _, id := range memberIDs {
+		if id == userID {
+			continue
+		}
+		if err := h.pendingRepo.Add(ctx, id, record.ID, record.CreatedAt); err != nil {
+			log.Printf("写入未确认消息队列失败: %v", err)
+		}
+	}
+
+	event := model.ChatMessageEvent{
+		MessageID:   record.ID.String(),
+		Seq:         record.Seq,
+		RoomID:      room.ID.String(),
+		FromUserID:  userID.String(),
+		Content:     record.Content,
+		Attachments: record.Attachments,
+		Timestamp:   record.CreatedAt,
+	}
+	if !room.IsGroup() {
+		event.ToUserID = peerOf(room, userID).String()
+	}
+	payload, err := encodeFrame(model.ChatFrameMessage, "", event)
+	if err != nil {
+		return nil, newFrameError(model.ChatErrInternal, "消息编码失败")
+	}
+	// 向房间全部参与者转发（可能位于其他实例），跳过发送连接自身
+	if err := h.broker.Publish(ctx, &service.ChatDelivery{
+		UserIDs:       memberIDs,
+		ExcludeConnID: conn.id,
+		Payload:       payload,
+	}); err != nil {
+		log.Printf("发布聊天消息失败: %v", err)
+	}
+
+	// 回执由传输层回给发送方
+	return &model.ChatAckPayload{
+		MessageIDs: []string{record.ID.String()},
+		Seq:        record.Seq,
+	}, nil
+}
+
+// handleAck 处理客户端对消息的确认
+func (h *ChatHub) handleAck(ctx context.Context, conn *chatConn, p *model.ChatAckPayload) *frameError {
+	ids, ferr := parseAckIDs(p)
+	if ferr != nil {
+		return ferr
+	}
+	if err := h.pendingRepo.Ack(ctx, conn.userID, ids); err != nil {
+		log.Printf("确认消息失败: %v", err)
+		return newFrameError(model.ChatErrInternal, "确认消息失败")
+	}
+	return nil
+}
+
+// handleTyping 把正在输入状态转发给房间其他参与者，不持久化
+// 节流范围内的重复帧直接丢弃，不返回错误
+func (h *ChatHub) handleTyping(ctx context.Context, conn *chatConn, p *model.ChatTypingPayload) *frameError {
+	rid, ferr := parseUUIDField(p.RoomID, "room_id")
+	if ferr != nil {
+		return ferr
+	}
+	state := p.State
+	if state == "" {
+		state = model.ChatTypingStart
+	}
+	if state != model.ChatTypingStart && state != model.ChatTypingStop {
+		return newFrameError(model.ChatErrInvalidPayload, "state 仅支持 start 或 stop")
+	}
+	now := time.Now()
+	if !conn.allowTyping(rid, state, now) {
+		return nil
+	}
+	room, memberIDs, ferr := h.resolveRoom(ctx, conn.userID, rid)
+	if ferr != nil {
+		conn.clearTyping(rid)
+		return ferr
+	}
+	if err := h.policy.AuthorizeSend(ctx, conn.userID, room); err != nil {
+		conn.clearTyping(rid)
+		return policyFrameError(err)
+	}
+	recipients, err := h.policy.FilterRecipients(ctx, conn.userID, room, othersOf(memberIDs, conn.userID))
+	if err != nil {
+		return policyFrameError(err)
+	}
+	event := model.ChatTypingPayload{
+		RoomID: rid.String(),
+		UserID: conn.userID.String(),
+		State:  state,
+	}
+	if state == model.ChatTypingStart {
+		expiresAt := now.Add(typingTTL)
+		event.ExpiresAt = &expiresAt
+	}
+	return h.publishEvent(ctx, model.ChatFrameTyping, recipients, "", event)
+}
+
+// handleRead 推进已读位置，并通知房间其他参与者及自己的其他连接
+func (h *ChatHub) handleRead(ctx context.Context, conn *chatConn, p *model.ChatReadPayload) *frameError {
+	rid, ferr := parseUUIDField(p.RoomID, "room_id")
+	if ferr != nil {
+		return ferr
+	}
+	mid, ferr := parseUUIDField(p.MessageID, "message_id")
+	if ferr != nil {
+		return ferr
+	}
+	memberIDs, changed, err := h.chatSvc.MarkRead(ctx, conn.userID, rid, mid)
+	if err != nil {
+		return chatServiceFrameError(err, "更新已读位置失败")
+	}
+	// 重复或更早的回执不再通知
+	if !changed {
+		return nil
+	}
+	return h.publishEvent(ctx, model.ChatFrameRead, memberIDs, conn.id, model.ChatReadPayload{
+		RoomID:    rid.String(),
+		MessageID: mid.String(),
+		UserID:    conn.userID.String(),
+	})
+}
+
+// handlePresence 客户端切换 online/away，通知好友
+func (h *ChatHub) handlePresence(ctx context.Context, conn *chatConn, p *model.ChatPresencePayload) *frameError {
+	status := model.PresenceStatus(p.Status)
+	if status != model.PresenceOnline && status != model.PresenceAway {
+		return newFrameError(model.ChatErrInvalidPayload, "status 仅支持 online 或 away")
+	}
+	if err := h.presenceSvc.SetStatus(ctx, conn.userID, status); err != nil {
+		log.Printf("更新在线状态失败: %v", err)
+		return newFrameError(model.ChatErrInternal, "更新在线状态失败")
+	}
+	return nil
+}
+
+// resolveRoom 校验房间有效且用户为参与者，返回房间与全部参与者ID
+func (h *ChatHub) resolveRoom(ctx context.Context, userID, roomID uuid.UUID) (*model.ChatRoom, []uuid.UUID, *frameError) {
+	room, memberIDs, err := h.chatSvc.ResolveRoom(ctx, userID, roomID)
+	if err != nil {
+		return nil, nil, chatServiceFrameError(err, "获取聊天房间失败")
+	}
+	if room.Status != "active" {
+		return nil, nil, newFrameError(model.ChatErrRoomNotFound, "聊天房间已关闭")
+	}
+	return room, memberIDs, nil
+}
+
+// peerOf 返回一对一房间中另一方的用户ID
+func peerOf(room *model.ChatRoom, userID uuid.UUID) uuid.UUID {
+	if room.UserAID == userID {
+		return room.UserBID
+	}
+	return room.UserAID
+}
+
+// othersOf 返回除 userID 外的参与者
+func othersOf(memberIDs []uuid.UUID, userID uuid.UUID) []uuid.UUID {
+	others := make([]uuid.UUID, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		if id != userID {
+			others = append(others, id)
+		}
+	}
+	return others
+}
+
+// publishEvent 编码事件帧并经分发器投递
+func (h *ChatHub) publishEvent(ctx context.Context, typ model.ChatFrameType, userIDs []uuid.UUID, excludeConnID string, payload interface{}) *frameError {
+	data, err := encodeFrame(typ, "", payload)
+	if err != nil {
+		return newFrameError(model.ChatErrInternal, "事件编码失败")
+	}
+	if err := h.broker.Publish(ctx, &service.ChatDelivery{
+		UserIDs:       userIDs,
+		ExcludeConnID: excludeConnID,
+		Payload:       data,
+	}); err != nil {
+		log.Printf("发布聊天事件失败: %v", err)
+	}
+	return nil
+}
+
+// writeFrame 向单个连接的发送队列放入一帧
+func (h *ChatHub) writeFrame(conn *chatConn, typ model.ChatFrameType, id string, payload interface{}) {
+	data, err := encodeFrame(typ, id, payload)
+	if err != nil {
+		return
+	}
+	conn.enqueue(data)
+}
+
+// writeError 向连接下发错误帧
+func (h *ChatHub) writeError(conn *chatConn, id string, ferr *frameError) {
+	h.writeFrame(conn, model.ChatFrameError, id, model.ChatErrorPayload{
+		Code:         ferr.code,
+		Message:      ferr.message,
+		RetryAfterMs: ferr.retryAfter.Milliseconds(),
+	})
+}
+
+// closeWithError 下发错误帧后关闭连接
+func (h *ChatHub) closeWithError(conn *chatConn, ferr *frameError) {
+	data, err := encodeFrame(model.ChatFrameError, "", model.ChatErrorPayload{
+		Code:    ferr.code,
+		Message: ferr.message,
+	})
+	if err != nil {
+		data = nil
+	}
+	conn.enqueueClose(data)
+}
+
+// flushPending 向新建立的连接补发该用户仍未确认的消息
+// 补发前复查房间仍有效且用户仍是参与者：已退出或被移出的群、已关闭的房间以及已不存在的消息不再补发，并从队列移除
+func (h *ChatHub) flushPending(ctx context.Context, conn *chatConn) {
+	ids, err := h.pendingRepo.List(ctx, conn.userID, pendingFlushLimit)
+	if err != nil {
+		log.Printf("读取未确认消息失败: %v", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+	msgs, err := h.msgRepo.GetByIDs(ids)
+	if err != nil {
+		log.Printf("加载未确认消息失败: %v", err)
+		return
+	}
+	found := make(map[uuid.UUID]bool, len(msgs))
+	for _, m := range msgs {
+		found[m.ID] = true
+	}
+	var stale []uuid.UUID
+	for _, id := range ids {
+		if !found[id] {
+			stale = append(stale, id)
+		}
+	}
+
+	rooms := make(map[uuid.UUID]pendingRoom)
+	var events [][]byte
+	for _, m := range msgs {
+		pr, ok := rooms[m.RoomID]
+		if !ok {
+			pr = h.resolvePendingRoom(ctx, conn.userID, m.RoomID)
+			rooms[m.RoomID] = pr
+		}
+		if pr.stale {
+			stale = append(stale, m.ID)
+			continue
+		}
+		// 查询失败时保留在队列中，下次连接再补发
+		if pr.room == nil {
+			continue
+		}
+		event := model.ChatMessageEvent{
+			MessageID:   m.ID.String(),
+			Seq:         m.Seq,
+			RoomID:      m.RoomID.String(),
+			FromUserID:  m.SenderID.String(),
+			Content:     m.Content,
+			Attachments: m.Attachments,
+			EditedAt:    m.EditedAt,
+			RecalledAt:  m.RecalledAt,
+			Timestamp:   m.CreatedAt,
+		}
+		if !pr.room.IsGroup() {
+			event.ToUserID = conn.userID.String()
+		}
+		payload, err := encodeFrame(model.ChatFrameMessage, "", event)
+		if err != nil {
+			continue
+		}
+		events = append(events, payload)
+	}
+
+	if len(stale) > 0 {
+		if err := h.pendingRepo.Ack(ctx, conn.userID, stale); err != nil {
+			log.Printf("移除失效的未确认消息失败: %v", err)
+		}
+	}
+	for _, payload := range events {
+		// 补发量可能超过队列容量，阻塞等待写协程消费
+		if !conn.enqueueWait(ctx, payload) {
+			return
+		}
+	}
+}
+
+// pendingRoom 补发时对消息所属房间的复查结果
+// stale 为 true 表示房间已不存在、已关闭或用户已不是参与者；room 为 nil 且 stale 为 false 表示查询失败
+type pendingRoom struct {
+	room  *model.ChatRoom
+	stale bool
+}
+
+func (h *ChatHub) resolvePendingRoom(ctx context.Context, userID, roomID uuid.UUID) pendingRoom {
+	room, _, err := h.chatSvc.ResolveRoom(ctx, userID, roomID)
+	if err != nil {
+		switch err.Error() {
+		case "聊天房间不存在", "无权访问该聊天房间":
+			return pendingRoom{stale: true}
+		}
+		log.Printf("补发时校验聊天房间失败: %v", err)
+		return pendingRoom{}
+	}
+	if room.Status != "active" {
+		return pendingRoom{stale: true}
+	}
+	return pendingRoom{room: room}
+}
+
+// register 登记本实例上的连接
+func (h *ChatHub) register(conn *chatConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	set := h.conns[conn.userID]
+	if set == nil {
+		set = make(map[*chatConn]struct{})
+		h.conns[conn.userID] = set
+	}
+	set[conn] = struct{}{}
+}
+
+// unregister 移除本实例上的连接
+func (h *ChatHub) unregister(conn *chatConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.conns[conn.userID]; ok {
+		delete(s, conn)
+		if len(s) == 0 {
+			delete(h.conns, conn.userID)
+		}
+	}
+}
+
+// deliver ChatBroker 回调：把投递写到本实例上对应用户的连接
+func (h *ChatHub) deliver(d *service.ChatDelivery) {
+	var targets []*chatConn
+	h.mu.RLock()
+	for _, uid := range d.UserIDs {
+		for conn := range h.conns[uid] {
+			if conn.id == d.ExcludeConnID {
+				continue
+			}
+			targets = append(targets, conn)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range targets {
+		if d.Close {
+			// 关闭后读循环返回，由 Chat 完成注销与离线处理
+			conn.enqueueClose(d.Payload)
+			continue
+		}
+		conn.enqueue(d.Payload)
+	}
+}
+
+// GetQueueStats 管理员获取聊天连接发送队列统计
+// @Summary 管理员获取聊天连接发送队列统计
+// @Description 本实例的在线连接数、当前排队帧数、单连接最大队列深度，以及进程启动以来因队列已满丢弃的帧数与断开的连接数
+// @Tags admin-stats
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=map[string]any}
+// @Router /admin/stats/chat [get]
+func (h *ChatHub) GetQueueStats(c *gin.Context) {
+	var conns, queued, maxDepth int
+	h.mu.RLock()
+	for _, set := range h.conns {
+		for conn := range set {
+			depth := conn.queueDepth()
+			conns++
+			queued += depth
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	policy := chatOverflowDisconnect
+	if h.dropOnOverflow {
+		policy = chatOverflowDrop
+	}
+	data := map[string]any{
+		"connections":               conns,
+		"queued_frames":             queued,
+		"max_queue_depth":           maxDepth,
+		"queue_capacity":            h.queueSize,
+		"overflow_policy":           policy,
+		"dropped_frames":            h.metrics.dropped.Load(),
+		"slow_consumer_disconnects": h.metrics.slowDisconnects.Load(),
+		"window":                    "since_start",
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", data)
+}
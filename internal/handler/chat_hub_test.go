@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// newTestHub 只包含投递所需字段的 ChatHub，订阅给定的分发器
+func newTestHub(t *testing.T, broker service.ChatBroker) *ChatHub {
+	t.Helper()
+	h := &ChatHub{
+		conns:     make(map[uuid.UUID]map[*chatConn]struct{}),
+		broker:    broker,
+		queueSize: 8,
+	}
+	if err := broker.Subscribe(h.deliver); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	t.Cleanup(func() { _ = broker.Close() })
+	return h
+}
+
+// newTestConn 登记一个没有底层传输的连接
+func newTestConn(h *ChatHub, userID uuid.UUID) *chatConn {
+	conn := newChatConn(userID, uuid.New(), "", h.queueSize, false, &h.metrics, nil)
+	h.register(conn)
+	return conn
+}
+
+// redisBrokers 两个连接同一 miniredis 的分发器，模拟两个实例
+func redisBrokers(t *testing.T) (service.ChatBroker, service.ChatBroker) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	newBroker := func() service.ChatBroker {
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = rdb.Close() })
+		return service.NewRedisChatBroker(rdb, "chat:test")
+	}
+	return newBroker(), newBroker()
+}
+
+func expectFrame(t *testing.T, conn *chatConn) chatOutbound {
+	t.Helper()
+	select {
+	case out := <-conn.send:
+		return out
+	case <-time.After(2 * time.Second):
+		t.Fatal("连接未收到帧")
+		return chatOutbound{}
+	}
+}
+
+func expectNoFrame(t *testing.T, conn *chatConn) {
+	t.Helper()
+	select {
+	case out := <-conn.send:
+		t.Fatalf("连接收到了不应收到的帧: %s", out.data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestChatHubCrossInstanceDeliveryExcludesSender(t *testing.T) {
+	brokerA, brokerB := redisBrokers(t)
+	hubA := newTestHub(t, brokerA)
+	hubB := newTestHub(t, brokerB)
+
+	alice, bob := uuid.New(), uuid.New()
+	aliceSender := newTestConn(hubA, alice)
+	aliceOther := newTestConn(hubB, alice)
+	bobConn := newTestConn(hubB, bob)
+	stranger := newTestConn(hubA, uuid.New())
+
+	payload := json.RawMessage(`{"v":1,"type":"message","payload":{}}`)
+	if err := brokerA.Publish(context.Background(), &service.ChatDelivery{
+		UserIDs:       []uuid.UUID{alice, bob},
+		ExcludeConnID: aliceSender.id,
+		Payload:       payload,
+	}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	for name, conn := range map[string]*chatConn{"接收方": bobConn, "发送方的其他设备": aliceOther} {
+		out := expectFrame(t, conn)
+		if string(out.data) != string(payload) || out.close {
+			t.Errorf("%s收到 %s close=%v", name, out.data, out.close)
+		}
+	}
+	expectNoFrame(t, aliceSender)
+	expectNoFrame(t, stranger)
+}
+
+func TestChatHubCloseDeliveryAcrossInstances(t *testing.T) {
+	brokerA, brokerB := redisBrokers(t)
+	newTestHub(t, brokerA)
+	hubB := newTestHub(t, brokerB)
+
+	banned := uuid.New()
+	conn := newTestConn(hubB, banned)
+	if err := brokerA.Publish(context.Background(), &service.ChatDelivery{
+		UserIDs: []uuid.UUID{banned},
+		Payload: json.RawMessage(`{"v":1,"type":"error"}`),
+		Close:   true,
+	}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if out := expectFrame(t, conn); !out.close {
+		t.Fatal("强制下线投递应在写出后关闭连接")
+	}
+}
+
+func TestChatHubUnregisteredConnReceivesNothing(t *testing.T) {
+	hub := newTestHub(t, service.NewLocalChatBroker())
+	userID := uuid.New()
+	conn := newTestConn(hub, userID)
+	hub.unregister(conn)
+
+	hub.deliver(&service.ChatDelivery{UserIDs: []uuid.UUID{userID}, Payload: json.RawMessage(`{}`)})
+	expectNoFrame(t, conn)
+}
+
+// fakeMessageRepo 只实现补发用到的 GetByIDs
+type fakeMessageRepo struct {
+	repository.ChatMessageRepository
+	msgs map[uuid.UUID]model.ChatMessage
+}
+
+func (r *fakeMessageRepo) GetByIDs(ids []uuid.UUID) ([]model.ChatMessage, error) {
+	var out []model.ChatMessage
+	for _, id := range ids {
+		if m, ok := r.msgs[id]; ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// fakeRoomService 只实现 ResolveRoom：rooms 中的房间对 members 中的用户可见
+type fakeRoomService struct {
+	service.ChatService
+	rooms   map[uuid.UUID]*model.ChatRoom
+	members map[uuid.UUID][]uuid.UUID
+	failing map[uuid.UUID]bool
+}
+
+func (s *fakeRoomService) ResolveRoom(ctx context.Context, userID, roomID uuid.UUID) (*model.ChatRoom, []uuid.UUID, error) {
+	if s.failing[roomID] {
+		return nil, nil, errors.New("connection refused")
+	}
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return nil, nil, errors.New("聊天房间不存在")
+	}
+	for _, id := range s.members[roomID] {
+		if id == userID {
+			return room, s.members[roomID], nil
+		}
+	}
+	return nil, nil, errors.New("无权访问该聊天房间")
+}
+
+// MarkRead 已读位置未变化，不触发通知
+func (s *fakeRoomService) MarkRead(ctx context.Context, userID, roomID, messageID uuid.UUID) ([]uuid.UUID, bool, error) {
+	return nil, false, nil
+}
+
+func TestChatHubFlushPendingSkipsStaleRooms(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	pending := repository.NewChatPendingRepository(rdb)
+
+	user, peer := uuid.New(), uuid.New()
+	active := &model.ChatRoom{ID: uuid.New(), UserAID: user, UserBID: peer, Status: "active"}
+	closed := &model.ChatRoom{ID: uuid.New(), UserAID: user, UserBID: peer, Status: "inactive"}
+	leftGroup := &model.ChatRoom{ID: uuid.New(), Status: "active", Type: model.ChatRoomTypeGroup}
+	flaky := &model.ChatRoom{ID: uuid.New(), UserAID: user, UserBID: peer, Status: "active"}
+	svc := &fakeRoomService{
+		rooms: map[uuid.UUID]*model.ChatRoom{active.ID: active, closed.ID: closed, leftGroup.ID: leftGroup, flaky.ID: flaky},
+		members: map[uuid.UUID][]uuid.UUID{
+			active.ID:    {user, peer},
+			closed.ID:    {user, peer},
+			leftGroup.ID: {peer},
+			flaky.ID:     {user, peer},
+		},
+		failing: map[uuid.UUID]bool{flaky.ID: true},
+	}
+
+	base := time.Now().Add(-time.Hour)
+	msgs := map[uuid.UUID]model.ChatMessage{}
+	add := func(room *model.ChatRoom, persisted bool) uuid.UUID {
+		id := uuid.New()
+		createdAt := base.Add(time.Duration(len(msgs)+1) * time.Second)
+		if persisted {
+			msgs[id] = model.ChatMessage{ID: id, RoomID: room.ID, SenderID: peer, Content: "hi", CreatedAt: createdAt}
+		}
+		if err := pending.Add(context.Background(), user, id, createdAt); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		return id
+	}
+	deliverable := add(active, true)
+	inClosed := add(closed, true)
+	inLeftGroup := add(leftGroup, true)
+	deleted := add(active, false)
+	retry := add(flaky, true)
+
+	hub := &ChatHub{
+		conns:       make(map[uuid.UUID]map[*chatConn]struct{}),
+		pendingRepo: pending,
+		msgRepo:     &fakeMessageRepo{msgs: msgs},
+		chatSvc:     svc,
+		queueSize:   8,
+	}
+	conn := newChatConn(user, uuid.New(), "", hub.queueSize, false, &hub.metrics, nil)
+	hub.flushPending(context.Background(), conn)
+
+	out := expectFrame(t, conn)
+	var frame model.ChatFrame
+	var event model.ChatMessageEvent
+	if err := json.Unmarshal(out.data, &frame); err != nil {
+		t.Fatalf("Unmarshal frame: %v", err)
+	}
+	if err := json.Unmarshal(frame.Payload, &event); err != nil {
+		t.Fatalf("Unmarshal event: %v", err)
+	}
+	if event.MessageID != deliverable.String() || event.ToUserID != user.String() {
+		t.Fatalf("补发了 %+v", event)
+	}
+	expectNoFrame(t, conn)
+
+	left, err := pending.List(context.Background(), user, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	// 已投递的消息等待客户端 ack；失效的消息被移除；查询失败的房间保留待下次补发
+	want := map[uuid.UUID]bool{deliverable: true, retry: true}
+	if len(left) != len(want) {
+		t.Fatalf("队列剩余 %v，期望 %v（已关闭 %s、已退群 %s、已删除 %s 应被移除）", left, want, inClosed, inLeftGroup, deleted)
+	}
+	for _, id := range left {
+		if !want[id] {
+			t.Fatalf("队列中残留失效消息 %s", id)
+		}
+	}
+}
+
+func TestChatHubAckAndReadSkipUserBucket(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	limiter := service.NewChatRateLimiter(repository.NewChatRateLimitRepository(rdb), nil,
+		&config.ChatConfig{UserRatePerSecond: 0.01, UserRateBurst: 1})
+	hub := &ChatHub{
+		conns:       make(map[uuid.UUID]map[*chatConn]struct{}),
+		pendingRepo: repository.NewChatPendingRepository(rdb),
+		chatSvc:     &fakeRoomService{},
+		limiter:     limiter,
+		queueSize:   8,
+	}
+	conn := newChatConn(uuid.New(), uuid.New(), "", hub.queueSize, false, &hub.metrics, nil)
+
+	frames := []*model.ChatFrame{
+		{Type: model.ChatFrameAck, Payload: json.RawMessage(`{"message_ids":["` + uuid.NewString() + `"]}`)},
+		{Type: model.ChatFrameRead, Payload: json.RawMessage(`{"room_id":"` + uuid.NewString() + `","message_id":"` + uuid.NewString() + `"}`)},
+	}
+	// 回执数量随收到的消息增长，远超用户桶容量也不应被限流
+	for i := 0; i < 10; i++ {
+		for _, frame := range frames {
+			if _, ferr := hub.handleFrame(ctx, conn, frame); ferr != nil {
+				t.Fatalf("%s 帧返回错误 %+v", frame.Type, ferr)
+			}
+		}
+	}
+	if ok, _ := limiter.AllowUser(ctx, conn.userID); !ok {
+		t.Fatal("ack/read 帧消耗了用户令牌")
+	}
+	// 其他帧仍受用户桶限制
+	_, ferr := hub.handleFrame(ctx, conn, &model.ChatFrame{Type: model.ChatFrameTyping, Payload: json.RawMessage(`{}`)})
+	if ferr == nil || ferr.code != model.ChatErrRateLimited || ferr.scope != "user" {
+		t.Fatalf("令牌耗尽后 typing 帧返回 %+v", ferr)
+	}
+}
+
+// fakeBlockRepo 只实现拉黑操作
+type fakeBlockRepo struct {
+	repository.BlockListRepository
+}
+
+func (fakeBlockRepo) Block(userID, blockedID uuid.UUID) error { return nil }
+
+func TestBlockDisconnectsBlockedUser(t *testing.T) {
+	broker := service.NewLocalChatBroker()
+	hub := newTestHub(t, broker)
+	policy := service.NewChatPolicy(nil, nil, nil, nil, broker)
+	friendSvc := service.NewFriendService(nil, nil, fakeBlockRepo{}, nil, nil, nil, nil, nil, 100, 500, nil, policy)
+
+	blocker, blocked := uuid.New(), uuid.New()
+	blockerConn := newTestConn(hub, blocker)
+	blockedConns := []*chatConn{newTestConn(hub, blocked), newTestConn(hub, blocked)}
+
+	if err := friendSvc.Block(context.Background(), blocker, blocked); err != nil {
+		t.Fatalf("Block: %v", err)
+	}
+	// 被拉黑用户的每个在线连接都收到原因码后被关闭
+	for _, conn := range blockedConns {
+		out := expectFrame(t, conn)
+		var frame model.ChatFrame
+		var payload model.ChatErrorPayload
+		if err := json.Unmarshal(out.data, &frame); err != nil {
+			t.Fatalf("Unmarshal frame: %v", err)
+		}
+		if err := json.Unmarshal(frame.Payload, &payload); err != nil {
+			t.Fatalf("Unmarshal payload: %v", err)
+		}
+		if !out.close || frame.Type != model.ChatFrameError || payload.Code != model.ChatErrBlocked {
+			t.Fatalf("被拉黑用户收到 %s close=%v", out.data, out.close)
+		}
+	}
+	expectNoFrame(t, blockerConn)
+}
+
+func TestChatHubTypingRelayedWithExpiry(t *testing.T) {
+	ctx := context.Background()
+	broker := service.NewLocalChatBroker()
+	hub := newTestHub(t, broker)
+	alice, bob := uuid.New(), uuid.New()
+	room := &model.ChatRoom{ID: uuid.New(), UserAID: alice, UserBID: bob, Status: "active"}
+	users := &fakeUserRepo{users: map[uuid.UUID]*model.User{alice: {ID: alice, Status: "active"}, bob: {ID: bob, Status: "active"}}}
+	hub.chatSvc = &fakeRoomService{
+		rooms:   map[uuid.UUID]*model.ChatRoom{room.ID: room},
+		members: map[uuid.UUID][]uuid.UUID{room.ID: {alice, bob}},
+	}
+	hub.policy = service.NewChatPolicy(users, noBlockRepo{}, nil, nil, broker)
+	msgs := &fakeMessageRepo{msgs: map[uuid.UUID]model.ChatMessage{}}
+	hub.msgRepo = msgs
+	sender := newTestConn(hub, alice)
+	senderOther := newTestConn(hub, alice)
+	peer := newTestConn(hub, bob)
+
+	typing := func(state string) *frameError {
+		return hub.handleTyping(ctx, sender, &model.ChatTypingPayload{RoomID: room.ID.String(), State: state})
+	}
+	before := time.Now()
+	if ferr := typing(""); ferr != nil {
+		t.Fatalf("handleTyping: %v", ferr)
+	}
+	var frame model.ChatFrame
+	var event model.ChatTypingPayload
+	if err := json.Unmarshal(expectFrame(t, peer).data, &frame); err != nil {
+		t.Fatalf("Unmarshal frame: %v", err)
+	}
+	if err := json.Unmarshal(frame.Payload, &event); err != nil {
+		t.Fatalf("Unmarshal payload: %v", err)
+	}
+	if frame.Type != model.ChatFrameTyping || event.State != model.ChatTypingStart || event.UserID != alice.String() ||
+		event.ExpiresAt == nil || event.ExpiresAt.Before(before.Add(typingTTL)) || event.ExpiresAt.After(time.Now().Add(typingTTL)) {
+		t.Fatalf("对方收到 %s", frame.Payload)
+	}
+	// 只转发给其他参与者，不持久化
+	expectNoFrame(t, senderOther)
+	if len(msgs.msgs) != 0 {
+		t.Fatal("正在输入状态不应持久化")
+	}
+
+	// 节流间隔内的重复 start 被静默丢弃
+	if ferr := typing(model.ChatTypingStart); ferr != nil {
+		t.Fatalf("handleTyping: %v", ferr)
+	}
+	expectNoFrame(t, peer)
+
+	if ferr := typing(model.ChatTypingStop); ferr != nil {
+		t.Fatalf("handleTyping: %v", ferr)
+	}
+	frame, event = model.ChatFrame{}, model.ChatTypingPayload{}
+	_ = json.Unmarshal(expectFrame(t, peer).data, &frame)
+	_ = json.Unmarshal(frame.Payload, &event)
+	if event.State != model.ChatTypingStop || event.ExpiresAt != nil {
+		t.Fatalf("对方收到 %s", frame.Payload)
+	}
+
+	if ferr := typing("paused"); ferr == nil || ferr.code != model.ChatErrInvalidPayload {
+		t.Fatalf("无效 state err = %v", ferr)
+	}
+	stranger := newTestConn(hub, uuid.New())
+	ferr := hub.handleTyping(ctx, stranger, &model.ChatTypingPayload{RoomID: room.ID.String()})
+	if ferr == nil || ferr.code != model.ChatErrForbidden {
+		t.Fatalf("非参与者 err = %v", ferr)
+	}
+	expectNoFrame(t, peer)
+}
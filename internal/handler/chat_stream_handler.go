@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/response"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxChatFrameBytes 单帧大小上限，与 WebSocket 读限制一致
+const maxChatFrameBytes = 64 * 1024
+
+// ChatStreamHandler SSE 下行与 REST 上行传输，供无法建立 WebSocket 的客户端使用
+// 鉴权、路由与投递由 ChatHub 完成，事件内容与 /ws/chat 一致
+type ChatStreamHandler struct {
+	hub *ChatHub
+}
+
+func NewChatStreamHandler(hub *ChatHub) *ChatStreamHandler {
+	return &ChatStreamHandler{hub: hub}
+}
+
+// Stream SSE 聊天事件流
+//
+// @Summary      SSE 聊天事件流
+// @Description  以 Server-Sent Events 推送与 /ws/chat 相同的帧，每个事件的 data 为一帧 JSON 信封。首个事件为 ready 帧，payload.conn_id 供 POST /chat/frames 使用。鉴权方式同 /ws/chat：Authorization 头或 query 参数 token。
+// @Tags         chat
+// @Produce      text/event-stream
+// @Param        token   query   string  false  "Access Token（可选，浏览器 EventSource 场景使用）"
+// @Success      200     {string}  string  "text/event-stream"
+// @Failure      401     {object}  response.ResponseData
+// @Failure      403     {object}  response.ResponseData
+// @Router       /chat/stream [get]
+func (h *ChatStreamHandler) Stream(c *gin.Context) {
+	token, claims, ok := h.hub.authenticate(c)
+	if !ok {
+		return
+	}
+
+	// 连接被服务端关闭（封禁、token 撤销、慢连接）时取消请求上下文，结束事件流
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	conn := h.hub.open(ctx, claims.UserID, claims.SessionID, token, cancel)
+	defer h.hub.close(conn)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 Nginx 等反向代理的响应缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	ready, err := encodeFrame(model.ChatFrameReady, "", model.ChatReadyPayload{ConnID: conn.id})
+	if err != nil || writeSSE(c.Writer, ready) != nil {
+		return
+	}
+
+	// 补发与事件流写出在同一连接上并发进行，补发量可能超过队列容量
+	go h.hub.flushPending(ctx, conn)
+
+	ticker := time.NewTicker(chatHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case item := <-conn.send:
+			if len(item.data) > 0 {
+				if err := writeSSE(c.Writer, item.data); err != nil {
+					conn.shutdown()
+					return
+				}
+			}
+			if item.close {
+				conn.shutdown()
+				return
+			}
+		case <-ticker.C:
+			// 注释行作为心跳，防止代理因空闲断开；token 撤销时关闭帧已入队，由下一轮写出
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			h.hub.heartbeat(conn)
+		case <-conn.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SendFrame 经 REST 发送一帧
+//
+// @Summary      经 REST 发送聊天帧
+// @Description  请求体与 /ws/chat 的客户端帧相同（message/ack/typing/read/presence），路由与授权规则一致。message 帧成功时 data 为 ack 帧；失败时 error 为 error 帧的 payload。携带 SSE ready 事件中的 conn_id 时，发送方的事件流不会收到自己发送的消息。鉴权方式同 /ws/chat。
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Param        conn_id  query  string  false  "SSE 事件流的连接ID"
+// @Param        token    query  string  false  "Access Token（可选）"
+// @Param        body     body   model.ChatFrame  true  "客户端帧"
+// @Success      200  {object}  response.ResponseData{data=model.ChatFrame}
+// @Failure      400  {object}  response.ResponseData{error=model.ChatErrorPayload}
+// @Failure      403  {object}  response.ResponseData{error=model.ChatErrorPayload}
+// @Failure      404  {object}  response.ResponseData{error=model.ChatErrorPayload}
+// @Failure      429  {object}  response.ResponseData{error=model.ChatErrorPayload}
+// @Router       /chat/frames [post]
+func (h *ChatStreamHandler) SendFrame(c *gin.Context) {
+	token, claims, ok := h.hub.authenticate(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxChatFrameBytes+1))
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "读取请求体失败", err.Error())
+		return
+	}
+	if len(data) > maxChatFrameBytes {
+		writeFrameErrorResponse(c, newFrameError(model.ChatErrInvalidFrame, "帧过大"))
+		return
+	}
+
+	// 指定的事件流位于本实例时复用其连接状态，否则使用临时连接
+	conn := h.hub.lookupConn(claims.UserID, c.Query("conn_id"))
+	if conn == nil {
+		conn = newDetachedConn(claims.UserID, token)
+	}
+
+	frame, ferr := decodeFrame(data)
+	var ack *model.ChatAckPayload
+	if ferr == nil {
+		ack, ferr = h.hub.handleFrame(ctx, conn, frame)
+	}
+	if ferr != nil {
+		// 持续超限时断开对应的事件流；未指定事件流时断开该用户的全部连接
+		if h.hub.rateLimitAbuse(ctx, conn, ferr) {
+			h.hub.disconnectAbusive(ctx, conn)
+		}
+		writeFrameErrorResponse(c, ferr)
+		return
+	}
+	if ack == nil {
+		response.SuccessResponse(c, http.StatusOK, "ok", nil)
+		return
+	}
+	reply, err := encodeFrame(model.ChatFrameAck, frame.ID, ack)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "回执编码失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "ok", json.RawMessage(reply))
+}
+
+// writeSSE 写出一个 data 事件并立即刷新
+func writeSSE(w gin.ResponseWriter, data []byte) error {
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// writeFrameErrorResponse 把帧错误映射为 HTTP 响应，error 字段为 error 帧的 payload
+func writeFrameErrorResponse(c *gin.Context, ferr *frameError) {
+	status := http.StatusBadRequest
+	switch ferr.code {
+	case model.ChatErrRoomNotFound:
+		status = http.StatusNotFound
+	case model.ChatErrForbidden, model.ChatErrNotFriends, model.ChatErrBlocked, model.ChatErrAccountDisabled:
+		status = http.StatusForbidden
+	case model.ChatErrTokenRevoked:
+		status = http.StatusUnauthorized
+	case model.ChatErrRateLimited:
+		status = http.StatusTooManyRequests
+		if ferr.retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int((ferr.retryAfter+time.Second-1)/time.Second)))
+		}
+	case model.ChatErrInternal:
+		status = http.StatusInternalServerError
+	}
+	response.ErrorResponse(c, status, ferr.message, model.ChatErrorPayload{
+		Code:         ferr.code,
+		Message:      ferr.message,
+		RetryAfterMs: ferr.retryAfter.Milliseconds(),
+	})
+}
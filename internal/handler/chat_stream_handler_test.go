@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// fakeUserRepo 只实现鉴权用到的 GetByID
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[uuid.UUID]*model.User
+}
+
+func (r *fakeUserRepo) GetByID(id uuid.UUID) (*model.User, error) {
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+// fakeUserLogService 丢弃行为日志
+type fakeUserLogService struct {
+	service.UserActionLogService
+}
+
+func (fakeUserLogService) Create(ctx context.Context, log *model.UserActionLog) error { return nil }
+
+// streamFixture 可经 HTTP 调用 SendFrame 的 ChatHub，鉴权与限流使用真实实现
+type streamFixture struct {
+	hub     *ChatHub
+	router  *gin.Engine
+	limiter service.ChatRateLimiter
+	userID  uuid.UUID
+	token   string
+}
+
+func newStreamFixture(t *testing.T, chatCfg *config.ChatConfig) *streamFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	jwtSvc, err := service.NewJwtService(&config.SecurityConfig{
+		JwtSecret: "test-secret", JwtSigningAlgorithm: "HS256",
+		JwtAccessTokenExpiresInMinutes: 15, JwtRefreshTokenExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+
+	f := &streamFixture{userID: uuid.New()}
+	f.token, err = jwtSvc.GenerateAccessToken(f.userID, "alice", uuid.Nil)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	users := &fakeUserRepo{users: map[uuid.UUID]*model.User{f.userID: {ID: f.userID, Username: "alice", Status: "active"}}}
+	broker := service.NewLocalChatBroker()
+	f.limiter = service.NewChatRateLimiter(repository.NewChatRateLimitRepository(rdb), fakeUserLogService{}, chatCfg)
+	f.hub = newTestHub(t, broker)
+	f.hub.jwtSvc = jwtSvc
+	f.hub.policy = service.NewChatPolicy(users, nil, repository.NewAccessTokenBlacklistRepository(rdb), nil, broker)
+	f.hub.limiter = f.limiter
+
+	f.router = gin.New()
+	f.router.POST("/chat/frames", NewChatStreamHandler(f.hub).SendFrame)
+	return f
+}
+
+// postFrame 以 Authorization 头调用 POST /chat/frames
+func (f *streamFixture) postFrame(t *testing.T, query, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/chat/frames"+query, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+f.token)
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSendFrameRepeatedRateLimitDisconnectsUser(t *testing.T) {
+	f := newStreamFixture(t, &config.ChatConfig{UserRatePerSecond: 0.01, UserRateBurst: 1, RateAbuseThreshold: 3})
+	// 该用户在本实例上的事件流
+	stream := newTestConn(f.hub, f.userID)
+	if ok, _ := f.limiter.AllowUser(context.Background(), f.userID); !ok {
+		t.Fatal("首个令牌应放行")
+	}
+
+	typing := `{"v":1,"id":"f1","type":"typing","payload":{"room_id":"` + uuid.NewString() + `","state":"start"}}`
+	// 不携带 conn_id，每个请求使用新的临时连接，违规仍按用户累计
+	for i := 1; i < 3; i++ {
+		if w := f.postFrame(t, "", typing); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("第 %d 次请求 status = %d: %s", i, w.Code, w.Body)
+		}
+		expectNoFrame(t, stream)
+	}
+	if w := f.postFrame(t, "", typing); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("第 3 次请求 status = %d: %s", w.Code, w.Body)
+	}
+
+	// 达到阈值后断开该用户的事件流
+	out := expectFrame(t, stream)
+	var frame struct {
+		Type    model.ChatFrameType    `json:"type"`
+		Payload model.ChatErrorPayload `json:"payload"`
+	}
+	if err := json.Unmarshal(out.data, &frame); err != nil {
+		t.Fatalf("解析帧失败: %v", err)
+	}
+	if frame.Type != model.ChatFrameError || frame.Payload.Code != model.ChatErrRateLimited || !out.close {
+		t.Fatalf("收到 %s close=%v，期望 rate_limited 并关闭", out.data, out.close)
+	}
+}
+
+func TestSendFrameRateLimitAbuseClosesNamedStream(t *testing.T) {
+	f := newStreamFixture(t, &config.ChatConfig{UserRatePerSecond: 0.01, UserRateBurst: 1, RateAbuseThreshold: 2})
+	stream := newTestConn(f.hub, f.userID)
+	other := newTestConn(f.hub, f.userID)
+	f.limiter.AllowUser(context.Background(), f.userID)
+
+	typing := `{"v":1,"id":"f1","type":"typing","payload":{}}`
+	for i := 0; i < 2; i++ {
+		if w := f.postFrame(t, "?conn_id="+stream.id, typing); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+	}
+	// 指定事件流时只关闭该连接
+	if out := expectFrame(t, stream); !out.close {
+		t.Fatalf("收到 %s，期望关闭事件流", out.data)
+	}
+	expectNoFrame(t, other)
+}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Create 分配ID与序号并保存到内存
+func (r *fakeMessageRepo) Create(msg *model.ChatMessage) error {
+	msg.ID = uuid.New()
+	msg.Seq = int64(len(r.msgs) + 1)
+	msg.CreatedAt = time.Now()
+	r.msgs[msg.ID] = *msg
+	return nil
+}
+
+// fakePresenceService 不记录在线状态
+type fakePresenceService struct {
+	service.PresenceService
+}
+
+func (fakePresenceService) Connect(ctx context.Context, userID uuid.UUID, connID string) error {
+	return nil
+}
+
+func (fakePresenceService) Disconnect(ctx context.Context, userID uuid.UUID, connID string) error {
+	return nil
+}
+
+// noBlockRepo 没有任何拉黑关系
+type noBlockRepo struct {
+	repository.BlockListRepository
+}
+
+func (noBlockRepo) IsBlocked(userID, blockedID uuid.UUID) (bool, error) { return false, nil }
+
+// transportFixture 在同一个 ChatHub 上挂载 WebSocket、SSE 与 REST 三个端点
+type transportFixture struct {
+	server *httptest.Server
+	jwtSvc service.JwtService
+	room   *model.ChatRoom
+	alice  uuid.UUID
+	bob    uuid.UUID
+}
+
+func newTransportFixture(t *testing.T) *transportFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	jwtSvc, err := service.NewJwtService(&config.SecurityConfig{
+		JwtSecret: "test-secret", JwtSigningAlgorithm: "HS256",
+		JwtAccessTokenExpiresInMinutes: 15, JwtRefreshTokenExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+
+	f := &transportFixture{jwtSvc: jwtSvc, alice: uuid.New(), bob: uuid.New()}
+	f.room = &model.ChatRoom{ID: uuid.New(), UserAID: f.alice, UserBID: f.bob, Status: "active"}
+	users := &fakeUserRepo{users: map[uuid.UUID]*model.User{
+		f.alice: {ID: f.alice, Username: "alice", Status: "active"},
+		f.bob:   {ID: f.bob, Username: "bob", Status: "active"},
+	}}
+	rooms := &fakeRoomService{
+		rooms:   map[uuid.UUID]*model.ChatRoom{f.room.ID: f.room},
+		members: map[uuid.UUID][]uuid.UUID{f.room.ID: {f.alice, f.bob}},
+	}
+	broker := service.NewLocalChatBroker()
+	t.Cleanup(func() { _ = broker.Close() })
+	policy := service.NewChatPolicy(users, noBlockRepo{}, repository.NewAccessTokenBlacklistRepository(rdb), nil, broker)
+	limiter := service.NewChatRateLimiter(repository.NewChatRateLimitRepository(rdb), fakeUserLogService{},
+		&config.ChatConfig{UserRatePerSecond: 100, UserRateBurst: 100, RoomRatePerSecond: 100, RoomRateBurst: 100})
+	hub := NewChatHub(jwtSvc, nil, nil, &fakeMessageRepo{msgs: map[uuid.UUID]model.ChatMessage{}},
+		repository.NewChatPendingRepository(rdb), rooms, fakePresenceService{}, policy, broker, limiter, 8, chatOverflowDisconnect)
+
+	router := gin.New()
+	router.GET("/ws/chat", NewWSHandler(hub).Chat)
+	stream := NewChatStreamHandler(hub)
+	router.GET("/chat/stream", stream.Stream)
+	router.POST("/chat/frames", stream.SendFrame)
+	f.server = httptest.NewServer(router)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *transportFixture) token(t *testing.T, userID uuid.UUID) string {
+	t.Helper()
+	token, err := f.jwtSvc.GenerateAccessToken(userID, "user", uuid.Nil)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	return token
+}
+
+// dialWS 以 Authorization 头建立 WebSocket 连接
+func (f *transportFixture) dialWS(t *testing.T, userID uuid.UUID) *websocket.Conn {
+	t.Helper()
+	header := http.Header{"Authorization": {"Bearer " + f.token(t, userID)}}
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(f.server.URL, "http")+"/ws/chat", header)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = ws.Close() })
+	return ws
+}
+
+// openSSE 以 query 参数 token 建立事件流，返回逐帧读取的通道
+func (f *transportFixture) openSSE(t *testing.T, userID uuid.UUID) <-chan model.ChatFrame {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, f.server.URL+"/chat/stream?token="+f.token(t, userID), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatalf("GET /chat/stream: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = resp.Body.Close()
+	})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	frames := make(chan model.ChatFrame, 8)
+	go func() {
+		defer close(frames)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var frame model.ChatFrame
+			if json.Unmarshal([]byte(data), &frame) == nil {
+				frames <- frame
+			}
+		}
+	}()
+	return frames
+}
+
+func readWSFrame(t *testing.T, ws *websocket.Conn) model.ChatFrame {
+	t.Helper()
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame model.ChatFrame
+	if err := ws.ReadJSON(&frame); err != nil {
+		t.Fatalf("读取 WebSocket 帧失败: %v", err)
+	}
+	return frame
+}
+
+func readSSEFrame(t *testing.T, frames <-chan model.ChatFrame) model.ChatFrame {
+	t.Helper()
+	select {
+	case frame, ok := <-frames:
+		if !ok {
+			t.Fatal("事件流已结束")
+		}
+		return frame
+	case <-time.After(2 * time.Second):
+		t.Fatal("事件流未收到帧")
+		return model.ChatFrame{}
+	}
+}
+
+func expectNoSSEFrame(t *testing.T, frames <-chan model.ChatFrame) {
+	t.Helper()
+	select {
+	case frame := <-frames:
+		t.Fatalf("事件流收到了不应收到的帧: %s %s", frame.Type, frame.Payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func decodeMessageEvent(t *testing.T, frame model.ChatFrame) model.ChatMessageEvent {
+	t.Helper()
+	if frame.Type != model.ChatFrameMessage {
+		t.Fatalf("帧类型 = %s，期望 message: %s", frame.Type, frame.Payload)
+	}
+	var event model.ChatMessageEvent
+	if err := json.Unmarshal(frame.Payload, &event); err != nil {
+		t.Fatalf("解析消息事件失败: %v", err)
+	}
+	return event
+}
+
+func TestChatDeliveryBetweenWebSocketAndSSE(t *testing.T) {
+	f := newTransportFixture(t)
+	ws := f.dialWS(t, f.alice)
+	sse := f.openSSE(t, f.bob)
+
+	ready := readSSEFrame(t, sse)
+	var readyPayload model.ChatReadyPayload
+	if ready.Type != model.ChatFrameReady || json.Unmarshal(ready.Payload, &readyPayload) != nil || readyPayload.ConnID == "" {
+		t.Fatalf("首个事件 = %s %s", ready.Type, ready.Payload)
+	}
+
+	// WebSocket 发送，SSE 接收
+	if err := ws.WriteJSON(map[string]any{"v": 1, "id": "c1", "type": "message",
+		"payload": map[string]string{"room_id": f.room.ID.String(), "content": "hi bob"}}); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	if ack := readWSFrame(t, ws); ack.Type != model.ChatFrameAck || ack.ID != "c1" {
+		t.Fatalf("回执 = %s id=%s", ack.Type, ack.ID)
+	}
+	if event := decodeMessageEvent(t, readSSEFrame(t, sse)); event.Content != "hi bob" || event.FromUserID != f.alice.String() || event.ToUserID != f.bob.String() {
+		t.Fatalf("SSE 收到 %+v", event)
+	}
+
+	// REST 发送并携带事件流的 conn_id，WebSocket 接收，发送方的事件流不回送自己的消息
+	body := `{"v":1,"id":"c2","type":"message","payload":{"room_id":"` + f.room.ID.String() + `","content":"hi alice"}}`
+	req, _ := http.NewRequest(http.MethodPost, f.server.URL+"/chat/frames?conn_id="+readyPayload.ConnID, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+f.token(t, f.bob))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /chat/frames: %v", err)
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Data model.ChatFrame `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, err = %v", resp.StatusCode, err)
+	}
+	if reply.Data.Type != model.ChatFrameAck || reply.Data.ID != "c2" {
+		t.Fatalf("REST 回执 = %s id=%s", reply.Data.Type, reply.Data.ID)
+	}
+	if event := decodeMessageEvent(t, readWSFrame(t, ws)); event.Content != "hi alice" || event.FromUserID != f.bob.String() {
+		t.Fatalf("WebSocket 收到 %+v", event)
+	}
+	expectNoSSEFrame(t, sse)
+}
+
+func TestChatTransportsRejectInvalidToken(t *testing.T) {
+	f := newTransportFixture(t)
+	for _, path := range []string{"/ws/chat", "/chat/stream"} {
+		resp, err := http.Get(f.server.URL + path + "?token=invalid")
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%s status = %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/response"
+	"backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceHandler 当前用户的受信任设备管理
+type DeviceHandler struct {
+	deviceSvc service.DeviceService
+}
+
+// NewDeviceHandler 创建设备处理器实例
+func NewDeviceHandler(deviceSvc service.DeviceService) *DeviceHandler {
+	return &DeviceHandler{deviceSvc: deviceSvc}
+}
+
+// ListDevices 列出设备
+// @Summary 列出设备
+// @Description 列出登录过的设备及各设备上仍然有效的会话数量；受信任设备登录时无需邮箱验证
+// @Tags 设备管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=[]model.DeviceResponse} "获取成功"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/devices [get]
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	res, err := h.deviceSvc.ListDevices(c.Request.Context(), claims.UserID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "获取设备列表失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", res)
+}
+
+// UpdateDevice 更新设备
+// @Summary 更新设备
+// @Description 重命名设备或取消信任。取消信任会撤销该设备上的全部登录会话，下次登录需重新完成设备验证；不能直接将设备设为受信任。
+// @Tags 设备管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "设备ID"
+// @Param request body model.UpdateDeviceRequest true "更新内容"
+// @Success 200 {object} response.ResponseData{data=model.DeviceResponse} "更新成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 404 {object} response.ResponseData "设备不存在"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/devices/{id} [patch]
+func (h *DeviceHandler) UpdateDevice(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req model.UpdateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	res, err := h.deviceSvc.UpdateDevice(c.Request.Context(), claims.UserID, id, &req)
+	if err != nil {
+		writeDeviceError(c, err, "更新设备失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "更新成功", res)
+}
+
+// RevokeDevice 移除设备
+// @Summary 移除设备
+// @Description 移除设备并撤销该设备上的全部登录会话（其 refresh token 与 access token 立即失效），下次在该设备登录需重新完成设备验证
+// @Tags 设备管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "设备ID"
+// @Success 200 {object} response.ResponseData{data=model.RevokeDeviceResponse} "移除成功"
+// @Failure 400 {object} response.ResponseData "ID格式错误"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 404 {object} response.ResponseData "设备不存在"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/devices/{id} [delete]
+func (h *DeviceHandler) RevokeDevice(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	n, err := h.deviceSvc.RevokeDevice(c.Request.Context(), claims.UserID, id)
+	if err != nil {
+		writeDeviceError(c, err, "移除设备失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "移除成功", model.RevokeDeviceResponse{RevokedSessions: n})
+}
+
+// writeDeviceError 设备管理业务错误映射
+func writeDeviceError(c *gin.Context, err error, fallback string) {
+	msg := err.Error()
+	switch msg {
+	case "设备不存在":
+		response.ErrorResponse(c, http.StatusNotFound, msg, nil)
+	case "设备需通过登录验证后才能受信任":
+		response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	default:
+		response.ErrorResponse(c, http.StatusInternalServerError, fallback, msg)
+	}
+}
@@ -155,7 +155,7 @@ func (h *FileHandler) UploadFiles(c *gin.Context) {
 
 // GetFile 获取文件详情
 // @Summary 获取文件详情
-// @Description 根据文件ID获取文件详细信息
+// @Description 根据文件ID获取文件详细信息；私有文件仅上传者或该文件作为聊天附件所在房间的参与者可访问
 // @Tags files
 // @Produce json
 // @Param id path string true "文件ID"
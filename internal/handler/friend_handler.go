@@ -15,11 +15,12 @@ import (
 // FriendHandler 好友系统处理器（MVP骨架）
 
 type FriendHandler struct {
-	friendSvc service.FriendService
+	friendSvc   service.FriendService
+	presenceSvc service.PresenceService
 }
 
-func NewFriendHandler(friendSvc service.FriendService) *FriendHandler {
-	return &FriendHandler{friendSvc: friendSvc}
+func NewFriendHandler(friendSvc service.FriendService, presenceSvc service.PresenceService) *FriendHandler {
+	return &FriendHandler{friendSvc: friendSvc, presenceSvc: presenceSvc}
 }
 
 // CreateRequest 发起好友请求
@@ -205,9 +206,11 @@ func (h *FriendHandler) CancelRequest(c *gin.Context) {
 
 // ListFriends 好友列表
 // @Summary 获取好友列表
+// @Description with_presence=true 时每项附带 presence（在线状态与最后在线时间）
 // @Tags 好友
 // @Security ApiKeyAuth
 // @Produce json
+// @Param with_presence query bool false "是否返回在线状态"
 // @Router /friends/list [get]
 func (h *FriendHandler) ListFriends(c *gin.Context) {
 	payload, ok := c.Get(middleware.AuthorizationPayloadKey)
@@ -228,8 +231,29 @@ func (h *FriendHandler) ListFriends(c *gin.Context) {
 		response.ErrorResponse(c, http.StatusInternalServerError, "获取好友列表失败", err.Error())
 		return
 	}
+	var items any = list
+	if c.Query("with_presence") == "true" {
+		ids := make([]uuid.UUID, 0, len(list))
+		for _, f := range list {
+			ids = append(ids, f.FriendID)
+		}
+		presence, err := h.presenceSvc.GetPresence(c.Request.Context(), ids)
+		if err != nil {
+			response.ErrorResponse(c, http.StatusInternalServerError, "获取在线状态失败", err.Error())
+			return
+		}
+		type friendWithPresence struct {
+			model.Friendship
+			Presence model.UserPresence `json:"presence"`
+		}
+		withPresence := make([]friendWithPresence, 0, len(list))
+		for _, f := range list {
+			withPresence = append(withPresence, friendWithPresence{Friendship: f, Presence: presence[f.FriendID]})
+		}
+		items = withPresence
+	}
 	data := map[string]any{
-		"items": list,
+		"items": items,
 		"total": total,
 		"page":  page,
 		"limit": limit,
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/response"
+	"backend/internal/service"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasskeyHandler 通行密钥（WebAuthn）注册、管理与登录
+type PasskeyHandler struct {
+	webAuthnSvc          service.WebAuthnService
+	userService          service.UserService
+	userActionLogService service.UserActionLogService
+}
+
+// NewPasskeyHandler 创建通行密钥处理器实例
+func NewPasskeyHandler(webAuthnSvc service.WebAuthnService, userService service.UserService, userActionLogService service.UserActionLogService) *PasskeyHandler {
+	return &PasskeyHandler{
+		webAuthnSvc:          webAuthnSvc,
+		userService:          userService,
+		userActionLogService: userActionLogService,
+	}
+}
+
+// BeginRegistration 开始注册通行密钥
+// @Summary 开始注册通行密钥
+// @Description 返回 WebAuthn 注册选项（JSON 序列化，二进制字段为 base64url），可直接传给 PublicKeyCredential.parseCreationOptionsFromJSON 后调用 navigator.credentials.create()。挑战在有效期内仅可使用一次。
+// @Tags 通行密钥
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=model.PublicKeyCredentialCreationOptions} "获取成功"
+// @Failure 400 {object} response.ResponseData "通行密钥数量已达上限"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/passkeys/register/begin [post]
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	opts, err := h.webAuthnSvc.BeginRegistration(c.Request.Context(), claims.UserID)
+	if err != nil {
+		writePasskeyError(c, err, "生成注册选项失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", opts)
+}
+
+// FinishRegistration 完成注册通行密钥
+// @Summary 完成注册通行密钥
+// @Description 提交 navigator.credentials.create() 返回凭证的 toJSON() 结果，校验通过后保存通行密钥
+// @Tags 通行密钥
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body model.PasskeyRegisterFinishRequest true "认证器响应"
+// @Success 201 {object} response.ResponseData{data=model.PasskeyResponse} "注册成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误或校验失败"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 409 {object} response.ResponseData "该通行密钥已注册"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/passkeys/register/finish [post]
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.PasskeyRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	res, err := h.webAuthnSvc.FinishRegistration(c.Request.Context(), claims.UserID, &req)
+	if err != nil {
+		writePasskeyError(c, err, "注册通行密钥失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusCreated, "注册成功", res)
+}
+
+// ListPasskeys 列出通行密钥
+// @Summary 列出通行密钥
+// @Tags 通行密钥
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=[]model.PasskeyResponse} "获取成功"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/passkeys [get]
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	res, err := h.webAuthnSvc.ListPasskeys(claims.UserID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "获取通行密钥失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", res)
+}
+
+// DeletePasskey 删除通行密钥
+// @Summary 删除通行密钥
+// @Tags 通行密钥
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "通行密钥ID"
+// @Success 200 {object} response.ResponseData "删除成功"
+// @Failure 400 {object} response.ResponseData "ID格式错误"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 404 {object} response.ResponseData "通行密钥不存在"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/passkeys/{id} [delete]
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	id, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.webAuthnSvc.DeletePasskey(c.Request.Context(), claims.UserID, id); err != nil {
+		writePasskeyError(c, err, "删除通行密钥失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "删除成功", nil)
+}
+
+// BeginLogin 开始通行密钥登录
+// @Summary 开始通行密钥登录
+// @Description 返回登录挑战与 session_id。提供用户名时仅允许该用户的通行密钥；不提供时由认证器选择可发现凭证。
+// @Tags 通行密钥
+// @Accept json
+// @Produce json
+// @Param request body model.PasskeyLoginBeginRequest false "用户名（可选）"
+// @Success 200 {object} response.ResponseData{data=model.PasskeyLoginBeginResponse} "获取成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/passkeys/login/begin [post]
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	var req model.PasskeyLoginBeginRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+			return
+		}
+	}
+	res, err := h.webAuthnSvc.BeginLogin(c.Request.Context(), &req)
+	if err != nil {
+		writePasskeyError(c, err, "生成登录挑战失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", res)
+}
+
+// FinishLogin 完成通行密钥登录
+// @Summary 完成通行密钥登录
+// @Description 提交 navigator.credentials.get() 返回凭证的 toJSON() 结果与 session_id，校验通过后签发Token。通行密钥已完成用户验证，不再要求设备验证码与两步验证；提供设备指纹时该设备被标记为受信任。
+// @Tags 通行密钥
+// @Accept json
+// @Produce json
+// @Param request body model.PasskeyLoginFinishRequest true "认证器响应"
+// @Success 200 {object} response.ResponseData{data=model.LoginResponse} "登录成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误或会话已过期"
+// @Failure 401 {object} response.ResponseData "通行密钥验证失败"
+// @Failure 403 {object} response.ResponseData "账户已被封禁或未激活"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/passkeys/login/finish [post]
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var req model.PasskeyLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	req.IPAddress = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
+
+	res, err := h.userService.LoginWithPasskey(c.Request.Context(), &req)
+	if err != nil {
+		writePasskeyError(c, err, "登录失败")
+		return
+	}
+
+	detailsBytes, _ := json.Marshal(map[string]any{
+		"method":      "passkey",
+		"device_id":   req.DeviceID,
+		"device_name": req.DeviceName,
+		"device_type": req.DeviceType,
+	})
+	_ = h.userActionLogService.Create(c.Request.Context(), &model.UserActionLog{
+		UserID:     &res.User.ID,
+		Username:   res.User.Username,
+		Action:     "login",
+		DeviceID:   req.DeviceID,
+		DeviceName: req.DeviceName,
+		DeviceType: req.DeviceType,
+		IPAddress:  req.IPAddress,
+		UserAgent:  req.UserAgent,
+		Details:    string(detailsBytes),
+	})
+	response.SuccessResponse(c, http.StatusOK, "登录成功", res)
+}
+
+// writePasskeyError 通行密钥业务错误映射
+func writePasskeyError(c *gin.Context, err error, fallback string) {
+	msg := err.Error()
+	switch msg {
+	case "通行密钥验证失败":
+		response.ErrorResponse(c, http.StatusUnauthorized, msg, nil)
+	case "账户已被封禁，无法登录", "账户未激活，无法登录":
+		response.ErrorResponse(c, http.StatusForbidden, msg, nil)
+	case "通行密钥不存在", "用户不存在":
+		response.ErrorResponse(c, http.StatusNotFound, msg, nil)
+	case "该通行密钥已注册":
+		response.ErrorResponse(c, http.StatusConflict, msg, nil)
+	case "通行密钥数量已达上限", "注册会话已过期，请重新开始", "登录会话已过期，请重新开始",
+		"通行密钥数据格式错误", "通行密钥数据类型错误", "通行密钥挑战不匹配", "通行密钥来源不受信任",
+		"通行密钥依赖方不匹配", "通行密钥未完成用户验证", "不支持的通行密钥算法":
+		response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	default:
+		response.ErrorResponse(c, http.StatusInternalServerError, fallback, msg)
+	}
+}
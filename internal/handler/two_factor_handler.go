@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/response"
+	"backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorHandler 两步验证（TOTP）管理
+type TwoFactorHandler struct {
+	twoFactorSvc service.TwoFactorService
+}
+
+// NewTwoFactorHandler 创建两步验证处理器实例
+func NewTwoFactorHandler(twoFactorSvc service.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactorSvc: twoFactorSvc}
+}
+
+// GetStatus 查询两步验证状态
+// @Summary 查询两步验证状态
+// @Description 返回当前用户是否已启用 TOTP 两步验证及剩余恢复码数量
+// @Tags 两步验证
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=model.TwoFactorStatusResponse} "获取成功"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/2fa [get]
+func (h *TwoFactorHandler) GetStatus(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	status, err := h.twoFactorSvc.GetStatus(claims.UserID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "获取两步验证状态失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", status)
+}
+
+// SetupTOTP 生成 TOTP 密钥
+// @Summary 生成 TOTP 密钥
+// @Description 生成新的共享密钥与 otpauth URI（可渲染为二维码供验证器应用扫描）。需调用确认接口提交动态码后才会启用；重复调用会替换尚未确认的密钥。
+// @Tags 两步验证
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=model.TOTPSetupResponse} "生成成功"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 409 {object} response.ResponseData "已启用两步验证"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/2fa/totp/setup [post]
+func (h *TwoFactorHandler) SetupTOTP(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	res, err := h.twoFactorSvc.SetupTOTP(c.Request.Context(), claims.UserID)
+	if err != nil {
+		writeTwoFactorError(c, err, "生成两步验证密钥失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "生成成功", res)
+}
+
+// ConfirmTOTP 确认启用 TOTP
+// @Summary 确认启用 TOTP
+// @Description 提交验证器应用生成的6位动态码以启用两步验证，成功后返回一次性恢复码（仅展示这一次，请妥善保存）
+// @Tags 两步验证
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body model.TOTPConfirmRequest true "动态码"
+// @Success 200 {object} response.ResponseData{data=model.RecoveryCodesResponse} "启用成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误或动态码错误"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 409 {object} response.ResponseData "已启用两步验证"
+// @Failure 429 {object} response.ResponseData "错误次数过多"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/2fa/totp/confirm [post]
+func (h *TwoFactorHandler) ConfirmTOTP(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.TOTPConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	res, err := h.twoFactorSvc.ConfirmTOTP(c.Request.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err, "启用两步验证失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "两步验证已启用", res)
+}
+
+// DisableTOTP 停用两步验证
+// @Summary 停用两步验证
+// @Description 提交当前动态码或一个未使用的恢复码以停用两步验证，全部恢复码随之失效
+// @Tags 两步验证
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body model.TwoFactorCodeRequest true "动态码或恢复码"
+// @Success 200 {object} response.ResponseData "停用成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误、动态码错误或未启用"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 429 {object} response.ResponseData "错误次数过多"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/2fa/totp/disable [post]
+func (h *TwoFactorHandler) DisableTOTP(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	if err := h.twoFactorSvc.DisableTOTP(c.Request.Context(), claims.UserID, req.Code); err != nil {
+		writeTwoFactorError(c, err, "停用两步验证失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "两步验证已停用", nil)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+// @Summary 重新生成恢复码
+// @Description 提交当前动态码后生成一批新的恢复码，旧恢复码全部失效
+// @Tags 两步验证
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body model.TwoFactorCodeRequest true "动态码"
+// @Success 200 {object} response.ResponseData{data=model.RecoveryCodesResponse} "生成成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误、动态码错误或未启用"
+// @Failure 401 {object} response.ResponseData "未授权"
+// @Failure 429 {object} response.ResponseData "错误次数过多"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/2fa/recovery-codes [post]
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	res, err := h.twoFactorSvc.RegenerateRecoveryCodes(c.Request.Context(), claims.UserID, req.Code)
+	if err != nil {
+		writeTwoFactorError(c, err, "生成恢复码失败")
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "恢复码已重新生成", res)
+}
+
+// writeTwoFactorError 两步验证业务错误映射
+func writeTwoFactorError(c *gin.Context, err error, fallback string) {
+	msg := err.Error()
+	switch msg {
+	case "已启用两步验证":
+		response.ErrorResponse(c, http.StatusConflict, msg, nil)
+	case "动态验证码错误次数过多，请稍后再试":
+		response.ErrorResponse(c, http.StatusTooManyRequests, msg, nil)
+	case "用户不存在":
+		response.ErrorResponse(c, http.StatusNotFound, msg, nil)
+	case "动态验证码错误", "动态验证码已使用，请等待下一个验证码", "恢复码无效或已使用",
+		"未启用两步验证", "请先生成两步验证密钥":
+		response.ErrorResponse(c, http.StatusBadRequest, msg, nil)
+	default:
+		response.ErrorResponse(c, http.StatusInternalServerError, fallback, msg)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"backend/internal/response"
 	"backend/internal/service"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -71,14 +74,17 @@ func (h *UserHandler) SendVerificationCode(c *gin.Context) {
 // Login 用户登录
 // @Summary 用户登录
 // @Description 使用用户名和密码登录，成功后返回包含Access Token、Refresh Token和用户信息的对象
+// @Description 若账户已启用两步验证，首次提交返回 two_factor_required=true 且不含Token，需在 two_factor_code 中携带6位动态码或恢复码重新提交
+// @Description 同一用户名或来源IP连续密码错误达到阈值后，后续尝试需等待的时间逐次翻倍；继续失败将临时锁定并邮件通知用户，期间返回429
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Param request body model.LoginRequest true "登录凭证"
 // @Success 200 {object} response.ResponseData{data=model.LoginResponse} "登录成功"
-// @Failure 400 {object} response.ResponseData "请求参数错误或设备验证码相关错误"
+// @Failure 400 {object} response.ResponseData "请求参数错误、设备验证码或两步验证码相关错误"
 // @Failure 401 {object} response.ResponseData "用户名或密码错误"
 // @Failure 403 {object} response.ResponseData "账户已被封禁或未激活"
+// @Failure 429 {object} response.ResponseData "密码错误次数过多处于退避或锁定期（响应头 Retry-After），或两步验证码错误次数过多"
 // @Failure 500 {object} response.ResponseData "服务器内部错误"
 // @Router /users/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
@@ -94,6 +100,14 @@ func (h *UserHandler) Login(c *gin.Context) {
 
 	res, err := h.userService.Login(c.Request.Context(), &req)
 	if err != nil {
+		// 连续登录失败过多，处于退避或锁定期
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			retryAfter := int((throttled.RetryAfter + time.Second - 1) / time.Second)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			response.ErrorResponse(c, http.StatusTooManyRequests, throttled.Message, gin.H{"retry_after_seconds": retryAfter})
+			return
+		}
 		errMsg := err.Error()
 		// 处理认证相关错误
 		if errMsg == "用户名或密码错误" {
@@ -109,8 +123,13 @@ func (h *UserHandler) Login(c *gin.Context) {
 			response.ErrorResponse(c, http.StatusForbidden, errMsg, nil)
 			return
 		}
-		// 处理设备验证相关错误
-		if strings.Contains(errMsg, "验证码") {
+		// 两步验证错误次数过多
+		if errMsg == "动态验证码错误次数过多，请稍后再试" {
+			response.ErrorResponse(c, http.StatusTooManyRequests, errMsg, nil)
+			return
+		}
+		// 处理设备验证与两步验证相关错误
+		if strings.Contains(errMsg, "验证码") || errMsg == "恢复码无效或已使用" {
 			response.ErrorResponse(c, http.StatusBadRequest, errMsg, nil)
 			return
 		}
@@ -119,6 +138,12 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// 已启用两步验证：需携带动态码或恢复码重新提交
+	if res != nil && res.TwoFactorRequired {
+		response.SuccessResponse(c, http.StatusOK, "请输入两步验证动态码", res)
+		return
+	}
+
 	// 成功后记录用户登录行为日志（不包含敏感信息）
 	if res != nil && res.User != nil {
 		detailsObj := map[string]any{
@@ -145,14 +170,14 @@ func (h *UserHandler) Login(c *gin.Context) {
 
 // RefreshToken 刷新访问Token
 // @Summary 刷新访问Token
-// @Description 使用有效的Refresh Token获取新的Access Token
+// @Description 使用有效的Refresh Token换取新的Access Token与Refresh Token，旧Refresh Token随即失效。已失效的Refresh Token再次使用时视为被盗用：撤销其所属会话并邮件通知用户。
 // @Tags 用户管理
 // @Accept json
 // @Produce json
 // @Param request body model.RefreshTokenRequest true "刷新Token请求"
 // @Success 200 {object} response.ResponseData{data=model.RefreshTokenResponse} "刷新成功"
 // @Failure 400 {object} response.ResponseData "请求参数错误"
-// @Failure 401 {object} response.ResponseData "Refresh Token无效或已过期"
+// @Failure 401 {object} response.ResponseData "Refresh Token无效、已过期或被重复使用"
 // @Failure 403 {object} response.ResponseData "账户已被封禁或未激活"
 // @Failure 500 {object} response.ResponseData "服务器内部错误"
 // @Router /users/refresh [post]
@@ -162,6 +187,8 @@ func (h *UserHandler) RefreshToken(c *gin.Context) {
 		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
 		return
 	}
+	req.IPAddress = c.ClientIP()
+	req.UserAgent = c.Request.UserAgent()
 
 	res, err := h.userService.RefreshToken(c.Request.Context(), &req)
 	if err != nil {
@@ -565,4 +592,242 @@ func (h *UserHandler) SendResetPasswordCode(c *gin.Context) {
 	response.SuccessResponse(c, http.StatusOK, "验证码已发送至您的邮箱，请注意查收", nil)
 }
 
- 
\ No newline at end of file
+ 
+// ListSessions 列出当前用户的登录会话
+// @Summary 列出登录会话
+// @Description 每次登录创建一个会话，列表按最近使用时间倒序，发起请求的会话 current 为 true
+// @Tags 用户管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=[]model.UserSession} "获取成功"
+// @Failure 401 {object} response.ResponseData "未授权或Token无效"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/sessions [get]
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	sessions, err := h.userService.ListSessions(c.Request.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "获取会话列表失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "获取成功", sessions)
+}
+
+// RevokeSession 撤销指定登录会话
+// @Summary 撤销登录会话
+// @Description 撤销后该会话的 refresh token 无法再刷新，已签发的 access token 立即失效，相关聊天长连接随之断开
+// @Tags 用户管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 200 {object} response.ResponseData "撤销成功"
+// @Failure 400 {object} response.ResponseData "ID格式错误"
+// @Failure 401 {object} response.ResponseData "未授权或Token无效"
+// @Failure 404 {object} response.ResponseData "会话不存在"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/sessions/{id} [delete]
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	sessionID, ok := parseUUID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.userService.RevokeSession(c.Request.Context(), claims.UserID, sessionID); err != nil {
+		if err.Error() == "会话不存在" {
+			response.ErrorResponse(c, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		response.ErrorResponse(c, http.StatusInternalServerError, "撤销会话失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "撤销成功", nil)
+}
+
+// RevokeOtherSessions 在其他设备上退出登录
+// @Summary 退出其他全部会话
+// @Description 撤销除当前会话外的全部登录会话
+// @Tags 用户管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} response.ResponseData{data=model.RevokeSessionsResponse} "撤销成功"
+// @Failure 401 {object} response.ResponseData "未授权或Token无效"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/sessions [delete]
+func (h *UserHandler) RevokeOtherSessions(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	n, err := h.userService.RevokeOtherSessions(c.Request.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, "撤销会话失败", err.Error())
+		return
+	}
+	response.SuccessResponse(c, http.StatusOK, "撤销成功", model.RevokeSessionsResponse{Revoked: n})
+}
+
+// RequestEmailChange 申请修改邮箱
+// @Summary 申请修改邮箱
+// @Description 校验当前密码后向新邮箱发送6位验证码，并向原邮箱发送提醒；验证码确认前邮箱不会改变
+// @Tags 用户管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body model.RequestEmailChangeRequest true "新邮箱与当前密码"
+// @Success 200 {object} response.ResponseData "验证码已发送"
+// @Failure 400 {object} response.ResponseData "请求参数错误或新邮箱与当前邮箱相同"
+// @Failure 401 {object} response.ResponseData "未授权或密码错误"
+// @Failure 409 {object} response.ResponseData "该邮箱已被注册"
+// @Failure 429 {object} response.ResponseData "请求过于频繁"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/email [post]
+func (h *UserHandler) RequestEmailChange(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.RequestEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+	req.IPAddress = c.ClientIP()
+
+	if err := h.userService.RequestEmailChange(c.Request.Context(), claims.UserID, &req); err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "密码错误":
+			response.ErrorResponse(c, http.StatusUnauthorized, errMsg, nil)
+		case errMsg == "新邮箱与当前邮箱相同":
+			response.ErrorResponse(c, http.StatusBadRequest, errMsg, nil)
+		case errMsg == "该邮箱已被注册":
+			response.ErrorResponse(c, http.StatusConflict, errMsg, nil)
+		case errMsg == "用户不存在":
+			response.ErrorResponse(c, http.StatusNotFound, errMsg, nil)
+		case strings.Contains(errMsg, "请求过于频繁"):
+			response.ErrorResponse(c, http.StatusTooManyRequests, errMsg, nil)
+		default:
+			response.ErrorResponse(c, http.StatusInternalServerError, "申请修改邮箱失败", errMsg)
+		}
+		return
+	}
+
+	detailsBytes, _ := json.Marshal(map[string]any{"new_email": req.NewEmail})
+	_ = h.userActionLogService.Create(c.Request.Context(), &model.UserActionLog{
+		UserID:    &claims.UserID,
+		Username:  claims.Username,
+		Action:    "email_change_requested",
+		IPAddress: req.IPAddress,
+		UserAgent: c.Request.UserAgent(),
+		Details:   string(detailsBytes),
+	})
+
+	response.SuccessResponse(c, http.StatusOK, "验证码已发送至新邮箱，请注意查收", nil)
+}
+
+// ConfirmEmailChange 确认修改邮箱
+// @Summary 确认修改邮箱
+// @Description 提交新邮箱收到的验证码后邮箱立即修改；原邮箱会收到撤销凭证，可在宽限期内恢复原邮箱
+// @Tags 用户管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body model.ConfirmEmailChangeRequest true "新邮箱收到的验证码"
+// @Success 200 {object} response.ResponseData{data=model.UserResponse} "修改成功"
+// @Failure 400 {object} response.ResponseData "请求参数错误、验证码错误或已过期"
+// @Failure 401 {object} response.ResponseData "未授权或Token无效"
+// @Failure 409 {object} response.ResponseData "该邮箱已被注册"
+// @Failure 429 {object} response.ResponseData "验证码错误次数过多，需重新申请"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/me/email/confirm [post]
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	claims, ok := chatClaims(c)
+	if !ok {
+		return
+	}
+	var req model.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+
+	user, err := h.userService.ConfirmEmailChange(c.Request.Context(), claims.UserID, &req)
+	if err != nil {
+		errMsg := err.Error()
+		switch {
+		case errMsg == "验证码错误次数过多，请重新获取":
+			response.ErrorResponse(c, http.StatusTooManyRequests, errMsg, nil)
+		case strings.Contains(errMsg, "验证码"):
+			response.ErrorResponse(c, http.StatusBadRequest, errMsg, nil)
+		case errMsg == "该邮箱已被注册":
+			response.ErrorResponse(c, http.StatusConflict, errMsg, nil)
+		case errMsg == "用户不存在":
+			response.ErrorResponse(c, http.StatusNotFound, errMsg, nil)
+		default:
+			response.ErrorResponse(c, http.StatusInternalServerError, "修改邮箱失败", errMsg)
+		}
+		return
+	}
+
+	detailsBytes, _ := json.Marshal(map[string]any{"new_email": user.Email})
+	_ = h.userActionLogService.Create(c.Request.Context(), &model.UserActionLog{
+		UserID:    &claims.UserID,
+		Username:  user.Username,
+		Action:    "email_changed",
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   string(detailsBytes),
+	})
+
+	response.SuccessResponse(c, http.StatusOK, "邮箱修改成功", user)
+}
+
+// UndoEmailChange 撤销邮箱修改
+// @Summary 撤销邮箱修改
+// @Description 使用原邮箱收到的撤销凭证恢复原邮箱，无需登录；成功后账户的全部登录会话被撤销
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Param request body model.UndoEmailChangeRequest true "撤销凭证"
+// @Success 200 {object} response.ResponseData "已恢复原邮箱"
+// @Failure 400 {object} response.ResponseData "请求参数错误或撤销凭证无效、已过期"
+// @Failure 409 {object} response.ResponseData "原邮箱已被其他账户使用"
+// @Failure 500 {object} response.ResponseData "服务器内部错误"
+// @Router /users/email/undo [post]
+func (h *UserHandler) UndoEmailChange(c *gin.Context) {
+	var req model.UndoEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "请求参数错误", err.Error())
+		return
+	}
+
+	user, err := h.userService.UndoEmailChange(c.Request.Context(), &req)
+	if err != nil {
+		errMsg := err.Error()
+		switch errMsg {
+		case "撤销凭证无效或已过期", "用户不存在":
+			response.ErrorResponse(c, http.StatusBadRequest, "撤销凭证无效或已过期", nil)
+		case "原邮箱已被其他账户使用，无法恢复":
+			response.ErrorResponse(c, http.StatusConflict, errMsg, nil)
+		default:
+			response.ErrorResponse(c, http.StatusInternalServerError, "撤销邮箱修改失败", errMsg)
+		}
+		return
+	}
+
+	_ = h.userActionLogService.Create(c.Request.Context(), &model.UserActionLog{
+		UserID:    &user.ID,
+		Username:  user.Username,
+		Action:    "email_change_undone",
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	response.SuccessResponse(c, http.StatusOK, "已恢复原邮箱，请重新登录", nil)
+}
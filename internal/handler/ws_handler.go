@@ -1,33 +1,20 @@
 package handler
 
 import (
-	"backend/internal/middleware"
-	"backend/internal/repository"
-	"backend/internal/service"
 	"net/http"
-	"sync"
 	"time"
-    "strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-// WSHandler 提供简单的基于用户ID的私信能力（内存转发，单实例）
+// WSHandler WebSocket 传输：鉴权、路由与投递由 ChatHub 完成
 type WSHandler struct {
 	upgrader websocket.Upgrader
-	mu       sync.RWMutex
-	// 在线连接：userID -> set(conns)
-	conns map[uuid.UUID]map[*websocket.Conn]struct{}
-	jwtSvc service.JwtService
-	friendRepo repository.FriendshipRepository
-	roomRepo repository.ChatRoomRepository
-	// 每个连接的写锁，避免并发写同一连接导致断开
-	writeMu map[*websocket.Conn]*sync.Mutex
+	hub      *ChatHub
 }
 
-func NewWSHandler(jwtSvc service.JwtService, friendRepo repository.FriendshipRepository, roomRepo repository.ChatRoomRepository) *WSHandler {
+func NewWSHandler(hub *ChatHub) *WSHandler {
 	return &WSHandler{
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
@@ -35,194 +22,98 @@ func NewWSHandler(jwtSvc service.JwtService, friendRepo repository.FriendshipRep
 			// 交由上游 Auth/CORS 控制，这里放宽跨域
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
-		conns: make(map[uuid.UUID]map[*websocket.Conn]struct{}),
-		jwtSvc: jwtSvc,
-		friendRepo: friendRepo,
-		roomRepo: roomRepo,
-		writeMu: make(map[*websocket.Conn]*sync.Mutex),
+		hub: hub,
 	}
 }
 
-// inbound 消息结构
-type inbound struct {
-	ToUserID string `json:"to_user_id"`
-	Content  string `json:"content"`
-	RoomID   string `json:"room_id"`
-}
-
-// outbound 消息结构
-type outbound struct {
-	FromUserID string    `json:"from_user_id"`
-	ToUserID   string    `json:"to_user_id"`
-	Content    string    `json:"content"`
-	Timestamp  time.Time `json:"timestamp"`
-	RoomID     string    `json:"room_id"`
-}
-
 // Chat WebSocket 连接端点
 //
 // @Summary      WebSocket 聊天连接
 // @Description  通过 WebSocket 建立一对一聊天连接。鉴权方式：优先读取 HTTP Header `Authorization: Bearer <access_token>`；浏览器无法自定义 Header 时可使用 query 参数 `?token=<access_token>`。
+// @Description  每一帧均为 `{"v":1,"type":"...","id":"...","payload":{...}}` 信封，type 取值 message/ack/typing/read/presence/error；处理失败时服务端下发 error 帧，payload.code 为原因码，id 与出错的客户端帧一致。
 // @Tags         chat
 // @Produce      json
 // @Param        token   query   string  false  "Access Token（可选，浏览器场景使用）"
 // @Success      101     {string}  string  "Switching Protocols"
 // @Router       /ws/chat [get]
 func (h *WSHandler) Chat(c *gin.Context) {
-	var userID uuid.UUID
-	if payload, ok := c.Get(middleware.AuthorizationPayloadKey); ok {
-		if claims, ok := payload.(*service.JWTClaims); ok {
-			userID = claims.UserID
-		}
-	}
-	// 浏览器 WebSocket 无法自定义 Authorization 头，支持 query 参数 token 作为兜底
-	if userID == uuid.Nil {
-		// 兼容非浏览器客户端：优先从 Authorization: Bearer <token> 读取
-		var token string
-		if auth := c.GetHeader("Authorization"); auth != "" {
-			lower := strings.ToLower(auth)
-			if strings.HasPrefix(lower, "bearer ") && len(auth) > 7 {
-				token = strings.TrimSpace(auth[7:])
-			}
-		}
-		if token == "" {
-			token = c.Query("token")
-		}
-		if token == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "未授权"})
-			return
-		}
-		claims, err := h.jwtSvc.ValidateToken(token)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Token 无效"})
-			return
-		}
-		userID = claims.UserID
+	token, claims, ok := h.hub.authenticate(c)
+	if !ok {
+		return
 	}
 
-	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
 	}
-	// 注册连接
-	h.mu.Lock()
-	set := h.conns[userID]
-	if set == nil {
-		set = make(map[*websocket.Conn]struct{})
-		h.conns[userID] = set
-	}
-	set[conn] = struct{}{}
-	h.writeMu[conn] = &sync.Mutex{}
-	h.mu.Unlock()
-
-	defer func() {
-		h.mu.Lock()
-		if s, ok := h.conns[userID]; ok {
-			delete(s, conn)
-			if len(s) == 0 { delete(h.conns, userID) }
-		}
-		delete(h.writeMu, conn)
-		h.mu.Unlock()
-		conn.Close()
-	}()
-
-	conn.SetReadLimit(64 * 1024)
-	conn.SetReadDeadline(time.Now().Add(75 * time.Second))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(75 * time.Second))
+	conn := h.hub.open(c.Request.Context(), claims.UserID, claims.SessionID, token, func() { _ = ws.Close() })
+	go wsWritePump(conn, ws)
+	defer h.hub.close(conn)
+
+	ws.SetReadLimit(64 * 1024)
+	ws.SetReadDeadline(time.Now().Add(75 * time.Second))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(75 * time.Second))
 		return nil
 	})
 
-	// 心跳：服务端每30秒发送一次 ping，防止空闲超时与中间网络设备断开
+	// 心跳：服务端定期发送 ping，防止空闲超时与中间网络设备断开，同时续期在线状态
+	// WriteControl 可与写协程并发调用
 	stopCh := make(chan struct{})
-	go func(c *websocket.Conn) {
-		ticker := time.NewTicker(30 * time.Second)
+	go func() {
+		ticker := time.NewTicker(chatHeartbeatInterval)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				h.mu.RLock()
-				m := h.writeMu[c]
-				h.mu.RUnlock()
-				if m == nil { return }
-				m.Lock()
-				_ = c.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				err := c.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(10*time.Second))
-				m.Unlock()
-				if err != nil { return }
+				if err := ws.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(chatWriteTimeout)); err != nil {
+					return
+				}
+				if !h.hub.heartbeat(conn) {
+					return
+				}
 			case <-stopCh:
 				return
+			case <-conn.done:
+				return
 			}
 		}
-	}(conn)
+	}()
+
+	// 补发离线期间未确认的消息
+	h.hub.flushPending(c.Request.Context(), conn)
 
 	// 读循环
 	for {
-		var msg inbound
-		if err := conn.ReadJSON(&msg); err != nil {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
 			break
 		}
-		if msg.Content == "" { continue }
-
-		var toID uuid.UUID
-		var roomID uuid.UUID
-
-		if msg.RoomID != "" {
-			// 依据 room_id 发送，校验房间有效且自己为参与者
-			rid, err := uuid.Parse(msg.RoomID)
-			if err != nil { continue }
-			room, err := h.roomRepo.GetByID(rid)
-			if err != nil || room.Status != "active" { continue }
-			if room.UserAID != userID && room.UserBID != userID { continue }
-			if room.UserAID == userID { toID = room.UserBID } else { toID = room.UserAID }
-			roomID = room.ID
-		} else {
-			// 依据 to_user_id 发送：先校验好友，再获取/创建房间
-			var err error
-			toID, err = uuid.Parse(msg.ToUserID)
-			if err != nil { continue }
-			// 需要存在好友关系
-			if ok, err := h.friendRepo.Exists(userID, toID); err != nil || !ok {
-				continue
-			}
-			room, err := h.roomRepo.GetOrCreateByUsers(userID, toID)
-			if err != nil { continue }
-			if room.Status != "active" { continue }
-			roomID = room.ID
-		}
-
-		out := outbound{
-			FromUserID: userID.String(),
-			ToUserID:   toID.String(),
-			Content:    msg.Content,
-			Timestamp:  time.Now(),
-			RoomID:     roomID.String(),
+		if !h.hub.process(c.Request.Context(), conn, data) {
+			break
 		}
+	}
+	close(stopCh)
+}
 
-		// 向目标用户与自己其他连接转发
-		h.mu.RLock()
-		recvSet := h.conns[toID]
-		selfSet := h.conns[userID]
-		h.mu.RUnlock()
-		// 向对端写
-		for ws := range recvSet {
-			h.mu.RLock(); m := h.writeMu[ws]; h.mu.RUnlock()
-			if m == nil { continue }
-			m.Lock()
-			_ = ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			_ = ws.WriteJSON(out)
-			m.Unlock()
-		}
-		// 向自己其他连接写
-		for ws := range selfSet {
-			if ws == conn { continue }
-			h.mu.RLock(); m := h.writeMu[ws]; h.mu.RUnlock()
-			if m == nil { continue }
-			m.Lock()
-			_ = ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			_ = ws.WriteJSON(out)
-			m.Unlock()
+// wsWritePump 写协程：依次写出队列中的帧，写失败或收到关闭帧后关闭连接
+func wsWritePump(conn *chatConn, ws *websocket.Conn) {
+	for {
+		select {
+		case item := <-conn.send:
+			if len(item.data) > 0 {
+				_ = ws.SetWriteDeadline(time.Now().Add(chatWriteTimeout))
+				if err := ws.WriteMessage(websocket.TextMessage, item.data); err != nil {
+					conn.shutdown()
+					return
+				}
+			}
+			if item.close {
+				conn.shutdown()
+				return
+			}
+		case <-conn.done:
+			return
 		}
 	}
-	close(stopCh)
 }
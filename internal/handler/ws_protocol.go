@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxAckBatch 单个 ack 帧最多确认的消息数
+const maxAckBatch = 500
+
+// frameError 帧处理失败的原因，会以 error 帧下发给客户端
+type frameError struct {
+	code    model.ChatErrorCode
+	message string
+	// 限流时的令牌桶维度（user/room）与建议的重试等待时长
+	scope      string
+	retryAfter time.Duration
+}
+
+func (e *frameError) Error() string { return string(e.code) + ": " + e.message }
+
+func newFrameError(code model.ChatErrorCode, message string) *frameError {
+	return &frameError{code: code, message: message}
+}
+
+func newRateLimitError(scope string, retryAfter time.Duration) *frameError {
+	msg := "发送过于频繁，请稍后再试"
+	if scope == "room" {
+		msg = "该房间消息过于频繁，请稍后再试"
+	}
+	return &frameError{code: model.ChatErrRateLimited, message: msg, scope: scope, retryAfter: retryAfter}
+}
+
+// decodeFrame 解析并校验帧信封
+func decodeFrame(data []byte) (*model.ChatFrame, *frameError) {
+	var frame model.ChatFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, newFrameError(model.ChatErrInvalidFrame, "帧格式错误")
+	}
+	if frame.Type == "" {
+		return &frame, newFrameError(model.ChatErrInvalidFrame, "缺少帧类型")
+	}
+	if frame.V == 0 {
+		frame.V = model.ChatProtocolVersion
+	}
+	if frame.V > model.ChatProtocolVersion {
+		return &frame, newFrameError(model.ChatErrUnsupportedVersion, "不支持的协议版本")
+	}
+	return &frame, nil
+}
+
+// decodePayload 把帧的 payload 解析到 v
+func decodePayload(frame *model.ChatFrame, v interface{}) *frameError {
+	if len(frame.Payload) == 0 {
+		return newFrameError(model.ChatErrInvalidPayload, "缺少 payload")
+	}
+	if err := json.Unmarshal(frame.Payload, v); err != nil {
+		return newFrameError(model.ChatErrInvalidPayload, "payload 格式错误")
+	}
+	return nil
+}
+
+// encodeFrame 按当前协议版本编码一帧
+func encodeFrame(typ model.ChatFrameType, id string, payload interface{}) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(model.ChatFrame{V: model.ChatProtocolVersion, Type: typ, ID: id, Payload: raw})
+}
+
+// validateMessagePayload 校验发送消息的 payload，返回解析后的附件文件ID
+func validateMessagePayload(p *model.ChatMessagePayload) ([]uuid.UUID, *frameError) {
+	if strings.TrimSpace(p.Content) == "" && len(p.Attachments) == 0 {
+		return nil, newFrameError(model.ChatErrInvalidPayload, "消息内容不能为空")
+	}
+	if utf8.RuneCountInString(p.Content) > service.MaxChatContentLength {
+		return nil, newFrameError(model.ChatErrContentTooLong, "消息内容过长")
+	}
+	if p.RoomID == "" && p.ToUserID == "" {
+		return nil, newFrameError(model.ChatErrInvalidPayload, "room_id 与 to_user_id 必须指定一个")
+	}
+	if p.RoomID != "" && p.ToUserID != "" {
+		return nil, newFrameError(model.ChatErrInvalidPayload, "room_id 与 to_user_id 不能同时指定")
+	}
+	if len(p.Attachments) > service.MaxChatAttachments {
+		return nil, newFrameError(model.ChatErrInvalidPayload, "附件数量过多")
+	}
+	fileIDs := make([]uuid.UUID, 0, len(p.Attachments))
+	for _, raw := range p.Attachments {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, newFrameError(model.ChatErrInvalidPayload, "无效的附件ID")
+		}
+		fileIDs = append(fileIDs, id)
+	}
+	return fileIDs, nil
+}
+
+// parseAckIDs 校验并解析 ack 帧中的消息ID
+func parseAckIDs(p *model.ChatAckPayload) ([]uuid.UUID, *frameError) {
+	if len(p.MessageIDs) == 0 {
+		return nil, newFrameError(model.ChatErrInvalidPayload, "message_ids 不能为空")
+	}
+	if len(p.MessageIDs) > maxAckBatch {
+		return nil, newFrameError(model.ChatErrInvalidPayload, "单次确认的消息过多")
+	}
+	ids := make([]uuid.UUID, 0, len(p.MessageIDs))
+	for _, raw := range p.MessageIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, newFrameError(model.ChatErrInvalidPayload, "无效的消息ID")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// chatServiceFrameError 把 ChatService 的业务错误映射为错误帧
+func chatServiceFrameError(err error, fallback string) *frameError {
+	switch msg := err.Error(); msg {
+	case "聊天房间不存在":
+		return newFrameError(model.ChatErrRoomNotFound, msg)
+	case "无权访问该聊天房间":
+		return newFrameError(model.ChatErrForbidden, msg)
+	case "消息不存在", "附件不存在", "附件数量过多":
+		return newFrameError(model.ChatErrInvalidPayload, msg)
+	case "只能发送自己上传的文件":
+		return newFrameError(model.ChatErrForbidden, msg)
+	default:
+		return newFrameError(model.ChatErrInternal, fallback)
+	}
+}
+
+// policyFrameError 把 ChatPolicy 的拒绝原因映射为错误帧
+func policyFrameError(err error) *frameError {
+	switch msg := err.Error(); msg {
+	case "对方已将你拉黑", "请先取消对该用户的拉黑":
+		return newFrameError(model.ChatErrBlocked, msg)
+	case "账户已被封禁", "账户未激活", "用户不存在":
+		return newFrameError(model.ChatErrAccountDisabled, msg)
+	default:
+		return newFrameError(model.ChatErrInternal, "发送权限校验失败")
+	}
+}
+
+// parseUUIDField 解析 payload 中必填的 UUID 字段
+func parseUUIDField(raw, field string) (uuid.UUID, *frameError) {
+	if raw == "" {
+		return uuid.Nil, newFrameError(model.ChatErrInvalidPayload, "缺少 "+field)
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, newFrameError(model.ChatErrInvalidPayload, "无效的 "+field)
+	}
+	return id, nil
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantCode model.ChatErrorCode
+		wantV    int
+	}{
+		{"合法帧", `{"v":1,"type":"message","id":"c1","payload":{}}`, "", 1},
+		{"缺省版本按当前版本处理", `{"type":"typing","payload":{}}`, "", model.ChatProtocolVersion},
+		{"不是 JSON", `hello`, model.ChatErrInvalidFrame, 0},
+		{"缺少类型", `{"v":1,"id":"c1"}`, model.ChatErrInvalidFrame, 0},
+		{"版本过高", `{"v":99,"type":"message"}`, model.ChatErrUnsupportedVersion, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, ferr := decodeFrame([]byte(tt.data))
+			if tt.wantCode == "" {
+				if ferr != nil || frame.V != tt.wantV {
+					t.Fatalf("decodeFrame = %+v, %v", frame, ferr)
+				}
+				return
+			}
+			if ferr == nil || ferr.code != tt.wantCode {
+				t.Fatalf("err = %v，期望 %s", ferr, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestValidateMessagePayload(t *testing.T) {
+	room := uuid.NewString()
+	tests := []struct {
+		name     string
+		payload  model.ChatMessagePayload
+		wantCode model.ChatErrorCode
+	}{
+		{"房间消息", model.ChatMessagePayload{RoomID: room, Content: "hi"}, ""},
+		{"只有附件", model.ChatMessagePayload{RoomID: room, Attachments: []string{uuid.NewString()}}, ""},
+		{"内容为空", model.ChatMessagePayload{RoomID: room, Content: "  "}, model.ChatErrInvalidPayload},
+		{"内容过长", model.ChatMessagePayload{RoomID: room, Content: strings.Repeat("字", service.MaxChatContentLength+1)}, model.ChatErrContentTooLong},
+		{"缺少接收方", model.ChatMessagePayload{Content: "hi"}, model.ChatErrInvalidPayload},
+		{"同时指定房间与用户", model.ChatMessagePayload{RoomID: room, ToUserID: uuid.NewString(), Content: "hi"}, model.ChatErrInvalidPayload},
+		{"无效的附件ID", model.ChatMessagePayload{RoomID: room, Attachments: []string{"x"}}, model.ChatErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ferr := validateMessagePayload(&tt.payload)
+			if tt.wantCode == "" && ferr != nil || tt.wantCode != "" && (ferr == nil || ferr.code != tt.wantCode) {
+				t.Fatalf("err = %v，期望 %q", ferr, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestChatHubProcessRepliesWithErrorFrame(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	hub := &ChatHub{
+		conns:     make(map[uuid.UUID]map[*chatConn]struct{}),
+		limiter:   service.NewChatRateLimiter(repository.NewChatRateLimitRepository(rdb), nil, &config.ChatConfig{UserRatePerSecond: 100, UserRateBurst: 100}),
+		queueSize: 8,
+	}
+	conn := newChatConn(uuid.New(), uuid.Nil, "", hub.queueSize, false, &hub.metrics, nil)
+
+	tests := []struct {
+		name     string
+		data     string
+		wantID   string
+		wantCode model.ChatErrorCode
+	}{
+		{"格式错误", `{`, "", model.ChatErrInvalidFrame},
+		{"未知类型", `{"v":1,"id":"c1","type":"bogus"}`, "c1", model.ChatErrUnsupportedType},
+		{"客户端不能发送 error 帧", `{"v":1,"id":"c2","type":"error","payload":{}}`, "c2", model.ChatErrUnsupportedType},
+		{"缺少 payload", `{"v":1,"id":"c3","type":"message"}`, "c3", model.ChatErrInvalidPayload},
+		{"payload 字段无效", `{"v":1,"id":"c4","type":"typing","payload":{"room_id":"x"}}`, "c4", model.ChatErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 出错的帧不会断开连接，客户端收到与请求 id 对应的 error 帧
+			if !hub.process(context.Background(), conn, []byte(tt.data)) {
+				t.Fatal("错误帧不应结束连接")
+			}
+			out := expectFrame(t, conn)
+			var frame model.ChatFrame
+			var payload model.ChatErrorPayload
+			if err := json.Unmarshal(out.data, &frame); err != nil {
+				t.Fatalf("解析帧失败: %v", err)
+			}
+			if err := json.Unmarshal(frame.Payload, &payload); err != nil {
+				t.Fatalf("解析 payload 失败: %v", err)
+			}
+			if frame.Type != model.ChatFrameError || frame.ID != tt.wantID || payload.Code != tt.wantCode || payload.Message == "" {
+				t.Fatalf("收到 %s", out.data)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 const (
@@ -20,7 +21,7 @@ const (
 )
 
 // AuthMiddleware creates a gin middleware for authentication.
-func AuthMiddleware(jwtSvc service.JwtService, blacklistRepo repository.AccessTokenBlacklistRepository) gin.HandlerFunc {
+func AuthMiddleware(jwtSvc service.JwtService, blacklistRepo repository.AccessTokenBlacklistRepository, sessionRepo repository.SessionRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Get the authorization header.
 		authHeader := c.GetHeader(AuthorizationHeaderKey)
@@ -48,21 +49,15 @@ func AuthMiddleware(jwtSvc service.JwtService, blacklistRepo repository.AccessTo
 
 		// 4. Validate the token.
 		accessToken := fields[1]
-		payload, err := jwtSvc.ValidateToken(accessToken)
+		// 只接受 access token：iss、aud、token_type 与签名密钥都必须匹配
+		payload, err := jwtSvc.ValidateAccessToken(accessToken)
 		if err != nil {
 			response.ErrorResponse(c, http.StatusUnauthorized, "无效的token", err.Error())
 			c.Abort()
 			return
 		}
 
-		// 5. Ensure this is an access token
-		if payload.TokenType != service.AccessToken {
-			response.ErrorResponse(c, http.StatusUnauthorized, "必须使用access token", nil)
-			c.Abort()
-			return
-		}
-
-		// 6. Check if the access token is blacklisted
+		// 5. Check if the access token is blacklisted
 		isBlacklisted, err := blacklistRepo.IsBlacklisted(c.Request.Context(), accessToken)
 		if err != nil {
 			response.ErrorResponse(c, http.StatusInternalServerError, "验证token黑名单状态失败", err.Error())
@@ -75,8 +70,51 @@ func AuthMiddleware(jwtSvc service.JwtService, blacklistRepo repository.AccessTo
 			return
 		}
 
+		// 6. Check the session the token belongs to is still active
+		if payload.SessionID != uuid.Nil {
+			active, err := sessionRepo.Exists(c.Request.Context(), payload.SessionID)
+			if err != nil {
+				response.ErrorResponse(c, http.StatusInternalServerError, "验证会话状态失败", err.Error())
+				c.Abort()
+				return
+			}
+			if !active {
+				response.ErrorResponse(c, http.StatusUnauthorized, "会话已失效，请重新登录", nil)
+				c.Abort()
+				return
+			}
+		}
+
 		// 7. Set the payload in the context.
 		c.Set(AuthorizationPayloadKey, payload)
 		c.Next()
 	}
-} 
\ No newline at end of file
+} 
+
+// OptionalAuthMiddleware 可选鉴权：携带有效且未撤销的 access token 时写入 payload，否则按匿名请求继续处理
+func OptionalAuthMiddleware(jwtSvc service.JwtService, blacklistRepo repository.AccessTokenBlacklistRepository, sessionRepo repository.SessionRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fields := strings.Fields(c.GetHeader(AuthorizationHeaderKey))
+		if len(fields) < 2 || strings.ToLower(fields[0]) != AuthorizationTypeBearer {
+			c.Next()
+			return
+		}
+		payload, err := jwtSvc.ValidateAccessToken(fields[1])
+		if err != nil {
+			c.Next()
+			return
+		}
+		if isBlacklisted, err := blacklistRepo.IsBlacklisted(c.Request.Context(), fields[1]); err != nil || isBlacklisted {
+			c.Next()
+			return
+		}
+		if payload.SessionID != uuid.Nil {
+			if active, err := sessionRepo.Exists(c.Request.Context(), payload.SessionID); err != nil || !active {
+				c.Next()
+				return
+			}
+		}
+		c.Set(AuthorizationPayloadKey, payload)
+		c.Next()
+	}
+}
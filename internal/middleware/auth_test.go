@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// authFixture 使用真实的 JWT 服务与 Redis 会话仓储挂载 AuthMiddleware
+type authFixture struct {
+	jwtSvc    service.JwtService
+	sessions  repository.SessionRepository
+	blacklist repository.AccessTokenBlacklistRepository
+	router    *gin.Engine
+	userID    uuid.UUID
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	jwtSvc, err := service.NewJwtService(&config.SecurityConfig{
+		JwtSecret: "test-secret", JwtSigningAlgorithm: "HS256",
+		JwtAccessTokenExpiresInMinutes: 15, JwtRefreshTokenExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+	f := &authFixture{
+		jwtSvc:    jwtSvc,
+		sessions:  repository.NewSessionRepository(rdb),
+		blacklist: repository.NewAccessTokenBlacklistRepository(rdb),
+		userID:    uuid.New(),
+	}
+	f.router = gin.New()
+	f.router.GET("/me", AuthMiddleware(f.jwtSvc, f.blacklist, f.sessions), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return f
+}
+
+// login 创建一个会话并返回绑定该会话的 access token
+func (f *authFixture) login(t *testing.T, deviceID string) (*model.UserSession, string) {
+	t.Helper()
+	now := time.Now()
+	session := &model.UserSession{ID: uuid.New(), UserID: f.userID, DeviceID: deviceID, CreatedAt: now, LastUsedAt: now}
+	if err := f.sessions.Create(context.Background(), session, "rt-"+session.ID.String(), time.Hour); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	token, err := f.jwtSvc.GenerateAccessToken(f.userID, "alice", session.ID)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	return session, token
+}
+
+func (f *authFixture) get(token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set(AuthorizationHeaderKey, "Bearer "+token)
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAuthMiddlewareRejectsRevokedSession(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	laptop, laptopToken := f.login(t, "laptop")
+	_, phoneToken := f.login(t, "phone")
+
+	for name, token := range map[string]string{"laptop": laptopToken, "phone": phoneToken} {
+		if code := f.get(token); code != http.StatusNoContent {
+			t.Fatalf("%s 撤销前 status = %d", name, code)
+		}
+	}
+
+	// 远程撤销 laptop 会话后，其 access token 未过期也立即失效，其他会话不受影响
+	if ok, err := f.sessions.Delete(ctx, f.userID, laptop.ID); err != nil || !ok {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if code := f.get(laptopToken); code != http.StatusUnauthorized {
+		t.Fatalf("撤销后 status = %d", code)
+	}
+	if code := f.get(phoneToken); code != http.StatusNoContent {
+		t.Fatalf("其他会话 status = %d", code)
+	}
+}
+
+func TestAuthMiddlewareLogoutEverywhereElse(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	current, currentToken := f.login(t, "laptop")
+	_, phoneToken := f.login(t, "phone")
+	_, tabletToken := f.login(t, "tablet")
+
+	revoked, err := f.sessions.DeleteAllByUser(ctx, f.userID, current.ID)
+	if err != nil || len(revoked) != 2 {
+		t.Fatalf("DeleteAllByUser = %v, %v", revoked, err)
+	}
+	if code := f.get(currentToken); code != http.StatusNoContent {
+		t.Fatalf("当前会话 status = %d", code)
+	}
+	for name, token := range map[string]string{"phone": phoneToken, "tablet": tabletToken} {
+		if code := f.get(token); code != http.StatusUnauthorized {
+			t.Fatalf("%s status = %d", name, code)
+		}
+	}
+}
+
+func TestAuthMiddlewaresRejectTokensForOtherSurfaces(t *testing.T) {
+	f := newAuthFixture(t)
+	session, accessToken := f.login(t, "laptop")
+	refreshToken, err := f.jwtSvc.GenerateRefreshToken(f.userID, "alice", session.ID)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	adminToken, err := f.jwtSvc.GenerateAdminToken("root")
+	if err != nil {
+		t.Fatalf("GenerateAdminToken: %v", err)
+	}
+	f.router.GET("/admin", AdminAuthMiddleware(f.jwtSvc), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	call := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(AuthorizationHeaderKey, "Bearer "+token)
+		w := httptest.NewRecorder()
+		f.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"access token 访问用户接口", "/me", accessToken, http.StatusNoContent},
+		{"refresh token 访问用户接口", "/me", refreshToken, http.StatusUnauthorized},
+		{"admin token 访问用户接口", "/me", adminToken, http.StatusUnauthorized},
+		{"admin token 访问管理接口", "/admin", adminToken, http.StatusNoContent},
+		{"access token 访问管理接口", "/admin", accessToken, http.StatusUnauthorized},
+		{"refresh token 访问管理接口", "/admin", refreshToken, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := call(tt.path, tt.token); code != tt.want {
+				t.Fatalf("status = %d，期望 %d", code, tt.want)
+			}
+		})
+	}
+}
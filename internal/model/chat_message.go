@@ -0,0 +1,82 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatMessage 聊天消息（持久化，供历史记录与多端同步）
+// 每条经 WebSocket 接收的消息在转发前写入此表
+// 索引 (room_id, created_at) 支撑按房间的游标分页
+// Seq 为房间内单调递增的序号（从1开始），客户端据此发现漏收的消息
+// 撤回的消息保留为墓碑：Content 清空并记录 RecalledAt，历史分页中仍占位；编辑前的内容见 ChatMessageEdit
+// 附件关联见 ChatMessageAttachment，查询时由仓储填充 Attachments
+
+type ChatMessage struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RoomID     uuid.UUID  `json:"room_id" gorm:"type:uuid;not null;index:idx_chat_msg_room_created;index:idx_chat_msg_room_seq"`
+	SenderID   uuid.UUID  `json:"sender_id" gorm:"type:uuid;not null;index"`
+	Seq        int64      `json:"seq" gorm:"not null;default:0;index:idx_chat_msg_room_seq"`
+	Content    string     `json:"content" gorm:"type:text;not null"`
+	EditedAt   *time.Time `json:"edited_at"`
+	RecalledAt *time.Time `json:"recalled_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index:idx_chat_msg_room_created"`
+
+	Attachments []ChatAttachment `json:"attachments,omitempty" gorm:"-"`
+}
+
+func (ChatMessage) TableName() string { return "chat_messages" }
+
+// ChatMessageAttachment 消息与文件的关联，Position 为附件在消息内的顺序
+// 文件仍归上传者所有；房间参与者凭此关联获得私有文件的访问权限，消息撤回时关联一并删除
+type ChatMessageAttachment struct {
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;primaryKey"`
+	FileID    uuid.UUID `json:"file_id" gorm:"type:uuid;primaryKey;index"`
+	Position  int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ChatMessageAttachment) TableName() string { return "chat_message_attachments" }
+
+// ChatAttachment 随消息下发的附件元数据
+// ThumbnailURL 图片缩略图地址，仅在存储层生成了缩略图时返回；目前不生成，客户端按 mime_type 使用 url 预览
+type ChatAttachment struct {
+	FileID       uuid.UUID `json:"file_id"`
+	Name         string    `json:"name"`
+	MimeType     string    `json:"mime_type"`
+	Size         int64     `json:"size"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+}
+
+// ChatMessageEdit 消息编辑历史，每次编辑记录编辑前的内容
+type ChatMessageEdit struct {
+	ID              uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	MessageID       uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
+	PreviousContent string    `json:"previous_content" gorm:"type:text;not null"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (ChatMessageEdit) TableName() string { return "chat_message_edits" }
+
+// ChatMessageHidden 仅对自己删除的消息，历史查询时对该用户隐藏
+type ChatMessageHidden struct {
+	MessageID uuid.UUID `json:"message_id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ChatMessageHidden) TableName() string { return "chat_message_hiddens" }
+
+// EditChatMessageRequest 编辑消息请求
+type EditChatMessageRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// ChatMessageListResponse 聊天历史分页响应
+// Messages 始终按时间正序返回；HasMore 表示游标方向上是否还有更多消息
+type ChatMessageListResponse struct {
+	Messages []ChatMessage `json:"messages"`
+	HasMore  bool          `json:"has_more"`
+}
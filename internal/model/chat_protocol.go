@@ -0,0 +1,162 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ChatProtocolVersion 当前 WebSocket 聊天协议版本
+// 客户端帧未携带 v 时按当前版本处理；高于当前版本的帧返回 unsupported_version 错误
+const ChatProtocolVersion = 1
+
+// ChatFrameType 帧类型
+type ChatFrameType string
+
+const (
+	ChatFrameMessage  ChatFrameType = "message"  // 聊天消息
+	ChatFrameAck      ChatFrameType = "ack"      // 消息确认：客户端确认收到，服务端确认已持久化
+	ChatFrameTyping   ChatFrameType = "typing"   // 正在输入
+	ChatFrameRead     ChatFrameType = "read"     // 已读回执
+	ChatFramePresence ChatFrameType = "presence" // 在线状态
+	ChatFrameEdit     ChatFrameType = "edit"     // 消息被编辑（仅服务端下发）
+	ChatFrameRecall   ChatFrameType = "recall"   // 消息被撤回（仅服务端下发）
+	ChatFrameDelete   ChatFrameType = "delete"   // 消息被自己删除，同步到自己的其他设备（仅服务端下发）
+	ChatFrameMember   ChatFrameType = "member"   // 群成员变更（仅服务端下发）
+	ChatFrameError    ChatFrameType = "error"    // 错误（仅服务端下发）
+	ChatFrameReady    ChatFrameType = "ready"    // SSE 事件流建立，携带连接ID（仅服务端下发）
+)
+
+// ChatErrorCode 错误帧原因码
+type ChatErrorCode string
+
+const (
+	ChatErrInvalidFrame       ChatErrorCode = "invalid_frame"       // 帧不是合法 JSON 或缺少 type
+	ChatErrUnsupportedVersion ChatErrorCode = "unsupported_version" // 协议版本不受支持
+	ChatErrUnsupportedType    ChatErrorCode = "unsupported_type"    // 未知或暂不支持的帧类型
+	ChatErrInvalidPayload     ChatErrorCode = "invalid_payload"     // payload 字段缺失或格式错误
+	ChatErrContentTooLong     ChatErrorCode = "content_too_long"    // 消息内容超出长度限制
+	ChatErrRoomNotFound       ChatErrorCode = "room_not_found"      // 房间不存在或已关闭
+	ChatErrForbidden          ChatErrorCode = "forbidden"           // 无权在该房间操作
+	ChatErrNotFriends         ChatErrorCode = "not_friends"         // 双方不是好友
+	ChatErrBlocked            ChatErrorCode = "blocked"             // 存在拉黑关系
+	ChatErrAccountDisabled    ChatErrorCode = "account_disabled"    // 账户被封禁或不可用，连接随后被关闭
+	ChatErrTokenRevoked       ChatErrorCode = "token_revoked"       // access token 已撤销，连接随后被关闭
+	ChatErrRateLimited        ChatErrorCode = "rate_limited"        // 发送过于频繁，该帧被丢弃；持续超限时连接随后被关闭
+	ChatErrInternal           ChatErrorCode = "internal_error"      // 服务端内部错误
+)
+
+// ChatFrame WebSocket 帧信封
+// ID 由客户端生成，服务端对该帧的确认或错误帧会原样带回，用于请求与响应的关联
+type ChatFrame struct {
+	V       int             `json:"v"`
+	Type    ChatFrameType   `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ChatMessagePayload 客户端发送消息：room_id 与 to_user_id 二选一，群聊只能使用 room_id
+// Attachments 为先经文件上传接口上传的文件ID，携带附件时 content 可为空
+type ChatMessagePayload struct {
+	RoomID      string   `json:"room_id"`
+	ToUserID    string   `json:"to_user_id"`
+	Content     string   `json:"content"`
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// ChatMessageEvent 服务端下发的消息
+// MessageID 由服务端分配；Seq 为房间内递增序号，客户端可据此发现缺失的消息
+// ToUserID 仅一对一房间返回，群聊消息以 RoomID 区分
+type ChatMessageEvent struct {
+	MessageID   string           `json:"message_id"`
+	Seq         int64            `json:"seq"`
+	RoomID      string           `json:"room_id"`
+	FromUserID  string           `json:"from_user_id"`
+	ToUserID    string           `json:"to_user_id,omitempty"`
+	Content     string           `json:"content"`
+	Attachments []ChatAttachment `json:"attachments,omitempty"`
+	EditedAt    *time.Time       `json:"edited_at,omitempty"`
+	RecalledAt  *time.Time       `json:"recalled_at,omitempty"`
+	Timestamp   time.Time        `json:"timestamp"`
+}
+
+// ChatAckPayload 消息确认
+// 客户端发送时表示已收到 MessageIDs；服务端回给发送方时表示消息已持久化，Seq 为分配的序号
+type ChatAckPayload struct {
+	MessageIDs []string `json:"message_ids"`
+	Seq        int64    `json:"seq,omitempty"`
+}
+
+// 正在输入状态
+const (
+	ChatTypingStart = "start" // 开始输入，客户端持续输入时应定期重发
+	ChatTypingStop  = "stop"  // 停止输入（清空输入框或发送后）
+)
+
+// ChatTypingPayload 正在输入，不持久化
+// 客户端发送时 state 缺省为 start；服务端转发时附带 expires_at，接收方在此之前未收到新的 start 即视为停止输入
+type ChatTypingPayload struct {
+	RoomID    string     `json:"room_id"`
+	UserID    string     `json:"user_id,omitempty"`
+	State     string     `json:"state,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ChatReadPayload 已读回执：MessageID 为该用户在房间内已读到的最后一条消息
+type ChatReadPayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id,omitempty"`
+}
+
+// ChatPresencePayload 在线状态
+// 客户端发送时只需 status（online/away）；服务端向好友推送时包含 user_id，离线时附带 last_seen_at
+type ChatPresencePayload struct {
+	UserID     string     `json:"user_id,omitempty"`
+	Status     string     `json:"status"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// ChatMessageUpdatePayload 消息变更事件（edit/recall/delete）
+// edit 时 Content 为新内容；recall 后 Content 为空
+type ChatMessageUpdatePayload struct {
+	MessageID  string     `json:"message_id"`
+	RoomID     string     `json:"room_id"`
+	UserID     string     `json:"user_id"`
+	Content    string     `json:"content,omitempty"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	RecalledAt *time.Time `json:"recalled_at,omitempty"`
+}
+
+// 群成员变更动作
+const (
+	ChatMemberInvited     = "invited"      // 成员被邀请加入
+	ChatMemberKicked      = "kicked"       // 成员被移出
+	ChatMemberLeft        = "left"         // 成员主动退出
+	ChatMemberTransferred = "transferred"  // 群主转让，UserIDs 为新群主
+	ChatMemberRoleUpdated = "role_updated" // 成员角色变更
+)
+
+// ChatMemberEventPayload 群成员变更事件，推送给变更前后的全部成员（含被移出、退出的用户）
+// ActorID 为操作者；UserIDs 为受影响的成员；Role 仅 role_updated 返回
+type ChatMemberEventPayload struct {
+	RoomID    string    `json:"room_id"`
+	Action    string    `json:"action"`
+	ActorID   string    `json:"actor_id"`
+	UserIDs   []string  `json:"user_ids"`
+	Role      string    `json:"role,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ChatReadyPayload SSE 事件流建立后的首个事件
+// 客户端经 REST 发送帧时携带 conn_id，服务端据此把发送方的事件流视为同一连接（不回送自己的消息、共享输入节流）
+type ChatReadyPayload struct {
+	ConnID string `json:"conn_id"`
+}
+
+// ChatErrorPayload 错误帧内容
+// RetryAfterMs 仅 rate_limited 返回，为建议的重试等待毫秒数
+type ChatErrorPayload struct {
+	Code         ChatErrorCode `json:"code"`
+	Message      string        `json:"message"`
+	RetryAfterMs int64         `json:"retry_after_ms,omitempty"`
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatReadState 用户在房间内的已读位置
+// 主键 (room_id, user_id)；LastReadSeq 与 LastReadMessageID 对应同一条消息，只前进不后退
+// 未读数 = 房间内 seq 大于 LastReadSeq 且非本人发送的消息数
+
+type ChatReadState struct {
+	RoomID            uuid.UUID  `json:"room_id" gorm:"type:uuid;primaryKey"`
+	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;primaryKey;index"`
+	LastReadMessageID *uuid.UUID `json:"last_read_message_id" gorm:"type:uuid"`
+	LastReadSeq       int64      `json:"last_read_seq" gorm:"not null;default:0"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+func (ChatReadState) TableName() string { return "chat_read_states" }
+
+// ChatRoomPeer 房间另一方的公开资料
+type ChatRoomPeer struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Nickname string    `json:"nickname"`
+	Avatar   string    `json:"avatar"`
+}
+
+// ChatRoomSummary 会话列表中的一项
+// 一对一房间返回 Peer；群聊房间 Peer 为空，返回 Name
+type ChatRoomSummary struct {
+	ID                uuid.UUID     `json:"id"`
+	Type              string        `json:"type"`
+	Name              string        `json:"name"`
+	Status            string        `json:"status"`
+	Peer              *ChatRoomPeer `json:"peer"`
+	LastMessage       *ChatMessage  `json:"last_message"`
+	LastMessageAt     *time.Time    `json:"last_message_at"`
+	LastReadMessageID *uuid.UUID    `json:"last_read_message_id"`
+	UnreadCount       int64         `json:"unread_count"`
+}
+
+// ChatRoomListResponse 会话列表分页响应，按最近活跃时间倒序
+type ChatRoomListResponse struct {
+	Rooms []ChatRoomSummary `json:"rooms"`
+	Total int64             `json:"total"`
+	Page  int               `json:"page"`
+	Limit int               `json:"limit"`
+}
@@ -6,17 +6,76 @@ import (
 	"github.com/google/uuid"
 )
 
-// ChatRoom 一对一聊天房间（仅两个用户）
-// 唯一约束 (user_a_id, user_b_id) 按字典序存储（较小者为 A）
+// ChatRoom 聊天房间
+// Type=direct 为一对一房间：参与者为 UserAID/UserBID，按字典序存储（较小者为 A），(user_a_id, user_b_id) 部分唯一
+// Type=group 为群聊房间：UserAID/UserBID 为空 UUID，成员及角色见 ChatRoomMember，Name 为群名称
 // Status: active/inactive
+// LastSeq 为房间内最后一条消息的序号，用于为新消息分配单调递增的 seq
+// LastMessageAt 为最后一条消息的时间，会话列表据此按活跃度排序
+
+const (
+	ChatRoomTypeDirect = "direct"
+	ChatRoomTypeGroup  = "group"
+)
 
 type ChatRoom struct {
-	ID       uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	UserAID  uuid.UUID `json:"user_a_id" gorm:"type:uuid;not null;index;uniqueIndex:uidx_chat_pair"`
-	UserBID  uuid.UUID `json:"user_b_id" gorm:"type:uuid;not null;index;uniqueIndex:uidx_chat_pair"`
-	Status   string    `json:"status" gorm:"type:varchar(16);not null;default:'active'"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Type          string     `json:"type" gorm:"type:varchar(16);not null;default:'direct';index"`
+	Name          string     `json:"name" gorm:"type:varchar(50)"`
+	UserAID       uuid.UUID  `json:"user_a_id" gorm:"type:uuid;not null;index;uniqueIndex:uidx_chat_direct_pair,where:type = 'direct'"`
+	UserBID       uuid.UUID  `json:"user_b_id" gorm:"type:uuid;not null;index;uniqueIndex:uidx_chat_direct_pair,where:type = 'direct'"`
+	Status        string     `json:"status" gorm:"type:varchar(16);not null;default:'active'"`
+	LastSeq       int64      `json:"last_seq" gorm:"not null;default:0"`
+	LastMessageAt *time.Time `json:"last_message_at" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 func (ChatRoom) TableName() string { return "chat_rooms" }
+
+// IsGroup 是否为群聊房间
+func (r *ChatRoom) IsGroup() bool { return r.Type == ChatRoomTypeGroup }
+
+// ChatMemberRole 群成员角色
+type ChatMemberRole string
+
+const (
+	ChatMemberOwner  ChatMemberRole = "owner"
+	ChatMemberAdmin  ChatMemberRole = "admin"
+	ChatMemberMember ChatMemberRole = "member"
+)
+
+// ChatRoomMember 群聊成员
+// 主键 (room_id, user_id)；每个群有且仅有一个 owner
+// 退出或被移出的成员直接删除记录
+
+type ChatRoomMember struct {
+	RoomID    uuid.UUID      `json:"room_id" gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID      `json:"user_id" gorm:"type:uuid;primaryKey;index"`
+	Role      ChatMemberRole `json:"role" gorm:"type:varchar(16);not null;default:'member'"`
+	InvitedBy *uuid.UUID     `json:"invited_by" gorm:"type:uuid"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+func (ChatRoomMember) TableName() string { return "chat_room_members" }
+
+// CreateChatGroupRequest 创建群聊请求
+type CreateChatGroupRequest struct {
+	Name      string   `json:"name" binding:"required,max=50"`
+	MemberIDs []string `json:"member_ids"`
+}
+
+// InviteChatGroupRequest 邀请成员请求
+type InviteChatGroupRequest struct {
+	UserIDs []string `json:"user_ids" binding:"required,min=1"`
+}
+
+// TransferChatGroupRequest 转让群主请求
+type TransferChatGroupRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+// UpdateChatMemberRoleRequest 设置成员角色请求（仅 admin/member）
+type UpdateChatMemberRoleRequest struct {
+	Role ChatMemberRole `json:"role" binding:"required,oneof=admin member"`
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatSearchRequest 聊天记录搜索请求
+// PeerID 限定与某位好友的一对一会话，RoomID 限定某个房间；From/To 为 RFC3339 时间，闭区间
+type ChatSearchRequest struct {
+	Q      string    `form:"q" binding:"required,max=100"`
+	PeerID string    `form:"peer_id" binding:"omitempty,uuid"`
+	RoomID string    `form:"room_id" binding:"omitempty,uuid"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page   int       `form:"page" binding:"omitempty,min=1"`
+	Limit  int       `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+// ChatSearchFilter 仓储层搜索条件，零值字段表示不限定
+// Terms 为按空白拆分后的关键词，消息内容须全部命中（不区分大小写；中日韩文字逐字切分，须连续出现）
+type ChatSearchFilter struct {
+	UserID uuid.UUID
+	Terms  []string
+	PeerID *uuid.UUID
+	RoomID *uuid.UUID
+	From   *time.Time
+	To     *time.Time
+}
+
+// ChatSearchHit 搜索命中的消息
+// Snippet 为命中片段，内容已做 HTML 转义，关键词以 <mark></mark> 包裹
+type ChatSearchHit struct {
+	MessageID uuid.UUID `json:"message_id"`
+	RoomID    uuid.UUID `json:"room_id"`
+	RoomType  string    `json:"room_type"`
+	RoomName  string    `json:"room_name,omitempty"`
+	SenderID  uuid.UUID `json:"sender_id"`
+	Seq       int64     `json:"seq"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"created_at"`
+	// Content 消息原文，仅用于生成 Snippet，不返回给客户端
+	Content string `json:"-"`
+}
+
+// ChatSearchResponse 搜索结果分页响应，按消息时间倒序
+type ChatSearchResponse struct {
+	Hits  []ChatSearchHit `json:"hits"`
+	Total int64           `json:"total"`
+	Page  int             `json:"page"`
+	Limit int             `json:"limit"`
+}
@@ -51,3 +51,31 @@ type DeviceVerification struct {
 func (DeviceVerification) TableName() string {
 	return "device_verifications"
 }
+
+// DeviceResponse 设备信息响应结构
+type DeviceResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	DeviceName  string     `json:"device_name"`
+	DeviceType  string     `json:"device_type"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddress   string     `json:"ip_address"`
+	Location    string     `json:"location"`
+	IsTrusted   bool       `json:"is_trusted"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// ActiveSessions 该设备上仍然有效的登录会话数量
+	ActiveSessions int `json:"active_sessions"`
+}
+
+// UpdateDeviceRequest 更新设备请求结构
+// IsTrusted 只能取消信任：设备须通过登录时的邮箱验证才能成为受信任设备
+type UpdateDeviceRequest struct {
+	DeviceName *string `json:"device_name" binding:"omitempty,max=100" example:"我的笔记本"`
+	IsTrusted  *bool   `json:"is_trusted" example:"false"`
+}
+
+// RevokeDeviceResponse 移除设备的结果
+type RevokeDeviceResponse struct {
+	// RevokedSessions 随设备一并撤销的登录会话数量
+	RevokedSessions int `json:"revoked_sessions"`
+}
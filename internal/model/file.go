@@ -83,6 +83,18 @@ func (f *File) ToResponse() *FileResponse {
 	}
 }
 
+// ToChatAttachment 将File转换为聊天消息附件元数据
+// 存储层不生成缩略图，不填写 ThumbnailURL
+func (f *File) ToChatAttachment() ChatAttachment {
+	return ChatAttachment{
+		FileID:   f.ID,
+		Name:     f.OriginalName,
+		MimeType: f.MimeType,
+		Size:     f.Size,
+		URL:      f.URL,
+	}
+}
+
 // FileListRequest 文件列表请求
 type FileListRequest struct {
 	Category    string `form:"category" binding:"omitempty"`     // 按分类筛选
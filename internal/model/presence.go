@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PresenceStatus 在线状态
+// online: 至少一个连接在线；away: 在线但客户端声明离开；offline: 无在线连接
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// UserPresence 用户在线状态快照
+// LastSeenAt 为最后一个连接断开的时间，在线时为空
+type UserPresence struct {
+	UserID     uuid.UUID      `json:"user_id"`
+	Status     PresenceStatus `json:"status"`
+	LastSeenAt *time.Time     `json:"last_seen_at,omitempty"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserSession 登录会话，每次登录创建一个，持有一个 refresh token
+// 会话保存在 Redis 中，过期时间与 refresh token 一致；access token 通过 sid 声明关联会话，会话删除后立即失效
+type UserSession struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"-"`
+	DeviceID   string    `json:"device_id,omitempty"`
+	DeviceName string    `json:"device_name,omitempty"`
+	DeviceType string    `json:"device_type,omitempty"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// Current 是否为发起请求的会话，仅在列表中填充
+	Current bool `json:"current"`
+}
+
+// RevokeSessionsResponse 批量撤销会话的结果
+type RevokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
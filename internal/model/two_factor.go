@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserTOTP 用户的 TOTP（RFC 6238）两步验证配置
+// 生成密钥后处于待确认状态，使用验证器应用生成的动态码确认后启用
+type UserTOTP struct {
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;primary_key"`
+	Secret    string     `json:"-" gorm:"not null;size:64"` // Base32 编码的共享密钥
+	Enabled   bool       `json:"enabled" gorm:"not null;default:false"`
+	EnabledAt *time.Time `json:"enabled_at"`
+	// LastUsedStep 最近一次验证通过的时间步，同一动态码不能重复使用
+	LastUsedStep int64 `json:"-" gorm:"not null;default:0"`
+	// 连续验证失败次数，达到上限后在 LockedUntil 之前拒绝验证
+	FailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil    *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// UserRecoveryCode 两步验证恢复码，仅保存哈希，每个恢复码只能使用一次
+type UserRecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;size:64"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserRecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+// TwoFactorStatusResponse 两步验证状态
+type TwoFactorStatusResponse struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+}
+
+// TOTPSetupResponse 生成的 TOTP 密钥，OtpauthURI 可直接生成二维码供验证器应用扫描
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OtpauthURI string `json:"otpauth_uri" example:"otpauth://totp/Backend:testuser?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=Backend&algorithm=SHA1&digits=6&period=30"`
+}
+
+// TOTPConfirmRequest 确认启用 TOTP
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
+
+// TwoFactorCodeRequest 需要当前动态码或恢复码的操作（停用、重新生成恢复码）
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=32" example:"123456"`
+}
+
+// RecoveryCodesResponse 新生成的恢复码，仅在生成时返回一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
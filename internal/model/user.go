@@ -11,7 +11,7 @@ type User struct {
 	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	Username     string    `json:"username" gorm:"uniqueIndex;not null;size:50"`
 	Email        string    `json:"email" gorm:"uniqueIndex;not null;size:100"`
-	PasswordSalt string    `json:"-" gorm:"not null;size:128"` // 密码加盐哈希，不在JSON中返回
+	PasswordSalt string    `json:"-" gorm:"not null;size:255"` // 密码哈希（PHC格式），不在JSON中返回
 	Nickname     string    `json:"nickname" gorm:"size:100"`
 	Bio          string    `json:"bio" gorm:"type:text"`
 	Avatar       string    `json:"avatar" gorm:"size:255"`
@@ -57,6 +57,8 @@ type LoginRequest struct {
 	DeviceType       string `json:"device_type" binding:"omitempty,oneof=mobile desktop tablet" example:"mobile"`
 	// 如果是第二步校验，客户端可在同一登录接口提交邮箱验证码完成验证
 	DeviceVerifyCode string `json:"device_verification_code" binding:"omitempty,len=6" example:"123456"`
+	// 已启用两步验证时，提交验证器应用生成的6位动态码或一次性恢复码
+	TwoFactorCode    string `json:"two_factor_code" binding:"omitempty,max=32" example:"654321"`
 	// 由服务器端在处理器中自动填充的请求来源信息
 	IPAddress        string `json:"ip_address" binding:"omitempty,max=45" example:"203.0.113.1"`
 	UserAgent        string `json:"user_agent" binding:"omitempty,max=500" example:"Mozilla/5.0 (Windows NT 10.0; Win64; x64)..."`
@@ -69,16 +71,23 @@ type LoginResponse struct {
 	User         *UserResponse `json:"user"`
 	// 若为陌生设备首次登录，将不会返回token，而是提示需要进行设备验证码验证
 	VerificationRequired bool `json:"verification_required,omitempty"`
+	// 账户已启用两步验证且未提交动态码时，不返回token，需携带 two_factor_code 重新登录
+	TwoFactorRequired bool `json:"two_factor_required,omitempty"`
 }
 
 // RefreshTokenRequest 刷新Token请求结构
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	// 由服务器端在处理器中自动填充，用于更新会话的最近使用信息
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 // RefreshTokenResponse 刷新Token响应结构
 type RefreshTokenResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	// RefreshToken 轮换后的新refresh token，旧refresh token已失效
+	RefreshToken string `json:"refresh_token"`
 }
 
 // LogoutRequest 登出请求结构
@@ -95,6 +104,25 @@ type UpdateProfileRequest struct {
 	BackgroundURL string `json:"background_url" binding:"omitempty,url" example:"https://example.com/bg.jpg"`
 }
 
+// RequestEmailChangeRequest 申请修改邮箱请求结构
+type RequestEmailChangeRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email,max=100" example:"new@example.com"`
+	// Password 当前密码，用于确认本人操作
+	Password string `json:"password" binding:"required" example:"Password123"`
+	// 由服务器端在处理器中自动填充
+	IPAddress string `json:"-"`
+}
+
+// ConfirmEmailChangeRequest 确认修改邮箱请求结构（验证码发送至新邮箱）
+type ConfirmEmailChangeRequest struct {
+	VerificationCode string `json:"verification_code" binding:"required,len=6" example:"123456"`
+}
+
+// UndoEmailChangeRequest 撤销邮箱修改请求结构（撤销凭证发送至原邮箱）
+type UndoEmailChangeRequest struct {
+	Token string `json:"token" binding:"required,max=128" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
 // SendResetCodeRequest 发送重置密码验证码请求结构
 type SendResetCodeRequest struct {
 	Email string `json:"email" binding:"required,email" example:"test@example.com"`
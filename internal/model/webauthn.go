@@ -0,0 +1,156 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential 用户注册的通行密钥（WebAuthn 凭证）
+// PublicKey 为 PKIX DER 编码的公钥，Algorithm 为 COSE 算法标识（-7 ES256、-8 EdDSA、-257 RS256）
+type WebAuthnCredential struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CredentialID []byte     `json:"-" gorm:"type:bytea;not null;uniqueIndex"`
+	PublicKey    []byte     `json:"-" gorm:"type:bytea;not null"`
+	Algorithm    int        `json:"-" gorm:"not null"`
+	SignCount    int64      `json:"-" gorm:"not null;default:0"`
+	AAGUID       string     `json:"-" gorm:"size:36"`
+	Transports   string     `json:"-" gorm:"size:100"` // 逗号分隔，如 internal,hybrid
+	Name         string     `json:"name" gorm:"size:100"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// PasskeyResponse 通行密钥列表项
+type PasskeyResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id"` // base64url
+	Transports   []string   `json:"transports,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// 以下选项结构与 WebAuthn Level 3 的 JSON 序列化一致，二进制字段均为无填充的 base64url，
+// 浏览器端可直接交给 PublicKeyCredential.parseCreationOptionsFromJSON / parseRequestOptionsFromJSON
+
+// PublicKeyCredentialRpEntity 依赖方信息
+type PublicKeyCredentialRpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PublicKeyCredentialUserEntity 用户信息，ID 为用户UUID的16字节
+type PublicKeyCredentialUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// PublicKeyCredentialParameters 可接受的公钥算法
+type PublicKeyCredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// PublicKeyCredentialDescriptor 凭证描述
+type PublicKeyCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelectionCriteria 认证器要求
+type AuthenticatorSelectionCriteria struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// PublicKeyCredentialCreationOptions 注册选项
+type PublicKeyCredentialCreationOptions struct {
+	Challenge              string                          `json:"challenge"`
+	RP                     PublicKeyCredentialRpEntity     `json:"rp"`
+	User                   PublicKeyCredentialUserEntity   `json:"user"`
+	PubKeyCredParams       []PublicKeyCredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                           `json:"timeout"`
+	ExcludeCredentials     []PublicKeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelectionCriteria  `json:"authenticatorSelection"`
+	Attestation            string                          `json:"attestation"`
+}
+
+// PublicKeyCredentialRequestOptions 登录选项；AllowCredentials 为空时由认证器选择可发现凭证
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        string                          `json:"challenge"`
+	RPID             string                          `json:"rpId"`
+	AllowCredentials []PublicKeyCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                          `json:"userVerification"`
+	Timeout          int64                           `json:"timeout"`
+}
+
+// PasskeyAttestationResponse 认证器注册响应
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports"`
+}
+
+// PasskeyAttestation navigator.credentials.create() 返回的凭证（PublicKeyCredential.toJSON()）
+type PasskeyAttestation struct {
+	ID       string                     `json:"id" binding:"required"`
+	RawID    string                     `json:"rawId" binding:"required"`
+	Type     string                     `json:"type" binding:"required,eq=public-key"`
+	Response PasskeyAttestationResponse `json:"response" binding:"required"`
+}
+
+// PasskeyRegisterFinishRequest 完成通行密钥注册
+type PasskeyRegisterFinishRequest struct {
+	Name       string             `json:"name" binding:"omitempty,max=100" example:"MacBook Touch ID"`
+	Credential PasskeyAttestation `json:"credential" binding:"required"`
+}
+
+// PasskeyAssertionResponse 认证器登录响应
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// PasskeyAssertion navigator.credentials.get() 返回的凭证（PublicKeyCredential.toJSON()）
+type PasskeyAssertion struct {
+	ID       string                   `json:"id" binding:"required"`
+	RawID    string                   `json:"rawId" binding:"required"`
+	Type     string                   `json:"type" binding:"required,eq=public-key"`
+	Response PasskeyAssertionResponse `json:"response" binding:"required"`
+}
+
+// PasskeyLoginBeginRequest 开始通行密钥登录；不提供用户名时使用可发现凭证
+type PasskeyLoginBeginRequest struct {
+	Username string `json:"username" binding:"omitempty,max=50" example:"testuser"`
+}
+
+// PasskeyLoginBeginResponse 登录挑战，完成登录时需回传 SessionID
+type PasskeyLoginBeginResponse struct {
+	SessionID string                            `json:"session_id"`
+	PublicKey PublicKeyCredentialRequestOptions `json:"public_key"`
+}
+
+// PasskeyLoginFinishRequest 完成通行密钥登录
+type PasskeyLoginFinishRequest struct {
+	SessionID  string           `json:"session_id" binding:"required,uuid"`
+	Credential PasskeyAssertion `json:"credential" binding:"required"`
+	// 设备信息，含义同 LoginRequest；通行密钥登录成功后该设备被标记为受信任
+	DeviceID   string `json:"device_id" binding:"omitempty,len=64,hexadecimal"`
+	DeviceName string `json:"device_name" binding:"omitempty,max=100"`
+	DeviceType string `json:"device_type" binding:"omitempty,oneof=mobile desktop tablet"`
+	// 由服务器端在处理器中自动填充
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
+}
@@ -14,6 +14,8 @@ type BlockListRepository interface {
 	Block(userID, blockedID uuid.UUID) error
 	Unblock(userID, blockedID uuid.UUID) error
 	IsBlocked(userID, blockedID uuid.UUID) (bool, error)
+	// ListBlockersAmong 返回 userIDs 中拉黑了 blockedID 的用户
+	ListBlockersAmong(blockedID uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, error)
 	List(userID uuid.UUID, page, limit int) ([]model.BlockList, int64, error)
 }
 
@@ -52,6 +54,18 @@ func (r *blockListRepository) IsBlocked(userID, blockedID uuid.UUID) (bool, erro
 	return cnt > 0, nil
 }
 
+func (r *blockListRepository) ListBlockersAmong(blockedID uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if len(userIDs) == 0 {
+		return ids, nil
+	}
+	if err := r.db.Model(&model.BlockList{}).Where("blocked_user_id = ? AND user_id IN ?", blockedID, userIDs).
+		Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func (r *blockListRepository) List(userID uuid.UUID, page, limit int) ([]model.BlockList, int64, error) {
 	var list []model.BlockList
 	var total int64
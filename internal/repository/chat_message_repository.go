@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChatMessageRepository 聊天消息仓储
+// 分页使用 (created_at, id) 复合游标，保证同一时间戳下顺序稳定
+// 返回的消息均已填充附件元数据（已删除的文件不返回）
+
+type ChatMessageRepository interface {
+	// Create 写入消息并在同一事务内分配房间序号 seq，msg.Attachments 按顺序写入附件关联
+	Create(msg *model.ChatMessage) error
+	GetByID(id uuid.UUID) (*model.ChatMessage, error)
+	// GetByIDs 批量获取消息，按 (created_at, id) 正序返回，不存在的ID被忽略
+	GetByIDs(ids []uuid.UUID) ([]model.ChatMessage, error)
+	// ListBefore 返回游标之前（更早）的最多 limit 条消息，按时间正序；cursor 为 nil 时返回最新的消息
+	// viewerID 自己删除的消息不返回
+	ListBefore(roomID, viewerID uuid.UUID, cursor *model.ChatMessage, limit int) ([]model.ChatMessage, error)
+	// ListAfter 返回游标之后（更新）的最多 limit 条消息，按时间正序
+	ListAfter(roomID, viewerID uuid.UUID, cursor *model.ChatMessage, limit int) ([]model.ChatMessage, error)
+	// GetLastByRooms 返回每个房间内 viewerID 可见的最后一条消息，key 为房间ID
+	// viewerID 自己删除的消息不计入
+	GetLastByRooms(roomIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID]model.ChatMessage, error)
+	// Edit 在同一事务内记录编辑前内容并更新消息
+	Edit(msg *model.ChatMessage, content string, editedAt time.Time) error
+	// Recall 把消息置为墓碑：清空内容、编辑历史与附件关联，记录撤回时间
+	Recall(msg *model.ChatMessage, recalledAt time.Time) error
+	// Hide 对 userID 隐藏消息（仅对自己删除），重复调用幂等
+	Hide(messageID, userID uuid.UUID) error
+	ListEdits(messageID uuid.UUID) ([]model.ChatMessageEdit, error)
+	// CanAccessAttachment 文件是否作为附件出现在 userID 参与的某个房间的消息中
+	CanAccessAttachment(fileID, userID uuid.UUID) (bool, error)
+	// Search 在 filter.UserID 参与的有效房间内按关键词全文检索消息，按时间倒序分页；命中的 Content 用于生成片段
+	// 已撤回及该用户自己删除的消息不返回
+	Search(filter *model.ChatSearchFilter, page, limit int) ([]model.ChatSearchHit, int64, error)
+}
+
+type chatMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewChatMessageRepository(db *gorm.DB) ChatMessageRepository {
+	return &chatMessageRepository{db: db}
+}
+
+func (r *chatMessageRepository) Create(msg *model.ChatMessage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = time.Now()
+		}
+		// 行锁保证同一房间内 seq 严格递增且不重复，同时记录房间最后活跃时间
+		var seq int64
+		if err := tx.Raw("UPDATE chat_rooms SET last_seq = last_seq + 1, last_message_at = ? WHERE id = ? RETURNING last_seq", msg.CreatedAt, msg.RoomID).
+			Scan(&seq).Error; err != nil {
+			return err
+		}
+		if seq == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		msg.Seq = seq
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if len(msg.Attachments) == 0 {
+			return nil
+		}
+		rows := make([]model.ChatMessageAttachment, 0, len(msg.Attachments))
+		for i, att := range msg.Attachments {
+			rows = append(rows, model.ChatMessageAttachment{MessageID: msg.ID, FileID: att.FileID, Position: i, CreatedAt: msg.CreatedAt})
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (r *chatMessageRepository) GetByID(id uuid.UUID) (*model.ChatMessage, error) {
+	var msg model.ChatMessage
+	if err := r.db.First(&msg, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	list := []model.ChatMessage{msg}
+	if err := r.loadAttachments(list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+func (r *chatMessageRepository) GetByIDs(ids []uuid.UUID) ([]model.ChatMessage, error) {
+	var list []model.ChatMessage
+	if len(ids) == 0 {
+		return list, nil
+	}
+	if err := r.db.Where("id IN ?", ids).Order("created_at ASC, id ASC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	if err := r.loadAttachments(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *chatMessageRepository) ListBefore(roomID, viewerID uuid.UUID, cursor *model.ChatMessage, limit int) ([]model.ChatMessage, error) {
+	var list []model.ChatMessage
+	q := r.visibleTo(roomID, viewerID)
+	if cursor != nil {
+		q = q.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	if err := q.Order("created_at DESC, id DESC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	// 倒序查询后翻转为时间正序
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if err := r.loadAttachments(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *chatMessageRepository) ListAfter(roomID, viewerID uuid.UUID, cursor *model.ChatMessage, limit int) ([]model.ChatMessage, error) {
+	var list []model.ChatMessage
+	q := r.visibleTo(roomID, viewerID)
+	if cursor != nil {
+		q = q.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	if err := q.Order("created_at ASC, id ASC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	if err := r.loadAttachments(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *chatMessageRepository) GetLastByRooms(roomIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID]model.ChatMessage, error) {
+	res := make(map[uuid.UUID]model.ChatMessage, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return res, nil
+	}
+	var list []model.ChatMessage
+	if err := r.db.Raw(`SELECT DISTINCT ON (room_id) * FROM chat_messages m
+		WHERE m.room_id IN ?
+		AND NOT EXISTS (SELECT 1 FROM chat_message_hiddens h WHERE h.message_id = m.id AND h.user_id = ?)
+		ORDER BY m.room_id, m.seq DESC`, roomIDs, viewerID).
+		Scan(&list).Error; err != nil {
+		return nil, err
+	}
+	if err := r.loadAttachments(list); err != nil {
+		return nil, err
+	}
+	for _, m := range list {
+		res[m.RoomID] = m
+	}
+	return res, nil
+}
+
+func (r *chatMessageRepository) Edit(msg *model.ChatMessage, content string, editedAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model.ChatMessageEdit{MessageID: msg.ID, PreviousContent: msg.Content, CreatedAt: editedAt}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.ChatMessage{}).Where("id = ?", msg.ID).
+			Updates(map[string]interface{}{"content": content, "edited_at": editedAt}).Error; err != nil {
+			return err
+		}
+		msg.Content = content
+		msg.EditedAt = &editedAt
+		return nil
+	})
+}
+
+func (r *chatMessageRepository) Recall(msg *model.ChatMessage, recalledAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", msg.ID).Delete(&model.ChatMessageEdit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", msg.ID).Delete(&model.ChatMessageAttachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.ChatMessage{}).Where("id = ?", msg.ID).
+			Updates(map[string]interface{}{"content": "", "recalled_at": recalledAt}).Error; err != nil {
+			return err
+		}
+		msg.Content = ""
+		msg.Attachments = nil
+		msg.RecalledAt = &recalledAt
+		return nil
+	})
+}
+
+func (r *chatMessageRepository) Hide(messageID, userID uuid.UUID) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.ChatMessageHidden{MessageID: messageID, UserID: userID}).Error
+}
+
+func (r *chatMessageRepository) ListEdits(messageID uuid.UUID) ([]model.ChatMessageEdit, error) {
+	var list []model.ChatMessageEdit
+	if err := r.db.Where("message_id = ?", messageID).Order("created_at ASC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *chatMessageRepository) CanAccessAttachment(fileID, userID uuid.UUID) (bool, error) {
+	var ok bool
+	err := r.db.Raw(`SELECT EXISTS (
+		SELECT 1 FROM chat_message_attachments a
+		JOIN chat_messages m ON m.id = a.message_id
+		JOIN chat_rooms cr ON cr.id = m.room_id
+		WHERE a.file_id = ?
+		AND (cr.user_a_id = ? OR cr.user_b_id = ? OR EXISTS (SELECT 1 FROM chat_room_members cm WHERE cm.room_id = cr.id AND cm.user_id = ?))
+	)`, fileID, userID, userID, userID).Scan(&ok).Error
+	return ok, err
+}
+
+func (r *chatMessageRepository) Search(filter *model.ChatSearchFilter, page, limit int) ([]model.ChatSearchHit, int64, error) {
+	hits := make([]model.ChatSearchHit, 0, limit)
+	var total int64
+	uid := filter.UserID
+	q := r.db.Table("chat_messages m").
+		Joins("JOIN chat_rooms cr ON cr.id = m.room_id").
+		Where("cr.status = ?", "active").
+		Where("m.recalled_at IS NULL").
+		Where("(cr.user_a_id = ? OR cr.user_b_id = ? OR EXISTS (SELECT 1 FROM chat_room_members cm WHERE cm.room_id = cr.id AND cm.user_id = ?))", uid, uid, uid).
+		Where("NOT EXISTS (SELECT 1 FROM chat_message_hiddens h WHERE h.message_id = m.id AND h.user_id = ?)", uid)
+	// 由 idx_chat_msg_search 加速，关键词须全部命中
+	q = q.Where("m.search_vector @@ websearch_to_tsquery('simple', ?)", chatSearchQuery(filter.Terms))
+	if filter.PeerID != nil {
+		q = q.Where("cr.type = ? AND (cr.user_a_id = ? OR cr.user_b_id = ?)", model.ChatRoomTypeDirect, *filter.PeerID, *filter.PeerID)
+	}
+	if filter.RoomID != nil {
+		q = q.Where("m.room_id = ?", *filter.RoomID)
+	}
+	if filter.From != nil {
+		q = q.Where("m.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where("m.created_at <= ?", *filter.To)
+	}
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	err := q.Select(`m.id AS message_id, m.room_id, cr.type AS room_type, COALESCE(cr.name, '') AS room_name, m.sender_id, m.seq, m.created_at, m.content`).
+		Order("m.created_at DESC, m.id DESC").Offset(offset).Limit(limit).Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return hits, total, nil
+}
+
+// chatSearchQuery 将关键词转换为 websearch_to_tsquery 的查询串
+// 与 chat_search_text 一致，在中日韩字符两侧插入空格，每个关键词作为带引号的短语，要求各字相邻出现；
+// 去掉关键词中的双引号，避免改变短语边界，短语内的 or、- 等按普通词处理
+func chatSearchQuery(terms []string) string {
+	phrases := make([]string, 0, len(terms))
+	for _, term := range terms {
+		var b strings.Builder
+		for _, r := range term {
+			switch {
+			case r == '"':
+				b.WriteRune(' ')
+			case isCJKSearchRune(r):
+				b.WriteRune(' ')
+				b.WriteRune(r)
+				b.WriteRune(' ')
+			default:
+				b.WriteRune(r)
+			}
+		}
+		if words := strings.Fields(b.String()); len(words) > 0 {
+			phrases = append(phrases, `"`+strings.Join(words, " ")+`"`)
+		}
+	}
+	return strings.Join(phrases, " ")
+}
+
+// isCJKSearchRune 是否为需要逐字切分的字符，范围与迁移中的 chat_search_text 保持一致
+func isCJKSearchRune(r rune) bool {
+	return (r >= 0x3000 && r <= 0x30ff) || (r >= 0x3400 && r <= 0x4dbf) || (r >= 0x4e00 && r <= 0x9fff) ||
+		(r >= 0xac00 && r <= 0xd7af) || (r >= 0xf900 && r <= 0xfaff) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// chatAttachmentRow 附件关联与文件的联表查询结果
+type chatAttachmentRow struct {
+	MessageID uuid.UUID
+	model.File
+}
+
+// loadAttachments 批量填充消息的附件元数据，按消息内顺序排列
+func (r *chatMessageRepository) loadAttachments(list []model.ChatMessage) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(list))
+	for _, m := range list {
+		ids = append(ids, m.ID)
+	}
+	var rows []chatAttachmentRow
+	if err := r.db.Raw(`SELECT a.message_id, f.* FROM chat_message_attachments a
+		JOIN files f ON f.id = a.file_id AND f.deleted_at IS NULL
+		WHERE a.message_id IN ? ORDER BY a.message_id, a.position`, ids).Scan(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	byMsg := make(map[uuid.UUID][]model.ChatAttachment, len(rows))
+	for i := range rows {
+		byMsg[rows[i].MessageID] = append(byMsg[rows[i].MessageID], rows[i].File.ToChatAttachment())
+	}
+	for i := range list {
+		list[i].Attachments = byMsg[list[i].ID]
+	}
+	return nil
+}
+
+// visibleTo 房间内未被 viewerID 删除的消息
+func (r *chatMessageRepository) visibleTo(roomID, viewerID uuid.UUID) *gorm.DB {
+	return r.db.Where("room_id = ?", roomID).
+		Where("NOT EXISTS (SELECT 1 FROM chat_message_hiddens h WHERE h.message_id = chat_messages.id AND h.user_id = ?)", viewerID)
+}
@@ -0,0 +1,28 @@
+package repository
+
+import "testing"
+
+func TestChatSearchQuery(t *testing.T) {
+	cases := []struct {
+		name  string
+		terms []string
+		want  string
+	}{
+		{"中文逐字切分为短语", []string{"火锅"}, `"火 锅"`},
+		{"单字", []string{"火"}, `"火"`},
+		{"英文整词", []string{"Review"}, `"Review"`},
+		{"中英混排", []string{"Go语言"}, `"Go 语 言"`},
+		{"全角标点单独切分", []string{"你好，世界"}, `"你 好 ， 世 界"`},
+		{"日文假名与韩文", []string{"カレー", "한국"}, `"カ レ ー" "한 국"`},
+		{"多个关键词须全部命中", []string{"周末", "聚餐"}, `"周 末" "聚 餐"`},
+		{"双引号与运算符按普通字符处理", []string{`"a`, "-b", "or"}, `"a" "-b" "or"`},
+		{"只有双引号的关键词被忽略", []string{`""`, "x"}, `"x"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := chatSearchQuery(tc.terms); got != tc.want {
+				t.Errorf("chatSearchQuery(%q) = %s，期望 %s", tc.terms, got, tc.want)
+			}
+		})
+	}
+}
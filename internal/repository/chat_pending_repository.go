@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// chatPendingTTL 未确认消息队列的保留时间，超过后由历史接口兜底
+const chatPendingTTL = 7 * 24 * time.Hour
+
+// ChatPendingRepository 每个用户的未确认（未送达）消息队列
+// 使用 Redis 有序集合，member 为消息ID，score 为消息创建时间，保证按时间顺序补发
+type ChatPendingRepository interface {
+	// Add 将消息加入用户的未确认队列
+	Add(ctx context.Context, userID, messageID uuid.UUID, createdAt time.Time) error
+	// Ack 从用户的未确认队列中移除消息
+	Ack(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) error
+	// List 按时间顺序返回最多 limit 条未确认消息ID
+	List(ctx context.Context, userID uuid.UUID, limit int64) ([]uuid.UUID, error)
+}
+
+// redisChatPendingRepository Redis 未确认消息队列实现
+type redisChatPendingRepository struct {
+	rdb *redis.Client
+}
+
+// NewChatPendingRepository 创建未确认消息队列仓储实例
+func NewChatPendingRepository(rdb *redis.Client) ChatPendingRepository {
+	return &redisChatPendingRepository{rdb: rdb}
+}
+
+// Add 将消息加入用户的未确认队列，并刷新队列过期时间
+func (r *redisChatPendingRepository) Add(ctx context.Context, userID, messageID uuid.UUID, createdAt time.Time) error {
+	key := r.getRedisKey(userID)
+	pipe := r.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(createdAt.UnixMilli()), Member: messageID.String()})
+	pipe.Expire(ctx, key, chatPendingTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("无法写入未确认消息队列: %w", err)
+	}
+	return nil
+}
+
+// Ack 从用户的未确认队列中移除消息
+func (r *redisChatPendingRepository) Ack(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		members = append(members, id.String())
+	}
+	if err := r.rdb.ZRem(ctx, r.getRedisKey(userID), members...).Err(); err != nil {
+		return fmt.Errorf("无法确认消息: %w", err)
+	}
+	return nil
+}
+
+// List 按时间顺序返回最多 limit 条未确认消息ID
+func (r *redisChatPendingRepository) List(ctx context.Context, userID uuid.UUID, limit int64) ([]uuid.UUID, error) {
+	members, err := r.rdb.ZRange(ctx, r.getRedisKey(userID), 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("无法读取未确认消息队列: %w", err)
+	}
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, m := range members {
+		id, err := uuid.Parse(m)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// getRedisKey 生成用户未确认消息队列的键
+func (r *redisChatPendingRepository) getRedisKey(userID uuid.UUID) string {
+	return fmt.Sprintf("chat:pending:%s", userID.String())
+}
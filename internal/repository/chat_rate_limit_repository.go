@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript 原子地补充并消耗一个令牌
+// KEYS[1] 桶；ARGV: 每秒补充速率、桶容量、当前毫秒时间戳
+// 返回 {是否允许, 需等待的毫秒数}
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+-- 以定点小数保存，tostring 可能产生 1e-05 这类科学计数法，部分 Lua 实现的 tonumber 无法解析
+redis.call('HSET', KEYS[1], 'tokens', string.format('%.6f', tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
+`)
+
+// ChatRateLimitRepository 聊天令牌桶限流与违规计数
+type ChatRateLimitRepository interface {
+	// Take 从 scope/id 对应的令牌桶中取一个令牌；不足时返回需等待的时长
+	Take(ctx context.Context, scope, id string, ratePerSecond float64, burst int) (bool, time.Duration, error)
+	// IncrViolation 累加用户在窗口期内的超限次数，返回累加后的值
+	IncrViolation(ctx context.Context, userID string, window time.Duration) (int64, error)
+}
+
+// redisChatRateLimitRepository Redis 聊天限流实现
+type redisChatRateLimitRepository struct {
+	rdb *redis.Client
+}
+
+// NewChatRateLimitRepository 创建聊天限流仓储实例
+func NewChatRateLimitRepository(rdb *redis.Client) ChatRateLimitRepository {
+	return &redisChatRateLimitRepository{rdb: rdb}
+}
+
+// Take 执行令牌桶脚本；多实例共享同一个桶
+func (r *redisChatRateLimitRepository) Take(ctx context.Context, scope, id string, ratePerSecond float64, burst int) (bool, time.Duration, error) {
+	res, err := tokenBucketScript.Run(ctx, r.rdb, []string{r.getRedisKey(scope, id)},
+		ratePerSecond, burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("无法执行令牌桶脚本: %w", err)
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("令牌桶脚本返回值无效")
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// IncrViolation 首次违规时设置窗口过期时间
+func (r *redisChatRateLimitRepository) IncrViolation(ctx context.Context, userID string, window time.Duration) (int64, error) {
+	key := r.getRedisKey("violations", userID)
+	pipe := r.rdb.Pipeline()
+	result := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("无法执行Redis pipeline进行违规计数: %w", err)
+	}
+	count, err := result.Result()
+	if err != nil {
+		return 0, fmt.Errorf("无法获取INCR命令结果: %w", err)
+	}
+	return count, nil
+}
+
+// getRedisKey 生成限流键，如 chat:ratelimit:user:<用户ID>、chat:ratelimit:room:<房间ID>:<用户ID>
+func (r *redisChatRateLimitRepository) getRedisKey(scope, id string) string {
+	return fmt.Sprintf("chat:ratelimit:%s:%s", scope, id)
+}
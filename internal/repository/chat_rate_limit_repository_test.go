@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurstThenWait(t *testing.T) {
+	ctx := context.Background()
+	repo := NewChatRateLimitRepository(newTestRedis(t))
+
+	for i := 0; i < 3; i++ {
+		ok, wait, err := repo.Take(ctx, "user", "u1", 1, 3)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		if !ok || wait != 0 {
+			t.Fatalf("第 %d 个令牌 ok=%v wait=%v，容量内应放行", i+1, ok, wait)
+		}
+	}
+	ok, wait, err := repo.Take(ctx, "user", "u1", 1, 3)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	// 每秒补充 1 个令牌，耗尽后至多等待 1 秒
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("耗尽后 ok=%v wait=%v", ok, wait)
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	ctx := context.Background()
+	repo := NewChatRateLimitRepository(newTestRedis(t))
+
+	if ok, _, _ := repo.Take(ctx, "user", "u1", 20, 1); !ok {
+		t.Fatal("首个令牌应放行")
+	}
+	if ok, _, _ := repo.Take(ctx, "user", "u1", 20, 1); ok {
+		t.Fatal("容量为 1 时第二个令牌应被拒绝")
+	}
+	// 每秒 20 个，100ms 后至少补充 1 个
+	time.Sleep(100 * time.Millisecond)
+	if ok, wait, err := repo.Take(ctx, "user", "u1", 20, 1); err != nil || !ok {
+		t.Fatalf("补充后 ok=%v wait=%v err=%v", ok, wait, err)
+	}
+}
+
+func TestTokenBucketStaysDrainedAtSlowRate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewChatRateLimitRepository(newTestRedis(t))
+
+	if ok, _, _ := repo.Take(ctx, "user", "u1", 0.01, 1); !ok {
+		t.Fatal("首个令牌应放行")
+	}
+	// 补充速率很低时桶内是极小的小数，持续请求不应被当作空桶重新装满
+	for i := 0; i < 5; i++ {
+		if ok, _, err := repo.Take(ctx, "user", "u1", 0.01, 1); err != nil || ok {
+			t.Fatalf("第 %d 次重试 ok=%v err=%v，令牌尚未补充", i+1, ok, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestTokenBucketKeysAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	repo := NewChatRateLimitRepository(newTestRedis(t))
+
+	if ok, _, _ := repo.Take(ctx, "room", "r1:u1", 1, 1); !ok {
+		t.Fatal("首个令牌应放行")
+	}
+	if ok, _, _ := repo.Take(ctx, "room", "r1:u1", 1, 1); ok {
+		t.Fatal("同一个桶应已耗尽")
+	}
+	for _, id := range []string{"r1:u2", "r2:u1"} {
+		if ok, _, _ := repo.Take(ctx, "room", id, 1, 1); !ok {
+			t.Fatalf("桶 %s 不应受其他桶影响", id)
+		}
+	}
+	if ok, _, _ := repo.Take(ctx, "user", "r1:u1", 1, 1); !ok {
+		t.Fatal("不同 scope 的桶应相互独立")
+	}
+}
+
+func TestIncrViolationWindow(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewChatRateLimitRepository(rdb)
+
+	for want := int64(1); want <= 3; want++ {
+		count, err := repo.IncrViolation(ctx, "u1", time.Minute)
+		if err != nil {
+			t.Fatalf("IncrViolation: %v", err)
+		}
+		if count != want {
+			t.Fatalf("count = %d，期望 %d", count, want)
+		}
+	}
+	// 窗口从首次违规开始计算，后续违规不延长
+	mr.FastForward(30 * time.Second)
+	if _, err := repo.IncrViolation(ctx, "u1", time.Minute); err != nil {
+		t.Fatalf("IncrViolation: %v", err)
+	}
+	mr.FastForward(31 * time.Second)
+	count, err := repo.IncrViolation(ctx, "u1", time.Minute)
+	if err != nil {
+		t.Fatalf("IncrViolation: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("窗口过期后 count = %d，期望重新从 1 计数", count)
+	}
+}
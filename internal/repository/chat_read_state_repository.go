@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChatReadStateRepository 房间已读位置仓储
+// 已读位置只前进：写入的 seq 不大于已有值时视为无变化
+
+type ChatReadStateRepository interface {
+	// MarkRead 把用户在房间内的已读位置推进到指定消息，返回是否发生了变化
+	MarkRead(roomID, userID, messageID uuid.UUID, seq int64) (bool, error)
+	// Get 获取用户在房间内的已读位置，不存在时返回 gorm.ErrRecordNotFound
+	Get(roomID, userID uuid.UUID) (*model.ChatReadState, error)
+	// ListByUser 批量获取用户在多个房间内的已读位置，key 为房间ID
+	ListByUser(userID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]model.ChatReadState, error)
+	// CountUnread 统计用户在多个房间内的未读消息数（不含自己发送的及自己删除的），key 为房间ID
+	CountUnread(userID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]int64, error)
+}
+
+type chatReadStateRepository struct {
+	db *gorm.DB
+}
+
+func NewChatReadStateRepository(db *gorm.DB) ChatReadStateRepository {
+	return &chatReadStateRepository{db: db}
+}
+
+func (r *chatReadStateRepository) MarkRead(roomID, userID, messageID uuid.UUID, seq int64) (bool, error) {
+	state := model.ChatReadState{
+		RoomID:            roomID,
+		UserID:            userID,
+		LastReadMessageID: &messageID,
+		LastReadSeq:       seq,
+		UpdatedAt:         time.Now(),
+	}
+	res := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "last_read_seq", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "chat_read_states.last_read_seq < EXCLUDED.last_read_seq"}}},
+	}).Create(&state)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (r *chatReadStateRepository) Get(roomID, userID uuid.UUID) (*model.ChatReadState, error) {
+	var state model.ChatReadState
+	if err := r.db.First(&state, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *chatReadStateRepository) ListByUser(userID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]model.ChatReadState, error) {
+	res := make(map[uuid.UUID]model.ChatReadState, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return res, nil
+	}
+	var list []model.ChatReadState
+	if err := r.db.Where("user_id = ? AND room_id IN ?", userID, roomIDs).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range list {
+		res[s.RoomID] = s
+	}
+	return res, nil
+}
+
+func (r *chatReadStateRepository) CountUnread(userID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]int64, error) {
+	res := make(map[uuid.UUID]int64, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return res, nil
+	}
+	var rows []struct {
+		RoomID uuid.UUID
+		Cnt    int64
+	}
+	if err := r.db.Raw(`SELECT m.room_id, COUNT(*) AS cnt
+		FROM chat_messages m
+		LEFT JOIN chat_read_states s ON s.room_id = m.room_id AND s.user_id = ?
+		WHERE m.room_id IN ? AND m.sender_id <> ? AND m.seq > COALESCE(s.last_read_seq, 0)
+		AND NOT EXISTS (SELECT 1 FROM chat_message_hiddens h WHERE h.message_id = m.id AND h.user_id = ?)
+		GROUP BY m.room_id`, userID, roomIDs, userID, userID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[row.RoomID] = row.Cnt
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"backend/internal/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChatRoomMemberRepository 群聊成员仓储
+
+type ChatRoomMemberRepository interface {
+	Get(roomID, userID uuid.UUID) (*model.ChatRoomMember, error)
+	List(roomID uuid.UUID) ([]model.ChatRoomMember, error)
+	ListUserIDs(roomID uuid.UUID) ([]uuid.UUID, error)
+	Count(roomID uuid.UUID) (int64, error)
+	// AddMembers 批量加入成员，已是成员的忽略
+	AddMembers(members []model.ChatRoomMember) error
+	Remove(roomID, userID uuid.UUID) error
+	UpdateRole(roomID, userID uuid.UUID, role model.ChatMemberRole) error
+	// TransferOwner 在同一事务内把群主转让给 toID，原群主降为管理员
+	TransferOwner(roomID, fromID, toID uuid.UUID) error
+}
+
+type chatRoomMemberRepository struct {
+	db *gorm.DB
+}
+
+func NewChatRoomMemberRepository(db *gorm.DB) ChatRoomMemberRepository {
+	return &chatRoomMemberRepository{db: db}
+}
+
+func (r *chatRoomMemberRepository) Get(roomID, userID uuid.UUID) (*model.ChatRoomMember, error) {
+	var m model.ChatRoomMember
+	if err := r.db.First(&m, "room_id = ? AND user_id = ?", roomID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *chatRoomMemberRepository) List(roomID uuid.UUID) ([]model.ChatRoomMember, error) {
+	var list []model.ChatRoomMember
+	if err := r.db.Where("room_id = ?", roomID).Order("created_at ASC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *chatRoomMemberRepository) ListUserIDs(roomID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.Model(&model.ChatRoomMember{}).Where("room_id = ?", roomID).Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *chatRoomMemberRepository) Count(roomID uuid.UUID) (int64, error) {
+	var cnt int64
+	if err := r.db.Model(&model.ChatRoomMember{}).Where("room_id = ?", roomID).Count(&cnt).Error; err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
+func (r *chatRoomMemberRepository) AddMembers(members []model.ChatRoomMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+func (r *chatRoomMemberRepository) Remove(roomID, userID uuid.UUID) error {
+	return r.db.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&model.ChatRoomMember{}).Error
+}
+
+func (r *chatRoomMemberRepository) UpdateRole(roomID, userID uuid.UUID, role model.ChatMemberRole) error {
+	return r.db.Model(&model.ChatRoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("role", role).Error
+}
+
+func (r *chatRoomMemberRepository) TransferOwner(roomID, fromID, toID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.ChatRoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, fromID).
+			Update("role", model.ChatMemberAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.ChatRoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, toID).
+			Update("role", model.ChatMemberOwner).Error
+	})
+}
@@ -7,13 +7,18 @@ import (
 	"gorm.io/gorm"
 )
 
-// ChatRoomRepository 一对一聊天房间仓储
-// 房间参与者严格两个，使用 (user_a_id, user_b_id) 按字典序唯一
+// ChatRoomRepository 聊天房间仓储
+// 一对一房间参与者严格两个，使用 (user_a_id, user_b_id) 按字典序唯一；群聊房间成员见 ChatRoomMemberRepository
 
 type ChatRoomRepository interface {
 	GetByID(id uuid.UUID) (*model.ChatRoom, error)
 	GetOrCreateByUsers(a, b uuid.UUID) (*model.ChatRoom, error)
 	DeactivateByUsers(a, b uuid.UUID) error
+	// CreateGroup 在同一事务内创建群聊房间及初始成员
+	CreateGroup(room *model.ChatRoom, members []model.ChatRoomMember) error
+	UpdateStatus(id uuid.UUID, status string) error
+	// ListByUser 分页列出用户参与的房间（一对一及所在群聊），按最后消息时间倒序（无消息时按创建时间）
+	ListByUser(userID uuid.UUID, page, limit int) ([]model.ChatRoom, int64, error)
 }
 
 type chatRoomRepository struct {
@@ -38,9 +43,9 @@ func (r *chatRoomRepository) GetByID(id uuid.UUID) (*model.ChatRoom, error) {
 func (r *chatRoomRepository) GetOrCreateByUsers(a, b uuid.UUID) (*model.ChatRoom, error) {
 	a1, b1 := orderPair(a, b)
 	var room model.ChatRoom
-	if err := r.db.Where("user_a_id = ? AND user_b_id = ?", a1, b1).First(&room).Error; err != nil {
+	if err := r.db.Where("type = ? AND user_a_id = ? AND user_b_id = ?", model.ChatRoomTypeDirect, a1, b1).First(&room).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			room = model.ChatRoom{UserAID: a1, UserBID: b1, Status: "active"}
+			room = model.ChatRoom{Type: model.ChatRoomTypeDirect, UserAID: a1, UserBID: b1, Status: "active"}
 			if err := r.db.Create(&room).Error; err != nil { return nil, err }
 			return &room, nil
 		}
@@ -59,6 +64,38 @@ func (r *chatRoomRepository) GetOrCreateByUsers(a, b uuid.UUID) (*model.ChatRoom
 func (r *chatRoomRepository) DeactivateByUsers(a, b uuid.UUID) error {
 	a1, b1 := orderPair(a, b)
 	return r.db.Model(&model.ChatRoom{}).
-		Where("user_a_id = ? AND user_b_id = ?", a1, b1).
+		Where("type = ? AND user_a_id = ? AND user_b_id = ?", model.ChatRoomTypeDirect, a1, b1).
 		Update("status", "inactive").Error
 }
+
+func (r *chatRoomRepository) CreateGroup(room *model.ChatRoom, members []model.ChatRoomMember) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(room).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].RoomID = room.ID
+		}
+		return tx.Create(&members).Error
+	})
+}
+
+func (r *chatRoomRepository) UpdateStatus(id uuid.UUID, status string) error {
+	return r.db.Model(&model.ChatRoom{}).Where("id = ?", id).Update("status", status).Error
+}
+
+func (r *chatRoomRepository) ListByUser(userID uuid.UUID, page, limit int) ([]model.ChatRoom, int64, error) {
+	var list []model.ChatRoom
+	var total int64
+	q := r.db.Model(&model.ChatRoom{}).Where(
+		"user_a_id = ? OR user_b_id = ? OR id IN (SELECT room_id FROM chat_room_members WHERE user_id = ?)",
+		userID, userID, userID)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * limit
+	if err := q.Order("COALESCE(last_message_at, created_at) DESC, id DESC").Offset(offset).Limit(limit).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
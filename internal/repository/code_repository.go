@@ -8,11 +8,43 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// CodePurpose 验证码用途，不同用途的键互相隔离，一种用途的验证码不能用于另一种用途
+type CodePurpose string
+
+const (
+	CodePurposeRegister         CodePurpose = "register"
+	CodePurposeActivate         CodePurpose = "activate"
+	CodePurposeResetPassword    CodePurpose = "reset_password"
+	CodePurposeEmailChange      CodePurpose = "email_change"
+	CodePurposeEmailChangeUndo  CodePurpose = "email_change_undo"
+	CodePurposeWebAuthnRegister CodePurpose = "webauthn_register"
+	CodePurposeWebAuthnLogin    CodePurpose = "webauthn_login"
+)
+
+// recordCodeFailureScript 累加验证码的错误次数，计数与验证码同时过期；验证码不存在时不计数并返回0
+// KEYS[1] 验证码，KEYS[2] 错误次数
+var recordCodeFailureScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -2 then
+	return 0
+end
+local failures = redis.call('INCR', KEYS[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return failures
+`)
+
 // CodeRepository 验证码缓存接口
+// key 为该用途下的标识，如邮箱、用户ID或会话ID
 type CodeRepository interface {
-	Set(ctx context.Context, email, code string, expiration time.Duration) error
-	Get(ctx context.Context, email string) (string, error)
-	Delete(ctx context.Context, email string) error
+	Set(ctx context.Context, purpose CodePurpose, key, code string, expiration time.Duration) error
+	Get(ctx context.Context, purpose CodePurpose, key string) (string, error)
+	Delete(ctx context.Context, purpose CodePurpose, key string) error
+	// Consume 原子地取出并删除验证码，保证一次性的挑战只能被一个请求使用；不存在或已过期时返回空字符串
+	Consume(ctx context.Context, purpose CodePurpose, key string) (string, error)
+	// RecordFailure 累加一次验证码错误并返回累计次数；Set 与 Delete 会清零该计数
+	RecordFailure(ctx context.Context, purpose CodePurpose, key string) (int64, error)
 }
 
 // redisCodeRepository Redis验证码缓存实现
@@ -25,10 +57,13 @@ func NewCodeRepository(rdb *redis.Client) CodeRepository {
 	return &redisCodeRepository{rdb: rdb}
 }
 
-// Set 将验证码存入Redis
-func (r *redisCodeRepository) Set(ctx context.Context, email, code string, expiration time.Duration) error {
-	key := r.getRedisKey(email)
-	err := r.rdb.Set(ctx, key, code, expiration).Err()
+// Set 将验证码存入Redis，新的验证码重新计算错误次数
+func (r *redisCodeRepository) Set(ctx context.Context, purpose CodePurpose, key, code string, expiration time.Duration) error {
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, r.getRedisKey(purpose, key), code, expiration)
+		pipe.Del(ctx, r.getFailuresKey(purpose, key))
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("无法将验证码存入Redis: %w", err)
 	}
@@ -36,9 +71,8 @@ func (r *redisCodeRepository) Set(ctx context.Context, email, code string, expir
 }
 
 // Get 从Redis获取验证码
-func (r *redisCodeRepository) Get(ctx context.Context, email string) (string, error) {
-	key := r.getRedisKey(email)
-	code, err := r.rdb.Get(ctx, key).Result()
+func (r *redisCodeRepository) Get(ctx context.Context, purpose CodePurpose, key string) (string, error) {
+	code, err := r.rdb.Get(ctx, r.getRedisKey(purpose, key)).Result()
 	if err == redis.Nil {
 		return "", nil // 验证码不存在或已过期
 	}
@@ -48,17 +82,42 @@ func (r *redisCodeRepository) Get(ctx context.Context, email string) (string, er
 	return code, nil
 }
 
-// Delete 从Redis删除验证码
-func (r *redisCodeRepository) Delete(ctx context.Context, email string) error {
-	key := r.getRedisKey(email)
-	err := r.rdb.Del(ctx, key).Err()
+// Delete 从Redis删除验证码及其错误次数
+func (r *redisCodeRepository) Delete(ctx context.Context, purpose CodePurpose, key string) error {
+	err := r.rdb.Del(ctx, r.getRedisKey(purpose, key), r.getFailuresKey(purpose, key)).Err()
 	if err != nil {
 		return fmt.Errorf("无法从Redis删除验证码: %w", err)
 	}
 	return nil
 }
 
-// getRedisKey 生成验证码在Redis中的键
-func (r *redisCodeRepository) getRedisKey(email string) string {
-	return fmt.Sprintf("verification_code:%s", email)
-} 
\ No newline at end of file
+// Consume 使用 GETDEL，读取与删除之间不会被并发请求插入
+func (r *redisCodeRepository) Consume(ctx context.Context, purpose CodePurpose, key string) (string, error) {
+	code, err := r.rdb.GetDel(ctx, r.getRedisKey(purpose, key)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("无法从Redis取出验证码: %w", err)
+	}
+	return code, nil
+}
+
+func (r *redisCodeRepository) RecordFailure(ctx context.Context, purpose CodePurpose, key string) (int64, error) {
+	failures, err := recordCodeFailureScript.Run(ctx, r.rdb,
+		[]string{r.getRedisKey(purpose, key), r.getFailuresKey(purpose, key)}).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("无法记录验证码错误次数: %w", err)
+	}
+	return failures, nil
+}
+
+// getRedisKey 生成验证码在Redis中的键，如 verification_code:register:<email>
+func (r *redisCodeRepository) getRedisKey(purpose CodePurpose, key string) string {
+	return fmt.Sprintf("verification_code:%s:%s", purpose, key)
+}
+
+// getFailuresKey 生成验证码错误次数的键，如 verification_code_failures:email_change:<用户ID>
+func (r *redisCodeRepository) getFailuresKey(purpose CodePurpose, key string) string {
+	return fmt.Sprintf("verification_code_failures:%s:%s", purpose, key)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCodeConsumeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	repo := NewCodeRepository(newTestRedis(t))
+	if err := repo.Set(ctx, CodePurposeWebAuthnLogin, "session", "challenge", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	var got atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := repo.Consume(ctx, CodePurposeWebAuthnLogin, "session")
+			if err != nil {
+				t.Errorf("Consume: %v", err)
+			}
+			if code == "challenge" {
+				got.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got.Load() != 1 {
+		t.Fatalf("%d 个调用方取到了同一个验证码", got.Load())
+	}
+	if code, err := repo.Get(ctx, CodePurposeWebAuthnLogin, "session"); err != nil || code != "" {
+		t.Fatalf("取出后仍可读取: %q err=%v", code, err)
+	}
+}
+
+func TestCodeConsumeIsolatesPurposes(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewCodeRepository(rdb)
+	if err := repo.Set(ctx, CodePurposeWebAuthnRegister, "user", "challenge", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if code, _ := repo.Consume(ctx, CodePurposeWebAuthnLogin, "user"); code != "" {
+		t.Fatal("不同用途的验证码不应被取出")
+	}
+	mr.FastForward(2 * time.Minute)
+	if code, err := repo.Consume(ctx, CodePurposeWebAuthnRegister, "user"); err != nil || code != "" {
+		t.Fatalf("过期后 Consume = %q err=%v", code, err)
+	}
+}
+
+func TestCodeRecordFailure(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewCodeRepository(rdb)
+
+	// 验证码不存在时不计数
+	if n, err := repo.RecordFailure(ctx, CodePurposeEmailChange, "user"); err != nil || n != 0 {
+		t.Fatalf("无验证码时 RecordFailure = %d, %v", n, err)
+	}
+	if err := repo.Set(ctx, CodePurposeEmailChange, "user", "123456", 5*time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	for want := int64(1); want <= 3; want++ {
+		if n, err := repo.RecordFailure(ctx, CodePurposeEmailChange, "user"); err != nil || n != want {
+			t.Fatalf("RecordFailure = %d, %v，期望 %d", n, err, want)
+		}
+	}
+	// 计数与验证码同时过期
+	if ttl := mr.TTL("verification_code_failures:email_change:user"); ttl != 5*time.Minute {
+		t.Fatalf("错误次数 TTL = %v", ttl)
+	}
+
+	// 重新发送验证码后重新计数
+	if err := repo.Set(ctx, CodePurposeEmailChange, "user", "654321", 5*time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if n, _ := repo.RecordFailure(ctx, CodePurposeEmailChange, "user"); n != 1 {
+		t.Fatalf("重新发送后 RecordFailure = %d", n)
+	}
+
+	// 删除验证码同时清除计数
+	if err := repo.Delete(ctx, CodePurposeEmailChange, "user"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if mr.Exists("verification_code_failures:email_change:user") {
+		t.Fatal("删除验证码后错误次数仍存在")
+	}
+
+	// 不同用途分别计数
+	_ = repo.Set(ctx, CodePurposeEmailChange, "user", "111111", time.Minute)
+	_ = repo.Set(ctx, CodePurposeResetPassword, "user", "222222", time.Minute)
+	_, _ = repo.RecordFailure(ctx, CodePurposeEmailChange, "user")
+	if n, _ := repo.RecordFailure(ctx, CodePurposeResetPassword, "user"); n != 1 {
+		t.Fatalf("其他用途的错误次数 = %d", n)
+	}
+}
@@ -15,6 +15,7 @@ import (
  type DeviceRepository interface {
 	// ---- UserDevice ----
 	GetDeviceByUserAndFingerprint(userID uuid.UUID, deviceID string) (*model.UserDevice, error)
+	GetDeviceByID(id uuid.UUID) (*model.UserDevice, error)
 	CreateDevice(device *model.UserDevice) error
 	UpdateDevice(device *model.UserDevice) error
 	ListDevicesByUser(userID uuid.UUID) ([]*model.UserDevice, error)
@@ -47,6 +48,15 @@ func (r *deviceRepository) GetDeviceByUserAndFingerprint(userID uuid.UUID, devic
 	return &d, nil
 }
 
+// GetDeviceByID 根据主键查询设备
+func (r *deviceRepository) GetDeviceByID(id uuid.UUID) (*model.UserDevice, error) {
+	var d model.UserDevice
+	if err := r.db.Where("id = ?", id).First(&d).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
 // CreateDevice 创建设备
 func (r *deviceRepository) CreateDevice(device *model.UserDevice) error {
     // 处理软删除与唯一索引 (user_id, device_id) 冲突：
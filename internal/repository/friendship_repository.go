@@ -18,6 +18,8 @@ type FriendshipRepository interface {
 	DeletePairTx(tx *gorm.DB, userID, friendID uuid.UUID) error
 	DeletePair(userID, friendID uuid.UUID) error
 	List(userID uuid.UUID, search string, page, limit int) ([]model.Friendship, int64, error)
+	// ListFriendIDs 返回用户的全部好友ID
+	ListFriendIDs(userID uuid.UUID) ([]uuid.UUID, error)
 	CountByUser(userID uuid.UUID) (int64, error)
 	Exists(userID, friendID uuid.UUID) (bool, error)
 	UpdateRemark(userID, friendID uuid.UUID, remark string) error
@@ -81,6 +83,14 @@ func (r *friendshipRepository) List(userID uuid.UUID, search string, page, limit
 	return list, total, nil
 }
 
+func (r *friendshipRepository) ListFriendIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := r.db.Model(&model.Friendship{}).Where("user_id = ?", userID).Pluck("friend_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func (r *friendshipRepository) CountByUser(userID uuid.UUID) (int64, error) {
 	var cnt int64
 	if err := r.db.Model(&model.Friendship{}).Where("user_id = ?", userID).Count(&cnt).Error; err != nil {
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 失败登录计数的维度
+const (
+	LoginAttemptScopeAccount = "account"
+	LoginAttemptScopeIP      = "ip"
+)
+
+// recordLoginFailureScript 原子地累加失败次数，达到锁定阈值且当前未锁定时写入锁定截止时间
+// KEYS[1] 计数；ARGV: 当前毫秒时间戳、计数窗口毫秒、锁定阈值（<=0 不锁定）、锁定毫秒
+// 返回 {失败次数, 锁定截止毫秒时间戳, 是否因本次失败而锁定}
+var recordLoginFailureScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local lockAfter = tonumber(ARGV[3])
+local lockedUntil = tonumber(redis.call('HGET', KEYS[1], 'locked_until') or '0')
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+redis.call('HSET', KEYS[1], 'last_failure_at', now)
+local locked = 0
+if lockAfter > 0 and failures >= lockAfter and lockedUntil <= now then
+	lockedUntil = now + tonumber(ARGV[4])
+	redis.call('HSET', KEYS[1], 'locked_until', lockedUntil)
+	locked = 1
+end
+redis.call('PEXPIRE', KEYS[1], math.max(tonumber(ARGV[2]), lockedUntil - now))
+return {failures, lockedUntil, locked}
+`)
+
+// LoginAttemptState 账户或来源IP的失败登录状态
+type LoginAttemptState struct {
+	Failures      int64
+	LastFailureAt time.Time
+	// LockedUntil 锁定截止时间，零值或早于当前时间表示未锁定
+	LockedUntil time.Time
+}
+
+// LoginAttemptRepository 失败登录计数仓储接口
+// 每个账户或IP保存为一个 Hash，距最近一次失败超过计数窗口（且不在锁定期内）后自动过期
+type LoginAttemptRepository interface {
+	// Get 获取失败登录状态，没有记录时返回零值状态
+	Get(ctx context.Context, scope, id string) (*LoginAttemptState, error)
+	// RecordFailure 累加一次失败；次数达到 lockAfter 且当前未锁定时锁定 lockDuration，返回最新状态与是否因本次失败而锁定
+	RecordFailure(ctx context.Context, scope, id string, window time.Duration, lockAfter int, lockDuration time.Duration) (*LoginAttemptState, bool, error)
+	// Clear 清除失败次数与锁定
+	Clear(ctx context.Context, scope, id string) error
+}
+
+// redisLoginAttemptRepository Redis失败登录计数实现
+type redisLoginAttemptRepository struct {
+	rdb *redis.Client
+}
+
+// NewLoginAttemptRepository 创建失败登录计数仓储实例
+func NewLoginAttemptRepository(rdb *redis.Client) LoginAttemptRepository {
+	return &redisLoginAttemptRepository{rdb: rdb}
+}
+
+func (r *redisLoginAttemptRepository) Get(ctx context.Context, scope, id string) (*LoginAttemptState, error) {
+	fields, err := r.rdb.HGetAll(ctx, r.getRedisKey(scope, id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取失败登录计数: %w", err)
+	}
+	failures, _ := strconv.ParseInt(fields["failures"], 10, 64)
+	return &LoginAttemptState{
+		Failures:      failures,
+		LastFailureAt: parseMillis(fields["last_failure_at"]),
+		LockedUntil:   parseMillis(fields["locked_until"]),
+	}, nil
+}
+
+func (r *redisLoginAttemptRepository) RecordFailure(ctx context.Context, scope, id string, window time.Duration, lockAfter int, lockDuration time.Duration) (*LoginAttemptState, bool, error) {
+	now := time.Now()
+	res, err := recordLoginFailureScript.Run(ctx, r.rdb, []string{r.getRedisKey(scope, id)},
+		now.UnixMilli(), window.Milliseconds(), lockAfter, lockDuration.Milliseconds()).Int64Slice()
+	if err != nil {
+		return nil, false, fmt.Errorf("无法记录失败登录: %w", err)
+	}
+	if len(res) != 3 {
+		return nil, false, fmt.Errorf("失败登录计数脚本返回值无效")
+	}
+	state := &LoginAttemptState{Failures: res[0], LastFailureAt: now}
+	if res[1] > 0 {
+		state.LockedUntil = time.UnixMilli(res[1])
+	}
+	return state, res[2] == 1, nil
+}
+
+func (r *redisLoginAttemptRepository) Clear(ctx context.Context, scope, id string) error {
+	if err := r.rdb.Del(ctx, r.getRedisKey(scope, id)).Err(); err != nil {
+		return fmt.Errorf("无法清除失败登录计数: %w", err)
+	}
+	return nil
+}
+
+// getRedisKey 生成计数键，如 login_attempt:account:<username>、login_attempt:ip:<ip>
+func (r *redisLoginAttemptRepository) getRedisKey(scope, id string) string {
+	return fmt.Sprintf("login_attempt:%s:%s", scope, id)
+}
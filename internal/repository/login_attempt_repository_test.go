@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoginAttemptRecordFailureLocksAtThreshold(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewLoginAttemptRepository(rdb)
+	key := "login_attempt:account:alice"
+
+	for i := int64(1); i <= 2; i++ {
+		state, locked, err := repo.RecordFailure(ctx, LoginAttemptScopeAccount, "alice", 10*time.Minute, 3, 30*time.Minute)
+		if err != nil || locked || state.Failures != i || !state.LockedUntil.IsZero() {
+			t.Fatalf("第%d次失败 = %+v locked=%v err=%v", i, state, locked, err)
+		}
+		// 未锁定时计数按窗口过期
+		if ttl := mr.TTL(key); ttl != 10*time.Minute {
+			t.Fatalf("计数 TTL = %v", ttl)
+		}
+	}
+
+	before := time.Now().Truncate(time.Millisecond)
+	state, locked, err := repo.RecordFailure(ctx, LoginAttemptScopeAccount, "alice", 10*time.Minute, 3, 30*time.Minute)
+	if err != nil || !locked || state.Failures != 3 {
+		t.Fatalf("达到阈值 = %+v locked=%v err=%v", state, locked, err)
+	}
+	if d := state.LockedUntil.Sub(before); d < 30*time.Minute || d > 30*time.Minute+time.Second {
+		t.Fatalf("锁定截止 = %v", state.LockedUntil)
+	}
+	// 锁定期长于计数窗口时，计数至少保留到锁定结束
+	if ttl := mr.TTL(key); ttl != 30*time.Minute {
+		t.Fatalf("锁定后 TTL = %v", ttl)
+	}
+
+	// 锁定期内继续失败只累加次数，不重新锁定也不延长锁定
+	again, locked, err := repo.RecordFailure(ctx, LoginAttemptScopeAccount, "alice", 10*time.Minute, 3, 30*time.Minute)
+	if err != nil || locked || again.Failures != 4 || !again.LockedUntil.Equal(state.LockedUntil) {
+		t.Fatalf("锁定期内失败 = %+v locked=%v err=%v", again, locked, err)
+	}
+
+	got, err := repo.Get(ctx, LoginAttemptScopeAccount, "alice")
+	if err != nil || got.Failures != 4 || !got.LockedUntil.Equal(state.LockedUntil) || got.LastFailureAt.IsZero() {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+}
+
+func TestLoginAttemptRelocksAfterLockExpires(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestMiniredis(t)
+	repo := NewLoginAttemptRepository(rdb)
+
+	if _, locked, _ := repo.RecordFailure(ctx, LoginAttemptScopeAccount, "bob", time.Minute, 1, 20*time.Millisecond); !locked {
+		t.Fatal("首次失败即应锁定")
+	}
+	// 脚本以调用方时间判断锁定是否结束
+	time.Sleep(30 * time.Millisecond)
+	state, locked, err := repo.RecordFailure(ctx, LoginAttemptScopeAccount, "bob", time.Minute, 1, 20*time.Millisecond)
+	if err != nil || !locked || state.Failures != 2 {
+		t.Fatalf("锁定结束后再次失败 = %+v locked=%v err=%v", state, locked, err)
+	}
+}
+
+func TestLoginAttemptWithoutLockout(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestMiniredis(t)
+	repo := NewLoginAttemptRepository(rdb)
+
+	for i := 0; i < 5; i++ {
+		state, locked, err := repo.RecordFailure(ctx, LoginAttemptScopeIP, "10.0.0.1", time.Minute, 0, time.Hour)
+		if err != nil || locked || !state.LockedUntil.IsZero() {
+			t.Fatalf("lockAfter=0 时不应锁定: %+v locked=%v err=%v", state, locked, err)
+		}
+	}
+}
+
+func TestLoginAttemptExpiryAndClear(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewLoginAttemptRepository(rdb)
+
+	if got, err := repo.Get(ctx, LoginAttemptScopeAccount, "carol"); err != nil || got.Failures != 0 || !got.LockedUntil.IsZero() {
+		t.Fatalf("无记录时 Get = %+v, %v", got, err)
+	}
+	_, _, _ = repo.RecordFailure(ctx, LoginAttemptScopeAccount, "carol", time.Minute, 5, time.Hour)
+	_, _, _ = repo.RecordFailure(ctx, LoginAttemptScopeIP, "carol", time.Minute, 5, time.Hour)
+
+	// 账户与IP分别计数
+	if err := repo.Clear(ctx, LoginAttemptScopeAccount, "carol"); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if got, _ := repo.Get(ctx, LoginAttemptScopeAccount, "carol"); got.Failures != 0 {
+		t.Fatalf("清除后 Failures = %d", got.Failures)
+	}
+	if got, _ := repo.Get(ctx, LoginAttemptScopeIP, "carol"); got.Failures != 1 {
+		t.Fatalf("IP 计数 = %d", got.Failures)
+	}
+
+	// 超过窗口没有新的失败，计数过期清零
+	mr.FastForward(2 * time.Minute)
+	if got, _ := repo.Get(ctx, LoginAttemptScopeIP, "carol"); got.Failures != 0 {
+		t.Fatalf("窗口过后 Failures = %d", got.Failures)
+	}
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// presenceLastSeenTTL 最后在线时间的保留时长
+const presenceLastSeenTTL = 90 * 24 * time.Hour
+
+// presenceConnsGrace 连接集合在最后一个连接过期后继续保留的时长，留给 SweepExpired 识别过期连接
+const presenceConnsGrace = 10 * time.Minute
+
+// 在线状态键前缀，后接用户ID
+const (
+	presenceConnsPrefix    = "presence:conns:"
+	presenceAwayPrefix     = "presence:away:"
+	presenceLastSeenPrefix = "presence:last_seen:"
+)
+
+// presenceExpiryKey 全部连接的过期索引，member 为 userID|connID，score 为过期时间（毫秒）
+const presenceExpiryKey = "presence:expiry"
+
+// claimExpiredPresenceScript 原子地认领已过期的连接：从过期索引中移除并返回，多个实例同时清理时每个连接只会被认领一次
+// KEYS[1] 过期索引；ARGV: 当前毫秒时间戳、单次上限
+// 返回 {member, score, member, score, ...}
+var claimExpiredPresenceScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[1]), 'WITHSCORES', 'LIMIT', 0, tonumber(ARGV[2]))
+for i = 1, #expired, 2 do
+	redis.call('ZREM', KEYS[1], expired[i])
+end
+return expired
+`)
+
+// releasePresenceConnScript 从用户连接集合中移除已认领的过期连接，
+// 用户因此没有任何有效连接时记录最后在线时间（最后一次续期的时间）并清除离开标记
+// 连接已被 RemoveConn/AddConn 清理（集合中已不存在）时不重复处理，避免重复的离线事件
+// KEYS: 连接集合、离开标记、最后在线时间；ARGV: 连接ID、当前毫秒时间戳、最后在线时间（秒）、最后在线时间保留秒数
+// 返回 1 表示用户因本次清理而离线
+var releasePresenceConnScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[2]))
+if redis.call('ZCARD', KEYS[1]) > 0 then
+	return 0
+end
+redis.call('SET', KEYS[3], ARGV[3], 'EX', tonumber(ARGV[4]))
+redis.call('DEL', KEYS[2])
+return 1
+`)
+
+// PresenceState 某用户在 Redis 中的在线记录
+type PresenceState struct {
+	Conns    int64
+	Away     bool
+	LastSeen *time.Time
+}
+
+// PresenceRepository 在线状态仓储（Redis，跨实例共享）
+// 每个用户的连接记录在有序集合中，score 为连接的过期时间；连接需在过期前续期，
+// 实例异常退出时其连接到期后自动视为离线，并由 SweepExpired 补记最后在线时间
+type PresenceRepository interface {
+	// AddConn 登记连接，返回登记前该用户是否没有任何有效连接
+	AddConn(ctx context.Context, userID uuid.UUID, connID string, ttl time.Duration) (bool, error)
+	// RefreshConn 续期连接
+	RefreshConn(ctx context.Context, userID uuid.UUID, connID string, ttl time.Duration) error
+	// RemoveConn 移除连接，返回移除后该用户是否已没有有效连接；此时记录最后在线时间
+	RemoveConn(ctx context.Context, userID uuid.UUID, connID string) (bool, error)
+	// SetAway 设置或清除离开标记；标记与连接一样需在 ttl 内续期（RefreshConn 时一并续期）
+	SetAway(ctx context.Context, userID uuid.UUID, away bool, ttl time.Duration) error
+	// GetStates 批量读取用户的在线记录
+	GetStates(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]PresenceState, error)
+	// SweepExpired 清理最多 limit 个未续期而过期的连接（实例异常退出时遗留），返回因此离线的用户及清理的连接数
+	// 部分用户清理失败时仍返回其余已离线的用户，并返回首个错误
+	// 多个实例可同时调用，每个过期连接只会被其中一个认领
+	SweepExpired(ctx context.Context, ttl time.Duration, limit int64) ([]uuid.UUID, int64, error)
+}
+
+// redisPresenceRepository Redis 在线状态实现
+type redisPresenceRepository struct {
+	rdb *redis.Client
+}
+
+// NewPresenceRepository 创建在线状态仓储实例
+func NewPresenceRepository(rdb *redis.Client) PresenceRepository {
+	return &redisPresenceRepository{rdb: rdb}
+}
+
+// AddConn 清理过期连接后登记新连接
+func (r *redisPresenceRepository) AddConn(ctx context.Context, userID uuid.UUID, connID string, ttl time.Duration) (bool, error) {
+	key := r.connsKey(userID)
+	now := time.Now()
+	pipe := r.rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	before := pipe.ZCard(ctx, key)
+	expiresAt := float64(now.Add(ttl).UnixMilli())
+	pipe.ZAdd(ctx, key, &redis.Z{Score: expiresAt, Member: connID})
+	pipe.Expire(ctx, key, ttl+presenceConnsGrace)
+	pipe.ZAdd(ctx, presenceExpiryKey, &redis.Z{Score: expiresAt, Member: r.expiryMember(userID, connID)})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("无法登记在线连接: %w", err)
+	}
+	return before.Val() == 0, nil
+}
+
+// RefreshConn 续期连接、集合与离开标记的过期时间
+func (r *redisPresenceRepository) RefreshConn(ctx context.Context, userID uuid.UUID, connID string, ttl time.Duration) error {
+	key := r.connsKey(userID)
+	expiresAt := float64(time.Now().Add(ttl).UnixMilli())
+	pipe := r.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: expiresAt, Member: connID})
+	pipe.Expire(ctx, key, ttl+presenceConnsGrace)
+	pipe.ZAdd(ctx, presenceExpiryKey, &redis.Z{Score: expiresAt, Member: r.expiryMember(userID, connID)})
+	pipe.Expire(ctx, r.awayKey(userID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("无法续期在线连接: %w", err)
+	}
+	return nil
+}
+
+// RemoveConn 移除连接；没有剩余有效连接时记录最后在线时间并清除离开标记
+func (r *redisPresenceRepository) RemoveConn(ctx context.Context, userID uuid.UUID, connID string) (bool, error) {
+	key := r.connsKey(userID)
+	now := time.Now()
+	pipe := r.rdb.TxPipeline()
+	pipe.ZRem(ctx, key, connID)
+	pipe.ZRem(ctx, presenceExpiryKey, r.expiryMember(userID, connID))
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	remaining := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("无法移除在线连接: %w", err)
+	}
+	if remaining.Val() > 0 {
+		return false, nil
+	}
+	pipe = r.rdb.TxPipeline()
+	pipe.Set(ctx, r.lastSeenKey(userID), now.Unix(), presenceLastSeenTTL)
+	pipe.Del(ctx, r.awayKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, fmt.Errorf("无法记录最后在线时间: %w", err)
+	}
+	return true, nil
+}
+
+// SetAway 离开标记与连接同样依赖续期，实例异常退出后随连接一同过期
+func (r *redisPresenceRepository) SetAway(ctx context.Context, userID uuid.UUID, away bool, ttl time.Duration) error {
+	var err error
+	if away {
+		err = r.rdb.Set(ctx, r.awayKey(userID), 1, ttl).Err()
+	} else {
+		err = r.rdb.Del(ctx, r.awayKey(userID)).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("无法更新离开状态: %w", err)
+	}
+	return nil
+}
+
+// GetStates 使用 pipeline 批量读取
+func (r *redisPresenceRepository) GetStates(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]PresenceState, error) {
+	res := make(map[uuid.UUID]PresenceState, len(userIDs))
+	if len(userIDs) == 0 {
+		return res, nil
+	}
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	type cmds struct {
+		conns    *redis.IntCmd
+		away     *redis.IntCmd
+		lastSeen *redis.StringCmd
+	}
+	pending := make(map[uuid.UUID]cmds, len(userIDs))
+	pipe := r.rdb.Pipeline()
+	for _, id := range userIDs {
+		pending[id] = cmds{
+			conns:    pipe.ZCount(ctx, r.connsKey(id), "("+now, "+inf"),
+			away:     pipe.Exists(ctx, r.awayKey(id)),
+			lastSeen: pipe.Get(ctx, r.lastSeenKey(id)),
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("无法读取在线状态: %w", err)
+	}
+	for id, c := range pending {
+		state := PresenceState{Conns: c.conns.Val(), Away: c.away.Val() > 0}
+		if ts, err := c.lastSeen.Int64(); err == nil {
+			t := time.Unix(ts, 0)
+			state.LastSeen = &t
+		}
+		res[id] = state
+	}
+	return res, nil
+}
+
+// SweepExpired 先认领过期连接，再逐个用户清理；每个脚本只访问经 KEYS 声明的键
+func (r *redisPresenceRepository) SweepExpired(ctx context.Context, ttl time.Duration, limit int64) ([]uuid.UUID, int64, error) {
+	now := time.Now().UnixMilli()
+	res, err := claimExpiredPresenceScript.Run(ctx, r.rdb, []string{presenceExpiryKey}, now, limit).StringSlice()
+	if err != nil {
+		return nil, 0, fmt.Errorf("无法认领过期的在线连接: %w", err)
+	}
+	claimed := int64(len(res) / 2)
+	var ids []uuid.UUID
+	// 已认领的连接不会再出现在索引中，单个用户清理失败时继续处理其余连接
+	var firstErr error
+	for i := 0; i+1 < len(res); i += 2 {
+		userID, connID, ok := r.parseExpiryMember(res[i])
+		if !ok {
+			continue
+		}
+		expiresAt, err := strconv.ParseFloat(res[i+1], 64)
+		if err != nil {
+			continue
+		}
+		lastSeen := (int64(expiresAt) - ttl.Milliseconds()) / 1000
+		offline, err := releasePresenceConnScript.Run(ctx, r.rdb,
+			[]string{r.connsKey(userID), r.awayKey(userID), r.lastSeenKey(userID)},
+			connID, now, lastSeen, int64(presenceLastSeenTTL.Seconds())).Int64()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("无法清理过期的在线连接: %w", err)
+			}
+			continue
+		}
+		if offline == 1 {
+			ids = append(ids, userID)
+		}
+	}
+	return ids, claimed, firstErr
+}
+
+// expiryMember 过期索引中的成员，连接ID为 UUID，不含分隔符
+func (r *redisPresenceRepository) expiryMember(userID uuid.UUID, connID string) string {
+	return userID.String() + "|" + connID
+}
+
+// parseExpiryMember 解析过期索引中的成员
+func (r *redisPresenceRepository) parseExpiryMember(member string) (uuid.UUID, string, bool) {
+	userPart, connID, ok := strings.Cut(member, "|")
+	if !ok {
+		return uuid.Nil, "", false
+	}
+	userID, err := uuid.Parse(userPart)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+	return userID, connID, true
+}
+
+func (r *redisPresenceRepository) connsKey(userID uuid.UUID) string {
+	return presenceConnsPrefix + userID.String()
+}
+
+func (r *redisPresenceRepository) awayKey(userID uuid.UUID) string {
+	return presenceAwayPrefix + userID.String()
+}
+
+func (r *redisPresenceRepository) lastSeenKey(userID uuid.UUID) string {
+	return presenceLastSeenPrefix + userID.String()
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	_, rdb := newTestMiniredis(t)
+	return rdb
+}
+
+// newTestMiniredis 需要推进键过期时间的测试使用：miniredis 的 TTL 只随 FastForward 推进
+func newTestMiniredis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return mr, rdb
+}
+
+// shortTTL 模拟实例退出后不再续期的连接
+const shortTTL = 20 * time.Millisecond
+
+func TestPresenceSweepExpiredReportsOfflineOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPresenceRepository(newTestRedis(t))
+	user := uuid.New()
+	addedAt := time.Now()
+	if _, err := repo.AddConn(ctx, user, "dead", shortTTL); err != nil {
+		t.Fatalf("AddConn: %v", err)
+	}
+	if err := repo.SetAway(ctx, user, true, time.Hour); err != nil {
+		t.Fatalf("SetAway: %v", err)
+	}
+	time.Sleep(2 * shortTTL)
+
+	offline, claimed, err := repo.SweepExpired(ctx, shortTTL, 100)
+	if err != nil {
+		t.Fatalf("SweepExpired: %v", err)
+	}
+	if claimed != 1 || len(offline) != 1 || offline[0] != user {
+		t.Fatalf("offline=%v claimed=%d", offline, claimed)
+	}
+	states, err := repo.GetStates(ctx, []uuid.UUID{user})
+	if err != nil {
+		t.Fatalf("GetStates: %v", err)
+	}
+	st := states[user]
+	if st.Conns != 0 || st.Away {
+		t.Fatalf("清理后状态 %+v", st)
+	}
+	// 最后在线时间为最后一次续期的时间，而不是清理的时间
+	if st.LastSeen == nil || st.LastSeen.Unix() != addedAt.Unix() {
+		t.Fatalf("LastSeen = %v，期望 %v", st.LastSeen, addedAt.Unix())
+	}
+
+	offline, claimed, err = repo.SweepExpired(ctx, shortTTL, 100)
+	if err != nil || claimed != 0 || len(offline) != 0 {
+		t.Fatalf("重复清理 offline=%v claimed=%d err=%v", offline, claimed, err)
+	}
+}
+
+func TestPresenceSweepKeepsUsersWithLiveConns(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPresenceRepository(newTestRedis(t))
+	user := uuid.New()
+	_, _ = repo.AddConn(ctx, user, "dead", shortTTL)
+	_, _ = repo.AddConn(ctx, user, "live", time.Hour)
+	time.Sleep(2 * shortTTL)
+
+	offline, claimed, err := repo.SweepExpired(ctx, shortTTL, 100)
+	if err != nil {
+		t.Fatalf("SweepExpired: %v", err)
+	}
+	if claimed != 1 || len(offline) != 0 {
+		t.Fatalf("其他实例上仍有连接时不应离线: offline=%v claimed=%d", offline, claimed)
+	}
+	states, _ := repo.GetStates(ctx, []uuid.UUID{user})
+	if states[user].Conns != 1 {
+		t.Fatalf("Conns = %d", states[user].Conns)
+	}
+}
+
+func TestPresenceSweepSkipsConnsAlreadyHandled(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPresenceRepository(newTestRedis(t))
+	user := uuid.New()
+	_, _ = repo.AddConn(ctx, user, "dead", shortTTL)
+	_, _ = repo.AddConn(ctx, user, "closing", time.Hour)
+	time.Sleep(2 * shortTTL)
+
+	// 正常断开的最后一个连接已触发离线并清理了过期连接，清理任务不应再次报告离线
+	last, err := repo.RemoveConn(ctx, user, "closing")
+	if err != nil || !last {
+		t.Fatalf("RemoveConn last=%v err=%v", last, err)
+	}
+	offline, claimed, err := repo.SweepExpired(ctx, shortTTL, 100)
+	if err != nil {
+		t.Fatalf("SweepExpired: %v", err)
+	}
+	if claimed != 1 || len(offline) != 0 {
+		t.Fatalf("offline=%v claimed=%d", offline, claimed)
+	}
+}
+
+func TestPresenceRefreshExtendsConnAndAway(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewPresenceRepository(rdb)
+	user := uuid.New()
+	_, _ = repo.AddConn(ctx, user, "c1", shortTTL)
+	_ = repo.SetAway(ctx, user, true, shortTTL)
+	if err := repo.RefreshConn(ctx, user, "c1", time.Hour); err != nil {
+		t.Fatalf("RefreshConn: %v", err)
+	}
+	mr.FastForward(2 * shortTTL)
+	time.Sleep(2 * shortTTL)
+
+	if offline, claimed, _ := repo.SweepExpired(ctx, time.Hour, 100); claimed != 0 || len(offline) != 0 {
+		t.Fatalf("已续期的连接被清理: offline=%v claimed=%d", offline, claimed)
+	}
+	states, _ := repo.GetStates(ctx, []uuid.UUID{user})
+	if st := states[user]; st.Conns != 1 || !st.Away {
+		t.Fatalf("续期后状态 %+v", st)
+	}
+}
+
+func TestPresenceAwayExpiresWithoutRefresh(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewPresenceRepository(rdb)
+	user := uuid.New()
+	_, _ = repo.AddConn(ctx, user, "c1", time.Hour)
+	_ = repo.SetAway(ctx, user, true, shortTTL)
+	mr.FastForward(2 * shortTTL)
+
+	states, _ := repo.GetStates(ctx, []uuid.UUID{user})
+	if states[user].Away {
+		t.Fatal("未续期的离开标记应随连接有效期过期")
+	}
+}
+
+func TestPresenceSweepRespectsLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPresenceRepository(newTestRedis(t))
+	for i := 0; i < 3; i++ {
+		_, _ = repo.AddConn(ctx, uuid.New(), uuid.NewString(), shortTTL)
+	}
+	time.Sleep(2 * shortTTL)
+
+	offline, claimed, err := repo.SweepExpired(ctx, shortTTL, 2)
+	if err != nil || claimed != 2 || len(offline) != 2 {
+		t.Fatalf("第一批 offline=%v claimed=%d err=%v", offline, claimed, err)
+	}
+	offline, claimed, err = repo.SweepExpired(ctx, shortTTL, 2)
+	if err != nil || claimed != 1 || len(offline) != 1 {
+		t.Fatalf("第二批 offline=%v claimed=%d err=%v", offline, claimed, err)
+	}
+}
+
+func TestPresenceSweepDropsMalformedIndexMembers(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewPresenceRepository(rdb)
+	if _, err := mr.ZAdd(presenceExpiryKey, 1, "garbage"); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	// 无法解析的成员同样被认领并移出索引，不会反复出现在后续清理中
+	offline, claimed, err := repo.SweepExpired(ctx, shortTTL, 100)
+	if err != nil || claimed != 1 || len(offline) != 0 {
+		t.Fatalf("offline=%v claimed=%d err=%v", offline, claimed, err)
+	}
+	if mr.Exists(presenceExpiryKey) {
+		t.Fatal("过期索引中仍有无效成员")
+	}
+}
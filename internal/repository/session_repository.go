@@ -0,0 +1,344 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// refreshReuseGrace 旧 refresh token 在轮换后仍被接受的时长
+// 客户端并发刷新或未收到响应而重试时，在此期间再次提交旧 token 返回本次轮换签发的 token 对，不视为盗用
+const refreshReuseGrace = 10 * time.Second
+
+// rotateRefreshScript 原子地把会话持有的 refresh token 从旧值换成新值，并按新 token 的有效期续期会话
+// 轮换后在宽限期内记录旧哈希与本次签发的 token 对
+// KEYS[1] 会话；KEYS[2] 用户会话集合；KEYS[3] 宽限记录
+// ARGV: 旧哈希、新哈希、有效期毫秒、当前毫秒时间戳、IP、User-Agent、新 access token、新 refresh token、宽限期毫秒
+// 返回 {1} 已轮换；{2, access, refresh} 宽限期内重复提交上一个 token；{0} 旧 token 已被轮换过（重复使用）；{-1} 会话不存在
+var rotateRefreshScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'refresh_hash')
+if not current then
+	return {-1}
+end
+if current ~= ARGV[1] then
+	local grace = redis.call('HMGET', KEYS[3], 'prev_hash', 'current_hash', 'access_token', 'refresh_token')
+	if grace[1] == ARGV[1] and grace[2] == current then
+		return {2, grace[3], grace[4]}
+	end
+	return {0}
+end
+redis.call('HSET', KEYS[1], 'refresh_hash', ARGV[2], 'last_used_at', ARGV[4])
+if ARGV[5] ~= '' then
+	redis.call('HSET', KEYS[1], 'ip_address', ARGV[5])
+end
+if ARGV[6] ~= '' then
+	redis.call('HSET', KEYS[1], 'user_agent', ARGV[6])
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[3]) then
+	redis.call('PEXPIRE', KEYS[2], ARGV[3])
+end
+redis.call('DEL', KEYS[3])
+redis.call('HSET', KEYS[3], 'prev_hash', ARGV[1], 'current_hash', ARGV[2], 'access_token', ARGV[7], 'refresh_token', ARGV[8])
+redis.call('PEXPIRE', KEYS[3], ARGV[9])
+return {1}
+`)
+
+// RefreshRotation refresh token 轮换结果
+type RefreshRotation int
+
+const (
+	// RefreshRotated 旧 token 为会话当前持有的 token，已换成新 token
+	RefreshRotated RefreshRotation = iota
+	// RefreshGrace 旧 token 刚被轮换，仍在宽限期内，应返回上次轮换签发的 token 对
+	RefreshGrace
+	// RefreshReused 旧 token 已被轮换过且超出宽限期，再次出现说明 token 可能被盗用
+	RefreshReused
+	// RefreshSessionMissing 会话已过期或已被撤销
+	RefreshSessionMissing
+)
+
+// RefreshTokenPair 一次轮换签发的 token 对
+type RefreshTokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// SessionRepository 登录会话仓储接口
+// 每个会话保存为一个 Hash（仅存 refresh token 的哈希），用户的会话ID集合用于列表与批量撤销
+type SessionRepository interface {
+	// Create 创建会话并绑定 refresh token，expiration 为会话有效期
+	Create(ctx context.Context, session *model.UserSession, refreshToken string, expiration time.Duration) error
+	// Get 获取会话，不存在或已过期时返回 nil
+	Get(ctx context.Context, sessionID uuid.UUID) (*model.UserSession, error)
+	// Exists 会话是否仍然有效
+	Exists(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	// RotateRefreshToken 旧 token 为会话当前持有的 token 时原子地换成 issued，同时记录使用时间与来源并续期会话
+	// 结果为 RefreshGrace 时返回宽限期内应重复下发的 token 对，其他结果返回 nil
+	RotateRefreshToken(ctx context.Context, session *model.UserSession, oldToken string, issued *RefreshTokenPair, expiration time.Duration) (RefreshRotation, *RefreshTokenPair, error)
+	// ListByUser 列出用户的有效会话，按最近使用时间倒序
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*model.UserSession, error)
+	// Delete 删除用户的某个会话，返回会话是否存在
+	Delete(ctx context.Context, userID, sessionID uuid.UUID) (bool, error)
+	// DeleteByDevice 删除用户在指定设备（设备指纹）上的全部会话，返回被删除的会话ID
+	DeleteByDevice(ctx context.Context, userID uuid.UUID, deviceID string) ([]uuid.UUID, error)
+	// DeleteAllByUser 删除用户除 exceptID 以外的全部会话（exceptID 为 uuid.Nil 时全部删除），返回被删除的会话ID
+	DeleteAllByUser(ctx context.Context, userID, exceptID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// redisSessionRepository Redis会话仓储实现
+type redisSessionRepository struct {
+	rdb *redis.Client
+}
+
+// NewSessionRepository 创建会话仓储实例
+func NewSessionRepository(rdb *redis.Client) SessionRepository {
+	return &redisSessionRepository{rdb: rdb}
+}
+
+func (r *redisSessionRepository) Create(ctx context.Context, session *model.UserSession, refreshToken string, expiration time.Duration) error {
+	key := r.getSessionKey(session.ID)
+	userKey := r.getUserKey(session.UserID)
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, key, map[string]any{
+		"user_id":      session.UserID.String(),
+		"refresh_hash": hashToken(refreshToken),
+		"device_id":    session.DeviceID,
+		"device_name":  session.DeviceName,
+		"device_type":  session.DeviceType,
+		"ip_address":   session.IPAddress,
+		"user_agent":   session.UserAgent,
+		"created_at":   session.CreatedAt.UnixMilli(),
+		"last_used_at": session.LastUsedAt.UnixMilli(),
+	})
+	pipe.Expire(ctx, key, expiration)
+	pipe.SAdd(ctx, userKey, session.ID.String())
+	// 集合的过期时间跟随最新创建的会话，已过期的成员在列表时清理
+	pipe.Expire(ctx, userKey, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("无法创建会话: %w", err)
+	}
+	return nil
+}
+
+func (r *redisSessionRepository) Get(ctx context.Context, sessionID uuid.UUID) (*model.UserSession, error) {
+	fields, err := r.rdb.HGetAll(ctx, r.getSessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取会话: %w", err)
+	}
+	return parseSession(sessionID, fields), nil
+}
+
+func (r *redisSessionRepository) Exists(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	n, err := r.rdb.Exists(ctx, r.getSessionKey(sessionID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("无法检查会话: %w", err)
+	}
+	return n == 1, nil
+}
+
+// RotateRefreshToken session 需提供 ID、UserID，以及本次请求的 IPAddress、UserAgent、LastUsedAt
+// 宽限记录中保存明文 token 对，仅保留 refreshReuseGrace
+func (r *redisSessionRepository) RotateRefreshToken(ctx context.Context, session *model.UserSession, oldToken string, issued *RefreshTokenPair, expiration time.Duration) (RefreshRotation, *RefreshTokenPair, error) {
+	keys := []string{r.getSessionKey(session.ID), r.getUserKey(session.UserID), r.getGraceKey(session.ID)}
+	res, err := rotateRefreshScript.Run(ctx, r.rdb, keys,
+		hashToken(oldToken), hashToken(issued.RefreshToken), expiration.Milliseconds(),
+		session.LastUsedAt.UnixMilli(), session.IPAddress, session.UserAgent,
+		issued.AccessToken, issued.RefreshToken, refreshReuseGrace.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return RefreshSessionMissing, nil, fmt.Errorf("无法轮换refresh token: %w", err)
+	}
+	if len(res) == 0 {
+		return RefreshSessionMissing, nil, fmt.Errorf("refresh token轮换脚本返回值无效")
+	}
+	code, _ := res[0].(int64)
+	switch code {
+	case 1:
+		return RefreshRotated, nil, nil
+	case 2:
+		if len(res) != 3 {
+			return RefreshSessionMissing, nil, fmt.Errorf("refresh token轮换脚本返回值无效")
+		}
+		access, _ := res[1].(string)
+		refresh, _ := res[2].(string)
+		return RefreshGrace, &RefreshTokenPair{AccessToken: access, RefreshToken: refresh}, nil
+	case 0:
+		return RefreshReused, nil, nil
+	default:
+		return RefreshSessionMissing, nil, nil
+	}
+}
+
+func (r *redisSessionRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*model.UserSession, error) {
+	userKey := r.getUserKey(userID)
+	ids, err := r.rdb.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取会话列表: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*model.UserSession{}, nil
+	}
+
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, "session:"+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("无法获取会话详情: %w", err)
+	}
+
+	sessions := make([]*model.UserSession, 0, len(ids))
+	var expired []any
+	for i, cmd := range cmds {
+		id, err := uuid.Parse(ids[i])
+		if err != nil {
+			expired = append(expired, ids[i])
+			continue
+		}
+		s := parseSession(id, cmd.Val())
+		if s == nil || s.UserID != userID {
+			expired = append(expired, ids[i])
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	if len(expired) > 0 {
+		_ = r.rdb.SRem(ctx, userKey, expired...).Err()
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (r *redisSessionRepository) Delete(ctx context.Context, userID, sessionID uuid.UUID) (bool, error) {
+	key := r.getSessionKey(sessionID)
+	owner, err := r.rdb.HGet(ctx, key, "user_id").Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("无法获取会话: %w", err)
+	}
+	if owner != userID.String() {
+		return false, nil
+	}
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.SRem(ctx, r.getUserKey(userID), sessionID.String())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("无法删除会话: %w", err)
+	}
+	return true, nil
+}
+
+func (r *redisSessionRepository) DeleteAllByUser(ctx context.Context, userID, exceptID uuid.UUID) ([]uuid.UUID, error) {
+	userKey := r.getUserKey(userID)
+	ids, err := r.rdb.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取会话列表: %w", err)
+	}
+	var deleted []uuid.UUID
+	pipe := r.rdb.TxPipeline()
+	for _, raw := range ids {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			pipe.SRem(ctx, userKey, raw)
+			continue
+		}
+		if id == exceptID {
+			continue
+		}
+		pipe.Del(ctx, r.getSessionKey(id))
+		pipe.SRem(ctx, userKey, raw)
+		deleted = append(deleted, id)
+	}
+	if pipe.Len() == 0 {
+		return nil, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("无法删除会话: %w", err)
+	}
+	return deleted, nil
+}
+
+func (r *redisSessionRepository) DeleteByDevice(ctx context.Context, userID uuid.UUID, deviceID string) ([]uuid.UUID, error) {
+	sessions, err := r.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []uuid.UUID
+	pipe := r.rdb.TxPipeline()
+	for _, s := range sessions {
+		if s.DeviceID == "" || s.DeviceID != deviceID {
+			continue
+		}
+		pipe.Del(ctx, r.getSessionKey(s.ID))
+		pipe.SRem(ctx, r.getUserKey(userID), s.ID.String())
+		deleted = append(deleted, s.ID)
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("无法删除会话: %w", err)
+	}
+	return deleted, nil
+}
+
+// parseSession 字段为空表示会话不存在
+func parseSession(id uuid.UUID, fields map[string]string) *model.UserSession {
+	userID, err := uuid.Parse(fields["user_id"])
+	if err != nil {
+		return nil
+	}
+	return &model.UserSession{
+		ID:         id,
+		UserID:     userID,
+		DeviceID:   fields["device_id"],
+		DeviceName: fields["device_name"],
+		DeviceType: fields["device_type"],
+		IPAddress:  fields["ip_address"],
+		UserAgent:  fields["user_agent"],
+		CreatedAt:  parseMillis(fields["created_at"]),
+		LastUsedAt: parseMillis(fields["last_used_at"]),
+	}
+}
+
+func parseMillis(s string) time.Time {
+	var ms int64
+	if _, err := fmt.Sscan(s, &ms); err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// hashToken refresh token 只保存 SHA-256 哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// getSessionKey 会话键，如 session:<sessionID>
+func (r *redisSessionRepository) getSessionKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("session:%s", sessionID.String())
+}
+
+// getUserKey 用户会话集合键，如 session:user:<userID>
+func (r *redisSessionRepository) getUserKey(userID uuid.UUID) string {
+	return fmt.Sprintf("session:user:%s", userID.String())
+}
+
+// getGraceKey 刷新宽限记录键，与会话键分开存放，不会出现在会话列表中
+func (r *redisSessionRepository) getGraceKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("session_grace:%s", sessionID.String())
+}
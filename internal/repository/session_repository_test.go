@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestSession(t *testing.T, repo SessionRepository, userID uuid.UUID, refreshToken string, ttl time.Duration) *model.UserSession {
+	t.Helper()
+	now := time.Now().Truncate(time.Millisecond)
+	s := &model.UserSession{
+		ID: uuid.New(), UserID: userID, DeviceID: "device-1", DeviceName: "Laptop",
+		IPAddress: "10.0.0.1", UserAgent: "ua/1", CreatedAt: now, LastUsedAt: now,
+	}
+	if err := repo.Create(context.Background(), s, refreshToken, ttl); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return s
+}
+
+// issuedPair 轮换时签发的 token 对，access token 由 refresh token 派生便于断言
+func issuedPair(refreshToken string) *RefreshTokenPair {
+	return &RefreshTokenPair{AccessToken: "at-" + refreshToken, RefreshToken: refreshToken}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewSessionRepository(rdb)
+	userID := uuid.New()
+	session := newTestSession(t, repo, userID, "rt-1", time.Hour)
+
+	// 会话快过期时轮换，按新 token 的有效期续期
+	mr.FastForward(50 * time.Minute)
+	used := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	req := &model.UserSession{ID: session.ID, UserID: userID, IPAddress: "10.0.0.2", LastUsedAt: used}
+	res, _, err := repo.RotateRefreshToken(ctx, req, "rt-1", issuedPair("rt-2"), 2*time.Hour)
+	if err != nil || res != RefreshRotated {
+		t.Fatalf("RotateRefreshToken = %v, %v", res, err)
+	}
+	if ttl := mr.TTL("session:" + session.ID.String()); ttl != 2*time.Hour {
+		t.Fatalf("会话 TTL = %v", ttl)
+	}
+	if ttl := mr.TTL("session:user:" + userID.String()); ttl != 2*time.Hour {
+		t.Fatalf("用户会话集合 TTL = %v", ttl)
+	}
+	got, err := repo.Get(ctx, session.ID)
+	if err != nil || got == nil {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	// 空的 User-Agent 不覆盖原值
+	if got.IPAddress != "10.0.0.2" || got.UserAgent != "ua/1" || !got.LastUsedAt.Equal(used) || got.DeviceID != "device-1" {
+		t.Fatalf("轮换后会话 = %+v", got)
+	}
+
+	// 宽限期内旧 token 再次出现，返回上次签发的 token 对，会话保持不变
+	res, current, err := repo.RotateRefreshToken(ctx, req, "rt-1", issuedPair("rt-3"), time.Hour)
+	if err != nil || res != RefreshGrace || current == nil || *current != *issuedPair("rt-2") {
+		t.Fatalf("宽限期内重复使用旧 token = %v, %+v, %v", res, current, err)
+	}
+
+	// 超出宽限期后旧 token 再次出现视为重复使用
+	mr.FastForward(refreshReuseGrace + time.Second)
+	if res, current, err := repo.RotateRefreshToken(ctx, req, "rt-1", issuedPair("rt-3"), time.Hour); err != nil || res != RefreshReused || current != nil {
+		t.Fatalf("重复使用旧 token = %v, %+v, %v", res, current, err)
+	}
+	if res, _, err := repo.RotateRefreshToken(ctx, req, "rt-2", issuedPair("rt-3"), time.Hour); err != nil || res != RefreshRotated {
+		t.Fatalf("使用新 token = %v, %v", res, err)
+	}
+	// 再次轮换后，更早的 token 即使在宽限期内也不再被接受
+	if res, _, err := repo.RotateRefreshToken(ctx, req, "rt-1", issuedPair("rt-4"), time.Hour); err != nil || res != RefreshReused {
+		t.Fatalf("两次轮换前的 token = %v, %v", res, err)
+	}
+}
+
+func TestRotateRefreshTokenKeepsLongerUserSetTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewSessionRepository(rdb)
+	userID := uuid.New()
+	short := newTestSession(t, repo, userID, "rt-short", time.Hour)
+	newTestSession(t, repo, userID, "rt-long", 30*24*time.Hour)
+
+	// 集合的过期时间不能被较短的续期缩短，否则其他会话会从列表中消失
+	req := &model.UserSession{ID: short.ID, UserID: userID, LastUsedAt: time.Now()}
+	if res, _, err := repo.RotateRefreshToken(ctx, req, "rt-short", issuedPair("rt-short-2"), time.Hour); err != nil || res != RefreshRotated {
+		t.Fatalf("RotateRefreshToken = %v, %v", res, err)
+	}
+	if ttl := mr.TTL("session:user:" + userID.String()); ttl != 30*24*time.Hour {
+		t.Fatalf("用户会话集合 TTL = %v", ttl)
+	}
+}
+
+func TestRotateRefreshTokenMissingSession(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestMiniredis(t)
+	repo := NewSessionRepository(rdb)
+	userID := uuid.New()
+	session := newTestSession(t, repo, userID, "rt-1", time.Minute)
+
+	mr.FastForward(2 * time.Minute)
+	req := &model.UserSession{ID: session.ID, UserID: userID, LastUsedAt: time.Now()}
+	if res, _, err := repo.RotateRefreshToken(ctx, req, "rt-1", issuedPair("rt-2"), time.Hour); err != nil || res != RefreshSessionMissing {
+		t.Fatalf("过期会话 = %v, %v", res, err)
+	}
+	if ok, _ := repo.Exists(ctx, session.ID); ok {
+		t.Fatal("过期会话不应被轮换脚本重新创建")
+	}
+
+	other := &model.UserSession{ID: uuid.New(), UserID: userID, LastUsedAt: time.Now()}
+	if res, _, err := repo.RotateRefreshToken(ctx, other, "rt-1", issuedPair("rt-2"), time.Hour); err != nil || res != RefreshSessionMissing {
+		t.Fatalf("不存在的会话 = %v, %v", res, err)
+	}
+}
+
+func TestRotateRefreshTokenConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(newTestRedis(t))
+	userID := uuid.New()
+	session := newTestSession(t, repo, userID, "rt-1", time.Hour)
+
+	// 同一 refresh token 并发刷新时只有一个请求完成轮换，其余在宽限期内拿到同一个新 token 对
+	type result struct {
+		res     RefreshRotation
+		issued  string
+		current *RefreshTokenPair
+	}
+	results := make(chan result, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := &model.UserSession{ID: session.ID, UserID: userID, LastUsedAt: time.Now()}
+			issued := uuid.NewString()
+			res, current, err := repo.RotateRefreshToken(ctx, req, "rt-1", issuedPair(issued), time.Hour)
+			if err != nil {
+				t.Errorf("RotateRefreshToken: %v", err)
+			}
+			results <- result{res, issued, current}
+		}()
+	}
+	wg.Wait()
+	close(results)
+	var winner string
+	var graced []string
+	for r := range results {
+		switch r.res {
+		case RefreshRotated:
+			if winner != "" {
+				t.Fatal("多个请求完成了轮换")
+			}
+			winner = r.issued
+		case RefreshGrace:
+			graced = append(graced, r.current.RefreshToken)
+		default:
+			t.Fatalf("结果 = %v", r.res)
+		}
+	}
+	if winner == "" || len(graced) != cap(results)-1 {
+		t.Fatalf("winner=%q graced=%d", winner, len(graced))
+	}
+	for _, rt := range graced {
+		if rt != winner {
+			t.Fatalf("宽限期内返回 %q，期望 %q", rt, winner)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TwoFactorRepository 两步验证（TOTP 与恢复码）仓储接口
+type TwoFactorRepository interface {
+	// GetTOTP 获取用户的 TOTP 配置，不存在时返回 gorm.ErrRecordNotFound
+	GetTOTP(userID uuid.UUID) (*model.UserTOTP, error)
+	// SaveTOTPSecret 写入待确认的密钥，覆盖未启用的旧配置
+	SaveTOTPSecret(userID uuid.UUID, secret string) error
+	// EnableTOTP 启用 TOTP 并替换恢复码
+	EnableTOTP(userID uuid.UUID, step int64, codeHashes []string) error
+	// DeleteTOTP 停用 TOTP，同时删除全部恢复码
+	DeleteTOTP(userID uuid.UUID) error
+	// ConsumeTOTPStep 记录验证通过的时间步并清零失败次数；该时间步已被使用时返回 false
+	ConsumeTOTPStep(userID uuid.UUID, step int64) (bool, error)
+	// RecordTOTPFailure 累加失败次数，达到 maxAttempts 时锁定至 lockUntil 并重新计数
+	RecordTOTPFailure(userID uuid.UUID, maxAttempts int, lockUntil time.Time) error
+
+	// ReplaceRecoveryCodes 删除旧恢复码并写入新的恢复码哈希
+	ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error
+	// ConsumeRecoveryCode 标记恢复码已使用；不存在或已使用时返回 false
+	ConsumeRecoveryCode(userID uuid.UUID, codeHash string) (bool, error)
+	// CountUnusedRecoveryCodes 统计剩余可用的恢复码
+	CountUnusedRecoveryCodes(userID uuid.UUID) (int64, error)
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+// NewTwoFactorRepository 创建两步验证仓储实例
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) GetTOTP(userID uuid.UUID) (*model.UserTOTP, error) {
+	var t model.UserTOTP
+	if err := r.db.Where("user_id = ?", userID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SaveTOTPSecret 已启用的配置不会被覆盖
+func (r *twoFactorRepository) SaveTOTPSecret(userID uuid.UUID, secret string) error {
+	now := time.Now()
+	t := &model.UserTOTP{UserID: userID, Secret: secret, CreatedAt: now, UpdatedAt: now}
+	res := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"secret":          secret,
+			"last_used_step":  0,
+			"failed_attempts": 0,
+			"locked_until":    nil,
+			"created_at":      now,
+			"updated_at":      now,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_totp.enabled = ?", Vars: []any{false}}}},
+	}).Create(t)
+	if res.Error != nil {
+		return fmt.Errorf("save totp secret error: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("totp already enabled")
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) EnableTOTP(userID uuid.UUID, step int64, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&model.UserTOTP{}).
+			Where("user_id = ? AND enabled = ?", userID, false).
+			Updates(map[string]any{
+				"enabled":         true,
+				"enabled_at":      now,
+				"last_used_step":  step,
+				"failed_attempts": 0,
+				"locked_until":    nil,
+				"updated_at":      now,
+			})
+		if res.Error != nil {
+			return fmt.Errorf("enable totp error: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (r *twoFactorRepository) DeleteTOTP(userID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("delete recovery codes error: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserTOTP{}).Error; err != nil {
+			return fmt.Errorf("delete totp error: %w", err)
+		}
+		return nil
+	})
+}
+
+// ConsumeTOTPStep 条件更新保证并发请求中同一时间步只有一个成功
+func (r *twoFactorRepository) ConsumeTOTPStep(userID uuid.UUID, step int64) (bool, error) {
+	res := r.db.Model(&model.UserTOTP{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Updates(map[string]any{
+			"last_used_step":  step,
+			"failed_attempts": 0,
+			"locked_until":    nil,
+			"updated_at":      time.Now(),
+		})
+	if res.Error != nil {
+		return false, fmt.Errorf("consume totp step error: %w", res.Error)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *twoFactorRepository) RecordTOTPFailure(userID uuid.UUID, maxAttempts int, lockUntil time.Time) error {
+	err := r.db.Model(&model.UserTOTP{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]any{
+			"failed_attempts": gorm.Expr("CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END", maxAttempts),
+			"locked_until":    gorm.Expr("CASE WHEN failed_attempts + 1 >= ? THEN ?::timestamptz ELSE locked_until END", maxAttempts, lockUntil),
+			"updated_at":      time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("record totp failure error: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (r *twoFactorRepository) ConsumeRecoveryCode(userID uuid.UUID, codeHash string) (bool, error) {
+	res := r.db.Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, fmt.Errorf("consume recovery code error: %w", res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (r *twoFactorRepository) CountUnusedRecoveryCodes(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// replaceRecoveryCodes 在事务内替换恢复码
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.UserRecoveryCode{}).Error; err != nil {
+		return fmt.Errorf("delete recovery codes error: %w", err)
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	codes := make([]model.UserRecoveryCode, 0, len(codeHashes))
+	for _, h := range codeHashes {
+		codes = append(codes, model.UserRecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: h})
+	}
+	if err := tx.Create(&codes).Error; err != nil {
+		return fmt.Errorf("create recovery codes error: %w", err)
+	}
+	return nil
+}
@@ -13,6 +13,8 @@ type UserRepository interface {
 	Create(user *model.User) error
 	// GetByID 根据ID获取用户
 	GetByID(id uuid.UUID) (*model.User, error)
+	// GetByIDs 批量获取用户，不存在的ID被忽略
+	GetByIDs(ids []uuid.UUID) ([]model.User, error)
 	// GetByUsername 根据用户名获取用户
 	GetByUsername(username string) (*model.User, error)
 	// GetByEmail 根据邮箱获取用户
@@ -27,6 +29,8 @@ type UserRepository interface {
 	UpdateProfile(userID uuid.UUID, nickname, bio, avatar, backgroundURL string) error
 	// UpdatePassword 更新用户密码
 	UpdatePassword(userID uuid.UUID, passwordSalt string) error
+	// UpdateEmail 更新用户邮箱
+	UpdateEmail(userID uuid.UUID, email string) error
 	// UpdateLastLoginAt 更新用户最后登录时间
 	UpdateLastLoginAt(userID uuid.UUID, t time.Time) error
 	// Delete 删除用户
@@ -73,6 +77,16 @@ func (r *userRepository) GetByID(id uuid.UUID) (*model.User, error) {
 	return &user, nil
 }
 
+// GetByIDs 批量获取用户
+func (r *userRepository) GetByIDs(ids []uuid.UUID) ([]model.User, error) {
+	var users []model.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
 // GetByUsername 根据用户名获取用户
 func (r *userRepository) GetByUsername(username string) (*model.User, error) {
 	var user model.User
@@ -150,6 +164,15 @@ func (r *userRepository) UpdatePassword(userID uuid.UUID, passwordSalt string) e
 	return r.db.Model(&model.User{}).Where("id = ?", userID).Updates(updates).Error
 }
 
+// UpdateEmail 更新用户邮箱
+func (r *userRepository) UpdateEmail(userID uuid.UUID, email string) error {
+	updates := map[string]interface{}{
+		"email":      email,
+		"updated_at": time.Now(),
+	}
+	return r.db.Model(&model.User{}).Where("id = ?", userID).Updates(updates).Error
+}
+
 // UpdateLastLoginAt 更新用户最后登录时间
 func (r *userRepository) UpdateLastLoginAt(userID uuid.UUID, t time.Time) error {
 	updates := map[string]interface{}{
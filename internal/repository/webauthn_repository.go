@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"backend/internal/model"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredentialRepository 通行密钥凭证仓储接口
+type WebAuthnCredentialRepository interface {
+	Create(cred *model.WebAuthnCredential) error
+	// GetByCredentialID 按认证器凭证ID查询，不存在时返回 gorm.ErrRecordNotFound
+	GetByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error)
+	ListByUser(userID uuid.UUID) ([]*model.WebAuthnCredential, error)
+	// UpdateSignCount 登录成功后更新签名计数与最近使用时间
+	UpdateSignCount(id uuid.UUID, signCount int64, usedAt time.Time) error
+	// Delete 删除用户的凭证，返回是否存在
+	Delete(userID, id uuid.UUID) (bool, error)
+}
+
+type webAuthnCredentialRepository struct {
+	db *gorm.DB
+}
+
+// NewWebAuthnCredentialRepository 创建通行密钥仓储实例
+func NewWebAuthnCredentialRepository(db *gorm.DB) WebAuthnCredentialRepository {
+	return &webAuthnCredentialRepository{db: db}
+}
+
+func (r *webAuthnCredentialRepository) Create(cred *model.WebAuthnCredential) error {
+	if err := r.db.Create(cred).Error; err != nil {
+		return fmt.Errorf("create webauthn credential error: %w", err)
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepository) GetByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error) {
+	var cred model.WebAuthnCredential
+	if err := r.db.Where("credential_id = ?", credentialID).First(&cred).Error; err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+func (r *webAuthnCredentialRepository) ListByUser(userID uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	var creds []*model.WebAuthnCredential
+	if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&creds).Error; err != nil {
+		return nil, fmt.Errorf("list webauthn credentials error: %w", err)
+	}
+	return creds, nil
+}
+
+func (r *webAuthnCredentialRepository) UpdateSignCount(id uuid.UUID, signCount int64, usedAt time.Time) error {
+	err := r.db.Model(&model.WebAuthnCredential{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"sign_count":   signCount,
+			"last_used_at": usedAt,
+			"updated_at":   usedAt,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("update webauthn sign count error: %w", err)
+	}
+	return nil
+}
+
+func (r *webAuthnCredentialRepository) Delete(userID, id uuid.UUID) (bool, error) {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.WebAuthnCredential{})
+	if res.Error != nil {
+		return false, fmt.Errorf("delete webauthn credential error: %w", res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // SetupRoutes 设置路由
-func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHandler, adminHandler *handler.AdminHandler, friendHandler *handler.FriendHandler, wsHandler *handler.WSHandler, jwtSvc service.JwtService, blacklistRepo repository.AccessTokenBlacklistRepository) *gin.Engine {
+func SetupRoutes(userHandler *handler.UserHandler, twoFactorHandler *handler.TwoFactorHandler, passkeyHandler *handler.PasskeyHandler, deviceHandler *handler.DeviceHandler, fileHandler *handler.FileHandler, adminHandler *handler.AdminHandler, friendHandler *handler.FriendHandler, chatHandler *handler.ChatHandler, wsHandler *handler.WSHandler, chatStreamHandler *handler.ChatStreamHandler, chatHub *handler.ChatHub, jwtSvc service.JwtService, blacklistRepo repository.AccessTokenBlacklistRepository, sessionRepo repository.SessionRepository) *gin.Engine {
 	// 创建Gin引擎
 	r := gin.Default()
 
@@ -45,8 +45,37 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 			users.POST("/reset-password", userHandler.ResetPassword)
 			users.POST("/send-activation-code", userHandler.SendActivationCode)
 			users.POST("/activate", userHandler.ActivateAccount)
-			users.GET("/me", middleware.AuthMiddleware(jwtSvc, blacklistRepo), userHandler.GetMe)
-			users.PUT("/me", middleware.AuthMiddleware(jwtSvc, blacklistRepo), userHandler.UpdateProfile)
+			users.GET("/me", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo), userHandler.GetMe)
+			users.PUT("/me", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo), userHandler.UpdateProfile)
+			// 修改邮箱：验证码发送到新邮箱，撤销凭证发送到原邮箱
+			users.POST("/me/email", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo), userHandler.RequestEmailChange)
+			users.POST("/me/email/confirm", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo), userHandler.ConfirmEmailChange)
+			users.POST("/email/undo", userHandler.UndoEmailChange)
+			// 登录会话
+			sessions := users.Group("/me/sessions", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
+			sessions.GET("", userHandler.ListSessions)
+			sessions.DELETE("", userHandler.RevokeOtherSessions)
+			sessions.DELETE("/:id", userHandler.RevokeSession)
+			// 受信任设备
+			devices := users.Group("/me/devices", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
+			devices.GET("", deviceHandler.ListDevices)
+			devices.PATCH("/:id", deviceHandler.UpdateDevice)
+			devices.DELETE("/:id", deviceHandler.RevokeDevice)
+			// 两步验证（TOTP）
+			twoFactor := users.Group("/me/2fa", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
+			twoFactor.GET("", twoFactorHandler.GetStatus)
+			twoFactor.POST("/totp/setup", twoFactorHandler.SetupTOTP)
+			twoFactor.POST("/totp/confirm", twoFactorHandler.ConfirmTOTP)
+			twoFactor.POST("/totp/disable", twoFactorHandler.DisableTOTP)
+			twoFactor.POST("/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+			// 通行密钥（WebAuthn）
+			passkeys := users.Group("/me/passkeys", middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
+			passkeys.GET("", passkeyHandler.ListPasskeys)
+			passkeys.POST("/register/begin", passkeyHandler.BeginRegistration)
+			passkeys.POST("/register/finish", passkeyHandler.FinishRegistration)
+			passkeys.DELETE("/:id", passkeyHandler.DeletePasskey)
+			users.POST("/passkeys/login/begin", passkeyHandler.BeginLogin)
+			users.POST("/passkeys/login/finish", passkeyHandler.FinishLogin)
 			users.GET("/username/:username", userHandler.GetUserByUsername)
 			users.GET("/:id", userHandler.GetUserByID)
 		}
@@ -57,10 +86,10 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 			// 公开路由
 			files.GET("/public", fileHandler.GetPublicFiles)
 			files.GET("/storages", fileHandler.GetStorageInfo)
-			files.GET("/:id", fileHandler.GetFile) // 支持公开和私有文件访问
+			files.GET("/:id", middleware.OptionalAuthMiddleware(jwtSvc, blacklistRepo, sessionRepo), fileHandler.GetFile) // 支持公开和私有文件访问
 
 			// 需要认证的路由
-			authFileRoutes := files.Group("/").Use(middleware.AuthMiddleware(jwtSvc, blacklistRepo))
+			authFileRoutes := files.Group("/").Use(middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
 			authFileRoutes.POST("/upload", fileHandler.UploadFile)
 			authFileRoutes.POST("/upload-multiple", fileHandler.UploadFiles)
 			authFileRoutes.GET("/my", fileHandler.GetUserFiles)
@@ -70,7 +99,7 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 
 		// 好友相关路由（需要认证）
 		friends := v1.Group("/friends")
-		friends.Use(middleware.AuthMiddleware(jwtSvc, blacklistRepo))
+		friends.Use(middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
 		{
 			friends.POST("/requests", friendHandler.CreateRequest)
 			friends.GET("/requests/incoming", friendHandler.ListIncomingRequests)
@@ -88,8 +117,32 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 			friends.GET("/blocks", friendHandler.ListBlocks)
 		}
 
+		// 聊天相关路由（需要认证）
+		chat := v1.Group("/chat")
+		chat.Use(middleware.AuthMiddleware(jwtSvc, blacklistRepo, sessionRepo))
+		{
+			chat.GET("/rooms", chatHandler.ListRooms)
+			chat.GET("/rooms/:id/messages", chatHandler.ListMessages)
+			chat.GET("/search", chatHandler.SearchMessages)
+			chat.PATCH("/messages/:id", chatHandler.EditMessage)
+			chat.DELETE("/messages/:id", chatHandler.DeleteMessage)
+			chat.POST("/messages/:id/recall", chatHandler.RecallMessage)
+			chat.GET("/messages/:id/edits", chatHandler.ListMessageEdits)
+
+			chat.POST("/groups", chatHandler.CreateGroup)
+			chat.GET("/groups/:id/members", chatHandler.ListGroupMembers)
+			chat.POST("/groups/:id/members", chatHandler.InviteGroupMembers)
+			chat.DELETE("/groups/:id/members/:user_id", chatHandler.KickGroupMember)
+			chat.PUT("/groups/:id/members/:user_id/role", chatHandler.UpdateGroupMemberRole)
+			chat.POST("/groups/:id/leave", chatHandler.LeaveGroup)
+			chat.POST("/groups/:id/transfer", chatHandler.TransferGroup)
+		}
+
 		// WebSocket 路由（鉴权由 handler 内部处理：支持 Authorization 头或 query token）
 		v1.GET("/ws/chat", wsHandler.Chat)
+		// SSE 下行与 REST 上行，供无法建立 WebSocket 的客户端使用（鉴权方式同上）
+		v1.GET("/chat/stream", chatStreamHandler.Stream)
+		v1.POST("/chat/frames", chatStreamHandler.SendFrame)
 
 		// 管理员相关路由
 		admin := v1.Group("/admin")
@@ -112,6 +165,7 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 			authAdminRoutes.GET("/users/:id", adminHandler.GetUserDetail)
 			authAdminRoutes.PUT("/users/:id/status", adminHandler.UpdateUserStatus)
 			authAdminRoutes.PUT("/users/:id/password", adminHandler.UpdateUserPassword)
+			authAdminRoutes.DELETE("/users/:id/login-lockout", adminHandler.ClearUserLoginLockout)
 			authAdminRoutes.DELETE("/users/:id", adminHandler.DeleteUser)
 			// 好友功能封禁（管理员）
 			authAdminRoutes.POST("/users/:id/friend-ban", adminHandler.AdminSetFriendBan)
@@ -120,6 +174,10 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 			authAdminRoutes.GET("/stats/users", adminHandler.GetUserStats)
 			// 用户行为日志（按用户）
 			authAdminRoutes.GET("/users/:id/action-logs", adminHandler.ListUserActionLogs)
+			// 用户设备（管理员）
+			authAdminRoutes.GET("/users/:id/devices", adminHandler.AdminListUserDevices)
+			authAdminRoutes.PATCH("/users/:id/devices/:device_id", adminHandler.AdminUpdateUserDevice)
+			authAdminRoutes.DELETE("/users/:id/devices/:device_id", adminHandler.AdminDeleteUserDevice)
 
 			// 文件管理相关路由（管理员）
 			authAdminRoutes.GET("/files", adminHandler.AdminListFiles)
@@ -135,9 +193,17 @@ func SetupRoutes(userHandler *handler.UserHandler, fileHandler *handler.FileHand
 			authAdminRoutes.GET("/logs", adminHandler.ListAdminLogs)
 			// 管理员统计：网络流量
 			authAdminRoutes.GET("/stats/traffic", adminHandler.GetTrafficStats)
+			// 管理员统计：聊天连接发送队列
+			authAdminRoutes.GET("/stats/chat", chatHub.GetQueueStats)
 		}
 	}
 
+	// JWT 公钥（JWKS），供其他服务校验本服务签发的 token；HS256 模式下为空
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, jwtSvc.JWKS())
+	})
+
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
 		response.SuccessResponse(c, 200, "服务正常", gin.H{
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// ChatDelivery 一次投递：把 Payload 写给 UserIDs 在各实例上的全部连接
+// ExcludeConnID 用于跳过发送方自身的连接（连接ID全局唯一，跨实例有效）
+// Close 为 true 时写入 Payload 后关闭这些连接（封禁、拉黑等强制下线）
+type ChatDelivery struct {
+	UserIDs       []uuid.UUID     `json:"user_ids"`
+	ExcludeConnID string          `json:"exclude_conn_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	Close         bool            `json:"close,omitempty"`
+}
+
+// encodeChatFrame 按当前协议版本编码一帧服务端事件
+func encodeChatFrame(typ model.ChatFrameType, payload interface{}) (json.RawMessage, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(model.ChatFrame{V: model.ChatProtocolVersion, Type: typ, Payload: raw})
+}
+
+// ChatBroker 聊天消息分发器
+// 发送方只负责 Publish；每个实例通过 Subscribe 注册回调，把投递写到本地连接
+type ChatBroker interface {
+	// Publish 发布一次投递
+	Publish(ctx context.Context, d *ChatDelivery) error
+	// Subscribe 注册本实例的投递回调，需在 Publish 之前调用
+	Subscribe(handler func(*ChatDelivery)) error
+	// Close 释放订阅资源
+	Close() error
+}
+
+// localChatBroker 进程内分发（单实例部署）
+type localChatBroker struct {
+	mu       sync.RWMutex
+	handlers []func(*ChatDelivery)
+}
+
+// NewLocalChatBroker 创建进程内分发器
+func NewLocalChatBroker() ChatBroker {
+	return &localChatBroker{}
+}
+
+func (b *localChatBroker) Publish(ctx context.Context, d *ChatDelivery) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(d)
+	}
+	return nil
+}
+
+func (b *localChatBroker) Subscribe(handler func(*ChatDelivery)) error {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *localChatBroker) Close() error { return nil }
+
+// redisChatBroker 基于 Redis pub/sub 的跨实例分发
+// 所有实例订阅同一频道，收到后只写本实例上存在的连接；发布实例自身也经由订阅收到消息
+type redisChatBroker struct {
+	rdb     *redis.Client
+	channel string
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+	cancel context.CancelFunc
+}
+
+// NewRedisChatBroker 创建 Redis 分发器
+func NewRedisChatBroker(rdb *redis.Client, channel string) ChatBroker {
+	return &redisChatBroker{rdb: rdb, channel: channel}
+}
+
+func (b *redisChatBroker) Publish(ctx context.Context, d *ChatDelivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("序列化聊天投递失败: %w", err)
+	}
+	if err := b.rdb.Publish(ctx, b.channel, data).Err(); err != nil {
+		return fmt.Errorf("发布聊天消息失败: %w", err)
+	}
+	return nil
+}
+
+func (b *redisChatBroker) Subscribe(handler func(*ChatDelivery)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pubsub != nil {
+		return fmt.Errorf("聊天分发器已订阅")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ps := b.rdb.Subscribe(ctx, b.channel)
+	// 等待订阅确认，确保此后发布的消息不会丢失
+	if _, err := ps.Receive(ctx); err != nil {
+		cancel()
+		_ = ps.Close()
+		return fmt.Errorf("订阅聊天频道失败: %w", err)
+	}
+	b.pubsub = ps
+	b.cancel = cancel
+
+	go func() {
+		for msg := range ps.Channel() {
+			var d ChatDelivery
+			if err := json.Unmarshal([]byte(msg.Payload), &d); err != nil {
+				log.Printf("解析聊天投递失败: %v", err)
+				continue
+			}
+			handler(&d)
+		}
+	}()
+	return nil
+}
+
+func (b *redisChatBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pubsub == nil {
+		return nil
+	}
+	b.cancel()
+	err := b.pubsub.Close()
+	b.pubsub = nil
+	return err
+}
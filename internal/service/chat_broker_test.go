@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// newTestRedis 启动 miniredis，返回服务端与一个新的客户端；每个客户端模拟一个实例的连接池
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return mr, newTestRedisClient(t, mr)
+}
+
+func newTestRedisClient(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
+// subscribeChan 订阅分发器，把收到的投递写入通道
+func subscribeChan(t *testing.T, b ChatBroker) <-chan *ChatDelivery {
+	t.Helper()
+	ch := make(chan *ChatDelivery, 16)
+	if err := b.Subscribe(func(d *ChatDelivery) { ch <- d }); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return ch
+}
+
+func receiveDelivery(t *testing.T, ch <-chan *ChatDelivery) *ChatDelivery {
+	t.Helper()
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("未在超时前收到投递")
+		return nil
+	}
+}
+
+func TestRedisChatBrokerFanOutAcrossInstances(t *testing.T) {
+	mr, rdbA := newTestRedis(t)
+	rdbB := newTestRedisClient(t, mr)
+	brokerA := NewRedisChatBroker(rdbA, "chat:test")
+	brokerB := NewRedisChatBroker(rdbB, "chat:test")
+	chA := subscribeChan(t, brokerA)
+	chB := subscribeChan(t, brokerB)
+
+	userID := uuid.New()
+	sent := &ChatDelivery{
+		UserIDs:       []uuid.UUID{userID},
+		ExcludeConnID: "conn-a",
+		Payload:       json.RawMessage(`{"v":1,"type":"message"}`),
+	}
+	if err := brokerA.Publish(context.Background(), sent); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// 发布实例自身与其他实例都经由订阅收到同一投递
+	for name, ch := range map[string]<-chan *ChatDelivery{"A": chA, "B": chB} {
+		got := receiveDelivery(t, ch)
+		if len(got.UserIDs) != 1 || got.UserIDs[0] != userID {
+			t.Errorf("实例%s UserIDs = %v", name, got.UserIDs)
+		}
+		if got.ExcludeConnID != "conn-a" {
+			t.Errorf("实例%s ExcludeConnID = %q", name, got.ExcludeConnID)
+		}
+		if string(got.Payload) != string(sent.Payload) {
+			t.Errorf("实例%s Payload = %s", name, got.Payload)
+		}
+		if got.Close {
+			t.Errorf("实例%s Close = true", name)
+		}
+	}
+}
+
+func TestRedisChatBrokerCloseDelivery(t *testing.T) {
+	mr, rdbA := newTestRedis(t)
+	brokerA := NewRedisChatBroker(rdbA, "chat:test")
+	brokerB := NewRedisChatBroker(newTestRedisClient(t, mr), "chat:test")
+	chB := subscribeChan(t, brokerB)
+
+	if err := brokerA.Publish(context.Background(), &ChatDelivery{
+		UserIDs: []uuid.UUID{uuid.New()},
+		Payload: json.RawMessage(`{"v":1,"type":"error"}`),
+		Close:   true,
+	}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := receiveDelivery(t, chB); !got.Close {
+		t.Error("强制下线投递跨实例后丢失了 Close 标记")
+	}
+}
+
+func TestRedisChatBrokerIgnoresOtherChannels(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	ch := subscribeChan(t, NewRedisChatBroker(rdb, "chat:a"))
+
+	if err := NewRedisChatBroker(rdb, "chat:b").Publish(context.Background(), &ChatDelivery{Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case d := <-ch:
+		t.Fatalf("收到了其他频道的投递: %+v", d)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRedisChatBrokerSubscribeTwice(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	b := NewRedisChatBroker(rdb, "chat:test")
+	subscribeChan(t, b)
+	if err := b.Subscribe(func(*ChatDelivery) {}); err == nil {
+		t.Fatal("重复订阅应返回错误")
+	}
+}
+
+func TestRedisChatBrokerStopsAfterClose(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	b := NewRedisChatBroker(rdb, "chat:test")
+	ch := subscribeChan(t, b)
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := b.Publish(context.Background(), &ChatDelivery{Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case d := <-ch:
+		t.Fatalf("关闭后仍收到投递: %+v", d)
+	case <-time.After(200 * time.Millisecond):
+	}
+	// 关闭后可重新订阅
+	if err := b.Subscribe(func(*ChatDelivery) {}); err != nil {
+		t.Fatalf("关闭后重新订阅失败: %v", err)
+	}
+}
+
+func TestRedisChatBrokerResubscribesAfterReconnect(t *testing.T) {
+	mr, rdbA := newTestRedis(t)
+	brokerA := NewRedisChatBroker(rdbA, "chat:test")
+	brokerB := NewRedisChatBroker(newTestRedisClient(t, mr), "chat:test")
+	chB := subscribeChan(t, brokerB)
+
+	// Redis 重启会断开订阅连接，go-redis 重连后需自动恢复订阅
+	mr.Close()
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		_ = brokerA.Publish(context.Background(), &ChatDelivery{Payload: json.RawMessage(`{"v":1}`)})
+		select {
+		case <-chB:
+			return
+		case <-deadline:
+			t.Fatal("Redis 重启后订阅未恢复")
+		case <-tick.C:
+		}
+	}
+}
+
+func TestLocalChatBrokerDeliversToAllHandlers(t *testing.T) {
+	b := NewLocalChatBroker()
+	var got []string
+	_ = b.Subscribe(func(d *ChatDelivery) { got = append(got, "first:"+d.ExcludeConnID) })
+	_ = b.Subscribe(func(d *ChatDelivery) { got = append(got, "second:"+d.ExcludeConnID) })
+	if err := b.Publish(context.Background(), &ChatDelivery{ExcludeConnID: "c1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(got) != 2 || got[0] != "first:c1" || got[1] != "second:c1" {
+		t.Fatalf("got %v", got)
+	}
+}
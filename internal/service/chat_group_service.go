@@ -0,0 +1,342 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxChatGroupMembers 群成员数上限（含群主）
+const maxChatGroupMembers = 200
+
+// ChatGroupService 群聊管理：创建、邀请、移出、退出、转让群主
+// 权限：owner 可执行全部操作；admin 可邀请并移出普通成员；member 仅可退出
+// 邀请时要求邀请人与被邀请人为好友
+// 邀请、移出、退出、转让群主与角色变更成功后，经 ChatBroker 向相关成员推送 member 事件
+
+type ChatGroupService interface {
+	CreateGroup(ctx context.Context, ownerID uuid.UUID, name string, memberIDs []uuid.UUID) (*model.ChatRoom, error)
+	ListMembers(ctx context.Context, userID, roomID uuid.UUID) ([]model.ChatRoomMember, error)
+	Invite(ctx context.Context, actorID, roomID uuid.UUID, userIDs []uuid.UUID) error
+	Kick(ctx context.Context, actorID, roomID, userID uuid.UUID) error
+	// Leave 退出群聊；群主需先转让，唯一成员为群主时退出即解散
+	Leave(ctx context.Context, userID, roomID uuid.UUID) error
+	TransferOwnership(ctx context.Context, actorID, roomID, newOwnerID uuid.UUID) error
+	UpdateMemberRole(ctx context.Context, actorID, roomID, userID uuid.UUID, role model.ChatMemberRole) error
+}
+
+type chatGroupService struct {
+	roomRepo   repository.ChatRoomRepository
+	memberRepo repository.ChatRoomMemberRepository
+	friendRepo repository.FriendshipRepository
+	broker     ChatBroker
+}
+
+func NewChatGroupService(roomRepo repository.ChatRoomRepository, memberRepo repository.ChatRoomMemberRepository, friendRepo repository.FriendshipRepository, broker ChatBroker) ChatGroupService {
+	return &chatGroupService{
+		roomRepo:   roomRepo,
+		memberRepo: memberRepo,
+		friendRepo: friendRepo,
+		broker:     broker,
+	}
+}
+
+func (s *chatGroupService) CreateGroup(ctx context.Context, ownerID uuid.UUID, name string, memberIDs []uuid.UUID) (*model.ChatRoom, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("群名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > 50 {
+		return nil, errors.New("群名称长度不能超过50字符")
+	}
+	memberIDs = dedupeUUIDs(memberIDs, ownerID)
+	if len(memberIDs)+1 > maxChatGroupMembers {
+		return nil, errors.New("群成员数已达上限")
+	}
+	if err := s.requireFriends(ownerID, memberIDs); err != nil {
+		return nil, err
+	}
+
+	room := &model.ChatRoom{Type: model.ChatRoomTypeGroup, Name: name, Status: "active"}
+	members := make([]model.ChatRoomMember, 0, len(memberIDs)+1)
+	members = append(members, model.ChatRoomMember{UserID: ownerID, Role: model.ChatMemberOwner})
+	for _, id := range memberIDs {
+		inviter := ownerID
+		members = append(members, model.ChatRoomMember{UserID: id, Role: model.ChatMemberMember, InvitedBy: &inviter})
+	}
+	if err := s.roomRepo.CreateGroup(room, members); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func (s *chatGroupService) ListMembers(ctx context.Context, userID, roomID uuid.UUID) ([]model.ChatRoomMember, error) {
+	if _, _, err := s.getGroupMember(roomID, userID); err != nil {
+		return nil, err
+	}
+	return s.memberRepo.List(roomID)
+}
+
+func (s *chatGroupService) Invite(ctx context.Context, actorID, roomID uuid.UUID, userIDs []uuid.UUID) error {
+	_, actor, err := s.getGroupMember(roomID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Role == model.ChatMemberMember {
+		return errors.New("仅群主或管理员可邀请成员")
+	}
+	userIDs = dedupeUUIDs(userIDs, actorID)
+	if len(userIDs) == 0 {
+		return errors.New("请指定被邀请的用户")
+	}
+	existing, err := s.memberRepo.ListUserIDs(roomID)
+	if err != nil {
+		return err
+	}
+	// 已是成员的用户忽略，不计入人数上限
+	isMember := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		isMember[id] = true
+	}
+	invited := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !isMember[id] {
+			invited = append(invited, id)
+		}
+	}
+	if len(invited) == 0 {
+		return nil
+	}
+	if len(existing)+len(invited) > maxChatGroupMembers {
+		return errors.New("群成员数已达上限")
+	}
+	if err := s.requireFriends(actorID, invited); err != nil {
+		return err
+	}
+	members := make([]model.ChatRoomMember, 0, len(invited))
+	for _, id := range invited {
+		members = append(members, model.ChatRoomMember{RoomID: roomID, UserID: id, Role: model.ChatMemberMember, InvitedBy: &actorID})
+	}
+	if err := s.memberRepo.AddMembers(members); err != nil {
+		return err
+	}
+	s.publishMemberEvent(ctx, append(existing, invited...), &model.ChatMemberEventPayload{
+		RoomID: roomID.String(), Action: model.ChatMemberInvited, ActorID: actorID.String(), UserIDs: uuidStrings(invited),
+	})
+	return nil
+}
+
+func (s *chatGroupService) Kick(ctx context.Context, actorID, roomID, userID uuid.UUID) error {
+	if actorID == userID {
+		return errors.New("不能移出自己，请使用退出群聊")
+	}
+	_, actor, err := s.getGroupMember(roomID, actorID)
+	if err != nil {
+		return err
+	}
+	target, err := s.memberRepo.Get(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("该用户不是群成员")
+		}
+		return err
+	}
+	// 群主可移出任何人；管理员只能移出普通成员
+	switch actor.Role {
+	case model.ChatMemberOwner:
+	case model.ChatMemberAdmin:
+		if target.Role != model.ChatMemberMember {
+			return errors.New("无权移出该成员")
+		}
+	default:
+		return errors.New("无权移出该成员")
+	}
+	// 变更前的成员列表，被移出的用户同样收到事件
+	recipients, err := s.memberRepo.ListUserIDs(roomID)
+	if err != nil {
+		return err
+	}
+	if err := s.memberRepo.Remove(roomID, userID); err != nil {
+		return err
+	}
+	s.publishMemberEvent(ctx, recipients, &model.ChatMemberEventPayload{
+		RoomID: roomID.String(), Action: model.ChatMemberKicked, ActorID: actorID.String(), UserIDs: []string{userID.String()},
+	})
+	return nil
+}
+
+func (s *chatGroupService) Leave(ctx context.Context, userID, roomID uuid.UUID) error {
+	_, member, err := s.getGroupMember(roomID, userID)
+	if err != nil {
+		return err
+	}
+	recipients, err := s.memberRepo.ListUserIDs(roomID)
+	if err != nil {
+		return err
+	}
+	if member.Role == model.ChatMemberOwner {
+		if len(recipients) > 1 {
+			return errors.New("群主需先转让群组")
+		}
+		// 最后一名成员退出，群聊解散
+		if err := s.roomRepo.UpdateStatus(roomID, "inactive"); err != nil {
+			return err
+		}
+	}
+	if err := s.memberRepo.Remove(roomID, userID); err != nil {
+		return err
+	}
+	// 退出者自己的其他设备同样收到事件
+	s.publishMemberEvent(ctx, recipients, &model.ChatMemberEventPayload{
+		RoomID: roomID.String(), Action: model.ChatMemberLeft, ActorID: userID.String(), UserIDs: []string{userID.String()},
+	})
+	return nil
+}
+
+func (s *chatGroupService) TransferOwnership(ctx context.Context, actorID, roomID, newOwnerID uuid.UUID) error {
+	if actorID == newOwnerID {
+		return errors.New("不能转让给自己")
+	}
+	_, actor, err := s.getGroupMember(roomID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Role != model.ChatMemberOwner {
+		return errors.New("仅群主可转让群组")
+	}
+	if _, err := s.memberRepo.Get(roomID, newOwnerID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("该用户不是群成员")
+		}
+		return err
+	}
+	if err := s.memberRepo.TransferOwner(roomID, actorID, newOwnerID); err != nil {
+		return err
+	}
+	s.publishRoomMemberEvent(ctx, roomID, &model.ChatMemberEventPayload{
+		RoomID: roomID.String(), Action: model.ChatMemberTransferred, ActorID: actorID.String(), UserIDs: []string{newOwnerID.String()},
+	})
+	return nil
+}
+
+func (s *chatGroupService) UpdateMemberRole(ctx context.Context, actorID, roomID, userID uuid.UUID, role model.ChatMemberRole) error {
+	if role != model.ChatMemberAdmin && role != model.ChatMemberMember {
+		return errors.New("无效的成员角色")
+	}
+	_, actor, err := s.getGroupMember(roomID, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Role != model.ChatMemberOwner {
+		return errors.New("仅群主可设置管理员")
+	}
+	target, err := s.memberRepo.Get(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("该用户不是群成员")
+		}
+		return err
+	}
+	if target.Role == model.ChatMemberOwner {
+		return errors.New("不能修改群主的角色")
+	}
+	if err := s.memberRepo.UpdateRole(roomID, userID, role); err != nil {
+		return err
+	}
+	s.publishRoomMemberEvent(ctx, roomID, &model.ChatMemberEventPayload{
+		RoomID: roomID.String(), Action: model.ChatMemberRoleUpdated, ActorID: actorID.String(), UserIDs: []string{userID.String()}, Role: string(role),
+	})
+	return nil
+}
+
+// publishRoomMemberEvent 向房间当前全部成员推送成员变更事件
+func (s *chatGroupService) publishRoomMemberEvent(ctx context.Context, roomID uuid.UUID, payload *model.ChatMemberEventPayload) {
+	recipients, err := s.memberRepo.ListUserIDs(roomID)
+	if err != nil {
+		log.Printf("查询群成员失败，未推送成员变更事件: %v", err)
+		return
+	}
+	s.publishMemberEvent(ctx, recipients, payload)
+}
+
+// publishMemberEvent 向 userIDs 推送成员变更事件；变更已生效，失败只记录日志
+func (s *chatGroupService) publishMemberEvent(ctx context.Context, userIDs []uuid.UUID, payload *model.ChatMemberEventPayload) {
+	payload.Timestamp = time.Now()
+	frame, err := encodeChatFrame(model.ChatFrameMember, payload)
+	if err != nil {
+		return
+	}
+	if err := s.broker.Publish(ctx, &ChatDelivery{UserIDs: userIDs, Payload: frame}); err != nil {
+		log.Printf("发布群成员变更事件失败: %v", err)
+	}
+}
+
+// getGroupMember 获取有效群聊及用户的成员记录
+func (s *chatGroupService) getGroupMember(roomID, userID uuid.UUID) (*model.ChatRoom, *model.ChatRoomMember, error) {
+	room, err := s.roomRepo.GetByID(roomID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("群聊不存在")
+		}
+		return nil, nil, err
+	}
+	if !room.IsGroup() || room.Status != "active" {
+		return nil, nil, errors.New("群聊不存在")
+	}
+	member, err := s.memberRepo.Get(roomID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("你不是该群成员")
+		}
+		return nil, nil, err
+	}
+	return room, member, nil
+}
+
+// requireFriends 校验 userIDs 均为 actorID 的好友
+func (s *chatGroupService) requireFriends(actorID uuid.UUID, userIDs []uuid.UUID) error {
+	for _, id := range userIDs {
+		ok, err := s.friendRepo.Exists(actorID, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("只能邀请好友加入群聊")
+		}
+	}
+	return nil
+}
+
+// uuidStrings 把 ID 列表转换为字符串形式
+func uuidStrings(ids []uuid.UUID) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, id.String())
+	}
+	return out
+}
+
+// dedupeUUIDs 去重并排除 self
+func dedupeUUIDs(ids []uuid.UUID, self uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]struct{}, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if id == self || id == uuid.Nil {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
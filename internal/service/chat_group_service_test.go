@@ -0,0 +1,354 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeGroupFriendRepo 只实现邀请校验用到的 Exists，好友关系单向登记即可
+type fakeGroupFriendRepo struct {
+	repository.FriendshipRepository
+	friends map[uuid.UUID][]uuid.UUID
+}
+
+func (r *fakeGroupFriendRepo) Exists(userID, friendID uuid.UUID) (bool, error) {
+	for _, id := range r.friends[userID] {
+		if id == friendID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeGroupRoomRepo 只实现群聊管理用到的 GetByID 与 UpdateStatus
+type fakeGroupRoomRepo struct {
+	repository.ChatRoomRepository
+	rooms map[uuid.UUID]*model.ChatRoom
+}
+
+func (r *fakeGroupRoomRepo) GetByID(id uuid.UUID) (*model.ChatRoom, error) {
+	if room, ok := r.rooms[id]; ok {
+		return room, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeGroupRoomRepo) UpdateStatus(id uuid.UUID, status string) error {
+	r.rooms[id].Status = status
+	return nil
+}
+
+// fakeGroupMemberRepo 内存中的群成员表
+type fakeGroupMemberRepo struct {
+	repository.ChatRoomMemberRepository
+	members map[uuid.UUID]map[uuid.UUID]*model.ChatRoomMember
+}
+
+func (r *fakeGroupMemberRepo) Get(roomID, userID uuid.UUID) (*model.ChatRoomMember, error) {
+	if m, ok := r.members[roomID][userID]; ok {
+		return m, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeGroupMemberRepo) ListUserIDs(roomID uuid.UUID) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(r.members[roomID]))
+	for id := range r.members[roomID] {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *fakeGroupMemberRepo) Count(roomID uuid.UUID) (int64, error) {
+	return int64(len(r.members[roomID])), nil
+}
+
+func (r *fakeGroupMemberRepo) AddMembers(members []model.ChatRoomMember) error {
+	for i := range members {
+		m := members[i]
+		if _, ok := r.members[m.RoomID][m.UserID]; !ok {
+			r.members[m.RoomID][m.UserID] = &m
+		}
+	}
+	return nil
+}
+
+func (r *fakeGroupMemberRepo) Remove(roomID, userID uuid.UUID) error {
+	delete(r.members[roomID], userID)
+	return nil
+}
+
+func (r *fakeGroupMemberRepo) UpdateRole(roomID, userID uuid.UUID, role model.ChatMemberRole) error {
+	r.members[roomID][userID].Role = role
+	return nil
+}
+
+func (r *fakeGroupMemberRepo) TransferOwner(roomID, fromID, toID uuid.UUID) error {
+	r.members[roomID][fromID].Role = model.ChatMemberAdmin
+	r.members[roomID][toID].Role = model.ChatMemberOwner
+	return nil
+}
+
+type groupFixture struct {
+	svc        ChatGroupService
+	rooms      *fakeGroupRoomRepo
+	members    *fakeGroupMemberRepo
+	friends    *fakeGroupFriendRepo
+	deliveries []*ChatDelivery
+	roomID     uuid.UUID
+	// 初始成员：群主、管理员、普通成员
+	owner, admin, member uuid.UUID
+}
+
+func newGroupFixture(t *testing.T) *groupFixture {
+	t.Helper()
+	f := &groupFixture{roomID: uuid.New(), owner: uuid.New(), admin: uuid.New(), member: uuid.New()}
+	f.rooms = &fakeGroupRoomRepo{rooms: map[uuid.UUID]*model.ChatRoom{
+		f.roomID: {ID: f.roomID, Type: model.ChatRoomTypeGroup, Name: "周末聚餐", Status: "active"},
+	}}
+	f.members = &fakeGroupMemberRepo{members: map[uuid.UUID]map[uuid.UUID]*model.ChatRoomMember{f.roomID: {}}}
+	f.addMember(f.owner, model.ChatMemberOwner)
+	f.addMember(f.admin, model.ChatMemberAdmin)
+	f.addMember(f.member, model.ChatMemberMember)
+	f.friends = &fakeGroupFriendRepo{friends: map[uuid.UUID][]uuid.UUID{}}
+	broker := NewLocalChatBroker()
+	_ = broker.Subscribe(func(d *ChatDelivery) { f.deliveries = append(f.deliveries, d) })
+	f.svc = NewChatGroupService(f.rooms, f.members, f.friends, broker)
+	return f
+}
+
+func (f *groupFixture) addMember(userID uuid.UUID, role model.ChatMemberRole) {
+	f.members.members[f.roomID][userID] = &model.ChatRoomMember{RoomID: f.roomID, UserID: userID, Role: role}
+}
+
+func (f *groupFixture) role(userID uuid.UUID) model.ChatMemberRole {
+	if m, ok := f.members.members[f.roomID][userID]; ok {
+		return m.Role
+	}
+	return ""
+}
+
+// befriend 登记 userID 的好友
+func (f *groupFixture) befriend(userID uuid.UUID, friendIDs ...uuid.UUID) {
+	f.friends.friends[userID] = append(f.friends.friends[userID], friendIDs...)
+}
+
+// lastMemberEvent 解析最后一次投递的 member 事件，返回事件内容与接收者
+func (f *groupFixture) lastMemberEvent(t *testing.T) (model.ChatMemberEventPayload, []uuid.UUID) {
+	t.Helper()
+	if len(f.deliveries) == 0 {
+		t.Fatal("没有推送成员变更事件")
+	}
+	d := f.deliveries[len(f.deliveries)-1]
+	var frame model.ChatFrame
+	var p model.ChatMemberEventPayload
+	if err := json.Unmarshal(d.Payload, &frame); err != nil || frame.Type != model.ChatFrameMember {
+		t.Fatalf("不是 member 帧: %s", d.Payload)
+	}
+	if err := json.Unmarshal(frame.Payload, &p); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return p, d.UserIDs
+}
+
+// sameUUIDs 忽略顺序比较两个 ID 集合
+func sameUUIDs(got, want []uuid.UUID) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	a := uuidStrings(got)
+	b := uuidStrings(want)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestChatGroupInvitePublishesEvent(t *testing.T) {
+	f := newGroupFixture(t)
+	carol := uuid.New()
+	f.befriend(f.admin, carol)
+
+	if err := f.svc.Invite(context.Background(), f.admin, f.roomID, []uuid.UUID{carol, carol, f.admin}); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	if f.role(carol) != model.ChatMemberMember {
+		t.Fatalf("carol 角色 = %q", f.role(carol))
+	}
+	p, recipients := f.lastMemberEvent(t)
+	if p.Action != model.ChatMemberInvited || p.ActorID != f.admin.String() || len(p.UserIDs) != 1 || p.UserIDs[0] != carol.String() {
+		t.Fatalf("事件 = %+v", p)
+	}
+	// 原有成员与新成员都会收到
+	if !sameUUIDs(recipients, []uuid.UUID{f.owner, f.admin, f.member, carol}) {
+		t.Fatalf("接收者 = %v", recipients)
+	}
+}
+
+func TestChatGroupInviteCapIgnoresExistingMembers(t *testing.T) {
+	ctx := context.Background()
+	f := newGroupFixture(t)
+	// 填充到距上限还差 2 人
+	for i := 3; i < maxChatGroupMembers-2; i++ {
+		f.addMember(uuid.New(), model.ChatMemberMember)
+	}
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	f.befriend(f.owner, a, b, c, f.member)
+
+	// 已是成员的用户不计入人数，恰好达到上限
+	if err := f.svc.Invite(ctx, f.owner, f.roomID, []uuid.UUID{f.member, a, b}); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	if n, _ := f.members.Count(f.roomID); n != maxChatGroupMembers {
+		t.Fatalf("成员数 = %d", n)
+	}
+	if err := f.svc.Invite(ctx, f.owner, f.roomID, []uuid.UUID{c}); err == nil || err.Error() != "群成员数已达上限" {
+		t.Fatalf("超出上限 err = %v", err)
+	}
+
+	// 邀请的用户均已是成员时不做任何变更，也不推送事件
+	sent := len(f.deliveries)
+	if err := f.svc.Invite(ctx, f.owner, f.roomID, []uuid.UUID{a, f.member}); err != nil {
+		t.Fatalf("重复邀请 err = %v", err)
+	}
+	if len(f.deliveries) != sent {
+		t.Fatal("重复邀请不应推送事件")
+	}
+}
+
+func TestChatGroupPermissions(t *testing.T) {
+	stranger, carol := uuid.New(), uuid.New()
+	tests := []struct {
+		name    string
+		call    func(f *groupFixture) error
+		wantErr string
+	}{
+		{"普通成员不能邀请", func(f *groupFixture) error {
+			f.befriend(f.member, carol)
+			return f.svc.Invite(context.Background(), f.member, f.roomID, []uuid.UUID{carol})
+		}, "仅群主或管理员可邀请成员"},
+		{"只能邀请好友", func(f *groupFixture) error {
+			return f.svc.Invite(context.Background(), f.owner, f.roomID, []uuid.UUID{carol})
+		}, "只能邀请好友加入群聊"},
+		{"非成员不能操作", func(f *groupFixture) error {
+			return f.svc.Invite(context.Background(), stranger, f.roomID, []uuid.UUID{carol})
+		}, "你不是该群成员"},
+		{"普通成员不能移出他人", func(f *groupFixture) error {
+			return f.svc.Kick(context.Background(), f.member, f.roomID, f.admin)
+		}, "无权移出该成员"},
+		{"管理员不能移出群主", func(f *groupFixture) error {
+			return f.svc.Kick(context.Background(), f.admin, f.roomID, f.owner)
+		}, "无权移出该成员"},
+		{"不能移出自己", func(f *groupFixture) error {
+			return f.svc.Kick(context.Background(), f.owner, f.roomID, f.owner)
+		}, "不能移出自己，请使用退出群聊"},
+		{"管理员不能转让群主", func(f *groupFixture) error {
+			return f.svc.TransferOwnership(context.Background(), f.admin, f.roomID, f.member)
+		}, "仅群主可转让群组"},
+		{"管理员不能设置角色", func(f *groupFixture) error {
+			return f.svc.UpdateMemberRole(context.Background(), f.admin, f.roomID, f.member, model.ChatMemberAdmin)
+		}, "仅群主可设置管理员"},
+		{"不能修改群主的角色", func(f *groupFixture) error {
+			return f.svc.UpdateMemberRole(context.Background(), f.owner, f.roomID, f.owner, model.ChatMemberMember)
+		}, "不能修改群主的角色"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newGroupFixture(t)
+			if err := tt.call(f); err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v，期望 %q", err, tt.wantErr)
+			}
+			if len(f.deliveries) != 0 {
+				t.Fatal("操作失败时不应推送事件")
+			}
+		})
+	}
+}
+
+func TestChatGroupKickPublishesToKickedUser(t *testing.T) {
+	f := newGroupFixture(t)
+	if err := f.svc.Kick(context.Background(), f.admin, f.roomID, f.member); err != nil {
+		t.Fatalf("Kick: %v", err)
+	}
+	if f.role(f.member) != "" {
+		t.Fatal("被移出的用户仍是成员")
+	}
+	p, recipients := f.lastMemberEvent(t)
+	if p.Action != model.ChatMemberKicked || p.ActorID != f.admin.String() || p.UserIDs[0] != f.member.String() {
+		t.Fatalf("事件 = %+v", p)
+	}
+	// 被移出的用户同样收到事件，客户端据此移除会话
+	if !sameUUIDs(recipients, []uuid.UUID{f.owner, f.admin, f.member}) {
+		t.Fatalf("接收者 = %v", recipients)
+	}
+}
+
+func TestChatGroupTransferOwnership(t *testing.T) {
+	ctx := context.Background()
+	f := newGroupFixture(t)
+
+	if err := f.svc.TransferOwnership(ctx, f.owner, f.roomID, f.owner); err == nil || err.Error() != "不能转让给自己" {
+		t.Fatalf("转让给自己 err = %v", err)
+	}
+	if err := f.svc.TransferOwnership(ctx, f.owner, f.roomID, uuid.New()); err == nil || err.Error() != "该用户不是群成员" {
+		t.Fatalf("转让给非成员 err = %v", err)
+	}
+	// 群主在还有其他成员时不能直接退出
+	if err := f.svc.Leave(ctx, f.owner, f.roomID); err == nil || err.Error() != "群主需先转让群组" {
+		t.Fatalf("群主退出 err = %v", err)
+	}
+
+	if err := f.svc.TransferOwnership(ctx, f.owner, f.roomID, f.member); err != nil {
+		t.Fatalf("TransferOwnership: %v", err)
+	}
+	if f.role(f.member) != model.ChatMemberOwner || f.role(f.owner) != model.ChatMemberAdmin {
+		t.Fatalf("转让后角色 新群主=%q 原群主=%q", f.role(f.member), f.role(f.owner))
+	}
+	p, recipients := f.lastMemberEvent(t)
+	if p.Action != model.ChatMemberTransferred || p.UserIDs[0] != f.member.String() || !sameUUIDs(recipients, []uuid.UUID{f.owner, f.admin, f.member}) {
+		t.Fatalf("事件 = %+v 接收者 = %v", p, recipients)
+	}
+
+	// 原群主降为管理员后可以退出，退出者自己也收到事件
+	if err := f.svc.Leave(ctx, f.owner, f.roomID); err != nil {
+		t.Fatalf("Leave: %v", err)
+	}
+	p, recipients = f.lastMemberEvent(t)
+	if p.Action != model.ChatMemberLeft || p.ActorID != f.owner.String() || !sameUUIDs(recipients, []uuid.UUID{f.owner, f.admin, f.member}) {
+		t.Fatalf("事件 = %+v 接收者 = %v", p, recipients)
+	}
+	// 原群主不再有管理权限
+	if err := f.svc.TransferOwnership(ctx, f.owner, f.roomID, f.admin); err == nil || err.Error() != "你不是该群成员" {
+		t.Fatalf("退出后转让 err = %v", err)
+	}
+}
+
+func TestChatGroupLastMemberLeaveDissolves(t *testing.T) {
+	ctx := context.Background()
+	f := newGroupFixture(t)
+	for _, id := range []uuid.UUID{f.admin, f.member} {
+		if err := f.svc.Leave(ctx, id, f.roomID); err != nil {
+			t.Fatalf("Leave: %v", err)
+		}
+	}
+	if err := f.svc.Leave(ctx, f.owner, f.roomID); err != nil {
+		t.Fatalf("群主最后退出: %v", err)
+	}
+	if f.rooms.rooms[f.roomID].Status != "inactive" {
+		t.Fatalf("群聊状态 = %s", f.rooms.rooms[f.roomID].Status)
+	}
+	if _, err := f.svc.ListMembers(ctx, f.owner, f.roomID); err == nil || err.Error() != "群聊不存在" {
+		t.Fatalf("解散后 err = %v", err)
+	}
+}
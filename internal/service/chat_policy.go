@@ -0,0 +1,149 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ChatPolicy 聊天授权策略
+// 连接时校验 token 及其所属会话未撤销且账户可用；每次发送时复查账户状态与拉黑关系；
+// 封禁、删除账户或拉黑时经 ChatBroker 强制断开目标用户在所有实例上的连接
+// 拉黑后被拉黑方重连仍可使用其他房间：一对一房间内禁止发送，群聊中拉黑方不再收到被拉黑方的消息与事件
+type ChatPolicy interface {
+	// AuthorizeConnect 校验 WebSocket 连接使用的 access token 与账户状态
+	AuthorizeConnect(ctx context.Context, token string, claims *JWTClaims) error
+	// CheckToken 连接存续期间复查 token 或其所属会话是否已被撤销，sessionID 为 uuid.Nil 时只检查黑名单
+	CheckToken(ctx context.Context, token string, sessionID uuid.UUID) error
+	// AuthorizeSend 校验用户能否向房间发送消息或事件
+	AuthorizeSend(ctx context.Context, senderID uuid.UUID, room *model.ChatRoom) error
+	// FilterRecipients 从群聊接收方中去掉拉黑了发送方的成员；一对一房间原样返回（发送已由 AuthorizeSend 拦截）
+	FilterRecipients(ctx context.Context, senderID uuid.UUID, room *model.ChatRoom, recipientIDs []uuid.UUID) ([]uuid.UUID, error)
+	// Disconnect 强制断开用户的全部连接，断开前下发带原因码的 error 帧
+	Disconnect(ctx context.Context, userID uuid.UUID, code model.ChatErrorCode, message string) error
+}
+
+type chatPolicy struct {
+	userRepo      repository.UserRepository
+	blockRepo     repository.BlockListRepository
+	blacklistRepo repository.AccessTokenBlacklistRepository
+	sessionRepo   repository.SessionRepository
+	broker        ChatBroker
+}
+
+func NewChatPolicy(userRepo repository.UserRepository, blockRepo repository.BlockListRepository, blacklistRepo repository.AccessTokenBlacklistRepository, sessionRepo repository.SessionRepository, broker ChatBroker) ChatPolicy {
+	return &chatPolicy{
+		userRepo:      userRepo,
+		blockRepo:     blockRepo,
+		blacklistRepo: blacklistRepo,
+		sessionRepo:   sessionRepo,
+		broker:        broker,
+	}
+}
+
+func (p *chatPolicy) AuthorizeConnect(ctx context.Context, token string, claims *JWTClaims) error {
+	if claims.TokenType != AccessToken {
+		return errors.New("必须使用access token")
+	}
+	if err := p.CheckToken(ctx, token, claims.SessionID); err != nil {
+		return err
+	}
+	return p.checkUserActive(claims.UserID)
+}
+
+func (p *chatPolicy) CheckToken(ctx context.Context, token string, sessionID uuid.UUID) error {
+	revoked, err := p.blacklistRepo.IsBlacklisted(ctx, token)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errors.New("token已被撤销")
+	}
+	if sessionID == uuid.Nil {
+		return nil
+	}
+	// 会话被撤销（退出登录、在其他设备上移除）后，该会话签发的 token 一并失效
+	active, err := p.sessionRepo.Exists(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return errors.New("token已被撤销")
+	}
+	return nil
+}
+
+func (p *chatPolicy) AuthorizeSend(ctx context.Context, senderID uuid.UUID, room *model.ChatRoom) error {
+	if err := p.checkUserActive(senderID); err != nil {
+		return err
+	}
+	if room.IsGroup() {
+		return nil
+	}
+	// 一对一房间：任意一方拉黑对方即禁止发送
+	peerID := room.UserAID
+	if peerID == senderID {
+		peerID = room.UserBID
+	}
+	if blocked, err := p.blockRepo.IsBlocked(peerID, senderID); err != nil {
+		return err
+	} else if blocked {
+		return errors.New("对方已将你拉黑")
+	}
+	if blocked, err := p.blockRepo.IsBlocked(senderID, peerID); err != nil {
+		return err
+	} else if blocked {
+		return errors.New("请先取消对该用户的拉黑")
+	}
+	return nil
+}
+
+func (p *chatPolicy) FilterRecipients(ctx context.Context, senderID uuid.UUID, room *model.ChatRoom, recipientIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if !room.IsGroup() {
+		return recipientIDs, nil
+	}
+	blockers, err := p.blockRepo.ListBlockersAmong(senderID, recipientIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockers) == 0 {
+		return recipientIDs, nil
+	}
+	skip := make(map[uuid.UUID]bool, len(blockers))
+	for _, id := range blockers {
+		skip[id] = true
+	}
+	filtered := make([]uuid.UUID, 0, len(recipientIDs))
+	for _, id := range recipientIDs {
+		if !skip[id] {
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered, nil
+}
+
+func (p *chatPolicy) Disconnect(ctx context.Context, userID uuid.UUID, code model.ChatErrorCode, message string) error {
+	frame, err := encodeChatFrame(model.ChatFrameError, model.ChatErrorPayload{Code: code, Message: message})
+	if err != nil {
+		return err
+	}
+	return p.broker.Publish(ctx, &ChatDelivery{UserIDs: []uuid.UUID{userID}, Payload: frame, Close: true})
+}
+
+// checkUserActive 账户被封禁、未激活或已删除时拒绝
+func (p *chatPolicy) checkUserActive(userID uuid.UUID) error {
+	user, err := p.userRepo.GetByID(userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	switch user.Status {
+	case "banned":
+		return errors.New("账户已被封禁")
+	case "inactive":
+		return errors.New("账户未激活")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newTestPolicy(t *testing.T, users ...*model.User) (ChatPolicy, *fakeBlockRepo, *[]*ChatDelivery) {
+	t.Helper()
+	broker := NewLocalChatBroker()
+	var deliveries []*ChatDelivery
+	_ = broker.Subscribe(func(d *ChatDelivery) { deliveries = append(deliveries, d) })
+	blocks := newFakeBlockRepo()
+	return NewChatPolicy(newFakeUserRepo(users...), blocks, nil, nil, broker), blocks, &deliveries
+}
+
+func activeUser() *model.User {
+	return &model.User{ID: uuid.New(), Status: "active"}
+}
+
+func TestChatPolicyAuthorizeSendChecksAccountStatus(t *testing.T) {
+	banned := &model.User{ID: uuid.New(), Status: "banned"}
+	inactive := &model.User{ID: uuid.New(), Status: "inactive"}
+	peer := activeUser()
+	policy, _, _ := newTestPolicy(t, banned, inactive, peer)
+
+	cases := []struct {
+		sender uuid.UUID
+		want   string
+	}{
+		{banned.ID, "账户已被封禁"},
+		{inactive.ID, "账户未激活"},
+		{uuid.New(), "用户不存在"},
+	}
+	for _, tc := range cases {
+		room := &model.ChatRoom{ID: uuid.New(), UserAID: tc.sender, UserBID: peer.ID, Type: model.ChatRoomTypeDirect}
+		err := policy.AuthorizeSend(context.Background(), tc.sender, room)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("AuthorizeSend = %v，期望 %q", err, tc.want)
+		}
+	}
+}
+
+func TestChatPolicyDirectRoomBlockedEitherWay(t *testing.T) {
+	alice, bob := activeUser(), activeUser()
+	policy, blocks, _ := newTestPolicy(t, alice, bob)
+	room := &model.ChatRoom{ID: uuid.New(), UserAID: alice.ID, UserBID: bob.ID, Type: model.ChatRoomTypeDirect}
+
+	if err := policy.AuthorizeSend(context.Background(), alice.ID, room); err != nil {
+		t.Fatalf("未拉黑时 AuthorizeSend = %v", err)
+	}
+	_ = blocks.Block(bob.ID, alice.ID)
+	if err := policy.AuthorizeSend(context.Background(), alice.ID, room); err == nil || err.Error() != "对方已将你拉黑" {
+		t.Errorf("被拉黑方发送 = %v", err)
+	}
+	if err := policy.AuthorizeSend(context.Background(), bob.ID, room); err == nil || err.Error() != "请先取消对该用户的拉黑" {
+		t.Errorf("拉黑方发送 = %v", err)
+	}
+}
+
+func TestChatPolicyGroupDropsBlockersFromRecipients(t *testing.T) {
+	sender, blocker, other := activeUser(), activeUser(), activeUser()
+	policy, blocks, _ := newTestPolicy(t, sender, blocker, other)
+	_ = blocks.Block(blocker.ID, sender.ID)
+	group := &model.ChatRoom{ID: uuid.New(), Type: model.ChatRoomTypeGroup, Status: "active"}
+
+	// 群聊中被拉黑方仍可发送，但拉黑方收不到
+	if err := policy.AuthorizeSend(context.Background(), sender.ID, group); err != nil {
+		t.Fatalf("AuthorizeSend = %v", err)
+	}
+	got, err := policy.FilterRecipients(context.Background(), sender.ID, group, []uuid.UUID{sender.ID, blocker.ID, other.ID})
+	if err != nil {
+		t.Fatalf("FilterRecipients: %v", err)
+	}
+	if len(got) != 2 || got[0] != sender.ID || got[1] != other.ID {
+		t.Fatalf("recipients = %v", got)
+	}
+
+	// 拉黑方自己发的消息其他成员照常收到，拉黑是单向的
+	got, _ = policy.FilterRecipients(context.Background(), blocker.ID, group, []uuid.UUID{blocker.ID, sender.ID, other.ID})
+	if len(got) != 3 {
+		t.Fatalf("拉黑方发送的 recipients = %v", got)
+	}
+}
+
+func TestChatPolicyDirectRecipientsUnchanged(t *testing.T) {
+	alice, bob := activeUser(), activeUser()
+	policy, blocks, _ := newTestPolicy(t, alice, bob)
+	_ = blocks.Block(bob.ID, alice.ID)
+	room := &model.ChatRoom{ID: uuid.New(), UserAID: alice.ID, UserBID: bob.ID, Type: model.ChatRoomTypeDirect}
+	got, err := policy.FilterRecipients(context.Background(), alice.ID, room, []uuid.UUID{alice.ID, bob.ID})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("recipients = %v err=%v", got, err)
+	}
+}
+
+func TestChatPolicyDisconnectPublishesCloseFrame(t *testing.T) {
+	user := activeUser()
+	policy, _, deliveries := newTestPolicy(t, user)
+	if err := policy.Disconnect(context.Background(), user.ID, model.ChatErrAccountDisabled, "账户已被封禁或停用"); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if len(*deliveries) != 1 {
+		t.Fatalf("deliveries = %d", len(*deliveries))
+	}
+	d := (*deliveries)[0]
+	if !d.Close || len(d.UserIDs) != 1 || d.UserIDs[0] != user.ID {
+		t.Fatalf("delivery = %+v", d)
+	}
+	var frame model.ChatFrame
+	var p model.ChatErrorPayload
+	if err := json.Unmarshal(d.Payload, &frame); err != nil || frame.Type != model.ChatFrameError {
+		t.Fatalf("frame = %s", d.Payload)
+	}
+	_ = json.Unmarshal(frame.Payload, &p)
+	if p.Code != model.ChatErrAccountDisabled {
+		t.Fatalf("code = %s", p.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chatViolationWindow 用户超限次数的统计窗口
+const chatViolationWindow = time.Minute
+
+// ChatRateLimiter 聊天上行限流
+// 用户维度的令牌桶限制该用户全部连接上行的帧（ack/read 除外），
+// 房间维度的令牌桶按（用户, 房间）限制该用户在单个房间内的消息，一个人刷屏不会挤占其他成员的配额
+// Redis 不可用时放行，仅记录日志
+type ChatRateLimiter interface {
+	// AllowUser 消耗用户令牌，不足时返回建议的重试等待时长
+	AllowUser(ctx context.Context, userID uuid.UUID) (bool, time.Duration)
+	// AllowRoom 消耗该用户在房间内的令牌
+	AllowRoom(ctx context.Context, userID, roomID uuid.UUID) (bool, time.Duration)
+	// RecordViolation 记录一次超限；窗口内首次超限与触发断开时写入用户行为日志
+	// 违规按用户累计，REST 请求没有长连接也会计入；connID 仅用于日志
+	// 返回 true 表示该用户持续超限，应断开
+	RecordViolation(ctx context.Context, userID uuid.UUID, connID, scope string) bool
+}
+
+type chatRateLimiter struct {
+	repo       repository.ChatRateLimitRepository
+	userLogSvc UserActionLogService
+	cfg        *config.ChatConfig
+}
+
+func NewChatRateLimiter(repo repository.ChatRateLimitRepository, userLogSvc UserActionLogService, cfg *config.ChatConfig) ChatRateLimiter {
+	return &chatRateLimiter{repo: repo, userLogSvc: userLogSvc, cfg: cfg}
+}
+
+func (l *chatRateLimiter) AllowUser(ctx context.Context, userID uuid.UUID) (bool, time.Duration) {
+	return l.take(ctx, "user", userID.String(), l.cfg.UserRatePerSecond, l.cfg.UserRateBurst)
+}
+
+func (l *chatRateLimiter) AllowRoom(ctx context.Context, userID, roomID uuid.UUID) (bool, time.Duration) {
+	return l.take(ctx, "room", roomID.String()+":"+userID.String(), l.cfg.RoomRatePerSecond, l.cfg.RoomRateBurst)
+}
+
+func (l *chatRateLimiter) RecordViolation(ctx context.Context, userID uuid.UUID, connID, scope string) bool {
+	count, err := l.repo.IncrViolation(ctx, userID.String(), chatViolationWindow)
+	if err != nil {
+		log.Printf("记录聊天限流违规失败: %v", err)
+		return false
+	}
+	abusive := l.cfg.RateAbuseThreshold > 0 && count >= int64(l.cfg.RateAbuseThreshold)
+	switch {
+	case abusive:
+		_ = l.userLogSvc.Create(ctx, &model.UserActionLog{
+			UserID:  &userID,
+			Action:  "chat_rate_limit_disconnect",
+			Details: fmt.Sprintf("conn:%s scope:%s violations:%d", connID, scope, count),
+		})
+	case count == 1:
+		_ = l.userLogSvc.Create(ctx, &model.UserActionLog{
+			UserID:  &userID,
+			Action:  "chat_rate_limited",
+			Details: fmt.Sprintf("conn:%s scope:%s", connID, scope),
+		})
+	}
+	return abusive
+}
+
+// take 速率或容量未配置（<=0）时不限流
+func (l *chatRateLimiter) take(ctx context.Context, scope, id string, rate float64, burst int) (bool, time.Duration) {
+	if rate <= 0 || burst <= 0 {
+		return true, 0
+	}
+	ok, wait, err := l.repo.Take(ctx, scope, id, rate, burst)
+	if err != nil {
+		log.Printf("聊天限流检查失败: %v", err)
+		return true, 0
+	}
+	return ok, wait
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeUserLogService 记录写入的用户行为日志
+type fakeUserLogService struct {
+	UserActionLogService
+	actions []string
+}
+
+func (s *fakeUserLogService) Create(ctx context.Context, log *model.UserActionLog) error {
+	s.actions = append(s.actions, log.Action)
+	return nil
+}
+
+// failingRateLimitRepo 模拟 Redis 不可用
+type failingRateLimitRepo struct {
+	repository.ChatRateLimitRepository
+}
+
+func (failingRateLimitRepo) Take(ctx context.Context, scope, id string, ratePerSecond float64, burst int) (bool, time.Duration, error) {
+	return false, 0, errFake
+}
+
+func (failingRateLimitRepo) IncrViolation(ctx context.Context, connID string, window time.Duration) (int64, error) {
+	return 0, errFake
+}
+
+func newTestLimiter(t *testing.T, cfg *config.ChatConfig) (ChatRateLimiter, *fakeUserLogService) {
+	t.Helper()
+	_, rdb := newTestRedis(t)
+	logs := &fakeUserLogService{}
+	return NewChatRateLimiter(repository.NewChatRateLimitRepository(rdb), logs, cfg), logs
+}
+
+func TestChatRateLimiterRoomBucketIsPerSender(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(t, &config.ChatConfig{RoomRatePerSecond: 0.01, RoomRateBurst: 2})
+	room, flooder, member := uuid.New(), uuid.New(), uuid.New()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.AllowRoom(ctx, flooder, room); !ok {
+			t.Fatalf("第 %d 条消息应放行", i+1)
+		}
+	}
+	ok, wait := limiter.AllowRoom(ctx, flooder, room)
+	if ok || wait <= 0 {
+		t.Fatalf("刷屏者超出容量后 ok=%v wait=%v", ok, wait)
+	}
+	// 其他成员在同一房间、刷屏者在其他房间都不受影响
+	if ok, _ := limiter.AllowRoom(ctx, member, room); !ok {
+		t.Fatal("一个成员刷屏不应限制同房间的其他成员")
+	}
+	if ok, _ := limiter.AllowRoom(ctx, flooder, uuid.New()); !ok {
+		t.Fatal("房间桶不应跨房间共享")
+	}
+}
+
+func TestChatRateLimiterUnconfiguredAllows(t *testing.T) {
+	ctx := context.Background()
+	limiter, _ := newTestLimiter(t, &config.ChatConfig{})
+	user := uuid.New()
+	for i := 0; i < 100; i++ {
+		if ok, _ := limiter.AllowUser(ctx, user); !ok {
+			t.Fatal("速率为 0 时不应限流")
+		}
+	}
+}
+
+func TestChatRateLimiterFailsOpen(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewChatRateLimiter(failingRateLimitRepo{}, &fakeUserLogService{},
+		&config.ChatConfig{UserRatePerSecond: 1, UserRateBurst: 1, RateAbuseThreshold: 1})
+	if ok, _ := limiter.AllowUser(ctx, uuid.New()); !ok {
+		t.Fatal("Redis 不可用时应放行")
+	}
+	if limiter.RecordViolation(ctx, uuid.New(), "conn", "user") {
+		t.Fatal("Redis 不可用时不应断开连接")
+	}
+}
+
+func TestChatRateLimiterRecordViolationThreshold(t *testing.T) {
+	ctx := context.Background()
+	limiter, logs := newTestLimiter(t, &config.ChatConfig{RateAbuseThreshold: 3})
+	user := uuid.New()
+
+	// 违规按用户累计：每次 REST 请求使用新的临时连接，也会计入同一个计数
+	for i, connID := range []string{"conn-1", "rest-1"} {
+		if limiter.RecordViolation(ctx, user, connID, "user") {
+			t.Fatalf("第 %d 次超限不应断开", i+1)
+		}
+	}
+	if !limiter.RecordViolation(ctx, user, "rest-2", "user") {
+		t.Fatal("达到阈值应断开")
+	}
+	// 其他用户的违规次数独立计算
+	if limiter.RecordViolation(ctx, uuid.New(), "conn-2", "user") {
+		t.Fatal("其他用户的违规次数应独立计算")
+	}
+	want := []string{"chat_rate_limited", "chat_rate_limit_disconnect", "chat_rate_limited"}
+	if len(logs.actions) != len(want) {
+		t.Fatalf("日志 %v，期望 %v", logs.actions, want)
+	}
+	for i := range want {
+		if logs.actions[i] != want[i] {
+			t.Fatalf("日志 %v，期望 %v", logs.actions, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxChatSearchTerms 单次搜索最多使用的关键词数，多余的忽略
+	maxChatSearchTerms = 5
+	// chatSnippetRunes 命中片段的最大长度（字符数，不含省略号）
+	chatSnippetRunes = 60
+	// chatSnippetLead 片段中第一个命中之前保留的字符数
+	chatSnippetLead = 15
+)
+
+// splitSearchTerms 按空白拆分关键词，忽略大小写去重，最多保留 maxChatSearchTerms 个
+func splitSearchTerms(q string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Fields(q) {
+		key := strings.ToLower(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		terms = append(terms, t)
+		if len(terms) == maxChatSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// highlightSnippet 截取第一个命中附近的片段，HTML 转义后用 <mark></mark> 包裹全部命中
+// 按字符（rune）处理，中文不会被截断；大小写不敏感，按子串标记，覆盖全文检索命中的词
+func highlightSnippet(content string, terms []string) string {
+	text := []rune(content)
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	needles := make([][]rune, 0, len(terms))
+	for _, t := range terms {
+		if n := []rune(strings.ToLower(t)); len(n) > 0 {
+			needles = append(needles, n)
+		}
+	}
+
+	// marks[i] > 0 表示从 i 开始命中，值为命中长度；重叠的命中只保留先出现（同起点取最长）的一个
+	marks := make([]int, len(text))
+	first := -1
+	for i := 0; i < len(lower); {
+		best := 0
+		for _, n := range needles {
+			if len(n) > best && hasPrefixRunes(lower[i:], n) {
+				best = len(n)
+			}
+		}
+		if best == 0 {
+			i++
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		marks[i] = best
+		i += best
+	}
+
+	start := 0
+	if first > chatSnippetLead {
+		start = first - chatSnippetLead
+	}
+	end := start + chatSnippetRunes
+	if end > len(text) {
+		end = len(text)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		if n := marks[i]; n > 0 {
+			stop := i + n
+			if stop > end {
+				stop = end
+			}
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(string(text[i:stop])))
+			b.WriteString("</mark>")
+			i = stop
+			continue
+		}
+		j := i + 1
+		for j < end && marks[j] == 0 {
+			j++
+		}
+		b.WriteString(html.EscapeString(string(text[i:j])))
+		i = j
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func hasPrefixRunes(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSearchTerms(t *testing.T) {
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{"你好", []string{"你好"}},
+		{"  周末 聚餐  ", []string{"周末", "聚餐"}},
+		{"Go go GO 语言", []string{"Go", "语言"}},
+		{"a b c d e f g", []string{"a", "b", "c", "d", "e"}},
+	}
+	for _, tc := range cases {
+		if got := splitSearchTerms(tc.q); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitSearchTerms(%q) = %v，期望 %v", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		terms   []string
+		want    string
+	}{
+		{
+			name:    "中文句中的词",
+			content: "我们周末一起去吃火锅吧",
+			terms:   []string{"火锅"},
+			want:    "我们周末一起去吃<mark>火锅</mark>吧",
+		},
+		{
+			name:    "大小写不敏感且保留原文大小写",
+			content: "Meeting at 3pm, bring the meeting notes",
+			terms:   []string{"MEETING"},
+			want:    "<mark>Meeting</mark> at 3pm, bring the <mark>meeting</mark> notes",
+		},
+		{
+			name:    "多个关键词",
+			content: "明天 review 代码",
+			terms:   []string{"review", "代码"},
+			want:    "明天 <mark>review</mark> <mark>代码</mark>",
+		},
+		{
+			name:    "内容先转义再高亮",
+			content: "<b>x</b> & 你好",
+			terms:   []string{"你好"},
+			want:    "&lt;b&gt;x&lt;/b&gt; &amp; <mark>你好</mark>",
+		},
+		{
+			name:    "关键词中的特殊字符按字面匹配",
+			content: "a<b and a<b",
+			terms:   []string{"a<b"},
+			want:    "<mark>a&lt;b</mark> and <mark>a&lt;b</mark>",
+		},
+		{
+			name:    "重叠命中取最长",
+			content: "火锅店",
+			terms:   []string{"火锅", "火锅店"},
+			want:    "<mark>火锅店</mark>",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := highlightSnippet(tc.content, tc.terms); got != tc.want {
+				t.Errorf("got %q\nwant %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippetTruncatesAroundFirstHit(t *testing.T) {
+	content := strings.Repeat("前", 40) + "关键词" + strings.Repeat("后", 80)
+	got := highlightSnippet(content, []string{"关键词"})
+	want := "…" + strings.Repeat("前", chatSnippetLead) + "<mark>关键词</mark>" +
+		strings.Repeat("后", chatSnippetRunes-chatSnippetLead-3) + "…"
+	if got != want {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+}
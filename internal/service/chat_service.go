@@ -0,0 +1,476 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"backend/internal/response"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxChatContentLength 单条消息内容的最大字符数（发送与编辑共用）
+const MaxChatContentLength = 4000
+
+// MaxChatAttachments 单条消息最多携带的附件数
+const MaxChatAttachments = 9
+
+const (
+	defaultChatHistoryLimit = 20
+	maxChatHistoryLimit     = 100
+	defaultChatRoomLimit    = 20
+	maxChatRoomLimit        = 100
+	defaultChatSearchLimit  = 20
+	maxChatSearchLimit      = 50
+)
+
+// ChatService 聊天相关服务（历史消息查询、会话列表、已读回执等）
+
+type ChatService interface {
+	// ListMessages 分页获取房间历史消息；before/after 为消息ID游标，最多指定其一
+	ListMessages(ctx context.Context, userID, roomID uuid.UUID, before, after *uuid.UUID, limit int) (*model.ChatMessageListResponse, error)
+	// ListRooms 分页获取用户的会话列表，含最后一条消息、未读数与对方资料，按最近活跃倒序
+	ListRooms(ctx context.Context, userID uuid.UUID, page, limit int) (*model.ChatRoomListResponse, error)
+	// MarkRead 把用户在房间内的已读位置推进到指定消息，返回房间全部参与者
+	// changed 为 false 表示已读位置未前进（重复或更早的回执），调用方无需通知其他参与者
+	MarkRead(ctx context.Context, userID, roomID, messageID uuid.UUID) (memberIDs []uuid.UUID, changed bool, err error)
+	// ResolveRoom 校验用户为房间参与者，返回房间及全部参与者ID（含自己）
+	ResolveRoom(ctx context.Context, userID, roomID uuid.UUID) (*model.ChatRoom, []uuid.UUID, error)
+	// EditMessage 编辑自己发送的消息并保留编辑历史，通知房间全部参与者
+	EditMessage(ctx context.Context, userID, messageID uuid.UUID, content string) (*model.ChatMessage, error)
+	// RecallMessage 在撤回时限内撤回自己发送的消息，消息变为墓碑，通知房间全部参与者
+	RecallMessage(ctx context.Context, userID, messageID uuid.UUID) (*model.ChatMessage, error)
+	// HideMessage 仅对自己删除消息，同步到自己的其他设备
+	HideMessage(ctx context.Context, userID, messageID uuid.UUID) error
+	// ListMessageEdits 获取消息的编辑历史，按时间正序
+	ListMessageEdits(ctx context.Context, userID, messageID uuid.UUID) ([]model.ChatMessageEdit, error)
+	// ResolveAttachments 校验待发送的附件均为 userID 上传的文件，按传入顺序返回附件元数据
+	ResolveAttachments(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]model.ChatAttachment, error)
+	// SearchMessages 按关键词检索用户参与的有效房间内的消息，可按好友、房间与时间范围筛选
+	SearchMessages(ctx context.Context, userID uuid.UUID, req *model.ChatSearchRequest) (*model.ChatSearchResponse, error)
+}
+
+type chatService struct {
+	roomRepo   repository.ChatRoomRepository
+	msgRepo    repository.ChatMessageRepository
+	readRepo   repository.ChatReadStateRepository
+	memberRepo repository.ChatRoomMemberRepository
+	userRepo   repository.UserRepository
+	fileRepo   repository.FileRepository
+	broker     ChatBroker
+	// policy 编辑、撤回与发送新消息使用同一授权策略
+	policy ChatPolicy
+	// recallWindow 消息发出后允许撤回的时长
+	recallWindow time.Duration
+}
+
+func NewChatService(roomRepo repository.ChatRoomRepository, msgRepo repository.ChatMessageRepository, readRepo repository.ChatReadStateRepository, memberRepo repository.ChatRoomMemberRepository, userRepo repository.UserRepository, fileRepo repository.FileRepository, broker ChatBroker, policy ChatPolicy, recallWindow time.Duration) ChatService {
+	return &chatService{
+		roomRepo:     roomRepo,
+		msgRepo:      msgRepo,
+		readRepo:     readRepo,
+		memberRepo:   memberRepo,
+		userRepo:     userRepo,
+		fileRepo:     fileRepo,
+		broker:       broker,
+		policy:       policy,
+		recallWindow: recallWindow,
+	}
+}
+
+func (s *chatService) ListMessages(ctx context.Context, userID, roomID uuid.UUID, before, after *uuid.UUID, limit int) (*model.ChatMessageListResponse, error) {
+	if before != nil && after != nil {
+		return nil, errors.New("before 与 after 不能同时指定")
+	}
+	if limit <= 0 {
+		limit = defaultChatHistoryLimit
+	}
+	if limit > maxChatHistoryLimit {
+		limit = maxChatHistoryLimit
+	}
+
+	// 仅房间参与者可查看历史
+	if _, _, err := s.ResolveRoom(ctx, userID, roomID); err != nil {
+		return nil, err
+	}
+
+	// 解析游标，游标消息必须属于该房间
+	var cursor *model.ChatMessage
+	var err error
+	if cursorID := firstCursor(before, after); cursorID != nil {
+		cursor, err = s.msgRepo.GetByID(*cursorID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("游标消息不存在")
+			}
+			return nil, err
+		}
+		if cursor.RoomID != roomID {
+			return nil, errors.New("游标消息不存在")
+		}
+	}
+
+	// 多取一条用于判断是否还有更多
+	var list []model.ChatMessage
+	if after != nil {
+		list, err = s.msgRepo.ListAfter(roomID, userID, cursor, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		hasMore := len(list) > limit
+		if hasMore {
+			list = list[:limit]
+		}
+		return &model.ChatMessageListResponse{Messages: list, HasMore: hasMore}, nil
+	}
+
+	list, err = s.msgRepo.ListBefore(roomID, userID, cursor, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(list) > limit
+	if hasMore {
+		// 正序结果中多出的一条位于最前面
+		list = list[1:]
+	}
+	return &model.ChatMessageListResponse{Messages: list, HasMore: hasMore}, nil
+}
+
+func (s *chatService) ListRooms(ctx context.Context, userID uuid.UUID, page, limit int) (*model.ChatRoomListResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = defaultChatRoomLimit
+	}
+	if limit > maxChatRoomLimit {
+		limit = maxChatRoomLimit
+	}
+
+	rooms, total, err := s.roomRepo.ListByUser(userID, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	roomIDs := make([]uuid.UUID, 0, len(rooms))
+	peerIDs := make([]uuid.UUID, 0, len(rooms))
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+		if !room.IsGroup() {
+			peerIDs = append(peerIDs, peerOf(&room, userID))
+		}
+	}
+
+	lastMsgs, err := s.msgRepo.GetLastByRooms(roomIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	states, err := s.readRepo.ListByUser(userID, roomIDs)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.readRepo.CountUnread(userID, roomIDs)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.userRepo.GetByIDs(peerIDs)
+	if err != nil {
+		return nil, err
+	}
+	peers := make(map[uuid.UUID]*model.ChatRoomPeer, len(users))
+	for _, u := range users {
+		peers[u.ID] = &model.ChatRoomPeer{ID: u.ID, Username: u.Username, Nickname: u.Nickname, Avatar: u.Avatar}
+	}
+
+	items := make([]model.ChatRoomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		item := model.ChatRoomSummary{
+			ID:            room.ID,
+			Type:          room.Type,
+			Name:          room.Name,
+			Status:        room.Status,
+			LastMessageAt: room.LastMessageAt,
+			UnreadCount:   unread[room.ID],
+		}
+		if !room.IsGroup() {
+			item.Peer = peers[peerOf(&room, userID)]
+		}
+		if m, ok := lastMsgs[room.ID]; ok {
+			item.LastMessage = &m
+		}
+		if st, ok := states[room.ID]; ok {
+			item.LastReadMessageID = st.LastReadMessageID
+		}
+		items = append(items, item)
+	}
+	return &model.ChatRoomListResponse{Rooms: items, Total: total, Page: page, Limit: limit}, nil
+}
+
+func (s *chatService) MarkRead(ctx context.Context, userID, roomID, messageID uuid.UUID) ([]uuid.UUID, bool, error) {
+	_, memberIDs, err := s.ResolveRoom(ctx, userID, roomID)
+	if err != nil {
+		return nil, false, err
+	}
+	msg, err := s.msgRepo.GetByID(messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, errors.New("消息不存在")
+		}
+		return nil, false, err
+	}
+	if msg.RoomID != roomID {
+		return nil, false, errors.New("消息不存在")
+	}
+	changed, err := s.readRepo.MarkRead(roomID, userID, msg.ID, msg.Seq)
+	if err != nil {
+		return nil, false, err
+	}
+	return memberIDs, changed, nil
+}
+
+func (s *chatService) ResolveRoom(ctx context.Context, userID, roomID uuid.UUID) (*model.ChatRoom, []uuid.UUID, error) {
+	room, err := s.roomRepo.GetByID(roomID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("聊天房间不存在")
+		}
+		return nil, nil, err
+	}
+	if !room.IsGroup() {
+		if room.UserAID != userID && room.UserBID != userID {
+			return nil, nil, errors.New("无权访问该聊天房间")
+		}
+		return room, []uuid.UUID{room.UserAID, room.UserBID}, nil
+	}
+	memberIDs, err := s.memberRepo.ListUserIDs(roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range memberIDs {
+		if id == userID {
+			return room, memberIDs, nil
+		}
+	}
+	return nil, nil, errors.New("无权访问该聊天房间")
+}
+
+func (s *chatService) EditMessage(ctx context.Context, userID, messageID uuid.UUID, content string) (*model.ChatMessage, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("消息内容不能为空")
+	}
+	if utf8.RuneCountInString(content) > MaxChatContentLength {
+		return nil, errors.New("消息内容过长")
+	}
+	msg, memberIDs, err := s.getOwnMessage(ctx, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.RecalledAt != nil {
+		return nil, errors.New("消息已撤回")
+	}
+	if msg.Content == content {
+		return msg, nil
+	}
+	if err := s.msgRepo.Edit(msg, content, time.Now()); err != nil {
+		return nil, err
+	}
+	s.publishUpdate(ctx, model.ChatFrameEdit, memberIDs, msg, userID)
+	return msg, nil
+}
+
+func (s *chatService) RecallMessage(ctx context.Context, userID, messageID uuid.UUID) (*model.ChatMessage, error) {
+	msg, memberIDs, err := s.getOwnMessage(ctx, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.RecalledAt != nil {
+		return msg, nil
+	}
+	if time.Since(msg.CreatedAt) > s.recallWindow {
+		return nil, errors.New("已超过可撤回时间")
+	}
+	if err := s.msgRepo.Recall(msg, time.Now()); err != nil {
+		return nil, err
+	}
+	s.publishUpdate(ctx, model.ChatFrameRecall, memberIDs, msg, userID)
+	return msg, nil
+}
+
+func (s *chatService) HideMessage(ctx context.Context, userID, messageID uuid.UUID) error {
+	msg, _, _, err := s.getVisibleMessage(ctx, userID, messageID)
+	if err != nil {
+		return err
+	}
+	if err := s.msgRepo.Hide(msg.ID, userID); err != nil {
+		return err
+	}
+	s.publishUpdate(ctx, model.ChatFrameDelete, []uuid.UUID{userID}, msg, userID)
+	return nil
+}
+
+func (s *chatService) ListMessageEdits(ctx context.Context, userID, messageID uuid.UUID) ([]model.ChatMessageEdit, error) {
+	msg, _, _, err := s.getVisibleMessage(ctx, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return s.msgRepo.ListEdits(msg.ID)
+}
+
+func (s *chatService) ResolveAttachments(ctx context.Context, userID uuid.UUID, fileIDs []uuid.UUID) ([]model.ChatAttachment, error) {
+	if len(fileIDs) > MaxChatAttachments {
+		return nil, errors.New("附件数量过多")
+	}
+	seen := make(map[uuid.UUID]struct{}, len(fileIDs))
+	list := make([]model.ChatAttachment, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		file, err := s.fileRepo.GetByID(id)
+		if err != nil {
+			if errors.Is(err, response.ErrFileNotFound) {
+				return nil, errors.New("附件不存在")
+			}
+			return nil, err
+		}
+		// 只能转发自己上传的文件，避免借消息获取他人私有文件的访问权限
+		if file.UserID == nil || *file.UserID != userID {
+			return nil, errors.New("只能发送自己上传的文件")
+		}
+		list = append(list, file.ToChatAttachment())
+	}
+	return list, nil
+}
+
+func (s *chatService) SearchMessages(ctx context.Context, userID uuid.UUID, req *model.ChatSearchRequest) (*model.ChatSearchResponse, error) {
+	query := strings.TrimSpace(req.Q)
+	if query == "" {
+		return nil, errors.New("搜索关键词不能为空")
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && req.From.After(req.To) {
+		return nil, errors.New("开始时间不能晚于结束时间")
+	}
+	page, limit := req.Page, req.Limit
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = defaultChatSearchLimit
+	}
+	if limit > maxChatSearchLimit {
+		limit = maxChatSearchLimit
+	}
+
+	filter := &model.ChatSearchFilter{UserID: userID, Terms: splitSearchTerms(query)}
+	if req.PeerID != "" {
+		id, err := uuid.Parse(req.PeerID)
+		if err != nil {
+			return nil, errors.New("无效的用户ID")
+		}
+		filter.PeerID = &id
+	}
+	if req.RoomID != "" {
+		id, err := uuid.Parse(req.RoomID)
+		if err != nil {
+			return nil, errors.New("无效的房间ID")
+		}
+		filter.RoomID = &id
+	}
+	if !req.From.IsZero() {
+		filter.From = &req.From
+	}
+	if !req.To.IsZero() {
+		filter.To = &req.To
+	}
+
+	hits, total, err := s.msgRepo.Search(filter, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].Snippet = highlightSnippet(hits[i].Content, filter.Terms)
+		hits[i].Content = ""
+	}
+	return &model.ChatSearchResponse{Hits: hits, Total: total, Page: page, Limit: limit}, nil
+}
+
+// getVisibleMessage 获取消息并校验用户为所在房间参与者
+func (s *chatService) getVisibleMessage(ctx context.Context, userID, messageID uuid.UUID) (*model.ChatMessage, *model.ChatRoom, []uuid.UUID, error) {
+	msg, err := s.msgRepo.GetByID(messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil, errors.New("消息不存在")
+		}
+		return nil, nil, nil, err
+	}
+	room, memberIDs, err := s.ResolveRoom(ctx, userID, msg.RoomID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return msg, room, memberIDs, nil
+}
+
+// getOwnMessage 获取用户自己发送、且仍可修改的消息，返回变更事件的接收方
+// 与发送新消息相同：房间须有效，并经 ChatPolicy 校验账户状态与拉黑关系
+func (s *chatService) getOwnMessage(ctx context.Context, userID, messageID uuid.UUID) (*model.ChatMessage, []uuid.UUID, error) {
+	msg, room, memberIDs, err := s.getVisibleMessage(ctx, userID, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.SenderID != userID {
+		return nil, nil, errors.New("只能操作自己发送的消息")
+	}
+	if room.Status != "active" {
+		return nil, nil, errors.New("聊天房间已关闭")
+	}
+	if err := s.policy.AuthorizeSend(ctx, userID, room); err != nil {
+		return nil, nil, err
+	}
+	recipients, err := s.policy.FilterRecipients(ctx, userID, room, memberIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, recipients, nil
+}
+
+// publishUpdate 向 userIDs 推送消息变更事件，失败只记录日志
+func (s *chatService) publishUpdate(ctx context.Context, typ model.ChatFrameType, userIDs []uuid.UUID, msg *model.ChatMessage, actorID uuid.UUID) {
+	frame, err := encodeChatFrame(typ, model.ChatMessageUpdatePayload{
+		MessageID:  msg.ID.String(),
+		RoomID:     msg.RoomID.String(),
+		UserID:     actorID.String(),
+		Content:    msg.Content,
+		EditedAt:   msg.EditedAt,
+		RecalledAt: msg.RecalledAt,
+	})
+	if err != nil {
+		return
+	}
+	if err := s.broker.Publish(ctx, &ChatDelivery{UserIDs: userIDs, Payload: frame}); err != nil {
+		log.Printf("发布消息变更事件失败: %v", err)
+	}
+}
+
+// peerOf 返回一对一房间中另一方的用户ID
+func peerOf(room *model.ChatRoom, userID uuid.UUID) uuid.UUID {
+	if room.UserAID == userID {
+		return room.UserBID
+	}
+	return room.UserAID
+}
+
+// firstCursor 返回第一个非空的游标
+func firstCursor(ids ...*uuid.UUID) *uuid.UUID {
+	for _, id := range ids {
+		if id != nil {
+			return id
+		}
+	}
+	return nil
+}
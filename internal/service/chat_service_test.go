@@ -0,0 +1,303 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type fakeRoomRepo struct {
+	repository.ChatRoomRepository
+	rooms map[uuid.UUID]*model.ChatRoom
+}
+
+func (r *fakeRoomRepo) GetByID(id uuid.UUID) (*model.ChatRoom, error) {
+	room, ok := r.rooms[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return room, nil
+}
+
+type fakeMemberRepo struct {
+	repository.ChatRoomMemberRepository
+	members map[uuid.UUID][]uuid.UUID
+}
+
+func (r *fakeMemberRepo) ListUserIDs(roomID uuid.UUID) ([]uuid.UUID, error) {
+	return r.members[roomID], nil
+}
+
+// fakeChatMessageRepo 记录编辑与撤回调用
+type fakeChatMessageRepo struct {
+	repository.ChatMessageRepository
+	msgs    map[uuid.UUID]*model.ChatMessage
+	edits   int
+	recalls int
+}
+
+func (r *fakeChatMessageRepo) GetByID(id uuid.UUID) (*model.ChatMessage, error) {
+	m, ok := r.msgs[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (r *fakeChatMessageRepo) Edit(msg *model.ChatMessage, content string, editedAt time.Time) error {
+	r.edits++
+	msg.Content = content
+	msg.EditedAt = &editedAt
+	return nil
+}
+
+func (r *fakeChatMessageRepo) Recall(msg *model.ChatMessage, recalledAt time.Time) error {
+	r.recalls++
+	msg.Content = ""
+	msg.RecalledAt = &recalledAt
+	return nil
+}
+
+// chatServiceFixture 一对一房间 direct（sender 与 peer）和群聊 group（sender、peer、blocker），sender 在两个房间各发了一条消息
+type chatServiceFixture struct {
+	svc                   ChatService
+	users                 *fakeUserRepo
+	blocks                *fakeBlockRepo
+	msgs                  *fakeChatMessageRepo
+	direct, group         *model.ChatRoom
+	sender, peer, blocker uuid.UUID
+	directMsg, groupMsg   uuid.UUID
+	deliveries            *[]*ChatDelivery
+}
+
+func newChatServiceFixture(t *testing.T) *chatServiceFixture {
+	t.Helper()
+	f := &chatServiceFixture{sender: uuid.New(), peer: uuid.New(), blocker: uuid.New()}
+	f.users = newFakeUserRepo(
+		&model.User{ID: f.sender, Status: "active"},
+		&model.User{ID: f.peer, Status: "active"},
+		&model.User{ID: f.blocker, Status: "active"},
+	)
+	f.blocks = newFakeBlockRepo()
+	f.direct = &model.ChatRoom{ID: uuid.New(), Type: model.ChatRoomTypeDirect, UserAID: f.sender, UserBID: f.peer, Status: "active"}
+	f.group = &model.ChatRoom{ID: uuid.New(), Type: model.ChatRoomTypeGroup, Status: "active"}
+	f.directMsg, f.groupMsg = uuid.New(), uuid.New()
+	now := time.Now()
+	f.msgs = &fakeChatMessageRepo{msgs: map[uuid.UUID]*model.ChatMessage{
+		f.directMsg: {ID: f.directMsg, RoomID: f.direct.ID, SenderID: f.sender, Content: "hi", CreatedAt: now},
+		f.groupMsg:  {ID: f.groupMsg, RoomID: f.group.ID, SenderID: f.sender, Content: "hi all", CreatedAt: now},
+	}}
+	broker := NewLocalChatBroker()
+	var deliveries []*ChatDelivery
+	_ = broker.Subscribe(func(d *ChatDelivery) { deliveries = append(deliveries, d) })
+	f.deliveries = &deliveries
+	policy := NewChatPolicy(f.users, f.blocks, nil, nil, broker)
+	f.svc = NewChatService(
+		&fakeRoomRepo{rooms: map[uuid.UUID]*model.ChatRoom{f.direct.ID: f.direct, f.group.ID: f.group}},
+		f.msgs, nil,
+		&fakeMemberRepo{members: map[uuid.UUID][]uuid.UUID{f.group.ID: {f.sender, f.peer, f.blocker}}},
+		f.users, nil, broker, policy, time.Hour)
+	return f
+}
+
+func TestChatServiceEditRecallEnforceSendPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		setup   func(f *chatServiceFixture)
+		message func(f *chatServiceFixture) uuid.UUID
+		want    string
+	}{
+		{
+			name:    "账户被封禁",
+			setup:   func(f *chatServiceFixture) { f.users.users[f.sender].Status = "banned" },
+			message: func(f *chatServiceFixture) uuid.UUID { return f.directMsg },
+			want:    "账户已被封禁",
+		},
+		{
+			name:    "房间已关闭",
+			setup:   func(f *chatServiceFixture) { f.direct.Status = "inactive" },
+			message: func(f *chatServiceFixture) uuid.UUID { return f.directMsg },
+			want:    "聊天房间已关闭",
+		},
+		{
+			name:    "被对方拉黑",
+			setup:   func(f *chatServiceFixture) { _ = f.blocks.Block(f.peer, f.sender) },
+			message: func(f *chatServiceFixture) uuid.UUID { return f.directMsg },
+			want:    "对方已将你拉黑",
+		},
+		{
+			name:    "群已解散",
+			setup:   func(f *chatServiceFixture) { f.group.Status = "inactive" },
+			message: func(f *chatServiceFixture) uuid.UUID { return f.groupMsg },
+			want:    "聊天房间已关闭",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newChatServiceFixture(t)
+			tc.setup(f)
+			id := tc.message(f)
+			if _, err := f.svc.EditMessage(context.Background(), f.sender, id, "changed"); err == nil || err.Error() != tc.want {
+				t.Errorf("EditMessage = %v，期望 %q", err, tc.want)
+			}
+			if _, err := f.svc.RecallMessage(context.Background(), f.sender, id); err == nil || err.Error() != tc.want {
+				t.Errorf("RecallMessage = %v，期望 %q", err, tc.want)
+			}
+			if f.msgs.edits != 0 || f.msgs.recalls != 0 || len(*f.deliveries) != 0 {
+				t.Errorf("被拒绝后仍修改了消息: edits=%d recalls=%d deliveries=%d", f.msgs.edits, f.msgs.recalls, len(*f.deliveries))
+			}
+		})
+	}
+}
+
+func TestChatServiceEditSkipsGroupBlockers(t *testing.T) {
+	f := newChatServiceFixture(t)
+	_ = f.blocks.Block(f.blocker, f.sender)
+
+	msg, err := f.svc.EditMessage(context.Background(), f.sender, f.groupMsg, "changed")
+	if err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if msg.Content != "changed" || f.msgs.edits != 1 {
+		t.Fatalf("msg=%+v edits=%d", msg, f.msgs.edits)
+	}
+	if len(*f.deliveries) != 1 {
+		t.Fatalf("deliveries = %d", len(*f.deliveries))
+	}
+	for _, id := range (*f.deliveries)[0].UserIDs {
+		if id == f.blocker {
+			t.Fatal("拉黑方不应收到被拉黑方的编辑事件")
+		}
+	}
+}
+
+func TestChatServiceRecallWindowAndOwnership(t *testing.T) {
+	f := newChatServiceFixture(t)
+	if _, err := f.svc.RecallMessage(context.Background(), f.peer, f.directMsg); err == nil || err.Error() != "只能操作自己发送的消息" {
+		t.Fatalf("撤回他人消息 = %v", err)
+	}
+	f.msgs.msgs[f.directMsg].CreatedAt = time.Now().Add(-2 * time.Hour)
+	if _, err := f.svc.RecallMessage(context.Background(), f.sender, f.directMsg); err == nil || err.Error() != "已超过可撤回时间" {
+		t.Fatalf("超时撤回 = %v", err)
+	}
+}
+
+// fakeHistoryRepo 按时间正序保存的房间消息，实现历史分页查询
+type fakeHistoryRepo struct {
+	repository.ChatMessageRepository
+	msgs []model.ChatMessage
+}
+
+func (r *fakeHistoryRepo) GetByID(id uuid.UUID) (*model.ChatMessage, error) {
+	for _, m := range r.msgs {
+		if m.ID == id {
+			cp := m
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeHistoryRepo) ListBefore(roomID, viewerID uuid.UUID, cursor *model.ChatMessage, limit int) ([]model.ChatMessage, error) {
+	var list []model.ChatMessage
+	for _, m := range r.msgs {
+		if m.RoomID == roomID && (cursor == nil || m.CreatedAt.Before(cursor.CreatedAt)) {
+			list = append(list, m)
+		}
+	}
+	if len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	return list, nil
+}
+
+func (r *fakeHistoryRepo) ListAfter(roomID, viewerID uuid.UUID, cursor *model.ChatMessage, limit int) ([]model.ChatMessage, error) {
+	var list []model.ChatMessage
+	for _, m := range r.msgs {
+		if m.RoomID == roomID && (cursor == nil || m.CreatedAt.After(cursor.CreatedAt)) && len(list) < limit {
+			list = append(list, m)
+		}
+	}
+	return list, nil
+}
+
+func TestChatServiceListMessagesPagination(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	room := &model.ChatRoom{ID: uuid.New(), Type: model.ChatRoomTypeDirect, UserAID: alice, UserBID: bob, Status: "active"}
+	other := &model.ChatRoom{ID: uuid.New(), Type: model.ChatRoomTypeDirect, UserAID: alice, UserBID: uuid.New(), Status: "active"}
+	base := time.Now().Add(-time.Hour)
+	repo := &fakeHistoryRepo{}
+	var ids []uuid.UUID
+	for i := 0; i < 5; i++ {
+		id := uuid.New()
+		ids = append(ids, id)
+		repo.msgs = append(repo.msgs, model.ChatMessage{ID: id, RoomID: room.ID, SenderID: alice, CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	foreign := model.ChatMessage{ID: uuid.New(), RoomID: other.ID, SenderID: alice, CreatedAt: base}
+	repo.msgs = append(repo.msgs, foreign)
+	svc := NewChatService(&fakeRoomRepo{rooms: map[uuid.UUID]*model.ChatRoom{room.ID: room, other.ID: other}},
+		repo, nil, nil, nil, nil, nil, nil, time.Hour)
+
+	page := func(before, after *uuid.UUID, limit int) ([]uuid.UUID, bool) {
+		t.Helper()
+		resp, err := svc.ListMessages(ctx, bob, room.ID, before, after, limit)
+		if err != nil {
+			t.Fatalf("ListMessages: %v", err)
+		}
+		var got []uuid.UUID
+		for _, m := range resp.Messages {
+			got = append(got, m.ID)
+		}
+		return got, resp.HasMore
+	}
+	expect := func(name string, got []uuid.UUID, hasMore bool, want []uuid.UUID, wantMore bool) {
+		t.Helper()
+		if len(got) != len(want) || hasMore != wantMore {
+			t.Fatalf("%s: %v has_more=%v，期望 %v has_more=%v", name, got, hasMore, want, wantMore)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: %v，期望 %v", name, got, want)
+			}
+		}
+	}
+
+	// 不带游标返回最新的一页，按时间正序
+	got, more := page(nil, nil, 2)
+	expect("最新一页", got, more, ids[3:], true)
+	got, more = page(&ids[3], nil, 2)
+	expect("before 向前翻页", got, more, ids[1:3], true)
+	got, more = page(&ids[1], nil, 2)
+	expect("最早一页", got, more, ids[:1], false)
+	got, more = page(nil, &ids[1], 2)
+	expect("after 向后补齐", got, more, ids[2:4], true)
+	got, more = page(nil, &ids[3], 2)
+	expect("after 到达最新", got, more, ids[4:], false)
+
+	missing := uuid.New()
+	errCases := []struct {
+		name          string
+		userID        uuid.UUID
+		before, after *uuid.UUID
+		wantErr       string
+	}{
+		{"非参与者", uuid.New(), nil, nil, "无权访问该聊天房间"},
+		{"同时指定两个游标", bob, &ids[1], &ids[3], "before 与 after 不能同时指定"},
+		{"游标属于其他房间", bob, &foreign.ID, nil, "游标消息不存在"},
+		{"游标不存在", bob, nil, &missing, "游标消息不存在"},
+	}
+	for _, tc := range errCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := svc.ListMessages(ctx, tc.userID, room.ID, tc.before, tc.after, 10); err == nil || err.Error() != tc.wantErr {
+				t.Fatalf("err = %v，期望 %q", err, tc.wantErr)
+			}
+		})
+	}
+}
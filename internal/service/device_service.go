@@ -0,0 +1,167 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DeviceService 受信任设备管理
+// 设备由登录时的陌生设备验证创建；取消信任或移除设备时，撤销该设备上的全部登录会话
+type DeviceService interface {
+	// ListDevices 列出用户的设备
+	ListDevices(ctx context.Context, userID uuid.UUID) ([]*model.DeviceResponse, error)
+	// UpdateDevice 重命名设备或取消信任
+	UpdateDevice(ctx context.Context, userID, id uuid.UUID, req *model.UpdateDeviceRequest) (*model.DeviceResponse, error)
+	// RevokeDevice 移除设备并撤销其上的会话，返回撤销的会话数量
+	RevokeDevice(ctx context.Context, userID, id uuid.UUID) (int, error)
+}
+
+type deviceService struct {
+	deviceRepo  repository.DeviceRepository
+	sessionRepo repository.SessionRepository
+	userLogSvc  UserActionLogService
+}
+
+// NewDeviceService 创建设备服务实例
+func NewDeviceService(deviceRepo repository.DeviceRepository, sessionRepo repository.SessionRepository, userLogSvc UserActionLogService) DeviceService {
+	return &deviceService{
+		deviceRepo:  deviceRepo,
+		sessionRepo: sessionRepo,
+		userLogSvc:  userLogSvc,
+	}
+}
+
+func (s *deviceService) ListDevices(ctx context.Context, userID uuid.UUID) ([]*model.DeviceResponse, error) {
+	devices, err := s.deviceRepo.ListDevicesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.sessionCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.DeviceResponse, 0, len(devices))
+	for _, d := range devices {
+		res = append(res, toDeviceResponse(d, counts[d.DeviceID]))
+	}
+	return res, nil
+}
+
+func (s *deviceService) UpdateDevice(ctx context.Context, userID, id uuid.UUID, req *model.UpdateDeviceRequest) (*model.DeviceResponse, error) {
+	d, err := s.getOwned(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.IsTrusted != nil && *req.IsTrusted && !d.IsTrusted {
+		return nil, errors.New("设备需通过登录验证后才能受信任")
+	}
+
+	untrust := req.IsTrusted != nil && !*req.IsTrusted && d.IsTrusted
+	if req.DeviceName != nil {
+		d.DeviceName = *req.DeviceName
+	}
+	if untrust {
+		d.IsTrusted = false
+	}
+	if err := s.deviceRepo.UpdateDevice(d); err != nil {
+		return nil, err
+	}
+
+	// 取消信任等同于在该设备上退出登录，下次登录需重新完成设备验证
+	if untrust {
+		revoked, err := s.sessionRepo.DeleteByDevice(ctx, userID, d.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		s.logAction(ctx, userID, d, "untrust_device", len(revoked))
+	}
+
+	counts, err := s.sessionCounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toDeviceResponse(d, counts[d.DeviceID]), nil
+}
+
+func (s *deviceService) RevokeDevice(ctx context.Context, userID, id uuid.UUID) (int, error) {
+	d, err := s.getOwned(userID, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.deviceRepo.DeleteDevice(d.ID); err != nil {
+		return 0, err
+	}
+	revoked, err := s.sessionRepo.DeleteByDevice(ctx, userID, d.DeviceID)
+	if err != nil {
+		return 0, err
+	}
+	s.logAction(ctx, userID, d, "revoke_device", len(revoked))
+	return len(revoked), nil
+}
+
+// getOwned 查询设备并确认属于该用户；不属于时与不存在同样处理，避免泄露其他用户的设备ID
+func (s *deviceService) getOwned(userID, id uuid.UUID) (*model.UserDevice, error) {
+	d, err := s.deviceRepo.GetDeviceByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("设备不存在")
+		}
+		return nil, fmt.Errorf("查询设备失败: %w", err)
+	}
+	if d.UserID != userID {
+		return nil, errors.New("设备不存在")
+	}
+	return d, nil
+}
+
+// sessionCounts 按设备指纹统计用户的有效会话数量
+func (s *deviceService) sessionCounts(ctx context.Context, userID uuid.UUID) (map[string]int, error) {
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(sessions))
+	for _, sess := range sessions {
+		if sess.DeviceID != "" {
+			counts[sess.DeviceID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *deviceService) logAction(ctx context.Context, userID uuid.UUID, d *model.UserDevice, action string, revokedSessions int) {
+	details, _ := json.Marshal(map[string]any{
+		"device":           d.ID.String(),
+		"revoked_sessions": revokedSessions,
+	})
+	_ = s.userLogSvc.Create(ctx, &model.UserActionLog{
+		UserID:     &userID,
+		Action:     action,
+		DeviceID:   d.DeviceID,
+		DeviceName: d.DeviceName,
+		DeviceType: d.DeviceType,
+		Details:    string(details),
+	})
+}
+
+func toDeviceResponse(d *model.UserDevice, activeSessions int) *model.DeviceResponse {
+	return &model.DeviceResponse{
+		ID:             d.ID,
+		DeviceName:     d.DeviceName,
+		DeviceType:     d.DeviceType,
+		UserAgent:      d.UserAgent,
+		IPAddress:      d.IPAddress,
+		Location:       d.Location,
+		IsTrusted:      d.IsTrusted,
+		LastLoginAt:    d.LastLoginAt,
+		CreatedAt:      d.CreatedAt,
+		ActiveSessions: activeSessions,
+	}
+}
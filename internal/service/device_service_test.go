@@ -0,0 +1,173 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeDeviceRepo 内存中的设备表
+type fakeDeviceRepo struct {
+	repository.DeviceRepository
+	devices map[uuid.UUID]*model.UserDevice
+}
+
+func (r *fakeDeviceRepo) GetDeviceByID(id uuid.UUID) (*model.UserDevice, error) {
+	d, ok := r.devices[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *d
+	return &cp, nil
+}
+
+func (r *fakeDeviceRepo) UpdateDevice(device *model.UserDevice) error {
+	cp := *device
+	r.devices[device.ID] = &cp
+	return nil
+}
+
+func (r *fakeDeviceRepo) ListDevicesByUser(userID uuid.UUID) ([]*model.UserDevice, error) {
+	var res []*model.UserDevice
+	for _, d := range r.devices {
+		if d.UserID == userID {
+			cp := *d
+			res = append(res, &cp)
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeDeviceRepo) DeleteDevice(id uuid.UUID) error {
+	delete(r.devices, id)
+	return nil
+}
+
+type deviceFixture struct {
+	svc      DeviceService
+	devices  *fakeDeviceRepo
+	sessions repository.SessionRepository
+	logs     *fakeUserLogService
+	userID   uuid.UUID
+	laptop   *model.UserDevice
+	phone    *model.UserDevice
+}
+
+func newDeviceFixture(t *testing.T) *deviceFixture {
+	t.Helper()
+	_, rdb := newTestRedis(t)
+	f := &deviceFixture{
+		devices:  &fakeDeviceRepo{devices: make(map[uuid.UUID]*model.UserDevice)},
+		sessions: repository.NewSessionRepository(rdb),
+		logs:     &fakeUserLogService{},
+		userID:   uuid.New(),
+	}
+	f.svc = NewDeviceService(f.devices, f.sessions, f.logs)
+	f.laptop = f.addDevice("fp-laptop", f.userID)
+	f.phone = f.addDevice("fp-phone", f.userID)
+	return f
+}
+
+func (f *deviceFixture) addDevice(fingerprint string, userID uuid.UUID) *model.UserDevice {
+	d := &model.UserDevice{ID: uuid.New(), UserID: userID, DeviceID: fingerprint, DeviceName: fingerprint, IsTrusted: true}
+	f.devices.devices[d.ID] = d
+	return d
+}
+
+// login 在指定设备上创建会话
+func (f *deviceFixture) login(t *testing.T, d *model.UserDevice) uuid.UUID {
+	t.Helper()
+	now := time.Now()
+	s := &model.UserSession{ID: uuid.New(), UserID: f.userID, DeviceID: d.DeviceID, CreatedAt: now, LastUsedAt: now}
+	if err := f.sessions.Create(context.Background(), s, "rt-"+s.ID.String(), time.Hour); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return s.ID
+}
+
+func (f *deviceFixture) sessionExists(t *testing.T, id uuid.UUID) bool {
+	t.Helper()
+	ok, err := f.sessions.Exists(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Exists: %v", err)
+	}
+	return ok
+}
+
+func TestRevokeDeviceDeletesItsSessions(t *testing.T) {
+	ctx := context.Background()
+	f := newDeviceFixture(t)
+	laptop1, laptop2 := f.login(t, f.laptop), f.login(t, f.laptop)
+	phone := f.login(t, f.phone)
+
+	devices, err := f.svc.ListDevices(ctx, f.userID)
+	if err != nil || len(devices) != 2 {
+		t.Fatalf("ListDevices = %+v, %v", devices, err)
+	}
+	for _, d := range devices {
+		if want := map[uuid.UUID]int{f.laptop.ID: 2, f.phone.ID: 1}[d.ID]; d.ActiveSessions != want {
+			t.Fatalf("%s ActiveSessions = %d，期望 %d", d.DeviceName, d.ActiveSessions, want)
+		}
+	}
+
+	revoked, err := f.svc.RevokeDevice(ctx, f.userID, f.laptop.ID)
+	if err != nil || revoked != 2 {
+		t.Fatalf("RevokeDevice = %d, %v", revoked, err)
+	}
+	if f.sessionExists(t, laptop1) || f.sessionExists(t, laptop2) {
+		t.Fatal("移除设备后其会话仍存在")
+	}
+	if !f.sessionExists(t, phone) {
+		t.Fatal("其他设备的会话不应被撤销")
+	}
+	if _, ok := f.devices.devices[f.laptop.ID]; ok {
+		t.Fatal("设备未被删除")
+	}
+	if len(f.logs.actions) != 1 || f.logs.actions[0] != "revoke_device" {
+		t.Fatalf("行为日志 = %v", f.logs.actions)
+	}
+}
+
+func TestUntrustDeviceDeletesItsSessions(t *testing.T) {
+	ctx := context.Background()
+	f := newDeviceFixture(t)
+	laptop := f.login(t, f.laptop)
+	phone := f.login(t, f.phone)
+	untrust, rename := false, "Work laptop"
+
+	resp, err := f.svc.UpdateDevice(ctx, f.userID, f.laptop.ID, &model.UpdateDeviceRequest{DeviceName: &rename, IsTrusted: &untrust})
+	if err != nil || resp.IsTrusted || resp.DeviceName != rename || resp.ActiveSessions != 0 {
+		t.Fatalf("UpdateDevice = %+v, %v", resp, err)
+	}
+	if f.sessionExists(t, laptop) || !f.sessionExists(t, phone) {
+		t.Fatal("取消信任应只撤销该设备的会话")
+	}
+
+	// 已取消信任的设备不能直接恢复信任，须重新完成登录验证
+	trust := true
+	if _, err := f.svc.UpdateDevice(ctx, f.userID, f.laptop.ID, &model.UpdateDeviceRequest{IsTrusted: &trust}); err == nil || err.Error() != "设备需通过登录验证后才能受信任" {
+		t.Fatalf("恢复信任 err = %v", err)
+	}
+}
+
+func TestDeviceServiceRejectsOtherUsersDevice(t *testing.T) {
+	ctx := context.Background()
+	f := newDeviceFixture(t)
+	other := f.addDevice("fp-other", uuid.New())
+	session := f.login(t, f.laptop)
+
+	if _, err := f.svc.RevokeDevice(ctx, f.userID, other.ID); err == nil || err.Error() != "设备不存在" {
+		t.Fatalf("移除他人设备 err = %v", err)
+	}
+	if _, err := f.svc.RevokeDevice(ctx, f.userID, uuid.New()); err == nil || err.Error() != "设备不存在" {
+		t.Fatalf("移除不存在的设备 err = %v", err)
+	}
+	if _, ok := f.devices.devices[other.ID]; !ok || !f.sessionExists(t, session) {
+		t.Fatal("拒绝的请求不应修改设备或会话")
+	}
+}
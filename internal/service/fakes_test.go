@@ -0,0 +1,182 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeUserRepo 内存中的用户表，只实现测试用到的方法
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[uuid.UUID]*model.User
+}
+
+func newFakeUserRepo(users ...*model.User) *fakeUserRepo {
+	r := &fakeUserRepo{users: make(map[uuid.UUID]*model.User)}
+	for _, u := range users {
+		r.users[u.ID] = u
+	}
+	return r
+}
+
+func (r *fakeUserRepo) GetByID(id uuid.UUID) (*model.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (r *fakeUserRepo) GetByUsername(username string) (*model.User, error) {
+	for _, u := range r.users {
+		if u.Username == username {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) UpdatePassword(userID uuid.UUID, passwordSalt string) error {
+	u, ok := r.users[userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.PasswordSalt = passwordSalt
+	return nil
+}
+
+func (r *fakeUserRepo) GetByEmail(email string) (*model.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) ExistsByEmail(email string) (bool, error) {
+	_, err := r.GetByEmail(email)
+	return err == nil, nil
+}
+
+func (r *fakeUserRepo) UpdateEmail(userID uuid.UUID, email string) error {
+	u, ok := r.users[userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	u.Email = email
+	return nil
+}
+
+// fakeBlockRepo 内存中的拉黑关系：blocks[拉黑方][被拉黑方]
+type fakeBlockRepo struct {
+	repository.BlockListRepository
+	blocks map[uuid.UUID]map[uuid.UUID]bool
+}
+
+func newFakeBlockRepo() *fakeBlockRepo {
+	return &fakeBlockRepo{blocks: make(map[uuid.UUID]map[uuid.UUID]bool)}
+}
+
+func (r *fakeBlockRepo) Block(userID, blockedID uuid.UUID) error {
+	if r.blocks[userID] == nil {
+		r.blocks[userID] = make(map[uuid.UUID]bool)
+	}
+	r.blocks[userID][blockedID] = true
+	return nil
+}
+
+func (r *fakeBlockRepo) IsBlocked(userID, blockedID uuid.UUID) (bool, error) {
+	return r.blocks[userID][blockedID], nil
+}
+
+func (r *fakeBlockRepo) ListBlockersAmong(blockedID uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, id := range userIDs {
+		if r.blocks[id][blockedID] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// errFake 模拟存储层故障
+var errFake = errors.New("fake storage failure")
+
+// sentMail 一封已发送的邮件，只保留测试关心的字段
+type sentMail struct {
+	kind string
+	to   string
+	// code 验证码或撤销凭证
+	code     string
+	failures int64
+}
+
+// fakeMailService 把发送的邮件写入通道；部分邮件在后台 goroutine 中发送，需通过 expectMail 等待
+type fakeMailService struct {
+	MailService
+	sent chan sentMail
+}
+
+func newFakeMailService() *fakeMailService {
+	return &fakeMailService{sent: make(chan sentMail, 16)}
+}
+
+func (m *fakeMailService) SendAccountLockedAlert(to, ip, ua string, failures int64, lockedUntil time.Time) error {
+	m.sent <- sentMail{kind: "account_locked", to: to, failures: failures}
+	return nil
+}
+
+func (m *fakeMailService) SendEmailChangeCode(to, code string) error {
+	m.sent <- sentMail{kind: "email_change_code", to: to, code: code}
+	return nil
+}
+
+func (m *fakeMailService) SendEmailChangeRequestedNotice(to, newEmail, ip string, requestedAt time.Time) error {
+	m.sent <- sentMail{kind: "email_change_requested", to: to}
+	return nil
+}
+
+func (m *fakeMailService) SendEmailChangedNotice(to, newEmail, undoToken string, undoDeadline time.Time) error {
+	m.sent <- sentMail{kind: "email_changed", to: to, code: undoToken}
+	return nil
+}
+
+func (m *fakeMailService) SendRefreshTokenReuseAlert(to, deviceName, ip, ua string, detectedAt time.Time) error {
+	m.sent <- sentMail{kind: "refresh_token_reuse", to: to}
+	return nil
+}
+
+// expectMail 等待下一封邮件并校验类型与收件人
+func (m *fakeMailService) expectMail(t *testing.T, kind, to string) sentMail {
+	t.Helper()
+	select {
+	case mail := <-m.sent:
+		if mail.kind != kind || mail.to != to {
+			t.Fatalf("邮件 = %+v，期望 %s 发往 %s", mail, kind, to)
+		}
+		return mail
+	case <-time.After(time.Second):
+		t.Fatalf("未收到 %s 邮件", kind)
+		return sentMail{}
+	}
+}
+
+// expectNoMail 确认短时间内没有新的邮件
+func (m *fakeMailService) expectNoMail(t *testing.T) {
+	t.Helper()
+	select {
+	case mail := <-m.sent:
+		t.Fatalf("不应发送邮件: %+v", mail)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -43,13 +43,16 @@ type FileService interface {
 type fileService struct {
 	fileRepo       repository.FileRepository
 	fileStorageSvc FileStorageService
+	// chatMsgRepo 用于判断私有文件是否作为聊天附件对当前用户可见
+	chatMsgRepo repository.ChatMessageRepository
 }
 
 // NewFileService 创建文件服务
-func NewFileService(fileRepo repository.FileRepository, fileStorageSvc FileStorageService) FileService {
+func NewFileService(fileRepo repository.FileRepository, fileStorageSvc FileStorageService, chatMsgRepo repository.ChatMessageRepository) FileService {
 	return &fileService{
 		fileRepo:       fileRepo,
 		fileStorageSvc: fileStorageSvc,
+		chatMsgRepo:    chatMsgRepo,
 	}
 }
 
@@ -130,9 +133,18 @@ func (s *fileService) GetFile(ctx context.Context, id uuid.UUID, userID *uuid.UU
 		return nil, err
 	}
 
-	// 检查权限
+	// 检查权限：公开文件、文件所有者，或文件作为附件出现在用户参与的聊天房间中
 	if !file.IsPublic && (userID == nil || file.UserID == nil || *file.UserID != *userID) {
-		return nil, response.ErrFileAccessDenied
+		if userID == nil {
+			return nil, response.ErrFileAccessDenied
+		}
+		ok, err := s.chatMsgRepo.CanAccessAttachment(file.ID, *userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, response.ErrFileAccessDenied
+		}
 	}
 
 	return file.ToResponse(), nil
@@ -5,6 +5,7 @@ import (
 	"backend/internal/repository"
 	"context"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -39,6 +40,7 @@ type friendService struct {
 	maxDailyReq   int
 	maxFriends    int
 	chatRoomRepo  repository.ChatRoomRepository
+	chatPolicy    ChatPolicy
 }
 
 func NewFriendService(friendReqRepo repository.FriendRequestRepository,
@@ -52,6 +54,7 @@ func NewFriendService(friendReqRepo repository.FriendRequestRepository,
 	maxDailyReq int,
 	maxFriends int,
 	chatRoomRepo repository.ChatRoomRepository,
+	chatPolicy ChatPolicy,
 ) FriendService {
 	return &friendService{
 		friendReqRepo: friendReqRepo,
@@ -65,6 +68,7 @@ func NewFriendService(friendReqRepo repository.FriendRequestRepository,
 		maxDailyReq:   maxDailyReq,
 		maxFriends:    maxFriends,
 		chatRoomRepo:  chatRoomRepo,
+		chatPolicy:    chatPolicy,
 	}
 }
 
@@ -430,7 +434,14 @@ func (s *friendService) Block(ctx context.Context, userID, blockedID uuid.UUID)
 	if userID == blockedID {
 		return errors.New("不能拉黑自己")
 	}
-	return s.blockRepo.Block(userID, blockedID)
+	if err := s.blockRepo.Block(userID, blockedID); err != nil {
+		return err
+	}
+	// 断开被拉黑用户的聊天连接，重连后发送将按拉黑关系被拒绝
+	if err := s.chatPolicy.Disconnect(ctx, blockedID, model.ChatErrBlocked, "你已被对方拉黑"); err != nil {
+		log.Printf("断开被拉黑用户的聊天连接失败: %v", err)
+	}
+	return nil
 }
 
 func (s *friendService) Unblock(ctx context.Context, userID, blockedID uuid.UUID) error {
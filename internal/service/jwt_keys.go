@@ -0,0 +1,230 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JSONWebKey JWKS 中的一个公钥（RFC 7517）
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP（Ed25519）
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet GET /.well-known/jwks.json 的响应
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// jwtKeyManifest 密钥清单文件
+// purpose 为密钥用途（access、refresh、admin），每种用途各自轮换；
+// private_key 为 PEM 私钥路径（相对路径相对于清单所在目录），active_from 为开始用于签名的时间
+type jwtKeyManifest struct {
+	Keys []struct {
+		Kid        string    `json:"kid"`
+		Purpose    TokenType `json:"purpose"`
+		PrivateKey string    `json:"private_key"`
+		ActiveFrom time.Time `json:"active_from"`
+	} `json:"keys"`
+}
+
+// jwtSigningKey 一把签名密钥及其轮换时间
+type jwtSigningKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	private    crypto.Signer
+	activeFrom time.Time
+	// retiredAt 下一把密钥启用的时间，此后不再签名；为零表示仍是最新的密钥
+	retiredAt time.Time
+}
+
+// jwtKeySet 按时间表轮换的非对称签名密钥
+// 启用时间最晚且已到达的密钥用于签名；被替换的旧密钥在其签发的 token 全部过期之前继续用于校验，
+// 尚未启用的密钥提前发布在 JWKS 中，便于其他服务在轮换前缓存
+type jwtKeySet struct {
+	keys []*jwtSigningKey // 按启用时间升序
+	// maxTokenLifetime 最长的 token 有效期，决定旧密钥退役后的校验宽限期
+	maxTokenLifetime time.Duration
+}
+
+// loadJWTKeySets 读取密钥清单与 PEM 私钥，按用途分组；algorithm 为 RS256 或 EdDSA，所有密钥须与之匹配
+// lifetimes 给出每种用途的 token 有效期，清单中每种用途都必须有已启用的密钥
+func loadJWTKeySets(manifestPath, algorithm string, lifetimes map[TokenType]time.Duration) (map[TokenType]*jwtKeySet, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取JWT密钥清单失败: %w", err)
+	}
+	var manifest jwtKeyManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析JWT密钥清单失败: %w", err)
+	}
+	if len(manifest.Keys) == 0 {
+		return nil, errors.New("JWT密钥清单为空")
+	}
+
+	baseDir := filepath.Dir(manifestPath)
+	seen := make(map[string]bool, len(manifest.Keys))
+	sets := make(map[TokenType]*jwtKeySet, len(lifetimes))
+	for purpose, lifetime := range lifetimes {
+		sets[purpose] = &jwtKeySet{maxTokenLifetime: lifetime}
+	}
+	for _, entry := range manifest.Keys {
+		if entry.Kid == "" || entry.PrivateKey == "" || entry.ActiveFrom.IsZero() {
+			return nil, errors.New("JWT密钥清单的每一项都必须包含 kid、purpose、private_key 与 active_from")
+		}
+		set, ok := sets[entry.Purpose]
+		if !ok {
+			return nil, fmt.Errorf("JWT密钥 %s 的用途无效: %q", entry.Kid, entry.Purpose)
+		}
+		// kid 全局唯一，避免不同用途的 token 按 kid 混用密钥
+		if seen[entry.Kid] {
+			return nil, fmt.Errorf("JWT密钥 kid 重复: %s", entry.Kid)
+		}
+		seen[entry.Kid] = true
+
+		path := entry.PrivateKey
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		signer, method, err := loadPrivateKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("加载JWT密钥 %s 失败: %w", entry.Kid, err)
+		}
+		if method.Alg() != algorithm {
+			return nil, fmt.Errorf("JWT密钥 %s 的算法为 %s，与配置的 %s 不一致", entry.Kid, method.Alg(), algorithm)
+		}
+		set.keys = append(set.keys, &jwtSigningKey{
+			kid:        entry.Kid,
+			method:     method,
+			private:    signer,
+			activeFrom: entry.ActiveFrom,
+		})
+	}
+
+	now := time.Now()
+	for purpose, set := range sets {
+		sort.Slice(set.keys, func(i, j int) bool { return set.keys[i].activeFrom.Before(set.keys[j].activeFrom) })
+		for i := 0; i+1 < len(set.keys); i++ {
+			set.keys[i].retiredAt = set.keys[i+1].activeFrom
+		}
+		if set.signingKey(now) == nil {
+			return nil, fmt.Errorf("JWT密钥清单中没有已启用的 %s 密钥", purpose)
+		}
+	}
+	return sets, nil
+}
+
+// loadPrivateKey 读取 PKCS#8 或 PKCS#1 格式的 PEM 私钥，RSA 对应 RS256，Ed25519 对应 EdDSA
+func loadPrivateKey(path string) (crypto.Signer, jwt.SigningMethod, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("不是有效的PEM文件")
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("不支持的PEM类型: %s", block.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, nil, errors.New("RSA密钥长度不能小于2048位")
+		}
+		return k, jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return k, jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("不支持的私钥类型: %T", key)
+	}
+}
+
+// signingKey 返回当前用于签名的密钥
+func (s *jwtKeySet) signingKey(now time.Time) *jwtSigningKey {
+	var current *jwtSigningKey
+	for _, k := range s.keys {
+		if !k.activeFrom.After(now) {
+			current = k
+		}
+	}
+	return current
+}
+
+// verifiable 密钥已启用，且未退役或退役后其签发的 token 仍可能有效
+func (s *jwtKeySet) verifiable(k *jwtSigningKey, now time.Time) bool {
+	if k.activeFrom.After(now) {
+		return false
+	}
+	return k.retiredAt.IsZero() || now.Before(k.retiredAt.Add(s.maxTokenLifetime))
+}
+
+// verificationKey 按 kid 查找可用于校验的公钥
+func (s *jwtKeySet) verificationKey(kid string, now time.Time) (*jwtSigningKey, bool) {
+	for _, k := range s.keys {
+		if k.kid == kid {
+			return k, s.verifiable(k, now)
+		}
+	}
+	return nil, false
+}
+
+// jwks 发布可校验的公钥与尚未启用的下一把公钥
+func (s *jwtKeySet) jwks(now time.Time) *JSONWebKeySet {
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range s.keys {
+		if !s.verifiable(k, now) && !k.activeFrom.After(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, publicJWK(k))
+	}
+	return set
+}
+
+func publicJWK(k *jwtSigningKey) JSONWebKey {
+	jwk := JSONWebKey{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeyEntry 密钥清单中的一项；file 为空时按 kid 命名
+type testKeyEntry struct {
+	kid        string
+	purpose    TokenType
+	activeFrom time.Time
+	key        crypto.Signer
+	file       string
+}
+
+// writePEM 以 PKCS#8 写出私钥
+func writePEM(t *testing.T, path string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+// writeKeyManifest 在临时目录写出 PEM 私钥与清单，私钥使用相对路径
+func writeKeyManifest(t *testing.T, entries []testKeyEntry) string {
+	t.Helper()
+	dir := t.TempDir()
+	type item struct {
+		Kid        string    `json:"kid"`
+		Purpose    TokenType `json:"purpose"`
+		PrivateKey string    `json:"private_key"`
+		ActiveFrom time.Time `json:"active_from"`
+	}
+	var manifest struct {
+		Keys []item `json:"keys"`
+	}
+	for _, e := range entries {
+		file := e.file
+		if file == "" {
+			file = e.kid + ".pem"
+			writePEM(t, filepath.Join(dir, file), e.key)
+		}
+		manifest.Keys = append(manifest.Keys, item{Kid: e.kid, Purpose: e.purpose, PrivateKey: file, ActiveFrom: e.activeFrom})
+	}
+	data, _ := json.Marshal(manifest)
+	path := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+// allPurposes 每种用途一把已启用的 Ed25519 密钥，kid 为 "<用途>-1"
+func allPurposes(t *testing.T, activeFrom time.Time) []testKeyEntry {
+	var entries []testKeyEntry
+	for _, p := range []TokenType{AccessToken, RefreshToken, AdminToken} {
+		entries = append(entries, testKeyEntry{kid: string(p) + "-1", purpose: p, activeFrom: activeFrom, key: newEd25519Key(t)})
+	}
+	return entries
+}
+
+var testLifetimes = map[TokenType]time.Duration{
+	AccessToken:  15 * time.Minute,
+	RefreshToken: 7 * 24 * time.Hour,
+	AdminToken:   15 * time.Minute,
+}
+
+func TestLoadJWTKeySetsErrors(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		entries func() []testKeyEntry
+		alg     string
+		wantErr string
+	}{
+		{"清单为空", func() []testKeyEntry { return nil }, "EdDSA", "JWT密钥清单为空"},
+		{"缺少启用时间", func() []testKeyEntry {
+			e := allPurposes(t, past)
+			e[0].activeFrom = time.Time{}
+			return e
+		}, "EdDSA", "必须包含"},
+		{"用途无效", func() []testKeyEntry {
+			return append(allPurposes(t, past), testKeyEntry{kid: "x", purpose: "session", activeFrom: past, key: newEd25519Key(t)})
+		}, "EdDSA", "用途无效"},
+		{"kid 跨用途重复", func() []testKeyEntry {
+			e := allPurposes(t, past)
+			e[1].kid = e[0].kid
+			return e
+		}, "EdDSA", "kid 重复"},
+		{"算法与配置不一致", func() []testKeyEntry { return allPurposes(t, past) }, "RS256", "与配置的 RS256 不一致"},
+		{"某用途没有已启用的密钥", func() []testKeyEntry {
+			e := allPurposes(t, past)
+			e[2].activeFrom = time.Now().Add(time.Hour)
+			return e
+		}, "EdDSA", "没有已启用的 admin 密钥"},
+		{"RSA 密钥过短", func() []testKeyEntry {
+			e := allPurposes(t, past)
+			e[0].key = weak
+			return e
+		}, "EdDSA", "不能小于2048位"},
+		{"私钥文件不存在", func() []testKeyEntry {
+			e := allPurposes(t, past)
+			e[0].file = "missing.pem"
+			return e
+		}, "EdDSA", "加载JWT密钥 access-1 失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadJWTKeySets(writeKeyManifest(t, tt.entries()), tt.alg, testLifetimes)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := loadJWTKeySets(filepath.Join(t.TempDir(), "none.json"), "EdDSA", testLifetimes); err == nil {
+		t.Fatal("清单文件不存在时应报错")
+	}
+}
+
+func TestLoadPrivateKeyFormats(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := sharedRSAKey(t)
+
+	pkcs1 := filepath.Join(dir, "pkcs1.pem")
+	_ = os.WriteFile(pkcs1, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0o600)
+	pkcs8 := filepath.Join(dir, "pkcs8.pem")
+	writePEM(t, pkcs8, newEd25519Key(t))
+	notPEM := filepath.Join(dir, "plain.txt")
+	_ = os.WriteFile(notPEM, []byte("not a key"), 0o600)
+	cert := filepath.Join(dir, "cert.pem")
+	_ = os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}), 0o600)
+
+	tests := []struct {
+		path    string
+		wantAlg string
+	}{
+		{pkcs1, "RS256"},
+		{pkcs8, "EdDSA"},
+		{notPEM, ""},
+		{cert, ""},
+	}
+	for _, tt := range tests {
+		_, method, err := loadPrivateKey(tt.path)
+		if tt.wantAlg == "" {
+			if err == nil {
+				t.Errorf("%s 应加载失败", filepath.Base(tt.path))
+			}
+			continue
+		}
+		if err != nil || method.Alg() != tt.wantAlg {
+			t.Errorf("%s: method=%v err=%v", filepath.Base(tt.path), method, err)
+		}
+	}
+}
+
+func TestJWTKeySetRotation(t *testing.T) {
+	now := time.Now()
+	entries := allPurposes(t, now.Add(-48*time.Hour))
+	entries = append(entries,
+		testKeyEntry{kid: "access-2", purpose: AccessToken, activeFrom: now.Add(-5 * time.Minute), key: newEd25519Key(t)},
+		testKeyEntry{kid: "access-3", purpose: AccessToken, activeFrom: now.Add(time.Hour), key: newEd25519Key(t)},
+	)
+	sets, err := loadJWTKeySets(writeKeyManifest(t, entries), "EdDSA", testLifetimes)
+	if err != nil {
+		t.Fatalf("loadJWTKeySets: %v", err)
+	}
+	set := sets[AccessToken]
+
+	kids := func(ks *JSONWebKeySet) string {
+		var out []string
+		for _, k := range ks.Keys {
+			out = append(out, k.Kid)
+		}
+		return strings.Join(out, ",")
+	}
+	tests := []struct {
+		name       string
+		at         time.Time
+		signing    string
+		verifiable map[string]bool
+		jwks       string
+	}{
+		// access-1 刚被替换，其签发的 token 在一个有效期内仍可校验；access-3 尚未启用但提前发布
+		{"轮换后宽限期内", now, "access-2", map[string]bool{"access-1": true, "access-2": true, "access-3": false}, "access-1,access-2,access-3"},
+		{"宽限期结束", now.Add(20 * time.Minute), "access-2", map[string]bool{"access-1": false, "access-2": true, "access-3": false}, "access-2,access-3"},
+		{"下一把密钥启用", now.Add(time.Hour + time.Minute), "access-3", map[string]bool{"access-1": false, "access-2": true, "access-3": true}, "access-2,access-3"},
+		{"上一把密钥宽限期结束", now.Add(2 * time.Hour), "access-3", map[string]bool{"access-2": false, "access-3": true}, "access-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if k := set.signingKey(tt.at); k == nil || k.kid != tt.signing {
+				t.Fatalf("签名密钥 = %+v，期望 %s", k, tt.signing)
+			}
+			for kid, want := range tt.verifiable {
+				if _, ok := set.verificationKey(kid, tt.at); ok != want {
+					t.Errorf("%s 可校验 = %v，期望 %v", kid, ok, want)
+				}
+			}
+			if got := kids(set.jwks(tt.at)); got != tt.jwks {
+				t.Errorf("JWKS = %s，期望 %s", got, tt.jwks)
+			}
+		})
+	}
+	if _, ok := set.verificationKey("refresh-1", now); ok {
+		t.Fatal("不应按 kid 接受其他用途的密钥")
+	}
+}
+
+func TestPublicJWK(t *testing.T) {
+	rsaKey := sharedRSAKey(t)
+	edKey := newEd25519Key(t)
+
+	rsaJWK := publicJWK(&jwtSigningKey{kid: "r", method: jwt.SigningMethodRS256, private: rsaKey})
+	n, _ := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.Use != "sig" ||
+		new(big.Int).SetBytes(n).Cmp(rsaKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(rsaKey.E) {
+		t.Fatalf("RSA JWK = %+v", rsaJWK)
+	}
+
+	edJWK := publicJWK(&jwtSigningKey{kid: "e", method: jwt.SigningMethodEdDSA, private: edKey})
+	x, _ := base64.RawURLEncoding.DecodeString(edJWK.X)
+	if edJWK.Kty != "OKP" || edJWK.Crv != "Ed25519" || edJWK.Alg != "EdDSA" || !ed25519.PublicKey(x).Equal(edKey.Public()) {
+		t.Fatalf("OKP JWK = %+v", edJWK)
+	}
+	// 只发布公钥
+	if raw, _ := json.Marshal(edJWK); strings.Contains(string(raw), `"d"`) {
+		t.Fatalf("JWK 包含私钥: %s", raw)
+	}
+}
@@ -2,7 +2,12 @@ package service
 
 import (
 	"backend/internal/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,11 +15,13 @@ import (
 )
 
 // TokenType represents the type of JWT token
+// 同时作为签名密钥的用途：access、refresh、admin 三类 token 使用各自的签发者、受众与密钥
 type TokenType string
 
 const (
 	AccessToken  TokenType = "access"
 	RefreshToken TokenType = "refresh"
+	AdminToken   TokenType = "admin"
 )
 
 // JWTClaims defines the structure of the JWT claims.
@@ -22,6 +29,8 @@ type JWTClaims struct {
 	UserID    uuid.UUID `json:"user_id"`
 	Username  string    `json:"username"`
 	TokenType TokenType `json:"token_type"`
+	// SessionID 所属登录会话，会话撤销后该会话签发的 token 立即失效；旧 token 没有该声明
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -41,45 +50,180 @@ type TokenPair struct {
 // JwtService handles JWT generation and validation.
 type JwtService interface {
 	// GenerateTokenPair creates both access and refresh tokens for a user
-	GenerateTokenPair(userID uuid.UUID, username string) (*TokenPair, error)
-	// GenerateAccessToken creates a new access token for a given user
-	GenerateAccessToken(userID uuid.UUID, username string) (string, error)
-	// GenerateRefreshToken creates a new refresh token for a given user
-	GenerateRefreshToken(userID uuid.UUID, username string) (string, error)
-	// ValidateToken validates a JWT string and returns the claims if valid
-	ValidateToken(tokenString string) (*JWTClaims, error)
-	// GetTokenRemainingTTL calculates the remaining time until token expiration
+	GenerateTokenPair(userID uuid.UUID, username string, sessionID uuid.UUID) (*TokenPair, error)
+	// GenerateAccessToken creates a new access token for a given user session
+	GenerateAccessToken(userID uuid.UUID, username string, sessionID uuid.UUID) (string, error)
+	// GenerateRefreshToken creates a new refresh token for a given user session
+	GenerateRefreshToken(userID uuid.UUID, username string, sessionID uuid.UUID) (string, error)
+	// ValidateAccessToken validates a user access token and returns the claims if valid
+	ValidateAccessToken(tokenString string) (*JWTClaims, error)
+	// ValidateRefreshToken validates a user refresh token and returns the claims if valid
+	ValidateRefreshToken(tokenString string) (*JWTClaims, error)
+	// GetTokenRemainingTTL calculates the remaining time until access token expiration
 	GetTokenRemainingTTL(tokenString string) (time.Duration, error)
 	// GenerateAdminToken generates a new token for an admin user
 	GenerateAdminToken(username string) (string, error)
 	// ValidateAdminToken validates an admin JWT string and returns the claims if valid
 	ValidateAdminToken(tokenString string) (*AdminClaims, error)
+	// JWKS returns the public keys that verify access and admin tokens; empty in HMAC mode
+	JWKS() *JSONWebKeySet
+}
+
+// defaultJwtSecret 未配置 JWT_SECRET 时的默认值，仅供本地开发
+const defaultJwtSecret = "a-very-secret-key-that-should-be-changed"
+
+// tokenProfile 一类 token 的签发者、受众与密钥，校验时三者及 token_type 必须全部匹配
+type tokenProfile struct {
+	tokenType TokenType
+	issuer    string
+	audience  string
+	lifetime  time.Duration
+	// secretKey HS256 模式下由 JWT_SECRET 按用途派生的密钥
+	secretKey []byte
+	// keys RS256/EdDSA 模式下该用途的轮换密钥
+	keys *jwtKeySet
 }
 
 // jwtService is the implementation of JwtService.
+// HS256 模式使用由共享密钥派生的各用途密钥；RS256/EdDSA 模式使用按时间表轮换的各用途私钥签名，并在头部写入 kid
 type jwtService struct {
-	secretKey                      []byte
-	accessTokenExpirationInMinutes int
-	refreshTokenExpirationInDays   int
+	access  *tokenProfile
+	refresh *tokenProfile
+	admin   *tokenProfile
 }
 
 // NewJwtService creates a new instance of JwtService.
-func NewJwtService(cfg *config.SecurityConfig) JwtService {
-	return &jwtService{
-		secretKey:                      []byte(cfg.JwtSecret),
-		accessTokenExpirationInMinutes: cfg.JwtAccessTokenExpiresInMinutes,
-		refreshTokenExpirationInDays:   cfg.JwtRefreshTokenExpiresInDays,
+func NewJwtService(cfg *config.SecurityConfig) (JwtService, error) {
+	accessLifetime := time.Duration(cfg.JwtAccessTokenExpiresInMinutes) * time.Minute
+	s := &jwtService{
+		access:  &tokenProfile{tokenType: AccessToken, issuer: "backend-app", audience: "backend-api", lifetime: accessLifetime},
+		refresh: &tokenProfile{tokenType: RefreshToken, issuer: "backend-app-refresh", audience: "backend-token-refresh", lifetime: time.Duration(cfg.JwtRefreshTokenExpiresInDays) * 24 * time.Hour},
+		admin:   &tokenProfile{tokenType: AdminToken, issuer: "backend-app-admin", audience: "backend-admin", lifetime: accessLifetime},
+	}
+	profiles := []*tokenProfile{s.access, s.refresh, s.admin}
+
+	switch alg := strings.TrimSpace(cfg.JwtSigningAlgorithm); alg {
+	case "", jwt.SigningMethodHS256.Alg():
+		if cfg.JwtSecret == defaultJwtSecret {
+			log.Printf("警告: JWT_SECRET 使用默认值，请在生产环境中修改或改用 RS256/EdDSA 签名")
+		}
+		for _, p := range profiles {
+			p.secretKey = deriveTokenKey(cfg.JwtSecret, p.tokenType)
+		}
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		if cfg.JwtKeysFile == "" {
+			return nil, fmt.Errorf("使用 %s 签名时必须配置 JWT_KEYS_FILE", alg)
+		}
+		lifetimes := make(map[TokenType]time.Duration, len(profiles))
+		for _, p := range profiles {
+			lifetimes[p.tokenType] = p.lifetime
+		}
+		sets, err := loadJWTKeySets(cfg.JwtKeysFile, alg, lifetimes)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range profiles {
+			p.keys = sets[p.tokenType]
+		}
+	default:
+		return nil, fmt.Errorf("不支持的JWT签名算法: %s", alg)
+	}
+	return s, nil
+}
+
+// deriveTokenKey 由 JWT_SECRET 派生某一用途的 HMAC 密钥，使一类 token 的签名无法被另一类接受
+func deriveTokenKey(secret string, purpose TokenType) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("backend-jwt:" + string(purpose)))
+	return mac.Sum(nil)
+}
+
+// sign 使用该用途当前的签名密钥签名
+func (p *tokenProfile) sign(claims jwt.Claims) (string, error) {
+	if p.keys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(p.secretKey)
+	}
+	key := p.keys.signingKey(time.Now())
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// keyFunc 按当前模式选择该用途的校验密钥；非对称模式下按 kid 查找，并要求算法与密钥一致
+func (p *tokenProfile) keyFunc(token *jwt.Token) (interface{}, error) {
+	if p.keys == nil {
+		return p.secretKey, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := p.keys.verificationKey(kid, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("unknown or retired signing key: %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.private.Public(), nil
+}
+
+// registeredClaims 该用途 token 的标准声明
+func (p *tokenProfile) registeredClaims(subject string) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   subject,
+		Issuer:    p.issuer,
+		Audience:  jwt.ClaimStrings{p.audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(p.lifetime)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+}
+
+// parse 校验签名、算法、iss、aud 与有效期
+func (p *tokenProfile) parse(tokenString string, claims jwt.Claims) error {
+	methods := []string{jwt.SigningMethodHS256.Alg()}
+	if p.keys != nil {
+		methods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+	}
+	token, err := jwt.ParseWithClaims(tokenString, claims, p.keyFunc,
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
 	}
+	return nil
+}
+
+// JWKS returns the public keys that verify access and admin tokens
+// refresh token 只由本服务校验，其公钥不对外发布
+func (s *jwtService) JWKS() *JSONWebKeySet {
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	now := time.Now()
+	for _, p := range []*tokenProfile{s.access, s.admin} {
+		if p.keys != nil {
+			set.Keys = append(set.Keys, p.keys.jwks(now).Keys...)
+		}
+	}
+	return set
 }
 
 // GenerateTokenPair creates both access and refresh tokens for a user
-func (s *jwtService) GenerateTokenPair(userID uuid.UUID, username string) (*TokenPair, error) {
-	accessToken, err := s.GenerateAccessToken(userID, username)
+func (s *jwtService) GenerateTokenPair(userID uuid.UUID, username string, sessionID uuid.UUID) (*TokenPair, error) {
+	accessToken, err := s.GenerateAccessToken(userID, username, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := s.GenerateRefreshToken(userID, username)
+	refreshToken, err := s.GenerateRefreshToken(userID, username, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -91,35 +235,28 @@ func (s *jwtService) GenerateTokenPair(userID uuid.UUID, username string) (*Toke
 }
 
 // GenerateAccessToken creates a new access token for a given user.
-func (s *jwtService) GenerateAccessToken(userID uuid.UUID, username string) (string, error) {
-	return s.generateToken(userID, username, AccessToken, time.Duration(s.accessTokenExpirationInMinutes)*time.Minute)
+func (s *jwtService) GenerateAccessToken(userID uuid.UUID, username string, sessionID uuid.UUID) (string, error) {
+	return s.generateToken(s.access, userID, username, sessionID)
 }
 
 // GenerateRefreshToken creates a new refresh token for a given user.
-func (s *jwtService) GenerateRefreshToken(userID uuid.UUID, username string) (string, error) {
-	return s.generateToken(userID, username, RefreshToken, time.Duration(s.refreshTokenExpirationInDays)*24*time.Hour)
+func (s *jwtService) GenerateRefreshToken(userID uuid.UUID, username string, sessionID uuid.UUID) (string, error) {
+	return s.generateToken(s.refresh, userID, username, sessionID)
 }
 
-// generateToken is a helper method to generate tokens with specific type and duration
-func (s *jwtService) generateToken(userID uuid.UUID, username string, tokenType TokenType, duration time.Duration) (string, error) {
+// generateToken is a helper method to generate user tokens for the given profile
+func (s *jwtService) generateToken(profile *tokenProfile, userID uuid.UUID, username string, sessionID uuid.UUID) (string, error) {
 	// Set custom claims
 	claims := &JWTClaims{
-		UserID:    userID,
-		Username:  username,
-		TokenType: tokenType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "backend-app",
-		},
-	}
-
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Generate encoded token and return it
-	signedToken, err := token.SignedString(s.secretKey)
+		UserID:           userID,
+		Username:         username,
+		TokenType:        profile.tokenType,
+		SessionID:        sessionID,
+		RegisteredClaims: profile.registeredClaims(userID.String()),
+	}
+
+	// Sign the token with the current key of this profile
+	signedToken, err := profile.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -127,30 +264,31 @@ func (s *jwtService) generateToken(userID uuid.UUID, username string, tokenType
 	return signedToken, nil
 }
 
-// ValidateToken validates a JWT string.
-func (s *jwtService) ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Check the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
+// ValidateAccessToken validates a user access token.
+func (s *jwtService) ValidateAccessToken(tokenString string) (*JWTClaims, error) {
+	return s.validateUserToken(s.access, tokenString)
+}
 
-	if err != nil {
+// ValidateRefreshToken validates a user refresh token.
+func (s *jwtService) ValidateRefreshToken(tokenString string) (*JWTClaims, error) {
+	return s.validateUserToken(s.refresh, tokenString)
+}
+
+// validateUserToken 按 profile 校验用户 token，token_type 必须与 profile 一致
+func (s *jwtService) validateUserToken(profile *tokenProfile, tokenString string) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+	if err := profile.parse(tokenString, claims); err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
-
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	if claims.TokenType != profile.tokenType {
+		return nil, fmt.Errorf("unexpected token type: %q", claims.TokenType)
 	}
-
-	return nil, fmt.Errorf("invalid token")
+	return claims, nil
 }
 
-// GetTokenRemainingTTL calculates the remaining time until token expiration
+// GetTokenRemainingTTL calculates the remaining time until access token expiration
 func (s *jwtService) GetTokenRemainingTTL(tokenString string) (time.Duration, error) {
-	claims, err := s.ValidateToken(tokenString)
+	claims, err := s.ValidateAccessToken(tokenString)
 	if err != nil {
 		return 0, fmt.Errorf("invalid token: %w", err)
 	}
@@ -158,7 +296,7 @@ func (s *jwtService) GetTokenRemainingTTL(tokenString string) (time.Duration, er
 	// Calculate remaining time until expiration
 	expirationTime := claims.ExpiresAt.Time
 	remainingTime := time.Until(expirationTime)
-	
+
 	// If token has already expired, return 0
 	if remainingTime <= 0 {
 		return 0, fmt.Errorf("token has already expired")
@@ -169,22 +307,13 @@ func (s *jwtService) GetTokenRemainingTTL(tokenString string) (time.Duration, er
 
 // GenerateAdminToken generates a new token for an admin user
 func (s *jwtService) GenerateAdminToken(username string) (string, error) {
-	duration := time.Duration(s.accessTokenExpirationInMinutes) * time.Minute
-
 	claims := &AdminClaims{
-		Username:  username,
-		TokenType: AccessToken,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "backend-app-admin",
-		},
+		Username:         username,
+		TokenType:        AdminToken,
+		RegisteredClaims: s.admin.registeredClaims(username),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	signedToken, err := token.SignedString(s.secretKey)
+	signedToken, err := s.admin.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign admin token: %w", err)
 	}
@@ -194,20 +323,12 @@ func (s *jwtService) GenerateAdminToken(username string) (string, error) {
 
 // ValidateAdminToken validates an admin JWT string and returns the claims if valid
 func (s *jwtService) ValidateAdminToken(tokenString string) (*AdminClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &AdminClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
-
-	if err != nil {
+	claims := &AdminClaims{}
+	if err := s.admin.parse(tokenString, claims); err != nil {
 		return nil, fmt.Errorf("failed to parse admin token: %w", err)
 	}
-
-	if claims, ok := token.Claims.(*AdminClaims); ok && token.Valid {
-		return claims, nil
+	if claims.TokenType != AdminToken {
+		return nil, fmt.Errorf("unexpected token type: %q", claims.TokenType)
 	}
-
-	return nil, fmt.Errorf("invalid admin token")
-}
\ No newline at end of file
+	return claims, nil
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"backend/internal/config"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newHMACJwtService(t *testing.T, secret string) JwtService {
+	t.Helper()
+	svc, err := NewJwtService(&config.SecurityConfig{
+		JwtSecret: secret, JwtSigningAlgorithm: "HS256",
+		JwtAccessTokenExpiresInMinutes: 15, JwtRefreshTokenExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+	return svc
+}
+
+func newEdDSAJwtService(t *testing.T, entries []testKeyEntry) JwtService {
+	t.Helper()
+	svc, err := NewJwtService(&config.SecurityConfig{
+		JwtSigningAlgorithm: "EdDSA", JwtKeysFile: writeKeyManifest(t, entries),
+		JwtAccessTokenExpiresInMinutes: 15, JwtRefreshTokenExpiresInDays: 7,
+	})
+	if err != nil {
+		t.Fatalf("NewJwtService: %v", err)
+	}
+	return svc
+}
+
+// tokenKid 读取 token 头部的 kid，不校验签名
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// signAccessClaims 以任意算法与密钥签发一个声明合法的 access token，用于构造伪造 token
+func signAccessClaims(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	userID := uuid.New()
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID: userID, Username: "alice", TokenType: AccessToken, SessionID: uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: userID.String(), Issuer: "backend-app", Audience: jwt.ClaimStrings{"backend-api"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)), IssuedAt: jwt.NewNumericDate(now),
+		},
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestJwtServiceConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.SecurityConfig
+		wantErr string
+	}{
+		{"不支持的算法", config.SecurityConfig{JwtSigningAlgorithm: "ES256"}, "不支持的JWT签名算法"},
+		{"RS256 缺少密钥清单", config.SecurityConfig{JwtSigningAlgorithm: "RS256"}, "必须配置 JWT_KEYS_FILE"},
+		{"EdDSA 缺少密钥清单", config.SecurityConfig{JwtSigningAlgorithm: "EdDSA"}, "必须配置 JWT_KEYS_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJwtService(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJwtServiceHMACRoundTrip(t *testing.T) {
+	svc := newHMACJwtService(t, "test-secret")
+	userID, sessionID := uuid.New(), uuid.New()
+
+	pair, err := svc.GenerateTokenPair(userID, "alice", sessionID)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+	access, err := svc.ValidateAccessToken(pair.AccessToken)
+	if err != nil || access.UserID != userID || access.SessionID != sessionID || access.Username != "alice" || access.TokenType != AccessToken {
+		t.Fatalf("ValidateAccessToken = %+v, %v", access, err)
+	}
+	refresh, err := svc.ValidateRefreshToken(pair.RefreshToken)
+	if err != nil || refresh.UserID != userID || refresh.TokenType != RefreshToken {
+		t.Fatalf("ValidateRefreshToken = %+v, %v", refresh, err)
+	}
+	if ttl, err := svc.GetTokenRemainingTTL(pair.AccessToken); err != nil || ttl <= 14*time.Minute || ttl > 15*time.Minute {
+		t.Fatalf("GetTokenRemainingTTL = %v, %v", ttl, err)
+	}
+	admin, err := svc.GenerateAdminToken("root")
+	if err != nil {
+		t.Fatalf("GenerateAdminToken: %v", err)
+	}
+	if claims, err := svc.ValidateAdminToken(admin); err != nil || claims.Username != "root" {
+		t.Fatalf("ValidateAdminToken = %+v, %v", claims, err)
+	}
+	// HMAC 模式没有可发布的公钥
+	if jwks := svc.JWKS(); jwks == nil || len(jwks.Keys) != 0 {
+		t.Fatalf("JWKS = %+v", jwks)
+	}
+}
+
+func TestJwtServiceRejectsCrossTypeAndTamperedTokens(t *testing.T) {
+	svc := newHMACJwtService(t, "test-secret")
+	pair, err := svc.GenerateTokenPair(uuid.New(), "alice", uuid.New())
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+	admin, err := svc.GenerateAdminToken("root")
+	if err != nil {
+		t.Fatalf("GenerateAdminToken: %v", err)
+	}
+	parts := strings.Split(pair.AccessToken, ".")
+	sig := []byte(parts[2])
+	sig[0] ^= 1
+	tampered := parts[0] + "." + parts[1] + "." + string(sig)
+	other := newHMACJwtService(t, "other-secret")
+
+	tests := []struct {
+		name     string
+		validate func(string) error
+		token    string
+	}{
+		{"refresh 当作 access", func(s string) error { _, err := svc.ValidateAccessToken(s); return err }, pair.RefreshToken},
+		{"access 当作 refresh", func(s string) error { _, err := svc.ValidateRefreshToken(s); return err }, pair.AccessToken},
+		{"access 当作 admin", func(s string) error { _, err := svc.ValidateAdminToken(s); return err }, pair.AccessToken},
+		{"admin 当作 access", func(s string) error { _, err := svc.ValidateAccessToken(s); return err }, admin},
+		{"签名被篡改", func(s string) error { _, err := svc.ValidateAccessToken(s); return err }, tampered},
+		{"其他密钥签发", func(s string) error { _, err := other.ValidateAccessToken(s); return err }, pair.AccessToken},
+		{"未签名", func(s string) error { _, err := svc.ValidateAccessToken(s); return err },
+			signAccessClaims(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.validate(tt.token); err == nil {
+				t.Fatal("应拒绝该 token")
+			}
+		})
+	}
+}
+
+func TestJwtServiceEdDSAKeyRotation(t *testing.T) {
+	now := time.Now()
+	entries := allPurposes(t, now.Add(-48*time.Hour))
+	before := newEdDSAJwtService(t, entries)
+	oldToken, err := before.GenerateAccessToken(uuid.New(), "alice", uuid.New())
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if kid := tokenKid(t, oldToken); kid != "access-1" {
+		t.Fatalf("kid = %q", kid)
+	}
+
+	// access-2 刚启用：新 token 使用 access-2，旧 token 在一个有效期内仍然有效
+	rotated := newEdDSAJwtService(t, append(entries,
+		testKeyEntry{kid: "access-2", purpose: AccessToken, activeFrom: now.Add(-5 * time.Minute), key: newEd25519Key(t)}))
+	newToken, err := rotated.GenerateAccessToken(uuid.New(), "alice", uuid.New())
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	if kid := tokenKid(t, newToken); kid != "access-2" {
+		t.Fatalf("轮换后 kid = %q", kid)
+	}
+	for name, token := range map[string]string{"旧密钥": oldToken, "新密钥": newToken} {
+		if _, err := rotated.ValidateAccessToken(token); err != nil {
+			t.Fatalf("%s签发的 token 校验失败: %v", name, err)
+		}
+	}
+
+	// access-1 退役已超过一个有效期，即使 token 未过期也不再接受
+	retired := newEdDSAJwtService(t, append(entries,
+		testKeyEntry{kid: "access-2", purpose: AccessToken, activeFrom: now.Add(-time.Hour), key: newEd25519Key(t)}))
+	if _, err := retired.ValidateAccessToken(oldToken); err == nil {
+		t.Fatal("宽限期后旧密钥签发的 token 应被拒绝")
+	}
+}
+
+func TestJwtServiceEdDSARejectsForgedTokens(t *testing.T) {
+	entries := allPurposes(t, time.Now().Add(-time.Hour))
+	svc := newEdDSAJwtService(t, entries)
+	accessKey := entries[0].key.(ed25519.PrivateKey)
+	refreshKey := entries[1].key.(ed25519.PrivateKey)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"未知 kid", signAccessClaims(t, jwt.SigningMethodEdDSA, "access-9", accessKey)},
+		{"缺少 kid", signAccessClaims(t, jwt.SigningMethodEdDSA, "", accessKey)},
+		{"kid 与密钥不符", signAccessClaims(t, jwt.SigningMethodEdDSA, "access-1", newEd25519Key(t))},
+		// 以公钥作为 HMAC 密钥伪造签名
+		{"算法混淆", signAccessClaims(t, jwt.SigningMethodHS256, "access-1", []byte(accessKey.Public().(ed25519.PublicKey)))},
+		{"使用 refresh 密钥", signAccessClaims(t, jwt.SigningMethodEdDSA, "refresh-1", refreshKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.ValidateAccessToken(tt.token); err == nil {
+				t.Fatal("应拒绝该 token")
+			}
+		})
+	}
+	// 对照：同样的声明用正确的密钥与 kid 签发可以通过
+	if _, err := svc.ValidateAccessToken(signAccessClaims(t, jwt.SigningMethodEdDSA, "access-1", accessKey)); err != nil {
+		t.Fatalf("合法 token 校验失败: %v", err)
+	}
+}
+
+func TestJwtServiceJWKS(t *testing.T) {
+	svc := newEdDSAJwtService(t, allPurposes(t, time.Now().Add(-time.Hour)))
+	jwks := svc.JWKS()
+
+	published := map[string]JSONWebKey{}
+	for _, k := range jwks.Keys {
+		published[k.Kid] = k
+	}
+	if len(published) != 2 || published["access-1"].Kid == "" || published["admin-1"].Kid == "" {
+		t.Fatalf("JWKS = %+v，期望只包含 access-1 与 admin-1", jwks.Keys)
+	}
+
+	// 第三方只凭发布的 JWK 即可校验 access token
+	token, err := svc.GenerateAccessToken(uuid.New(), "alice", uuid.New())
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	parsed, err := jwt.Parse(token, func(tok *jwt.Token) (interface{}, error) {
+		x, err := base64.RawURLEncoding.DecodeString(published[tok.Header["kid"].(string)].X)
+		return ed25519.PublicKey(x), err
+	}, jwt.WithValidMethods([]string{"EdDSA"}), jwt.WithAudience("backend-api"))
+	if err != nil || !parsed.Valid {
+		t.Fatalf("使用 JWKS 校验失败: %v", err)
+	}
+}
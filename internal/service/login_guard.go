@@ -0,0 +1,185 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// minLoginFailureWindow 失败计数窗口的下限，避免配置为0时计数立即过期
+const minLoginFailureWindow = time.Minute
+
+// LoginThrottledError 登录因失败次数过多处于退避或锁定期，RetryAfter 为需等待的时长
+type LoginThrottledError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string { return e.Message }
+
+// LoginGuard 密码登录的暴力破解防护
+// 账户（按用户名，无论账户是否存在）与来源IP分别计数：达到退避阈值后每次失败所需的等待时间翻倍，
+// 达到锁定阈值后临时锁定并邮件通知用户。Redis 不可用时放行，仅记录日志
+type LoginGuard interface {
+	// Check 校验密码前调用，账户或IP处于退避或锁定期时返回 *LoginThrottledError
+	Check(ctx context.Context, username, ip string) error
+	// RecordFailure 记录一次密码错误并写入用户行为日志，触发账户锁定时邮件通知用户
+	RecordFailure(ctx context.Context, req *model.LoginRequest)
+	// RecordSuccess 密码校验通过后清除账户的失败计数
+	RecordSuccess(ctx context.Context, username string)
+	// ClearAccount 清除账户的失败计数与锁定
+	ClearAccount(ctx context.Context, username string) error
+}
+
+type loginGuard struct {
+	repo       repository.LoginAttemptRepository
+	userRepo   repository.UserRepository
+	mailSvc    MailService
+	userLogSvc UserActionLogService
+	cfg        *config.LoginLockoutConfig
+}
+
+// NewLoginGuard 创建登录防护实例
+func NewLoginGuard(repo repository.LoginAttemptRepository, userRepo repository.UserRepository, mailSvc MailService, userLogSvc UserActionLogService, cfg *config.LoginLockoutConfig) LoginGuard {
+	return &loginGuard{repo: repo, userRepo: userRepo, mailSvc: mailSvc, userLogSvc: userLogSvc, cfg: cfg}
+}
+
+func (g *loginGuard) Check(ctx context.Context, username, ip string) error {
+	if err := g.check(ctx, repository.LoginAttemptScopeAccount, accountKey(username), g.cfg.AccountBackoffAfter,
+		"登录失败次数过多，账户已被临时锁定，请稍后再试"); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return g.check(ctx, repository.LoginAttemptScopeIP, ip, g.cfg.IPBackoffAfter,
+		"该IP登录失败次数过多，已被临时限制，请稍后再试")
+}
+
+// check lockedMessage 为锁定期内的提示，退避期内统一提示稍后再试
+func (g *loginGuard) check(ctx context.Context, scope, id string, backoffAfter int, lockedMessage string) error {
+	if id == "" {
+		return nil
+	}
+	state, err := g.repo.Get(ctx, scope, id)
+	if err != nil {
+		log.Printf("登录失败计数检查失败: %v", err)
+		return nil
+	}
+	now := time.Now()
+	if now.Before(state.LockedUntil) {
+		return &LoginThrottledError{Message: lockedMessage, RetryAfter: state.LockedUntil.Sub(now)}
+	}
+	if backoffAfter > 0 && state.Failures >= int64(backoffAfter) {
+		next := state.LastFailureAt.Add(g.backoff(state.Failures - int64(backoffAfter)))
+		if now.Before(next) {
+			return &LoginThrottledError{Message: "登录尝试过于频繁，请稍后再试", RetryAfter: next.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// backoff 达到退避阈值后第 n 次（从0开始）失败所需的等待时长：基础时长 * 2^n，不超过上限
+func (g *loginGuard) backoff(n int64) time.Duration {
+	base := time.Duration(g.cfg.BackoffBaseSeconds) * time.Second
+	limit := time.Duration(g.cfg.BackoffMaxSeconds) * time.Second
+	if base <= 0 {
+		return 0
+	}
+	if n >= 30 {
+		return limit
+	}
+	if d := base << uint(n); d < limit {
+		return d
+	}
+	return limit
+}
+
+func (g *loginGuard) RecordFailure(ctx context.Context, req *model.LoginRequest) {
+	window := time.Duration(g.cfg.FailureWindowMinutes) * time.Minute
+	if window < minLoginFailureWindow {
+		window = minLoginFailureWindow
+	}
+	lockDuration := time.Duration(g.cfg.LockoutMinutes) * time.Minute
+
+	var user *model.User
+	if u, err := g.userRepo.GetByUsername(req.Username); err == nil {
+		user = u
+	}
+	entry := &model.UserActionLog{
+		Username:   req.Username,
+		Action:     "login_failed",
+		DeviceID:   req.DeviceID,
+		DeviceName: req.DeviceName,
+		DeviceType: req.DeviceType,
+		IPAddress:  req.IPAddress,
+		UserAgent:  req.UserAgent,
+	}
+	if user != nil {
+		entry.UserID = &user.ID
+	}
+
+	account, accountLocked, err := g.repo.RecordFailure(ctx, repository.LoginAttemptScopeAccount, accountKey(req.Username),
+		window, g.cfg.AccountLockoutAfter, lockDuration)
+	if err != nil {
+		log.Printf("记录账户登录失败次数失败: %v", err)
+		account = &repository.LoginAttemptState{}
+	}
+	ip := &repository.LoginAttemptState{}
+	ipLocked := false
+	if req.IPAddress != "" {
+		if ip, ipLocked, err = g.repo.RecordFailure(ctx, repository.LoginAttemptScopeIP, req.IPAddress,
+			window, g.cfg.IPLockoutAfter, lockDuration); err != nil {
+			log.Printf("记录IP登录失败次数失败: %v", err)
+			ip = &repository.LoginAttemptState{}
+		}
+	}
+
+	entry.Details = fmt.Sprintf("account_failures:%d ip_failures:%d", account.Failures, ip.Failures)
+	_ = g.userLogSvc.Create(ctx, entry)
+
+	if ipLocked {
+		log.Printf("IP登录失败次数过多，已临时限制: ip=%s failures=%d until=%s", req.IPAddress, ip.Failures, ip.LockedUntil.Format(time.RFC3339))
+	}
+	if !accountLocked {
+		return
+	}
+	log.Printf("账户登录失败次数过多，已临时锁定: username=%s failures=%d until=%s", req.Username, account.Failures, account.LockedUntil.Format(time.RFC3339))
+	if user == nil {
+		return
+	}
+	_ = g.userLogSvc.Create(ctx, &model.UserActionLog{
+		UserID:    &user.ID,
+		Username:  user.Username,
+		Action:    "login_locked",
+		IPAddress: req.IPAddress,
+		UserAgent: req.UserAgent,
+		Details:   fmt.Sprintf("failures:%d locked_until:%s", account.Failures, account.LockedUntil.Format(time.RFC3339)),
+	})
+
+	if user.Email != "" {
+		go func() {
+			_ = g.mailSvc.SendAccountLockedAlert(user.Email, req.IPAddress, req.UserAgent, account.Failures, account.LockedUntil)
+		}()
+	}
+}
+
+func (g *loginGuard) RecordSuccess(ctx context.Context, username string) {
+	if err := g.repo.Clear(ctx, repository.LoginAttemptScopeAccount, accountKey(username)); err != nil {
+		log.Printf("清除账户登录失败次数失败: %v", err)
+	}
+}
+
+func (g *loginGuard) ClearAccount(ctx context.Context, username string) error {
+	return g.repo.Clear(ctx, repository.LoginAttemptScopeAccount, accountKey(username))
+}
+
+// accountKey 账户计数按用户名（忽略大小写与首尾空白）区分
+func accountKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+func testLockoutConfig() *config.LoginLockoutConfig {
+	return &config.LoginLockoutConfig{
+		FailureWindowMinutes: 15,
+		AccountBackoffAfter:  3,
+		AccountLockoutAfter:  5,
+		IPBackoffAfter:       10,
+		IPLockoutAfter:       20,
+		BackoffBaseSeconds:   2,
+		BackoffMaxSeconds:    60,
+		LockoutMinutes:       15,
+	}
+}
+
+type loginGuardFixture struct {
+	guard LoginGuard
+	mr    *miniredis.Miniredis
+	mail  *fakeMailService
+	logs  *fakeUserLogService
+	user  *model.User
+}
+
+func newLoginGuardFixture(t *testing.T, cfg *config.LoginLockoutConfig) *loginGuardFixture {
+	t.Helper()
+	mr, rdb := newTestRedis(t)
+	f := &loginGuardFixture{
+		mr:   mr,
+		mail: newFakeMailService(),
+		logs: &fakeUserLogService{},
+		user: &model.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com"},
+	}
+	f.guard = NewLoginGuard(repository.NewLoginAttemptRepository(rdb), newFakeUserRepo(f.user), f.mail, f.logs, cfg)
+	return f
+}
+
+// seedAttempts 直接写入失败计数，模拟过去某一时刻的失败
+func (f *loginGuardFixture) seedAttempts(scope, id string, failures int, lastFailureAt, lockedUntil time.Time) {
+	key := "login_attempt:" + scope + ":" + id
+	f.mr.HSet(key, "failures", strconv.Itoa(failures), "last_failure_at", strconv.FormatInt(lastFailureAt.UnixMilli(), 10))
+	if !lockedUntil.IsZero() {
+		f.mr.HSet(key, "locked_until", strconv.FormatInt(lockedUntil.UnixMilli(), 10))
+	}
+}
+
+func (f *loginGuardFixture) fail(username, ip string) {
+	f.guard.RecordFailure(context.Background(), &model.LoginRequest{Username: username, IPAddress: ip, UserAgent: "ua/1"})
+}
+
+func TestLoginGuardBackoffDuration(t *testing.T) {
+	g := &loginGuard{cfg: testLockoutConfig()}
+	tests := []struct {
+		n    int64
+		want time.Duration
+	}{
+		{0, 2 * time.Second},
+		{1, 4 * time.Second},
+		{4, 32 * time.Second},
+		{5, 60 * time.Second},
+		{100, 60 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := g.backoff(tt.n); got != tt.want {
+			t.Errorf("backoff(%d) = %v，期望 %v", tt.n, got, tt.want)
+		}
+	}
+	if got := (&loginGuard{cfg: &config.LoginLockoutConfig{BackoffMaxSeconds: 60}}).backoff(3); got != 0 {
+		t.Errorf("基础时长为0时 backoff = %v", got)
+	}
+}
+
+func TestLoginGuardCheck(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		seed        func(f *loginGuardFixture)
+		username    string
+		ip          string
+		wantMessage string
+		// wantRetry 期望的等待时长，允许1秒误差
+		wantRetry time.Duration
+	}{
+		{"没有失败记录", func(f *loginGuardFixture) {}, "alice", "10.0.0.1", "", 0},
+		{"未达到退避阈值", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 2, now, time.Time{})
+		}, "alice", "10.0.0.1", "", 0},
+		{"刚达到退避阈值", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 3, now, time.Time{})
+		}, "alice", "10.0.0.1", "登录尝试过于频繁，请稍后再试", 2 * time.Second},
+		{"退避时长翻倍", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 5, now.Add(-5*time.Second), time.Time{})
+		}, "alice", "10.0.0.1", "登录尝试过于频繁，请稍后再试", 3 * time.Second},
+		{"退避已结束", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 4, now.Add(-5*time.Second), time.Time{})
+		}, "alice", "10.0.0.1", "", 0},
+		{"账户锁定中", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 5, now, now.Add(10*time.Minute))
+		}, "alice", "10.0.0.1", "登录失败次数过多，账户已被临时锁定，请稍后再试", 10 * time.Minute},
+		{"用户名忽略大小写与空白", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 5, now, now.Add(10*time.Minute))
+		}, " Alice ", "10.0.0.1", "登录失败次数过多，账户已被临时锁定，请稍后再试", 10 * time.Minute},
+		{"锁定已结束", func(f *loginGuardFixture) {
+			f.seedAttempts("account", "alice", 5, now.Add(-20*time.Minute), now.Add(-5*time.Minute))
+		}, "alice", "10.0.0.1", "", 0},
+		{"IP锁定中", func(f *loginGuardFixture) {
+			f.seedAttempts("ip", "10.0.0.1", 20, now, now.Add(5*time.Minute))
+		}, "bob", "10.0.0.1", "该IP登录失败次数过多，已被临时限制，请稍后再试", 5 * time.Minute},
+		{"其他IP不受影响", func(f *loginGuardFixture) {
+			f.seedAttempts("ip", "10.0.0.1", 20, now, now.Add(5*time.Minute))
+		}, "bob", "10.0.0.2", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newLoginGuardFixture(t, testLockoutConfig())
+			tt.seed(f)
+			err := f.guard.Check(context.Background(), tt.username, tt.ip)
+			if tt.wantMessage == "" {
+				if err != nil {
+					t.Fatalf("Check = %v", err)
+				}
+				return
+			}
+			var throttled *LoginThrottledError
+			if !errors.As(err, &throttled) || throttled.Message != tt.wantMessage {
+				t.Fatalf("Check = %v，期望 %q", err, tt.wantMessage)
+			}
+			if d := throttled.RetryAfter - tt.wantRetry; d > 0 || d < -time.Second {
+				t.Fatalf("RetryAfter = %v，期望约 %v", throttled.RetryAfter, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestLoginGuardLocksAccountAndAlertsOnce(t *testing.T) {
+	ctx := context.Background()
+	f := newLoginGuardFixture(t, testLockoutConfig())
+
+	for i := 0; i < 4; i++ {
+		f.fail("alice", "10.0.0.1")
+	}
+	f.mail.expectNoMail(t)
+	var throttled *LoginThrottledError
+	if err := f.guard.Check(ctx, "alice", "10.0.0.1"); !errors.As(err, &throttled) || throttled.Message != "登录尝试过于频繁，请稍后再试" {
+		t.Fatalf("锁定前 Check = %v", err)
+	}
+
+	// 第5次失败锁定账户，并通知账户邮箱
+	f.fail("alice", "10.0.0.1")
+	if mail := f.mail.expectMail(t, "account_locked", "alice@example.com"); mail.failures != 5 {
+		t.Fatalf("锁定提醒中的失败次数 = %d", mail.failures)
+	}
+	if err := f.guard.Check(ctx, "alice", "10.0.0.1"); !errors.As(err, &throttled) || throttled.Message != "登录失败次数过多，账户已被临时锁定，请稍后再试" {
+		t.Fatalf("锁定后 Check = %v", err)
+	}
+	want := []string{"login_failed", "login_failed", "login_failed", "login_failed", "login_failed", "login_locked"}
+	if len(f.logs.actions) != len(want) {
+		t.Fatalf("行为日志 = %v", f.logs.actions)
+	}
+	for i := range want {
+		if f.logs.actions[i] != want[i] {
+			t.Fatalf("行为日志 = %v", f.logs.actions)
+		}
+	}
+
+	// 锁定期内继续失败不会重复发送提醒
+	f.fail("alice", "10.0.0.1")
+	f.mail.expectNoMail(t)
+
+	// 管理员解锁后可以立即登录
+	if err := f.guard.ClearAccount(ctx, "Alice"); err != nil {
+		t.Fatalf("ClearAccount: %v", err)
+	}
+	if err := f.guard.Check(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("解锁后 Check = %v", err)
+	}
+}
+
+func TestLoginGuardUnknownAccountLocksWithoutAlert(t *testing.T) {
+	ctx := context.Background()
+	f := newLoginGuardFixture(t, testLockoutConfig())
+
+	// 不存在的账户同样计数和锁定，避免通过响应区分账户是否存在
+	for i := 0; i < 5; i++ {
+		f.fail("mallory", "10.0.0.1")
+	}
+	var throttled *LoginThrottledError
+	if err := f.guard.Check(ctx, "mallory", "10.0.0.1"); !errors.As(err, &throttled) {
+		t.Fatalf("Check = %v", err)
+	}
+	f.mail.expectNoMail(t)
+	for _, action := range f.logs.actions {
+		if action == "login_locked" {
+			t.Fatal("不存在的账户不应写入锁定日志")
+		}
+	}
+}
+
+func TestLoginGuardLocksIPAcrossAccounts(t *testing.T) {
+	ctx := context.Background()
+	cfg := testLockoutConfig()
+	cfg.IPBackoffAfter, cfg.IPLockoutAfter = 0, 3
+	f := newLoginGuardFixture(t, cfg)
+
+	// 同一IP对不同账户的失败累计到IP计数上
+	for _, name := range []string{"u1", "u2", "u3"} {
+		f.fail(name, "10.0.0.1")
+	}
+	var throttled *LoginThrottledError
+	if err := f.guard.Check(ctx, "alice", "10.0.0.1"); !errors.As(err, &throttled) || throttled.Message != "该IP登录失败次数过多，已被临时限制，请稍后再试" {
+		t.Fatalf("Check = %v", err)
+	}
+	if err := f.guard.Check(ctx, "alice", "10.0.0.2"); err != nil {
+		t.Fatalf("其他IP Check = %v", err)
+	}
+	// 账户本身没有被锁定，IP锁定不发送邮件
+	f.mail.expectNoMail(t)
+}
+
+func TestLoginGuardSuccessClearsAccountFailures(t *testing.T) {
+	ctx := context.Background()
+	f := newLoginGuardFixture(t, testLockoutConfig())
+	for i := 0; i < 2; i++ {
+		f.fail("alice", "10.0.0.1")
+	}
+	f.guard.RecordSuccess(ctx, "alice")
+
+	// 清除后重新从0计数，再失败2次仍未达到退避阈值
+	for i := 0; i < 2; i++ {
+		f.fail("alice", "10.0.0.2")
+	}
+	if err := f.guard.Check(ctx, "alice", "10.0.0.2"); err != nil {
+		t.Fatalf("Check = %v", err)
+	}
+}
+
+func TestLoginGuardFailsOpenWhenRedisUnavailable(t *testing.T) {
+	ctx := context.Background()
+	f := newLoginGuardFixture(t, testLockoutConfig())
+	f.seedAttempts("account", "alice", 5, time.Now(), time.Now().Add(time.Hour))
+	f.mr.Close()
+
+	if err := f.guard.Check(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Redis 不可用时应放行: %v", err)
+	}
+	f.fail("alice", "10.0.0.1")
+	if len(f.logs.actions) != 1 || f.logs.actions[0] != "login_failed" {
+		t.Fatalf("Redis 不可用时仍应记录行为日志: %v", f.logs.actions)
+	}
+	f.mail.expectNoMail(t)
+}
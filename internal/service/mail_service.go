@@ -17,6 +17,16 @@ type MailService interface {
 	SendVerificationCode(to, code string) error
 	SendResetPasswordCode(to, code string) error
 	SendDeviceVerificationCode(to, code, deviceName, ip, ua string) error
+	// 检测到已轮换的 refresh token 被再次使用（疑似被盗），相关会话已撤销
+	SendRefreshTokenReuseAlert(to, deviceName, ip, ua string, detectedAt time.Time) error
+	// 密码连续错误次数过多，账户已被临时锁定
+	SendAccountLockedAlert(to, ip, ua string, failures int64, lockedUntil time.Time) error
+	// 修改邮箱：验证码发送到新邮箱
+	SendEmailChangeCode(to, code string) error
+	// 修改邮箱：提醒原邮箱有人申请将账户邮箱改为 newEmail
+	SendEmailChangeRequestedNotice(to, newEmail, ip string, requestedAt time.Time) error
+	// 修改邮箱：通知原邮箱修改已生效，并附上在 undoDeadline 之前可用的撤销凭证
+	SendEmailChangedNotice(to, newEmail, undoToken string, undoDeadline time.Time) error
 	// 收到好友请求通知（发送给接收方）
 	SendFriendRequestNotification(to, requesterName, requesterUsername, receiverName string, note string, requestCreatedAt time.Time) error
 	// 好友请求结果通知（发送给另一方）result: accepted/rejected/cancelled
@@ -118,6 +128,136 @@ func (s *smtpMailService) SendDeviceVerificationCode(to, code, deviceName, ip, u
     return nil
 }
 
+// SendRefreshTokenReuseAlert 发送登录凭证重复使用告警邮件
+func (s *smtpMailService) SendRefreshTokenReuseAlert(to, deviceName, ip, ua string, detectedAt time.Time) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "账号安全提醒：检测到异常的登录凭证使用")
+
+	body := fmt.Sprintf(`
+        <p>您好,</p>
+        <p>我们检测到您账号的一个登录凭证在失效后被再次使用，这可能意味着该凭证已被他人窃取。</p>
+        <p>为保护您的账号，该设备上的登录会话已被强制退出。</p>
+        <p>会话设备：<b>%s</b></p>
+        <p>请求来源IP：<b>%s</b></p>
+        <p>请求User-Agent：<b>%s</b></p>
+        <p>检测时间：%s</p>
+        <p>如果非您本人操作，请尽快修改密码，并在“登录会话”中检查和移除不认识的设备。</p>
+    `, html.EscapeString(deviceName), html.EscapeString(ip), html.EscapeString(ua), detectedAt.Local().Format("2006-01-02 15:04:05"))
+	m.SetBody("text/html", body)
+
+	log.Printf("准备发送登录凭证重复使用告警: to=%s from=%s", to, s.from)
+	if err := s.dialer.DialAndSend(m); err != nil {
+		log.Printf("发送登录凭证重复使用告警失败: host=%s port=%d username=%s to=%s err=%v", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+		return fmt.Errorf("发送安全告警邮件失败(host=%s port=%d user=%s to=%s): %w", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+	}
+	log.Printf("发送登录凭证重复使用告警成功: to=%s", to)
+	return nil
+}
+
+// SendEmailChangeCode 发送修改邮箱验证码邮件
+func (s *smtpMailService) SendEmailChangeCode(to, code string) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "修改邮箱验证码")
+
+	body := fmt.Sprintf(`
+        <p>您好,</p>
+        <p>您正在将账户邮箱修改为此邮箱。您的验证码是：<b>%s</b></p>
+        <p>此验证码将在5分钟后失效。</p>
+        <p>如果不是您本人操作，请忽略此邮件，账户邮箱不会被修改。</p>
+    `, html.EscapeString(code))
+	m.SetBody("text/html", body)
+
+	log.Printf("准备发送修改邮箱验证码: to=%s from=%s", to, s.from)
+	if err := s.dialer.DialAndSend(m); err != nil {
+		log.Printf("发送修改邮箱验证码失败: host=%s port=%d username=%s to=%s err=%v", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+		return fmt.Errorf("发送修改邮箱验证码失败(host=%s port=%d user=%s to=%s): %w", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+	}
+	log.Printf("发送修改邮箱验证码成功: to=%s", to)
+	return nil
+}
+
+// SendEmailChangeRequestedNotice 发送修改邮箱申请提醒邮件
+func (s *smtpMailService) SendEmailChangeRequestedNotice(to, newEmail, ip string, requestedAt time.Time) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "账号安全提醒：有人申请修改您的账户邮箱")
+
+	body := fmt.Sprintf(`
+        <p>您好,</p>
+        <p>您的账户申请将邮箱修改为：<b>%s</b></p>
+        <p>请求来源IP：<b>%s</b></p>
+        <p>申请时间：%s</p>
+        <p>新邮箱验证通过后修改才会生效，届时我们会再次通知此邮箱，并提供撤销修改的凭证。</p>
+        <p>如果不是您本人操作，请尽快修改密码，并在“登录会话”中移除不认识的设备。</p>
+    `, html.EscapeString(newEmail), html.EscapeString(ip), requestedAt.Local().Format("2006-01-02 15:04:05"))
+	m.SetBody("text/html", body)
+
+	log.Printf("准备发送修改邮箱申请提醒: to=%s from=%s", to, s.from)
+	if err := s.dialer.DialAndSend(m); err != nil {
+		log.Printf("发送修改邮箱申请提醒失败: host=%s port=%d username=%s to=%s err=%v", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+		return fmt.Errorf("发送安全提醒邮件失败(host=%s port=%d user=%s to=%s): %w", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+	}
+	log.Printf("发送修改邮箱申请提醒成功: to=%s", to)
+	return nil
+}
+
+// SendEmailChangedNotice 发送邮箱已修改通知邮件（含撤销凭证）
+func (s *smtpMailService) SendEmailChangedNotice(to, newEmail, undoToken string, undoDeadline time.Time) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "账号安全提醒：您的账户邮箱已修改")
+
+	body := fmt.Sprintf(`
+        <p>您好,</p>
+        <p>您的账户邮箱已修改为：<b>%s</b>，此邮箱将不再接收账户相关邮件。</p>
+        <p>如果不是您本人操作，请在 %s 之前使用以下撤销凭证恢复原邮箱（调用 POST /api/v1/users/email/undo）：</p>
+        <p><b>%s</b></p>
+        <p>撤销后账户的所有登录会话将被强制退出，随后您可以通过“重置密码”重新设置密码。</p>
+    `, html.EscapeString(newEmail), undoDeadline.Local().Format("2006-01-02 15:04:05"), html.EscapeString(undoToken))
+	m.SetBody("text/html", body)
+
+	log.Printf("准备发送邮箱已修改通知: to=%s from=%s", to, s.from)
+	if err := s.dialer.DialAndSend(m); err != nil {
+		log.Printf("发送邮箱已修改通知失败: host=%s port=%d username=%s to=%s err=%v", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+		return fmt.Errorf("发送安全提醒邮件失败(host=%s port=%d user=%s to=%s): %w", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+	}
+	log.Printf("发送邮箱已修改通知成功: to=%s", to)
+	return nil
+}
+
+// SendAccountLockedAlert 发送账户临时锁定通知邮件
+func (s *smtpMailService) SendAccountLockedAlert(to, ip, ua string, failures int64, lockedUntil time.Time) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "账号安全提醒：登录失败次数过多，账号已被临时锁定")
+
+	body := fmt.Sprintf(`
+        <p>您好,</p>
+        <p>您的账号近期连续 <b>%d</b> 次登录密码错误，为防止密码被暴力猜测，账号已被临时锁定。</p>
+        <p>最近一次尝试来源IP：<b>%s</b></p>
+        <p>最近一次尝试User-Agent：<b>%s</b></p>
+        <p>锁定解除时间：%s</p>
+        <p>锁定期间使用密码登录将被拒绝，解除后可正常登录；如需提前解锁请联系管理员。</p>
+        <p>如果这些尝试并非您本人操作，建议您在解锁后尽快修改密码并开启两步验证。</p>
+    `, failures, html.EscapeString(ip), html.EscapeString(ua), lockedUntil.Local().Format("2006-01-02 15:04:05"))
+	m.SetBody("text/html", body)
+
+	log.Printf("准备发送账户锁定通知: to=%s from=%s", to, s.from)
+	if err := s.dialer.DialAndSend(m); err != nil {
+		log.Printf("发送账户锁定通知失败: host=%s port=%d username=%s to=%s err=%v", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+		return fmt.Errorf("发送安全告警邮件失败(host=%s port=%d user=%s to=%s): %w", s.dialer.Host, s.dialer.Port, s.dialer.Username, to, err)
+	}
+	log.Printf("发送账户锁定通知成功: to=%s", to)
+	return nil
+}
+
 // smtpMailService SMTP邮件服务实现
 type smtpMailService struct {
 	dialer *gomail.Dialer
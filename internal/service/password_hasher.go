@@ -0,0 +1,156 @@
+package service
+
+import (
+	"backend/internal/config"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordAlgorithmArgon2id = "argon2id"
+	PasswordAlgorithmBcrypt   = "bcrypt"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher 密码哈希
+// 新密码统一编码为 PHC 字符串（$argon2id$v=19$m=...,t=...,p=...$salt$hash 或 bcrypt 的 $2a$/$2b$），
+// 算法与参数随哈希一起存储；历史的 "salt:sha256" 格式仅用于校验
+type PasswordHasher interface {
+	// Hash 使用当前配置的算法生成密码哈希
+	Hash(password string) (string, error)
+	// Verify 校验密码；密码正确且存储格式或参数已过时时 needsRehash 为 true
+	Verify(password, encoded string) (ok bool, needsRehash bool, err error)
+}
+
+type passwordHasher struct {
+	algorithm   string
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	bcryptCost  int
+}
+
+// NewPasswordHasher 按安全配置创建密码哈希器，未知算法回退为 argon2id
+func NewPasswordHasher(cfg *config.SecurityConfig) PasswordHasher {
+	h := &passwordHasher{
+		algorithm:   PasswordAlgorithmArgon2id,
+		memory:      64 * 1024,
+		iterations:  3,
+		parallelism: 2,
+		bcryptCost:  bcrypt.DefaultCost,
+	}
+	if cfg.PasswordHashAlgorithm == PasswordAlgorithmBcrypt {
+		h.algorithm = PasswordAlgorithmBcrypt
+	}
+	if cfg.Argon2MemoryKiB > 0 {
+		h.memory = uint32(cfg.Argon2MemoryKiB)
+	}
+	if cfg.Argon2Iterations > 0 {
+		h.iterations = uint32(cfg.Argon2Iterations)
+	}
+	if cfg.Argon2Parallelism > 0 && cfg.Argon2Parallelism <= 255 {
+		h.parallelism = uint8(cfg.Argon2Parallelism)
+	}
+	if cfg.BcryptCost >= bcrypt.MinCost && cfg.BcryptCost <= bcrypt.MaxCost {
+		h.bcryptCost = cfg.BcryptCost
+	}
+	return h
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.algorithm == PasswordAlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *passwordHasher) Verify(password, encoded string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.verifyArgon2id(password, encoded)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, _ := bcrypt.Cost([]byte(encoded))
+		return true, h.algorithm != PasswordAlgorithmBcrypt || cost != h.bcryptCost, nil
+	default:
+		return verifyLegacySHA256(password, encoded)
+	}
+}
+
+// verifyArgon2id 参数取自哈希本身，与当前配置不一致时要求重新哈希
+func (h *passwordHasher) verifyArgon2id(password, encoded string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, errors.New("密码格式错误")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errors.New("密码格式错误")
+	}
+	var memory, iterations uint32
+	var parallelism uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, false, errors.New("密码格式错误")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errors.New("密码格式错误")
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, false, errors.New("密码格式错误")
+	}
+
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false, nil
+	}
+	needsRehash := h.algorithm != PasswordAlgorithmArgon2id ||
+		memory != h.memory || iterations != h.iterations || parallelism != h.parallelism
+	return true, needsRehash, nil
+}
+
+// verifyLegacySHA256 历史格式 "salt:hex(sha256(password+salt))"，校验通过后总是要求重新哈希
+func verifyLegacySHA256(password, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, ":")
+	if len(parts) != 2 {
+		return false, false, errors.New("密码格式错误")
+	}
+	sum := sha256.Sum256([]byte(password + parts[0]))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(parts[1])) != 1 {
+		return false, false, nil
+	}
+	return true, true, nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 测试使用最低成本参数，避免拖慢测试
+func testArgon2Config() *config.SecurityConfig {
+	return &config.SecurityConfig{
+		PasswordHashAlgorithm: PasswordAlgorithmArgon2id,
+		Argon2MemoryKiB:       1024,
+		Argon2Iterations:      1,
+		Argon2Parallelism:     1,
+	}
+}
+
+func testBcryptConfig() *config.SecurityConfig {
+	return &config.SecurityConfig{PasswordHashAlgorithm: PasswordAlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+}
+
+// legacyHash 生成历史的 "salt:hex(sha256(password+salt))" 格式
+func legacyHash(password, salt string) string {
+	sum := sha256.Sum256([]byte(password + salt))
+	return salt + ":" + hex.EncodeToString(sum[:])
+}
+
+func mustHash(t *testing.T, h PasswordHasher, password string) string {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return encoded
+}
+
+func TestPasswordHasherEncoding(t *testing.T) {
+	argon := mustHash(t, NewPasswordHasher(testArgon2Config()), "secret")
+	if !strings.HasPrefix(argon, "$argon2id$v=19$m=1024,t=1,p=1$") || len(strings.Split(argon, "$")) != 6 {
+		t.Fatalf("argon2id 编码 = %s", argon)
+	}
+	bc := mustHash(t, NewPasswordHasher(testBcryptConfig()), "secret")
+	if cost, err := bcrypt.Cost([]byte(bc)); err != nil || !strings.HasPrefix(bc, "$2a$") || cost != bcrypt.MinCost {
+		t.Fatalf("bcrypt 编码 = %s cost=%d err=%v", bc, cost, err)
+	}
+	// 每次生成随机盐
+	if again := mustHash(t, NewPasswordHasher(testArgon2Config()), "secret"); again == argon {
+		t.Fatal("相同密码生成了相同的哈希")
+	}
+}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	argon2Hasher := NewPasswordHasher(testArgon2Config())
+	bcryptHasher := NewPasswordHasher(testBcryptConfig())
+	stronger := testArgon2Config()
+	stronger.Argon2Iterations = 2
+
+	argonHash := mustHash(t, argon2Hasher, "secret")
+	bcryptHash := mustHash(t, bcryptHasher, "secret")
+	costlier, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		hasher      PasswordHasher
+		password    string
+		encoded     string
+		ok          bool
+		needsRehash bool
+		wantErr     bool
+	}{
+		{"argon2id 正确", argon2Hasher, "secret", argonHash, true, false, false},
+		{"argon2id 错误密码", argon2Hasher, "Secret", argonHash, false, false, false},
+		{"argon2id 参数已调整", NewPasswordHasher(stronger), "secret", argonHash, true, true, false},
+		{"argon2id 切换为 bcrypt", bcryptHasher, "secret", argonHash, true, true, false},
+		{"bcrypt 正确", bcryptHasher, "secret", bcryptHash, true, false, false},
+		{"bcrypt 错误密码", bcryptHasher, "wrong", bcryptHash, false, false, false},
+		{"bcrypt 成本已调整", bcryptHasher, "secret", string(costlier), true, true, false},
+		{"bcrypt 切换为 argon2id", argon2Hasher, "secret", bcryptHash, true, true, false},
+		{"历史格式正确", argon2Hasher, "secret", legacyHash("secret", "salt"), true, true, false},
+		{"历史格式错误密码", argon2Hasher, "wrong", legacyHash("secret", "salt"), false, false, false},
+		{"argon2id 段数错误", argon2Hasher, "secret", "$argon2id$v=19$m=1024,t=1,p=1$abc", false, false, true},
+		{"argon2id 版本不支持", argon2Hasher, "secret", strings.Replace(argonHash, "v=19", "v=16", 1), false, false, true},
+		{"argon2id 参数无法解析", argon2Hasher, "secret", strings.Replace(argonHash, "m=1024", "m=x", 1), false, false, true},
+		{"argon2id 盐非 base64", argon2Hasher, "secret", "$argon2id$v=19$m=1024,t=1,p=1$!!$AAAA", false, false, true},
+		{"未知格式", argon2Hasher, "secret", "plaintext", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := tt.hasher.Verify(tt.password, tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.ok || needsRehash != tt.needsRehash {
+				t.Fatalf("ok=%v needsRehash=%v，期望 ok=%v needsRehash=%v", ok, needsRehash, tt.ok, tt.needsRehash)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasherIgnoresInvalidConfig(t *testing.T) {
+	h := NewPasswordHasher(&config.SecurityConfig{PasswordHashAlgorithm: "md5", BcryptCost: 99, Argon2Parallelism: 1000})
+	encoded := mustHash(t, h, "secret")
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Fatalf("未知算法应回退为默认参数的 argon2id，得到 %s", encoded)
+	}
+}
+
+func TestValidatePasswordUpgradesLegacyHash(t *testing.T) {
+	legacy := legacyHash("secret", "salt")
+	user := &model.User{ID: uuid.New(), Username: "alice", Status: "active", PasswordSalt: legacy}
+	repo := newFakeUserRepo(user)
+	hasher := NewPasswordHasher(testArgon2Config())
+	svc := &userService{userRepo: repo, passwordHasher: hasher}
+
+	if _, err := svc.ValidatePassword("alice", "wrong"); err == nil || err.Error() != "用户名或密码错误" {
+		t.Fatalf("错误密码返回 %v", err)
+	}
+	if repo.users[user.ID].PasswordSalt != legacy {
+		t.Fatal("密码错误时不应升级哈希")
+	}
+
+	got, err := svc.ValidatePassword("alice", "secret")
+	if err != nil {
+		t.Fatalf("ValidatePassword: %v", err)
+	}
+	stored := repo.users[user.ID].PasswordSalt
+	if !strings.HasPrefix(stored, "$argon2id$") || got.PasswordSalt != stored {
+		t.Fatalf("历史哈希未升级：存储 %s，返回 %s", stored, got.PasswordSalt)
+	}
+	if ok, needsRehash, err := hasher.Verify("secret", stored); err != nil || !ok || needsRehash {
+		t.Fatalf("升级后的哈希 ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	// 已是当前格式时不再写库
+	if _, err := svc.ValidatePassword("alice", "secret"); err != nil {
+		t.Fatalf("ValidatePassword: %v", err)
+	}
+	if repo.users[user.ID].PasswordSalt != stored {
+		t.Fatal("当前格式的哈希不应被重新生成")
+	}
+}
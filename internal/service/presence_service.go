@@ -0,0 +1,169 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PresenceConnTTL 连接在线记录的有效期，连接需在此之前通过心跳续期
+const PresenceConnTTL = 90 * time.Second
+
+// PresenceSweepInterval 清理过期连接的间隔：实例异常退出后，其用户最迟在 PresenceConnTTL 加上该间隔后被判定离线
+const PresenceSweepInterval = 30 * time.Second
+
+// presenceSweepBatch 单次清理的连接数上限，剩余的在下一轮处理
+const presenceSweepBatch = 500
+
+// PresenceService 在线状态服务
+// 状态变化（上线、离开、离线）时经 ChatBroker 向该用户的好友推送 presence 帧
+type PresenceService interface {
+	// Connect 登记连接；用户由离线变为在线时通知好友
+	Connect(ctx context.Context, userID uuid.UUID, connID string) error
+	// Heartbeat 续期连接
+	Heartbeat(ctx context.Context, userID uuid.UUID, connID string) error
+	// Disconnect 移除连接；用户最后一个连接断开时记录最后在线时间并通知好友
+	Disconnect(ctx context.Context, userID uuid.UUID, connID string) error
+	// SetStatus 客户端主动切换 online/away
+	SetStatus(ctx context.Context, userID uuid.UUID, status model.PresenceStatus) error
+	// GetPresence 批量获取用户在线状态
+	GetPresence(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]model.UserPresence, error)
+	// SweepExpired 清理未续期而过期的连接（实例异常退出时遗留），为因此离线的用户通知好友
+	SweepExpired(ctx context.Context) error
+	// RunSweeper 每隔 interval 执行一次 SweepExpired，直到 ctx 取消；每个实例各自运行即可
+	RunSweeper(ctx context.Context, interval time.Duration)
+}
+
+type presenceService struct {
+	presenceRepo repository.PresenceRepository
+	friendRepo   repository.FriendshipRepository
+	broker       ChatBroker
+}
+
+func NewPresenceService(presenceRepo repository.PresenceRepository, friendRepo repository.FriendshipRepository, broker ChatBroker) PresenceService {
+	return &presenceService{
+		presenceRepo: presenceRepo,
+		friendRepo:   friendRepo,
+		broker:       broker,
+	}
+}
+
+func (s *presenceService) Connect(ctx context.Context, userID uuid.UUID, connID string) error {
+	first, err := s.presenceRepo.AddConn(ctx, userID, connID, PresenceConnTTL)
+	if err != nil {
+		return err
+	}
+	if first {
+		s.notifyFriends(ctx, model.UserPresence{UserID: userID, Status: model.PresenceOnline})
+	}
+	return nil
+}
+
+func (s *presenceService) Heartbeat(ctx context.Context, userID uuid.UUID, connID string) error {
+	return s.presenceRepo.RefreshConn(ctx, userID, connID, PresenceConnTTL)
+}
+
+func (s *presenceService) Disconnect(ctx context.Context, userID uuid.UUID, connID string) error {
+	last, err := s.presenceRepo.RemoveConn(ctx, userID, connID)
+	if err != nil {
+		return err
+	}
+	if last {
+		now := time.Now()
+		s.notifyFriends(ctx, model.UserPresence{UserID: userID, Status: model.PresenceOffline, LastSeenAt: &now})
+	}
+	return nil
+}
+
+func (s *presenceService) SetStatus(ctx context.Context, userID uuid.UUID, status model.PresenceStatus) error {
+	if err := s.presenceRepo.SetAway(ctx, userID, status == model.PresenceAway, PresenceConnTTL); err != nil {
+		return err
+	}
+	s.notifyFriends(ctx, model.UserPresence{UserID: userID, Status: status})
+	return nil
+}
+
+func (s *presenceService) GetPresence(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]model.UserPresence, error) {
+	states, err := s.presenceRepo.GetStates(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[uuid.UUID]model.UserPresence, len(states))
+	for id, st := range states {
+		p := model.UserPresence{UserID: id, Status: model.PresenceOffline}
+		switch {
+		case st.Conns > 0 && st.Away:
+			p.Status = model.PresenceAway
+		case st.Conns > 0:
+			p.Status = model.PresenceOnline
+		default:
+			p.LastSeenAt = st.LastSeen
+		}
+		res[id] = p
+	}
+	return res, nil
+}
+
+func (s *presenceService) SweepExpired(ctx context.Context) error {
+	for {
+		// 部分用户清理失败时，已离线的用户仍需通知
+		userIDs, claimed, sweepErr := s.presenceRepo.SweepExpired(ctx, PresenceConnTTL, presenceSweepBatch)
+		if len(userIDs) > 0 {
+			states, err := s.presenceRepo.GetStates(ctx, userIDs)
+			if err != nil {
+				return err
+			}
+			for _, id := range userIDs {
+				s.notifyFriends(ctx, model.UserPresence{UserID: id, Status: model.PresenceOffline, LastSeenAt: states[id].LastSeen})
+			}
+		}
+		if sweepErr != nil {
+			return sweepErr
+		}
+		if claimed < presenceSweepBatch {
+			return nil
+		}
+	}
+}
+
+func (s *presenceService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SweepExpired(ctx); err != nil {
+				log.Printf("清理过期在线连接失败: %v", err)
+			}
+		}
+	}
+}
+
+// notifyFriends 向用户的全部好友推送状态变化，失败只记录日志
+func (s *presenceService) notifyFriends(ctx context.Context, p model.UserPresence) {
+	friendIDs, err := s.friendRepo.ListFriendIDs(p.UserID)
+	if err != nil {
+		log.Printf("获取好友列表失败: %v", err)
+		return
+	}
+	if len(friendIDs) == 0 {
+		return
+	}
+	frame, err := encodeChatFrame(model.ChatFramePresence, model.ChatPresencePayload{
+		UserID:     p.UserID.String(),
+		Status:     string(p.Status),
+		LastSeenAt: p.LastSeenAt,
+	})
+	if err != nil {
+		return
+	}
+	if err := s.broker.Publish(ctx, &ChatDelivery{UserIDs: friendIDs, Payload: frame}); err != nil {
+		log.Printf("发布在线状态失败: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeFriendRepo 只实现 ListFriendIDs
+type fakeFriendRepo struct {
+	repository.FriendshipRepository
+	friends map[uuid.UUID][]uuid.UUID
+}
+
+func (r *fakeFriendRepo) ListFriendIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	return r.friends[userID], nil
+}
+
+// decodePresence 解析投递中的 presence 帧
+func decodePresence(t *testing.T, d *ChatDelivery) model.ChatPresencePayload {
+	t.Helper()
+	var frame model.ChatFrame
+	var p model.ChatPresencePayload
+	if err := json.Unmarshal(d.Payload, &frame); err != nil || frame.Type != model.ChatFramePresence {
+		t.Fatalf("不是 presence 帧: %s", d.Payload)
+	}
+	if err := json.Unmarshal(frame.Payload, &p); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return p
+}
+
+func TestPresenceSweepNotifiesFriendsOfDeadInstanceUsers(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestRedis(t)
+	presenceRepo := repository.NewPresenceRepository(rdb)
+	user, friend := uuid.New(), uuid.New()
+	broker := NewLocalChatBroker()
+	var deliveries []*ChatDelivery
+	_ = broker.Subscribe(func(d *ChatDelivery) { deliveries = append(deliveries, d) })
+	svc := NewPresenceService(presenceRepo, &fakeFriendRepo{friends: map[uuid.UUID][]uuid.UUID{user: {friend}}}, broker)
+
+	// 模拟已退出的实例登记的连接：不再续期，也不会调用 Disconnect
+	if _, err := presenceRepo.AddConn(ctx, user, "dead", 10*time.Millisecond); err != nil {
+		t.Fatalf("AddConn: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if err := svc.SweepExpired(ctx); err != nil {
+		t.Fatalf("SweepExpired: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d", len(deliveries))
+	}
+	d := deliveries[0]
+	if len(d.UserIDs) != 1 || d.UserIDs[0] != friend {
+		t.Fatalf("UserIDs = %v", d.UserIDs)
+	}
+	p := decodePresence(t, d)
+	if p.UserID != user.String() || p.Status != string(model.PresenceOffline) || p.LastSeenAt == nil {
+		t.Fatalf("presence = %+v", p)
+	}
+
+	if err := svc.SweepExpired(ctx); err != nil {
+		t.Fatalf("SweepExpired: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatal("同一连接不应重复通知离线")
+	}
+}
+
+func TestPresenceDisconnectNotifiesOnlyOnLastConn(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newTestRedis(t)
+	user, friend := uuid.New(), uuid.New()
+	broker := NewLocalChatBroker()
+	var statuses []string
+	_ = broker.Subscribe(func(d *ChatDelivery) { statuses = append(statuses, decodePresence(t, d).Status) })
+	svc := NewPresenceService(repository.NewPresenceRepository(rdb), &fakeFriendRepo{friends: map[uuid.UUID][]uuid.UUID{user: {friend}}}, broker)
+
+	_ = svc.Connect(ctx, user, "a")
+	_ = svc.Connect(ctx, user, "b")
+	_ = svc.Disconnect(ctx, user, "a")
+	_ = svc.Disconnect(ctx, user, "b")
+
+	want := []string{string(model.PresenceOnline), string(model.PresenceOffline)}
+	if len(statuses) != len(want) || statuses[0] != want[0] || statuses[1] != want[1] {
+		t.Fatalf("statuses = %v，期望 %v", statuses, want)
+	}
+}
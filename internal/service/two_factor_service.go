@@ -0,0 +1,354 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	totpPeriod     = 30
+	totpDigits     = 6
+	totpSecretSize = 20
+	// totpSkew 允许前后各偏差一个时间步，容忍客户端时钟误差
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	// 连续失败达到上限后锁定一段时间，防止暴力猜测动态码
+	totpMaxAttempts  = 5
+	totpLockDuration = 15 * time.Minute
+)
+
+// recoveryCodeEncoding 恢复码使用小写 Base32，不易混淆且便于手工输入
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// TwoFactorService 两步验证服务：RFC 6238 TOTP 与一次性恢复码
+type TwoFactorService interface {
+	// GetStatus 查询两步验证状态
+	GetStatus(userID uuid.UUID) (*model.TwoFactorStatusResponse, error)
+	// SetupTOTP 生成新的密钥与 otpauth URI；确认前不生效
+	SetupTOTP(ctx context.Context, userID uuid.UUID) (*model.TOTPSetupResponse, error)
+	// ConfirmTOTP 校验动态码后启用 TOTP，返回首批恢复码
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) (*model.RecoveryCodesResponse, error)
+	// DisableTOTP 校验动态码或恢复码后停用两步验证
+	DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error
+	// RegenerateRecoveryCodes 校验动态码后重新生成恢复码，旧恢复码全部失效
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) (*model.RecoveryCodesResponse, error)
+	// IsEnabled 用户是否已启用两步验证
+	IsEnabled(userID uuid.UUID) (bool, error)
+	// Verify 登录第二步：校验动态码或恢复码
+	Verify(ctx context.Context, userID uuid.UUID, code string) error
+}
+
+type twoFactorService struct {
+	repo       repository.TwoFactorRepository
+	userRepo   repository.UserRepository
+	userLogSvc UserActionLogService
+	issuer     string
+}
+
+// NewTwoFactorService 创建两步验证服务实例
+func NewTwoFactorService(repo repository.TwoFactorRepository, userRepo repository.UserRepository, userLogSvc UserActionLogService, securityCfg *config.SecurityConfig) TwoFactorService {
+	return &twoFactorService{
+		repo:       repo,
+		userRepo:   userRepo,
+		userLogSvc: userLogSvc,
+		issuer:     securityCfg.TOTPIssuer,
+	}
+}
+
+func (s *twoFactorService) GetStatus(userID uuid.UUID) (*model.TwoFactorStatusResponse, error) {
+	t, err := s.getEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return &model.TwoFactorStatusResponse{Enabled: false}, nil
+	}
+	remaining, err := s.repo.CountUnusedRecoveryCodes(userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询恢复码失败: %w", err)
+	}
+	return &model.TwoFactorStatusResponse{
+		Enabled:                true,
+		EnabledAt:              t.EnabledAt,
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+func (s *twoFactorService) SetupTOTP(ctx context.Context, userID uuid.UUID) (*model.TOTPSetupResponse, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	enabled, err := s.IsEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+
+	raw := make([]byte, totpSecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %w", err)
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+	if err := s.repo.SaveTOTPSecret(userID, secret); err != nil {
+		return nil, fmt.Errorf("保存密钥失败: %w", err)
+	}
+
+	label := url.PathEscape(s.issuer + ":" + user.Username)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", s.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return &model.TOTPSetupResponse{
+		Secret:     secret,
+		OtpauthURI: "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+func (s *twoFactorService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) (*model.RecoveryCodesResponse, error) {
+	t, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("请先生成两步验证密钥")
+		}
+		return nil, fmt.Errorf("查询两步验证配置失败: %w", err)
+	}
+	if t.Enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+	if t.LockedUntil != nil && time.Now().Before(*t.LockedUntil) {
+		return nil, errors.New("动态验证码错误次数过多，请稍后再试")
+	}
+	step, ok := matchTOTP(t.Secret, code, time.Now())
+	if !ok {
+		s.recordFailure(userID)
+		return nil, errors.New("动态验证码错误")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	if err := s.repo.EnableTOTP(userID, step, hashes); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("请先生成两步验证密钥")
+		}
+		return nil, fmt.Errorf("启用两步验证失败: %w", err)
+	}
+	s.logAction(ctx, userID, "2fa_enabled", "totp")
+	return &model.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *twoFactorService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTOTP(userID); err != nil {
+		return fmt.Errorf("停用两步验证失败: %w", err)
+	}
+	s.logAction(ctx, userID, "2fa_disabled", "totp")
+	return nil
+}
+
+// RegenerateRecoveryCodes 只接受动态码，避免用一个恢复码换取整批新恢复码
+func (s *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) (*model.RecoveryCodesResponse, error) {
+	t, err := s.getEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.New("未启用两步验证")
+	}
+	if err := s.verifyTOTP(t, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, fmt.Errorf("保存恢复码失败: %w", err)
+	}
+	s.logAction(ctx, userID, "2fa_recovery_codes_regenerated", "")
+	return &model.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *twoFactorService) IsEnabled(userID uuid.UUID) (bool, error) {
+	t, err := s.getEnabled(userID)
+	if err != nil {
+		return false, err
+	}
+	return t != nil, nil
+}
+
+// Verify 6位数字按动态码校验，其余按恢复码校验
+func (s *twoFactorService) Verify(ctx context.Context, userID uuid.UUID, code string) error {
+	t, err := s.getEnabled(userID)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return errors.New("未启用两步验证")
+	}
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		return s.verifyTOTP(t, code)
+	}
+
+	if t.LockedUntil != nil && time.Now().Before(*t.LockedUntil) {
+		return errors.New("动态验证码错误次数过多，请稍后再试")
+	}
+	ok, err := s.repo.ConsumeRecoveryCode(userID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("校验恢复码失败: %w", err)
+	}
+	if !ok {
+		s.recordFailure(userID)
+		return errors.New("恢复码无效或已使用")
+	}
+	s.logAction(ctx, userID, "2fa_recovery_code_used", "")
+	return nil
+}
+
+// verifyTOTP 校验动态码并记录时间步，拒绝重放
+func (s *twoFactorService) verifyTOTP(t *model.UserTOTP, code string) error {
+	if t.LockedUntil != nil && time.Now().Before(*t.LockedUntil) {
+		return errors.New("动态验证码错误次数过多，请稍后再试")
+	}
+	step, ok := matchTOTP(t.Secret, strings.TrimSpace(code), time.Now())
+	if !ok || step <= t.LastUsedStep {
+		s.recordFailure(t.UserID)
+		return errors.New("动态验证码错误")
+	}
+	consumed, err := s.repo.ConsumeTOTPStep(t.UserID, step)
+	if err != nil {
+		return fmt.Errorf("校验动态验证码失败: %w", err)
+	}
+	if !consumed {
+		return errors.New("动态验证码已使用，请等待下一个验证码")
+	}
+	return nil
+}
+
+// getEnabled 返回已启用的配置，未启用（含待确认）时返回 nil
+func (s *twoFactorService) getEnabled(userID uuid.UUID) (*model.UserTOTP, error) {
+	t, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询两步验证配置失败: %w", err)
+	}
+	if !t.Enabled {
+		return nil, nil
+	}
+	return t, nil
+}
+
+func (s *twoFactorService) recordFailure(userID uuid.UUID) {
+	if err := s.repo.RecordTOTPFailure(userID, totpMaxAttempts, time.Now().Add(totpLockDuration)); err != nil {
+		log.Printf("记录两步验证失败次数失败: %v", err)
+	}
+}
+
+func (s *twoFactorService) logAction(ctx context.Context, userID uuid.UUID, action, details string) {
+	_ = s.userLogSvc.Create(ctx, &model.UserActionLog{
+		UserID:  &userID,
+		Action:  action,
+		Details: details,
+	})
+}
+
+// matchTOTP 在允许的时钟偏差内查找匹配的时间步
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	if !isTOTPCode(code) {
+		return 0, false
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+		if hmac.Equal([]byte(totpAt(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpAt 计算指定时间步的动态码（RFC 4226 动态截断，HMAC-SHA1）
+func totpAt(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// generateRecoveryCodes 生成恢复码明文（xxxxx-xxxxx）及其哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := recoveryCodeEncoding.EncodeToString(raw)[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 忽略大小写、空格与分隔符后计算哈希；恢复码为随机生成，无需加盐
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"encoding/base32"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeTwoFactorRepo 内存中的 TOTP 配置与恢复码，语义与数据库实现一致
+type fakeTwoFactorRepo struct {
+	totp     map[uuid.UUID]*model.UserTOTP
+	recovery map[uuid.UUID]map[string]bool // 恢复码哈希 -> 是否已使用
+}
+
+func newFakeTwoFactorRepo() *fakeTwoFactorRepo {
+	return &fakeTwoFactorRepo{
+		totp:     make(map[uuid.UUID]*model.UserTOTP),
+		recovery: make(map[uuid.UUID]map[string]bool),
+	}
+}
+
+func (r *fakeTwoFactorRepo) GetTOTP(userID uuid.UUID) (*model.UserTOTP, error) {
+	t, ok := r.totp[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (r *fakeTwoFactorRepo) SaveTOTPSecret(userID uuid.UUID, secret string) error {
+	r.totp[userID] = &model.UserTOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) EnableTOTP(userID uuid.UUID, step int64, codeHashes []string) error {
+	t, ok := r.totp[userID]
+	if !ok || t.Enabled {
+		return gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	t.Enabled, t.EnabledAt, t.LastUsedStep = true, &now, step
+	return r.ReplaceRecoveryCodes(userID, codeHashes)
+}
+
+func (r *fakeTwoFactorRepo) DeleteTOTP(userID uuid.UUID) error {
+	delete(r.totp, userID)
+	delete(r.recovery, userID)
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) ConsumeTOTPStep(userID uuid.UUID, step int64) (bool, error) {
+	t, ok := r.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep, t.FailedAttempts, t.LockedUntil = step, 0, nil
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepo) RecordTOTPFailure(userID uuid.UUID, maxAttempts int, lockUntil time.Time) error {
+	t, ok := r.totp[userID]
+	if !ok {
+		return nil
+	}
+	t.FailedAttempts++
+	if t.FailedAttempts >= maxAttempts {
+		t.FailedAttempts = 0
+		t.LockedUntil = &lockUntil
+	}
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	r.recovery[userID] = make(map[string]bool)
+	for _, h := range codeHashes {
+		r.recovery[userID][h] = false
+	}
+	return nil
+}
+
+func (r *fakeTwoFactorRepo) ConsumeRecoveryCode(userID uuid.UUID, codeHash string) (bool, error) {
+	used, ok := r.recovery[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.recovery[userID][codeHash] = true
+	return true, nil
+}
+
+func (r *fakeTwoFactorRepo) CountUnusedRecoveryCodes(userID uuid.UUID) (int64, error) {
+	var n int64
+	for _, used := range r.recovery[userID] {
+		if !used {
+			n++
+		}
+	}
+	return n, nil
+}
+
+var _ repository.TwoFactorRepository = (*fakeTwoFactorRepo)(nil)
+
+// codeAt 计算密钥在 now 之后 offset 个时间步的动态码
+func codeAt(t *testing.T, secret string, now time.Time, offset int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("DecodeString: %v", err)
+	}
+	return totpAt(key, now.Unix()/totpPeriod+offset)
+}
+
+func TestTOTPAtRFC6238Vectors(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量，取 8 位结果的后 6 位
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := totpAt(key, unix/totpPeriod); got != want {
+			t.Errorf("T=%d 得到 %s，期望 %s", unix, got, want)
+		}
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		ok       bool
+	}{
+		{"当前时间步", codeAt(t, secret, now, 0), current, true},
+		{"上一个时间步", codeAt(t, secret, now, -1), current - 1, true},
+		{"下一个时间步", codeAt(t, secret, now, 1), current + 1, true},
+		{"超出允许偏差", codeAt(t, secret, now, 2), 0, false},
+		{"非数字", "12a456", 0, false},
+		{"位数不足", "12345", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(secret, tt.code, now)
+			if ok != tt.ok || (ok && step != tt.wantStep) {
+				t.Fatalf("step=%d ok=%v，期望 step=%d ok=%v", step, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+	if _, ok := matchTOTP("not base32!", codeAt(t, secret, now, 0), now); ok {
+		t.Fatal("无效密钥不应匹配")
+	}
+}
+
+func TestRecoveryCodeFormatAndHash(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("生成 %d 个恢复码、%d 个哈希", len(codes), len(hashes))
+	}
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("恢复码格式错误: %s", code)
+		}
+		if seen[code] {
+			t.Errorf("恢复码重复: %s", code)
+		}
+		seen[code] = true
+		if hashes[i] != hashRecoveryCode(code) {
+			t.Errorf("恢复码 %s 的哈希不一致", code)
+		}
+	}
+	// 输入时忽略大小写、空格与分隔符
+	if hashRecoveryCode(" ABCDE-fghij ") != hashRecoveryCode("abcdefghij") || hashRecoveryCode("abcde fghij") != hashRecoveryCode("abcde-fghij") {
+		t.Fatal("恢复码哈希未做规范化")
+	}
+}
+
+// enabledTwoFactor 完成密钥生成与确认，返回服务、密钥、首批恢复码与确认所用动态码的时间
+// 后续动态码以该时间为基准计算，避免测试跨越时间步边界
+func enabledTwoFactor(t *testing.T) (*twoFactorService, *fakeTwoFactorRepo, uuid.UUID, string, []string, time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	user := &model.User{ID: uuid.New(), Username: "alice"}
+	repo := newFakeTwoFactorRepo()
+	svc := NewTwoFactorService(repo, newFakeUserRepo(user), &fakeUserLogService{}, &config.SecurityConfig{TOTPIssuer: "Backend"}).(*twoFactorService)
+
+	setup, err := svc.SetupTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	now := time.Now()
+	codes, err := svc.ConfirmTOTP(ctx, user.ID, codeAt(t, setup.Secret, now, 0))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return svc, repo, user.ID, setup.Secret, codes.RecoveryCodes, now
+}
+
+func TestTwoFactorSetupURI(t *testing.T) {
+	user := &model.User{ID: uuid.New(), Username: "alice"}
+	svc := NewTwoFactorService(newFakeTwoFactorRepo(), newFakeUserRepo(user), &fakeUserLogService{}, &config.SecurityConfig{TOTPIssuer: "My App"})
+	setup, err := svc.SetupTOTP(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(setup.Secret)
+	if err != nil || len(key) != totpSecretSize {
+		t.Fatalf("密钥 %q 解码得到 %d 字节, err=%v", setup.Secret, len(key), err)
+	}
+	u, err := url.Parse(setup.OtpauthURI)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/My App:alice" {
+		t.Fatalf("URI = %s", setup.OtpauthURI)
+	}
+	if q.Get("secret") != setup.Secret || q.Get("issuer") != "My App" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("URI 参数 = %v", q)
+	}
+	if enabled, _ := svc.IsEnabled(user.ID); enabled {
+		t.Fatal("确认前不应启用")
+	}
+}
+
+func TestTwoFactorConfirmRejectsWrongCode(t *testing.T) {
+	ctx := context.Background()
+	user := &model.User{ID: uuid.New(), Username: "alice"}
+	repo := newFakeTwoFactorRepo()
+	svc := NewTwoFactorService(repo, newFakeUserRepo(user), &fakeUserLogService{}, &config.SecurityConfig{})
+	setup, err := svc.SetupTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	wrong := codeAt(t, setup.Secret, time.Now(), 5)
+	if _, err := svc.ConfirmTOTP(ctx, user.ID, wrong); err == nil || err.Error() != "动态验证码错误" {
+		t.Fatalf("错误动态码返回 %v", err)
+	}
+	if repo.totp[user.ID].FailedAttempts != 1 {
+		t.Fatalf("FailedAttempts = %d", repo.totp[user.ID].FailedAttempts)
+	}
+	if enabled, _ := svc.IsEnabled(user.ID); enabled {
+		t.Fatal("动态码错误时不应启用")
+	}
+}
+
+func TestTwoFactorVerifyRejectsReplay(t *testing.T) {
+	ctx := context.Background()
+	svc, _, userID, secret, _, now := enabledTwoFactor(t)
+
+	// 确认时使用过的时间步不能再次使用
+	if err := svc.Verify(ctx, userID, codeAt(t, secret, now, 0)); err == nil {
+		t.Fatal("重放确认时的动态码应被拒绝")
+	}
+	next := codeAt(t, secret, now, 1)
+	if err := svc.Verify(ctx, userID, next); err != nil {
+		t.Fatalf("下一个时间步的动态码: %v", err)
+	}
+	if err := svc.Verify(ctx, userID, next); err == nil {
+		t.Fatal("同一动态码不能使用两次")
+	}
+}
+
+func TestTwoFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	svc, _, userID, _, codes, _ := enabledTwoFactor(t)
+
+	if err := svc.Verify(ctx, userID, strings.ToUpper(codes[0])); err != nil {
+		t.Fatalf("恢复码（大写输入）: %v", err)
+	}
+	if err := svc.Verify(ctx, userID, codes[0]); err == nil || err.Error() != "恢复码无效或已使用" {
+		t.Fatalf("重复使用恢复码返回 %v", err)
+	}
+	status, err := svc.GetStatus(userID)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if !status.Enabled || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Fatalf("状态 = %+v", status)
+	}
+}
+
+func TestTwoFactorLocksAfterRepeatedFailures(t *testing.T) {
+	ctx := context.Background()
+	svc, repo, userID, secret, codes, now := enabledTwoFactor(t)
+
+	for i := 0; i < totpMaxAttempts; i++ {
+		if err := svc.Verify(ctx, userID, "nope-nope"); err == nil {
+			t.Fatal("无效恢复码应被拒绝")
+		}
+	}
+	if repo.totp[userID].LockedUntil == nil {
+		t.Fatal("连续失败后应锁定")
+	}
+	// 锁定期内正确的动态码与恢复码都被拒绝
+	locked := "动态验证码错误次数过多，请稍后再试"
+	if err := svc.Verify(ctx, userID, codeAt(t, secret, now, 1)); err == nil || err.Error() != locked {
+		t.Fatalf("锁定期内动态码返回 %v", err)
+	}
+	if err := svc.Verify(ctx, userID, codes[0]); err == nil || err.Error() != locked {
+		t.Fatalf("锁定期内恢复码返回 %v", err)
+	}
+
+	past := now.Add(-time.Second)
+	repo.totp[userID].LockedUntil = &past
+	if err := svc.Verify(ctx, userID, codeAt(t, secret, now, 1)); err != nil {
+		t.Fatalf("锁定到期后: %v", err)
+	}
+}
+
+func TestTwoFactorRegenerateRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	svc, _, userID, secret, oldCodes, now := enabledTwoFactor(t)
+
+	// 只接受动态码，不能用恢复码换取新的一批
+	if _, err := svc.RegenerateRecoveryCodes(ctx, userID, oldCodes[0]); err == nil {
+		t.Fatal("恢复码不应能重新生成恢复码")
+	}
+	resp, err := svc.RegenerateRecoveryCodes(ctx, userID, codeAt(t, secret, now, 1))
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes: %v", err)
+	}
+	if len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("生成 %d 个恢复码", len(resp.RecoveryCodes))
+	}
+	if err := svc.Verify(ctx, userID, oldCodes[1]); err == nil {
+		t.Fatal("旧恢复码应全部失效")
+	}
+	if err := svc.Verify(ctx, userID, resp.RecoveryCodes[0]); err != nil {
+		t.Fatalf("新恢复码: %v", err)
+	}
+}
+
+func TestTwoFactorDisableWithRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	svc, _, userID, _, codes, _ := enabledTwoFactor(t)
+
+	if err := svc.DisableTOTP(ctx, userID, "wrong-code"); err == nil {
+		t.Fatal("无效恢复码不应停用两步验证")
+	}
+	if err := svc.DisableTOTP(ctx, userID, codes[0]); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if enabled, _ := svc.IsEnabled(userID); enabled {
+		t.Fatal("停用后仍为启用状态")
+	}
+	if err := svc.Verify(ctx, userID, codes[1]); err == nil || err.Error() != "未启用两步验证" {
+		t.Fatalf("停用后 Verify 返回 %v", err)
+	}
+}
@@ -24,6 +24,10 @@ const (
 	verificationCodeTTL    = 5 * time.Minute
 	// activationGracePeriod 注册后允许未激活登录的宽限时间
 	activationGracePeriod  = 24 * time.Hour
+	// defaultEmailChangeUndoWindow 未配置 EMAIL_CHANGE_UNDO_HOURS 时原邮箱可撤销修改的时长
+	defaultEmailChangeUndoWindow = 72 * time.Hour
+	// emailChangeMaxAttempts 修改邮箱验证码允许的错误次数，达到后需重新申请
+	emailChangeMaxAttempts = 5
 )
 
 // UserService 用户服务接口
@@ -71,6 +75,22 @@ type UserService interface {
 	ActivateAccount(ctx context.Context, req *model.ActivateAccountRequest) error
 	// AdminUpdateUserPassword 管理员更新指定用户密码
 	AdminUpdateUserPassword(ctx context.Context, userID uuid.UUID, newPassword string) error
+	// LoginWithPasskey 通行密钥登录
+	LoginWithPasskey(ctx context.Context, req *model.PasskeyLoginFinishRequest) (*model.LoginResponse, error)
+	// ListSessions 列出用户的登录会话，currentSessionID 对应的会话标记为当前会话
+	ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]*model.UserSession, error)
+	// RevokeSession 撤销用户的某个登录会话
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	// RevokeOtherSessions 撤销除当前会话外的全部会话，返回撤销数量
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int, error)
+	// ClearLoginLockout 清除用户因密码错误产生的失败计数与临时锁定（管理员用）
+	ClearLoginLockout(ctx context.Context, userID uuid.UUID) error
+	// RequestEmailChange 申请修改邮箱：向新邮箱发送验证码并提醒原邮箱
+	RequestEmailChange(ctx context.Context, userID uuid.UUID, req *model.RequestEmailChangeRequest) error
+	// ConfirmEmailChange 校验新邮箱收到的验证码后修改邮箱，并向原邮箱发送撤销凭证
+	ConfirmEmailChange(ctx context.Context, userID uuid.UUID, req *model.ConfirmEmailChangeRequest) (*model.UserResponse, error)
+	// UndoEmailChange 使用原邮箱收到的撤销凭证恢复原邮箱，并撤销账户的全部会话
+	UndoEmailChange(ctx context.Context, req *model.UndoEmailChangeRequest) (*model.UserResponse, error)
 }
 
 // firstNonEmpty 返回第一个非空字符串
@@ -84,83 +104,112 @@ func firstNonEmpty(values ...string) string {
 }
 
 // RefreshToken handles refresh token requests
+// 每次刷新都轮换refresh token：签发新的token对，旧refresh token随即失效。
+// 轮换后的短暂宽限期内再次提交旧token（并发刷新、响应丢失后重试）返回同一个新token对；
+// 超出宽限期后已轮换过的refresh token再次出现时视为被盗用，撤销整个会话（token家族）并邮件通知用户
 func (s *userService) RefreshToken(ctx context.Context, req *model.RefreshTokenRequest) (*model.RefreshTokenResponse, error) {
     // 1. 验证Refresh Token格式和签名
-    claims, err := s.jwtSvc.ValidateToken(req.RefreshToken)
+    // 仅接受refresh token：签发者、受众、token类型与签名密钥均须匹配
+    claims, err := s.jwtSvc.ValidateRefreshToken(req.RefreshToken)
     if err != nil {
         return nil, errors.New("无效的refresh token")
     }
 
-    // 2. 确保这是一个Refresh Token
-    if claims.TokenType != RefreshToken {
-        return nil, errors.New("提供的token不是refresh token")
-    }
-
-    // 3. 验证Refresh Token是否存在于Redis中
-    isValid, err := s.refreshTokenRepo.Validate(ctx, claims.UserID, req.RefreshToken)
-    if err != nil {
-        return nil, fmt.Errorf("验证refresh token失败: %w", err)
-    }
-    if !isValid {
+    // 2. 旧版本签发的token没有会话
+    if claims.SessionID == uuid.Nil {
         return nil, errors.New("refresh token已失效或不存在")
     }
 
-    // 4. 检查用户当前状态
+    // 3. 检查用户当前状态
     user, err := s.userRepo.GetByID(claims.UserID)
     if err != nil {
         return nil, errors.New("用户不存在")
     }
     if user.Status == "banned" {
-        // 封禁用户，立即删除其所有refresh token
-        _ = s.refreshTokenRepo.Delete(ctx, claims.UserID)
+        // 封禁用户，立即撤销其所有会话
+        _, _ = s.sessionRepo.DeleteAllByUser(ctx, claims.UserID, uuid.Nil)
         return nil, errors.New("账户已被封禁，无法刷新token")
     }
     if user.Status == "inactive" {
         return nil, errors.New("账户未激活，无法刷新token")
     }
 
-    // 5. 生成新的Access Token
-    newAccessToken, err := s.jwtSvc.GenerateAccessToken(claims.UserID, claims.Username)
+    // 4. 生成新的Token对，沿用原会话
+    tokenPair, err := s.jwtSvc.GenerateTokenPair(user.ID, user.Username, claims.SessionID)
     if err != nil {
-        return nil, fmt.Errorf("生成新access token失败: %w", err)
+        return nil, fmt.Errorf("生成token失败: %w", err)
     }
 
-    // 5. 返回新的Access Token
+    // 5. 原子地以新refresh token替换旧token，同时记录会话最近使用时间与来源
+    now := time.Now()
+    refreshTokenExpiration := time.Duration(s.securityCfg.JwtRefreshTokenExpiresInDays) * 24 * time.Hour
+    rotation, current, err := s.sessionRepo.RotateRefreshToken(ctx, &model.UserSession{
+        ID:         claims.SessionID,
+        UserID:     user.ID,
+        IPAddress:  req.IPAddress,
+        UserAgent:  req.UserAgent,
+        LastUsedAt: now,
+    }, req.RefreshToken, &repository.RefreshTokenPair{AccessToken: tokenPair.AccessToken, RefreshToken: tokenPair.RefreshToken}, refreshTokenExpiration)
+    if err != nil {
+        return nil, fmt.Errorf("轮换refresh token失败: %w", err)
+    }
+    switch rotation {
+    case repository.RefreshGrace:
+        // 刚轮换过，返回上一次签发的token对，本次生成的token对丢弃
+        return &model.RefreshTokenResponse{
+            AccessToken:  current.AccessToken,
+            RefreshToken: current.RefreshToken,
+        }, nil
+    case repository.RefreshReused:
+        s.revokeReusedSession(ctx, user, claims.SessionID, req, now)
+        return nil, errors.New("refresh token已被使用过，会话已失效，请重新登录")
+    case repository.RefreshSessionMissing:
+        return nil, errors.New("refresh token已失效或不存在")
+    }
+
+    // 6. 返回新的Token对
     return &model.RefreshTokenResponse{
-        AccessToken: newAccessToken,
+        AccessToken:  tokenPair.AccessToken,
+        RefreshToken: tokenPair.RefreshToken,
     }, nil
 }
 
+// revokeReusedSession 撤销出现refresh token重复使用的会话，该会话的access token随之失效，并异步邮件通知用户
+func (s *userService) revokeReusedSession(ctx context.Context, user *model.User, sessionID uuid.UUID, req *model.RefreshTokenRequest, detectedAt time.Time) {
+    deviceName := "未知设备"
+    if sess, err := s.sessionRepo.Get(ctx, sessionID); err == nil && sess != nil {
+        deviceName = firstNonEmpty(sess.DeviceName, sess.DeviceType, sess.UserAgent, deviceName)
+    }
+    if _, err := s.sessionRepo.Delete(ctx, user.ID, sessionID); err != nil {
+        log.Printf("撤销会话失败: user=%s session=%s err=%v", user.ID, sessionID, err)
+    }
+    log.Printf("检测到refresh token重复使用，已撤销会话: user=%s session=%s ip=%s", user.ID, sessionID, req.IPAddress)
+
+    go func() {
+        _ = s.mailSvc.SendRefreshTokenReuseAlert(user.Email, deviceName, req.IPAddress, req.UserAgent, detectedAt)
+    }()
+}
+
 // Logout handles user logout by invalidating both access and refresh tokens
 func (s *userService) Logout(ctx context.Context, req *model.LogoutRequest) error {
-    // 1. 验证Refresh Token格式和签名
-    refreshClaims, err := s.jwtSvc.ValidateToken(req.RefreshToken)
+    // 1. 验证Refresh Token（签名、签发者、受众与token类型）
+    refreshClaims, err := s.jwtSvc.ValidateRefreshToken(req.RefreshToken)
     if err != nil {
         return errors.New("无效的refresh token")
     }
 
-    // 2. 确保这是一个Refresh Token
-    if refreshClaims.TokenType != RefreshToken {
-        return errors.New("提供的token不是refresh token")
-    }
-
-    // 3. 验证Access Token格式和签名
-    accessClaims, err := s.jwtSvc.ValidateToken(req.AccessToken)
+    // 2. 验证Access Token（签名、签发者、受众与token类型）
+    accessClaims, err := s.jwtSvc.ValidateAccessToken(req.AccessToken)
     if err != nil {
         return errors.New("无效的access token")
     }
 
-    // 4. 确保这是一个Access Token
-    if accessClaims.TokenType != AccessToken {
-        return errors.New("提供的token不是access token")
-    }
-
-    // 5. 确保两个token属于同一用户
+    // 3. 确保两个token属于同一用户
     if refreshClaims.UserID != accessClaims.UserID {
         return errors.New("access token和refresh token不属于同一用户")
     }
 
-    // 6. 将Access Token加入黑名单
+    // 4. 将Access Token加入黑名单
     // 计算access token的剩余有效时间
     remainingTTL, err := s.jwtSvc.GetTokenRemainingTTL(req.AccessToken)
     if err != nil {
@@ -174,10 +223,11 @@ func (s *userService) Logout(ctx context.Context, req *model.LogoutRequest) erro
         }
     }
 
-    // 7. 从Redis中删除Refresh Token
-    err = s.refreshTokenRepo.DeleteByToken(ctx, req.RefreshToken)
-    if err != nil {
-        return fmt.Errorf("删除refresh token失败: %w", err)
+    // 5. 删除refresh token所属的会话，该会话签发的token随之失效
+    if refreshClaims.SessionID != uuid.Nil {
+        if _, err := s.sessionRepo.Delete(ctx, refreshClaims.UserID, refreshClaims.SessionID); err != nil {
+            return fmt.Errorf("删除会话失败: %w", err)
+        }
     }
 
     return nil
@@ -247,7 +297,7 @@ func (s *userService) SendVerificationCode(ctx context.Context, req *model.SendC
     }
 
     // 将验证码存入Redis，有效期5分钟
-    if err := s.codeRepo.Set(ctx, req.Email, code, verificationCodeTTL); err != nil {
+    if err := s.codeRepo.Set(ctx, repository.CodePurposeRegister, req.Email, code, verificationCodeTTL); err != nil {
         return fmt.Errorf("存储验证码失败: %w", err)
     }
 
@@ -262,7 +312,7 @@ func (s *userService) SendVerificationCode(ctx context.Context, req *model.SendC
 // Register 用户注册
 func (s *userService) Register(ctx context.Context, req *model.UserRegisterRequest) (*model.UserResponse, error) {
     // 验证验证码
-    storedCode, err := s.codeRepo.Get(ctx, req.Email)
+    storedCode, err := s.codeRepo.Get(ctx, repository.CodePurposeRegister, req.Email)
     if err != nil {
         return nil, fmt.Errorf("获取验证码失败: %w", err)
     }
@@ -274,24 +324,22 @@ func (s *userService) Register(ctx context.Context, req *model.UserRegisterReque
     }
 
     // 立即删除验证码，防止重放攻击
-    if err := s.codeRepo.Delete(ctx, req.Email); err != nil {
+    if err := s.codeRepo.Delete(ctx, repository.CodePurposeRegister, req.Email); err != nil {
         log.Printf("删除验证码失败: %v", err)
     }
 
-    // 生成密码盐和哈希
-    salt, err := s.generateSalt()
+    // 生成密码哈希
+    passwordHash, err := s.passwordHasher.Hash(req.Password)
     if err != nil {
-        return nil, fmt.Errorf("生成密码盐失败: %w", err)
+        return nil, fmt.Errorf("生成密码哈希失败: %w", err)
     }
 
-    passwordHash := s.hashPassword(req.Password, salt)
-
     // 创建用户对象
     user := &model.User{
         ID:           uuid.New(),
         Username:     req.Username,
         Email:        req.Email,
-        PasswordSalt: fmt.Sprintf("%s:%s", salt, passwordHash),
+        PasswordSalt: passwordHash,
         Nickname:     req.Nickname,
         Bio:          req.Bio,
         Avatar:       req.Avatar,
@@ -350,35 +398,46 @@ func (s *userService) ValidatePassword(username, password string) (*model.User,
         return nil, fmt.Errorf("查询用户失败: %w", err)
     }
 
-    // 解析存储的密码盐和哈希
-    parts := strings.Split(user.PasswordSalt, ":")
-    if len(parts) != 2 {
-        return nil, errors.New("密码格式错误")
+    // 校验密码哈希
+    ok, needsRehash, err := s.passwordHasher.Verify(password, user.PasswordSalt)
+    if err != nil {
+        return nil, err
     }
-
-    salt := parts[0]
-    storedHash := parts[1]
-
-    // 计算输入密码的哈希
-    inputHash := s.hashPassword(password, salt)
-
-    // 比较哈希值
-    if inputHash != storedHash {
+    if !ok {
         return nil, errors.New("用户名或密码错误")
     }
 
     // 检查用户状态
+    if err := checkLoginStatus(user); err != nil {
+        return nil, err
+    }
+
+    // 旧格式或参数已过时的哈希在验证成功后升级，失败不影响本次登录
+    if needsRehash {
+        if newHash, herr := s.passwordHasher.Hash(password); herr != nil {
+            log.Printf("重新生成用户 %s 的密码哈希失败: %v", user.ID, herr)
+        } else if uerr := s.userRepo.UpdatePassword(user.ID, newHash); uerr != nil {
+            log.Printf("升级用户 %s 的密码哈希失败: %v", user.ID, uerr)
+        } else {
+            user.PasswordSalt = newHash
+        }
+    }
+
+    return user, nil
+}
+
+// checkLoginStatus 检查账户状态是否允许登录
+func checkLoginStatus(user *model.User) error {
     if user.Status == "banned" {
-        return nil, errors.New("账户已被封禁，无法登录")
+        return errors.New("账户已被封禁，无法登录")
     }
     if user.Status == "inactive" {
         // 未激活账户：若在注册后宽限期内，允许登录；否则要求先激活
         if time.Since(user.CreatedAt) > activationGracePeriod {
-            return nil, errors.New("账户未激活，无法登录")
+            return errors.New("账户未激活，无法登录")
         }
     }
-
-    return user, nil
+    return nil
 }
 
 // SendResetPasswordCode 发送重置密码验证码
@@ -408,9 +467,8 @@ func (s *userService) SendResetPasswordCode(ctx context.Context, req *model.Send
         return fmt.Errorf("生成验证码失败: %w", err)
     }
 
-    // 4. 将验证码存入Redis，使用专用前缀区分重置密码验证码
-    resetCodeKey := "reset:" + req.Email
-    if err := s.codeRepo.Set(ctx, resetCodeKey, code, verificationCodeTTL); err != nil {
+    // 4. 将验证码存入Redis，与注册等其他用途的验证码互相隔离
+    if err := s.codeRepo.Set(ctx, repository.CodePurposeResetPassword, req.Email, code, verificationCodeTTL); err != nil {
         return fmt.Errorf("存储验证码失败: %w", err)
     }
 
@@ -425,8 +483,7 @@ func (s *userService) SendResetPasswordCode(ctx context.Context, req *model.Send
 // ResetPassword 重置密码
 func (s *userService) ResetPassword(ctx context.Context, req *model.ResetPasswordRequest) error {
     // 1. 验证重置密码验证码
-    resetCodeKey := "reset:" + req.Email
-    storedCode, err := s.codeRepo.Get(ctx, resetCodeKey)
+    storedCode, err := s.codeRepo.Get(ctx, repository.CodePurposeResetPassword, req.Email)
     if err != nil {
         return fmt.Errorf("获取验证码失败: %w", err)
     }
@@ -446,44 +503,26 @@ func (s *userService) ResetPassword(ctx context.Context, req *model.ResetPasswor
         return fmt.Errorf("查询用户失败: %w", err)
     }
 
-    // 3. 生成新的密码盐和哈希
-    salt, err := s.generateSalt()
+    // 3. 生成新的密码哈希
+    passwordHash, err := s.passwordHasher.Hash(req.NewPassword)
     if err != nil {
-        return fmt.Errorf("生成密码盐失败: %w", err)
+        return fmt.Errorf("生成密码哈希失败: %w", err)
     }
 
-    passwordHash := s.hashPassword(req.NewPassword, salt)
-    newPasswordSalt := fmt.Sprintf("%s:%s", salt, passwordHash)
-
     // 4. 更新用户密码
-    if err := s.userRepo.UpdatePassword(user.ID, newPasswordSalt); err != nil {
+    if err := s.userRepo.UpdatePassword(user.ID, passwordHash); err != nil {
         return fmt.Errorf("更新密码失败: %w", err)
     }
 
     // 5. 删除已使用的验证码
-    _ = s.codeRepo.Delete(ctx, resetCodeKey)
+    _ = s.codeRepo.Delete(ctx, repository.CodePurposeResetPassword, req.Email)
 
-    // 6. 撤销该用户的所有refresh token，强制重新登录
-    _ = s.refreshTokenRepo.Delete(ctx, user.ID)
+    // 6. 撤销该用户的所有会话，强制重新登录
+    _, _ = s.sessionRepo.DeleteAllByUser(ctx, user.ID, uuid.Nil)
 
     return nil
 }
 
-// generateSalt
-func (s *userService) generateSalt() (string, error) {
-    bytes := make([]byte, 16)
-    if _, err := rand.Read(bytes); err != nil {
-        return "", err
-    }
-    return hex.EncodeToString(bytes), nil
-}
-
-// hashPassword
-func (s *userService) hashPassword(password, salt string) string {
-    hash := sha256.Sum256([]byte(password + salt))
-    return hex.EncodeToString(hash[:])
-}
-
 // generateVerificationCode 生成指定长度的数字验证码
 func (s *userService) generateVerificationCode(length int) (string, error) {
     code := ""
@@ -513,35 +552,247 @@ func (s *userService) AdminUpdateUserPassword(ctx context.Context, userID uuid.U
         return fmt.Errorf("查询用户失败: %w", err)
     }
 
-    // 2. 生成新的盐和哈希
-    salt, err := s.generateSalt()
+    // 2. 生成新的密码哈希
+    passwordHash, err := s.passwordHasher.Hash(newPassword)
     if err != nil {
-        return fmt.Errorf("生成密码盐失败: %w", err)
+        return fmt.Errorf("生成密码哈希失败: %w", err)
     }
-    passwordHash := s.hashPassword(newPassword, salt)
-    newPasswordSalt := fmt.Sprintf("%s:%s", salt, passwordHash)
 
     // 3. 更新密码
-    if err := s.userRepo.UpdatePassword(userID, newPasswordSalt); err != nil {
+    if err := s.userRepo.UpdatePassword(userID, passwordHash); err != nil {
         return fmt.Errorf("更新密码失败: %w", err)
     }
 
-    // 4. 撤销该用户所有refresh token，强制重新登录
-    _ = s.refreshTokenRepo.Delete(ctx, userID)
+    // 4. 撤销该用户所有会话，强制重新登录
+    _, _ = s.sessionRepo.DeleteAllByUser(ctx, userID, uuid.Nil)
 
     return nil
 }
 
+// ClearLoginLockout 清除账户的失败登录计数与锁定，来源IP的计数不受影响
+func (s *userService) ClearLoginLockout(ctx context.Context, userID uuid.UUID) error {
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return errors.New("用户不存在")
+        }
+        return fmt.Errorf("查询用户失败: %w", err)
+    }
+    if err := s.loginGuard.ClearAccount(ctx, user.Username); err != nil {
+        return fmt.Errorf("解除登录锁定失败: %w", err)
+    }
+    return nil
+}
+
+// RequestEmailChange 校验当前密码后，将验证码与新邮箱一起保存；重复申请会覆盖之前未确认的申请
+func (s *userService) RequestEmailChange(ctx context.Context, userID uuid.UUID, req *model.RequestEmailChangeRequest) error {
+    // 1. IP频率限制检查
+    count, err := s.rateLimitRepo.Increment(ctx, req.IPAddress)
+    if err != nil {
+        log.Printf("无法检查IP (%s) 的请求频率: %v", req.IPAddress, err)
+    }
+    if count > int64(s.securityCfg.MaxRequestsPerIPPerDay) {
+        return fmt.Errorf("请求过于频繁，请24小时后再试 (IP: %s)", req.IPAddress)
+    }
+
+    // 2. 校验当前密码，确认本人操作
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return errors.New("用户不存在")
+        }
+        return fmt.Errorf("查询用户失败: %w", err)
+    }
+    ok, _, err := s.passwordHasher.Verify(req.Password, user.PasswordSalt)
+    if err != nil {
+        return fmt.Errorf("校验密码失败: %w", err)
+    }
+    if !ok {
+        return errors.New("密码错误")
+    }
+
+    // 3. 新邮箱须与当前邮箱不同且未被注册
+    newEmail := strings.TrimSpace(req.NewEmail)
+    if strings.EqualFold(newEmail, user.Email) {
+        return errors.New("新邮箱与当前邮箱相同")
+    }
+    exists, err := s.userRepo.ExistsByEmail(newEmail)
+    if err != nil {
+        return fmt.Errorf("检查邮箱失败: %w", err)
+    }
+    if exists {
+        return errors.New("该邮箱已被注册")
+    }
+
+    // 4. 生成验证码，与新邮箱一起保存
+    code, err := s.generateVerificationCode(verificationCodeLength)
+    if err != nil {
+        return fmt.Errorf("生成验证码失败: %w", err)
+    }
+    if err := s.codeRepo.Set(ctx, repository.CodePurposeEmailChange, userID.String(), code+":"+newEmail, verificationCodeTTL); err != nil {
+        return fmt.Errorf("存储验证码失败: %w", err)
+    }
+
+    // 5. 验证码发送到新邮箱，同时提醒原邮箱
+    if err := s.mailSvc.SendEmailChangeCode(newEmail, code); err != nil {
+        _ = s.codeRepo.Delete(ctx, repository.CodePurposeEmailChange, userID.String())
+        return fmt.Errorf("发送验证码邮件失败: %w", err)
+    }
+    requestedAt := time.Now()
+    go func() {
+        _ = s.mailSvc.SendEmailChangeRequestedNotice(user.Email, newEmail, req.IPAddress, requestedAt)
+    }()
+
+    return nil
+}
+
+// ConfirmEmailChange 撤销凭证先于邮箱修改保存，保证修改生效时原邮箱一定可以撤销
+func (s *userService) ConfirmEmailChange(ctx context.Context, userID uuid.UUID, req *model.ConfirmEmailChangeRequest) (*model.UserResponse, error) {
+    // 1. 校验新邮箱收到的验证码
+    pending, err := s.codeRepo.Get(ctx, repository.CodePurposeEmailChange, userID.String())
+    if err != nil {
+        return nil, fmt.Errorf("获取验证码失败: %w", err)
+    }
+    code, newEmail, found := strings.Cut(pending, ":")
+    if !found {
+        return nil, errors.New("验证码已过期或不存在，请重新获取")
+    }
+    if code != req.VerificationCode {
+        // 错误次数达到上限后作废该申请，防止在有效期内穷举验证码
+        failures, err := s.codeRepo.RecordFailure(ctx, repository.CodePurposeEmailChange, userID.String())
+        if err != nil {
+            log.Printf("记录修改邮箱验证码错误次数失败: %v", err)
+        }
+        if failures >= emailChangeMaxAttempts {
+            _ = s.codeRepo.Delete(ctx, repository.CodePurposeEmailChange, userID.String())
+            return nil, errors.New("验证码错误次数过多，请重新获取")
+        }
+        return nil, errors.New("验证码错误")
+    }
+    // 验证码只能使用一次
+    _ = s.codeRepo.Delete(ctx, repository.CodePurposeEmailChange, userID.String())
+
+    // 2. 再次确认新邮箱未被注册
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, errors.New("用户不存在")
+        }
+        return nil, fmt.Errorf("查询用户失败: %w", err)
+    }
+    exists, err := s.userRepo.ExistsByEmail(newEmail)
+    if err != nil {
+        return nil, fmt.Errorf("检查邮箱失败: %w", err)
+    }
+    if exists {
+        return nil, errors.New("该邮箱已被注册")
+    }
+
+    // 3. 保存原邮箱的撤销凭证（只保存哈希）
+    undoToken, err := generateEmailChangeUndoToken()
+    if err != nil {
+        return nil, fmt.Errorf("生成撤销凭证失败: %w", err)
+    }
+    undoWindow := time.Duration(s.securityCfg.EmailChangeUndoHours) * time.Hour
+    if undoWindow <= 0 {
+        undoWindow = defaultEmailChangeUndoWindow
+    }
+    undoKey := hashEmailChangeUndoToken(undoToken)
+    if err := s.codeRepo.Set(ctx, repository.CodePurposeEmailChangeUndo, undoKey, userID.String()+":"+user.Email, undoWindow); err != nil {
+        return nil, fmt.Errorf("存储撤销凭证失败: %w", err)
+    }
+
+    // 4. 修改邮箱
+    oldEmail := user.Email
+    if err := s.userRepo.UpdateEmail(userID, newEmail); err != nil {
+        _ = s.codeRepo.Delete(ctx, repository.CodePurposeEmailChangeUndo, undoKey)
+        return nil, fmt.Errorf("更新邮箱失败: %w", err)
+    }
+
+    // 5. 通知原邮箱并附上撤销凭证
+    undoDeadline := time.Now().Add(undoWindow)
+    go func() {
+        _ = s.mailSvc.SendEmailChangedNotice(oldEmail, newEmail, undoToken, undoDeadline)
+    }()
+
+    user.Email = newEmail
+    return user.ToResponse(), nil
+}
+
+// UndoEmailChange 撤销意味着修改可能并非本人操作：恢复原邮箱的同时作废进行中的修改申请并撤销全部会话
+func (s *userService) UndoEmailChange(ctx context.Context, req *model.UndoEmailChangeRequest) (*model.UserResponse, error) {
+    // 1. 校验撤销凭证
+    undoKey := hashEmailChangeUndoToken(strings.TrimSpace(req.Token))
+    value, err := s.codeRepo.Get(ctx, repository.CodePurposeEmailChangeUndo, undoKey)
+    if err != nil {
+        return nil, fmt.Errorf("获取撤销凭证失败: %w", err)
+    }
+    rawID, oldEmail, found := strings.Cut(value, ":")
+    userID, perr := uuid.Parse(rawID)
+    if !found || perr != nil {
+        return nil, errors.New("撤销凭证无效或已过期")
+    }
+
+    user, err := s.userRepo.GetByID(userID)
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, errors.New("用户不存在")
+        }
+        return nil, fmt.Errorf("查询用户失败: %w", err)
+    }
+
+    // 2. 恢复原邮箱；期间原邮箱被其他账户注册时无法恢复
+    if user.Email != oldEmail {
+        other, err := s.userRepo.GetByEmail(oldEmail)
+        if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, fmt.Errorf("检查邮箱失败: %w", err)
+        }
+        if err == nil && other.ID != userID {
+            return nil, errors.New("原邮箱已被其他账户使用，无法恢复")
+        }
+        if err := s.userRepo.UpdateEmail(userID, oldEmail); err != nil {
+            return nil, fmt.Errorf("恢复邮箱失败: %w", err)
+        }
+        user.Email = oldEmail
+    }
+
+    // 3. 撤销凭证只能使用一次；作废进行中的修改申请并撤销全部会话，强制重新登录
+    _ = s.codeRepo.Delete(ctx, repository.CodePurposeEmailChangeUndo, undoKey)
+    _ = s.codeRepo.Delete(ctx, repository.CodePurposeEmailChange, userID.String())
+    _, _ = s.sessionRepo.DeleteAllByUser(ctx, userID, uuid.Nil)
+
+    return user.ToResponse(), nil
+}
+
+// generateEmailChangeUndoToken 生成32字节随机撤销凭证（十六进制）
+func generateEmailChangeUndoToken() (string, error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
+
+// hashEmailChangeUndoToken 撤销凭证只以 SHA-256 哈希作为键保存
+func hashEmailChangeUndoToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
 // userService 用户服务实现
 type userService struct {
 	userRepo                 repository.UserRepository
 	deviceRepo               repository.DeviceRepository
 	codeRepo                 repository.CodeRepository
-	refreshTokenRepo         repository.RefreshTokenRepository
+	sessionRepo              repository.SessionRepository
 	rateLimitRepo            repository.RateLimitRepository
 	accessTokenBlacklistRepo repository.AccessTokenBlacklistRepository
 	mailSvc                  MailService
 	jwtSvc                   JwtService
+	passwordHasher           PasswordHasher
+	twoFactorSvc             TwoFactorService
+	webAuthnSvc              WebAuthnService
+	loginGuard               LoginGuard
 	securityCfg              *config.SecurityConfig
 }
 
@@ -550,29 +801,42 @@ func NewUserService(
 	userRepo repository.UserRepository,
 	deviceRepo repository.DeviceRepository,
 	codeRepo repository.CodeRepository,
-	refreshTokenRepo repository.RefreshTokenRepository,
+	sessionRepo repository.SessionRepository,
 	rateLimitRepo repository.RateLimitRepository,
 	accessTokenBlacklistRepo repository.AccessTokenBlacklistRepository,
 	mailSvc MailService,
 	jwtSvc JwtService,
+	passwordHasher PasswordHasher,
+	twoFactorSvc TwoFactorService,
+	webAuthnSvc WebAuthnService,
+	loginGuard LoginGuard,
 	securityCfg *config.SecurityConfig,
 ) UserService {
 	return &userService{
 		userRepo:                 userRepo,
 		deviceRepo:               deviceRepo,
 		codeRepo:                 codeRepo,
-		refreshTokenRepo:         refreshTokenRepo,
+		sessionRepo:              sessionRepo,
 		rateLimitRepo:            rateLimitRepo,
 		accessTokenBlacklistRepo: accessTokenBlacklistRepo,
 		mailSvc:                  mailSvc,
 		jwtSvc:                   jwtSvc,
+		passwordHasher:           passwordHasher,
+		twoFactorSvc:             twoFactorSvc,
+		webAuthnSvc:              webAuthnSvc,
+		loginGuard:               loginGuard,
 		securityCfg:              securityCfg,
 	}
 }
 
 // Login handles user login.
 func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*model.LoginResponse, error) {
-	// 1. 验证用户名和密码
+	// 1. 账户或来源IP连续登录失败过多时处于退避或锁定期，期间不校验密码
+	if err := s.loginGuard.Check(ctx, req.Username, req.IPAddress); err != nil {
+		return nil, err
+	}
+
+	// 2. 验证用户名和密码
 	user, err := s.ValidatePassword(req.Username, req.Password)
 	if err != nil {
 		// 检查是否是账户状态相关的错误，如果是则直接返回具体错误信息
@@ -580,9 +844,13 @@ func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*mode
 		if errMsg == "账户已被封禁，无法登录" || errMsg == "账户未激活，无法登录" {
 			return nil, err
 		}
+		if errMsg == "用户名或密码错误" {
+			s.loginGuard.RecordFailure(ctx, req)
+		}
 		// 其他错误（如用户名不存在、密码错误等）统一返回通用错误信息，避免用户枚举攻击
 		return nil, errors.New("用户名或密码错误")
 	}
+	s.loginGuard.RecordSuccess(ctx, req.Username)
 
 	// 首次登录（LastLoginAt为空）跳过设备验证，直接签发Token
 	if user.LastLoginAt == nil {
@@ -613,7 +881,7 @@ func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*mode
 				_ = s.deviceRepo.CreateDevice(dev)
 			}
 		}
-		return s.issueTokenPair(ctx, user)
+		return s.completeLogin(ctx, user, req)
 	}
 
 	// 非首次登录：需要设备指纹并进行陌生设备验证
@@ -624,7 +892,7 @@ func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*mode
 		}, errors.New("为了账户安全，请提供设备指纹信息")
 	}
 
-	// 2. 检查设备是否已信任
+	// 3. 检查设备是否已信任
 	var device *model.UserDevice
 	d, derr := s.deviceRepo.GetDeviceByUserAndFingerprint(user.ID, req.DeviceID)
 	if derr != nil {
@@ -650,7 +918,7 @@ func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*mode
 		}
 		device.LastLoginAt = &now
 		_ = s.deviceRepo.UpdateDevice(device)
-		return s.issueTokenPair(ctx, user)
+		return s.completeLogin(ctx, user, req)
 	}
 
 	// 未信任设备：若带验证码则校验，否则发送验证码并提示二次验证
@@ -711,7 +979,7 @@ func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*mode
 		}
 
 		// 通过后签发token
-		return s.issueTokenPair(ctx, user)
+		return s.completeLogin(ctx, user, req)
 	}
 
 	// 发送设备验证码并返回需要验证标记
@@ -745,17 +1013,103 @@ func (s *userService) Login(ctx context.Context, req *model.LoginRequest) (*mode
 	}, nil
 }
 
-func (s *userService) issueTokenPair(ctx context.Context, user *model.User) (*model.LoginResponse, error) {
-	tokenPair, err := s.jwtSvc.GenerateTokenPair(user.ID, user.Username)
+// completeLogin 已启用两步验证时要求动态码或恢复码，通过后签发Token
+func (s *userService) completeLogin(ctx context.Context, user *model.User, req *model.LoginRequest) (*model.LoginResponse, error) {
+	enabled, err := s.twoFactorSvc.IsEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		if strings.TrimSpace(req.TwoFactorCode) == "" {
+			return &model.LoginResponse{
+				User:              user.ToResponse(),
+				TwoFactorRequired: true,
+			}, nil
+		}
+		if err := s.twoFactorSvc.Verify(ctx, user.ID, req.TwoFactorCode); err != nil {
+			return nil, err
+		}
+	}
+	return s.issueTokenPair(ctx, user, &model.UserSession{
+		DeviceID:   req.DeviceID,
+		DeviceName: req.DeviceName,
+		DeviceType: req.DeviceType,
+		IPAddress:  req.IPAddress,
+		UserAgent:  req.UserAgent,
+	})
+}
+
+// LoginWithPasskey 通行密钥已完成持有与用户验证（UV），不再要求设备验证码与两步验证；
+// 提供设备指纹时将该设备标记为受信任
+func (s *userService) LoginWithPasskey(ctx context.Context, req *model.PasskeyLoginFinishRequest) (*model.LoginResponse, error) {
+	user, err := s.webAuthnSvc.FinishLogin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLoginStatus(user); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(req.DeviceID) != "" {
+		now := time.Now()
+		if d, derr := s.deviceRepo.GetDeviceByUserAndFingerprint(user.ID, req.DeviceID); derr == nil && d != nil {
+			d.IsTrusted = true
+			d.IPAddress = req.IPAddress
+			d.UserAgent = req.UserAgent
+			if req.DeviceName != "" {
+				d.DeviceName = req.DeviceName
+			}
+			if req.DeviceType != "" {
+				d.DeviceType = req.DeviceType
+			}
+			d.LastLoginAt = &now
+			if err := s.deviceRepo.UpdateDevice(d); err != nil {
+				return nil, fmt.Errorf("更新设备失败: %w", err)
+			}
+		} else {
+			dev := &model.UserDevice{
+				ID:          uuid.New(),
+				UserID:      user.ID,
+				DeviceID:    req.DeviceID,
+				DeviceName:  req.DeviceName,
+				DeviceType:  req.DeviceType,
+				UserAgent:   req.UserAgent,
+				IPAddress:   req.IPAddress,
+				IsTrusted:   true,
+				LastLoginAt: &now,
+			}
+			if err := s.deviceRepo.CreateDevice(dev); err != nil {
+				return nil, fmt.Errorf("创建设备失败: %w", err)
+			}
+		}
+	}
+	return s.issueTokenPair(ctx, user, &model.UserSession{
+		DeviceID:   req.DeviceID,
+		DeviceName: req.DeviceName,
+		DeviceType: req.DeviceType,
+		IPAddress:  req.IPAddress,
+		UserAgent:  req.UserAgent,
+	})
+}
+
+// issueTokenPair 为本次登录创建新会话并签发绑定该会话的Token
+// session 仅需填写设备与来源信息，ID 与时间在此生成
+func (s *userService) issueTokenPair(ctx context.Context, user *model.User, session *model.UserSession) (*model.LoginResponse, error) {
+	now := time.Now()
+	session.ID = uuid.New()
+	session.UserID = user.ID
+	session.CreatedAt = now
+	session.LastUsedAt = now
+
+	tokenPair, err := s.jwtSvc.GenerateTokenPair(user.ID, user.Username, session.ID)
 	if err != nil {
 		return nil, fmt.Errorf("生成token失败: %w", err)
 	}
 	refreshTokenExpiration := time.Duration(s.securityCfg.JwtRefreshTokenExpiresInDays) * 24 * time.Hour
-	if err := s.refreshTokenRepo.Store(ctx, user.ID, tokenPair.RefreshToken, refreshTokenExpiration); err != nil {
-		return nil, fmt.Errorf("存储refresh token失败: %w", err)
+	if err := s.sessionRepo.Create(ctx, session, tokenPair.RefreshToken, refreshTokenExpiration); err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
 	}
 	// 更新用户最后登录时间（忽略错误以不中断登录流程）
-	now := time.Now()
 	_ = s.userRepo.UpdateLastLoginAt(user.ID, now)
 	user.LastLoginAt = &now
 	return &model.LoginResponse{
@@ -765,6 +1119,39 @@ func (s *userService) issueTokenPair(ctx context.Context, user *model.User) (*mo
 	}, nil
 }
 
+// ListSessions 列出用户的登录会话
+func (s *userService) ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]*model.UserSession, error) {
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sess := range sessions {
+		sess.Current = sess.ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession 撤销会话后其refresh token不可再用，已签发的access token在下一次请求时被拒绝
+func (s *userService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	ok, err := s.sessionRepo.Delete(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("会话不存在")
+	}
+	return nil
+}
+
+// RevokeOtherSessions 在其他设备上退出登录，保留当前会话
+func (s *userService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int, error) {
+	revoked, err := s.sessionRepo.DeleteAllByUser(ctx, userID, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return len(revoked), nil
+}
+
 // GetUsersForAdmin 获取用户列表（管理员用）
 func (s *userService) GetUsersForAdmin(page, limit int, search string) ([]*model.UserResponse, int64, error) {
 	users, total, err := s.userRepo.GetUsersWithPagination(page, limit, search)
@@ -886,7 +1273,7 @@ func (s *userService) SendActivationCode(ctx context.Context, req *model.SendAct
 	}
 
 	// 5. 存储验证码到Redis（5分钟过期）
-	if err := s.codeRepo.Set(ctx, req.Email, code, 5*time.Minute); err != nil {
+	if err := s.codeRepo.Set(ctx, repository.CodePurposeActivate, req.Email, code, 5*time.Minute); err != nil {
 		return fmt.Errorf("存储验证码失败: %w", err)
 	}
 
@@ -901,7 +1288,7 @@ func (s *userService) SendActivationCode(ctx context.Context, req *model.SendAct
 // ActivateAccount 激活账户
 func (s *userService) ActivateAccount(ctx context.Context, req *model.ActivateAccountRequest) error {
 	// 1. 验证验证码
-	storedCode, err := s.codeRepo.Get(ctx, req.Email)
+	storedCode, err := s.codeRepo.Get(ctx, repository.CodePurposeActivate, req.Email)
 	if err != nil {
 		return fmt.Errorf("获取验证码失败: %w", err)
 	}
@@ -924,7 +1311,7 @@ func (s *userService) ActivateAccount(ctx context.Context, req *model.ActivateAc
 	// 3. 检查用户状态
 	if user.Status == "active" {
 		// 删除验证码
-		_ = s.codeRepo.Delete(ctx, req.Email)
+		_ = s.codeRepo.Delete(ctx, repository.CodePurposeActivate, req.Email)
 		return errors.New("账户已激活")
 	}
 	if user.Status == "banned" {
@@ -938,7 +1325,7 @@ func (s *userService) ActivateAccount(ctx context.Context, req *model.ActivateAc
 	}
 
 	// 5. 删除验证码
-	_ = s.codeRepo.Delete(ctx, req.Email)
+	_ = s.codeRepo.Delete(ctx, repository.CodePurposeActivate, req.Email)
 
 	return nil
 }
\ No newline at end of file
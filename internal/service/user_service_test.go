@@ -0,0 +1,286 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type emailChangeFixture struct {
+	svc      *userService
+	mail     *fakeMailService
+	user     *model.User
+	other    *model.User
+	sessions repository.SessionRepository
+}
+
+func newEmailChangeFixture(t *testing.T) *emailChangeFixture {
+	t.Helper()
+	_, rdb := newTestRedis(t)
+	hasher := NewPasswordHasher(testArgon2Config())
+	f := &emailChangeFixture{
+		mail:     newFakeMailService(),
+		user:     &model.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", PasswordSalt: mustHash(t, hasher, "Password123")},
+		other:    &model.User{ID: uuid.New(), Username: "bob", Email: "bob@example.com"},
+		sessions: repository.NewSessionRepository(rdb),
+	}
+	f.svc = &userService{
+		userRepo:       newFakeUserRepo(f.user, f.other),
+		codeRepo:       repository.NewCodeRepository(rdb),
+		sessionRepo:    f.sessions,
+		rateLimitRepo:  repository.NewRateLimitRepository(rdb),
+		mailSvc:        f.mail,
+		passwordHasher: hasher,
+		securityCfg:    &config.SecurityConfig{MaxRequestsPerIPPerDay: 10, EmailChangeUndoHours: 72},
+	}
+	return f
+}
+
+// request 申请修改邮箱，返回发送到新邮箱的验证码
+func (f *emailChangeFixture) request(t *testing.T, newEmail string) string {
+	t.Helper()
+	err := f.svc.RequestEmailChange(context.Background(), f.user.ID,
+		&model.RequestEmailChangeRequest{NewEmail: newEmail, Password: "Password123", IPAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("RequestEmailChange: %v", err)
+	}
+	code := f.mail.expectMail(t, "email_change_code", newEmail).code
+	f.mail.expectMail(t, "email_change_requested", f.user.Email)
+	return code
+}
+
+// confirm 确认修改邮箱，返回发送到原邮箱的撤销凭证
+func (f *emailChangeFixture) confirm(t *testing.T, code string) string {
+	t.Helper()
+	oldEmail := f.user.Email
+	if _, err := f.svc.ConfirmEmailChange(context.Background(), f.user.ID, &model.ConfirmEmailChangeRequest{VerificationCode: code}); err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	return f.mail.expectMail(t, "email_changed", oldEmail).code
+}
+
+// wrongCode 生成一个与 code 不同的验证码
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestRequestEmailChangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		newEmail string
+		password string
+		wantErr  string
+	}{
+		{"密码错误", "new@example.com", "wrong", "密码错误"},
+		{"与当前邮箱相同", "Alice@Example.com", "Password123", "新邮箱与当前邮箱相同"},
+		{"邮箱已被注册", "bob@example.com", "Password123", "该邮箱已被注册"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newEmailChangeFixture(t)
+			err := f.svc.RequestEmailChange(context.Background(), f.user.ID,
+				&model.RequestEmailChangeRequest{NewEmail: tt.newEmail, Password: tt.password, IPAddress: "10.0.0.1"})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v，期望 %q", err, tt.wantErr)
+			}
+			f.mail.expectNoMail(t)
+		})
+	}
+}
+
+func TestRequestEmailChangeIPRateLimit(t *testing.T) {
+	f := newEmailChangeFixture(t)
+	f.svc.securityCfg.MaxRequestsPerIPPerDay = 1
+	f.request(t, "new@example.com")
+	err := f.svc.RequestEmailChange(context.Background(), f.user.ID,
+		&model.RequestEmailChangeRequest{NewEmail: "new@example.com", Password: "Password123", IPAddress: "10.0.0.1"})
+	if err == nil || !strings.Contains(err.Error(), "请求过于频繁") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	ctx := context.Background()
+	f := newEmailChangeFixture(t)
+	code := f.request(t, "new@example.com")
+	if f.user.Email != "alice@example.com" {
+		t.Fatal("确认前不应修改邮箱")
+	}
+
+	resp, err := f.svc.ConfirmEmailChange(ctx, f.user.ID, &model.ConfirmEmailChangeRequest{VerificationCode: code})
+	if err != nil || resp.Email != "new@example.com" || f.user.Email != "new@example.com" {
+		t.Fatalf("ConfirmEmailChange = %+v, %v", resp, err)
+	}
+	if token := f.mail.expectMail(t, "email_changed", "alice@example.com").code; len(token) != 64 {
+		t.Fatalf("撤销凭证 = %q", token)
+	}
+
+	// 验证码只能使用一次
+	_, err = f.svc.ConfirmEmailChange(ctx, f.user.ID, &model.ConfirmEmailChangeRequest{VerificationCode: code})
+	if err == nil || err.Error() != "验证码已过期或不存在，请重新获取" {
+		t.Fatalf("重复确认 err = %v", err)
+	}
+}
+
+func TestConfirmEmailChangeRechecksNewEmail(t *testing.T) {
+	f := newEmailChangeFixture(t)
+	code := f.request(t, "new@example.com")
+	// 申请后新邮箱被其他账户占用
+	f.other.Email = "new@example.com"
+
+	_, err := f.svc.ConfirmEmailChange(context.Background(), f.user.ID, &model.ConfirmEmailChangeRequest{VerificationCode: code})
+	if err == nil || err.Error() != "该邮箱已被注册" {
+		t.Fatalf("err = %v", err)
+	}
+	if f.user.Email != "alice@example.com" {
+		t.Fatalf("邮箱 = %s", f.user.Email)
+	}
+	f.mail.expectNoMail(t)
+}
+
+func TestConfirmEmailChangeAttemptLimit(t *testing.T) {
+	ctx := context.Background()
+	f := newEmailChangeFixture(t)
+	code := f.request(t, "new@example.com")
+	confirm := func(c string) error {
+		_, err := f.svc.ConfirmEmailChange(ctx, f.user.ID, &model.ConfirmEmailChangeRequest{VerificationCode: c})
+		return err
+	}
+
+	for i := 1; i < emailChangeMaxAttempts; i++ {
+		if err := confirm(wrongCode(code)); err == nil || err.Error() != "验证码错误" {
+			t.Fatalf("第%d次错误 err = %v", i, err)
+		}
+	}
+	if err := confirm(wrongCode(code)); err == nil || err.Error() != "验证码错误次数过多，请重新获取" {
+		t.Fatalf("达到上限 err = %v", err)
+	}
+	// 申请已作废，正确的验证码也不再有效
+	if err := confirm(code); err == nil || err.Error() != "验证码已过期或不存在，请重新获取" {
+		t.Fatalf("作废后 err = %v", err)
+	}
+	if f.user.Email != "alice@example.com" {
+		t.Fatalf("邮箱 = %s", f.user.Email)
+	}
+
+	// 重新申请后重新计数
+	code = f.request(t, "new@example.com")
+	for i := 1; i < emailChangeMaxAttempts; i++ {
+		_ = confirm(wrongCode(code))
+	}
+	f.confirm(t, code)
+	if f.user.Email != "new@example.com" {
+		t.Fatalf("邮箱 = %s", f.user.Email)
+	}
+}
+
+func TestUndoEmailChange(t *testing.T) {
+	ctx := context.Background()
+	f := newEmailChangeFixture(t)
+	session := &model.UserSession{ID: uuid.New(), UserID: f.user.ID, CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	if err := f.sessions.Create(ctx, session, "rt-1", time.Hour); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	token := f.confirm(t, f.request(t, "new@example.com"))
+	// 修改后又发起了一次新的申请
+	pending := f.request(t, "newer@example.com")
+
+	resp, err := f.svc.UndoEmailChange(ctx, &model.UndoEmailChangeRequest{Token: " " + token + " "})
+	if err != nil || resp.Email != "alice@example.com" || f.user.Email != "alice@example.com" {
+		t.Fatalf("UndoEmailChange = %+v, %v", resp, err)
+	}
+	// 撤销全部会话并作废进行中的申请
+	if ok, _ := f.sessions.Exists(ctx, session.ID); ok {
+		t.Fatal("撤销后会话仍存在")
+	}
+	_, err = f.svc.ConfirmEmailChange(ctx, f.user.ID, &model.ConfirmEmailChangeRequest{VerificationCode: pending})
+	if err == nil || err.Error() != "验证码已过期或不存在，请重新获取" {
+		t.Fatalf("撤销后确认进行中的申请 err = %v", err)
+	}
+
+	// 撤销凭证只能使用一次
+	if _, err := f.svc.UndoEmailChange(ctx, &model.UndoEmailChangeRequest{Token: token}); err == nil || err.Error() != "撤销凭证无效或已过期" {
+		t.Fatalf("重复撤销 err = %v", err)
+	}
+}
+
+func TestUndoEmailChangeRejects(t *testing.T) {
+	ctx := context.Background()
+
+	f := newEmailChangeFixture(t)
+	if _, err := f.svc.UndoEmailChange(ctx, &model.UndoEmailChangeRequest{Token: "unknown"}); err == nil || err.Error() != "撤销凭证无效或已过期" {
+		t.Fatalf("无效凭证 err = %v", err)
+	}
+
+	// 原邮箱在修改后被其他账户使用，无法恢复
+	token := f.confirm(t, f.request(t, "new@example.com"))
+	f.other.Email = "alice@example.com"
+	if _, err := f.svc.UndoEmailChange(ctx, &model.UndoEmailChangeRequest{Token: token}); err == nil || err.Error() != "原邮箱已被其他账户使用，无法恢复" {
+		t.Fatalf("原邮箱被占用 err = %v", err)
+	}
+	if f.user.Email != "new@example.com" {
+		t.Fatalf("邮箱 = %s", f.user.Email)
+	}
+}
+
+func TestRefreshTokenReuseGraceWindow(t *testing.T) {
+	ctx := context.Background()
+	mr, rdb := newTestRedis(t)
+	mail := newFakeMailService()
+	user := &model.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", Status: "active"}
+	sessions := repository.NewSessionRepository(rdb)
+	svc := &userService{
+		userRepo:    newFakeUserRepo(user),
+		sessionRepo: sessions,
+		mailSvc:     mail,
+		jwtSvc:      newHMACJwtService(t, "test-secret"),
+		securityCfg: &config.SecurityConfig{JwtRefreshTokenExpiresInDays: 7},
+	}
+	session := &model.UserSession{ID: uuid.New(), UserID: user.ID, CreatedAt: time.Now(), LastUsedAt: time.Now()}
+	issued, err := svc.jwtSvc.GenerateTokenPair(user.ID, user.Username, session.ID)
+	if err != nil {
+		t.Fatalf("GenerateTokenPair: %v", err)
+	}
+	if err := sessions.Create(ctx, session, issued.RefreshToken, time.Hour); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	refresh := func(token string) (*model.RefreshTokenResponse, error) {
+		return svc.RefreshToken(ctx, &model.RefreshTokenRequest{RefreshToken: token, IPAddress: "10.0.0.1"})
+	}
+
+	first, err := refresh(issued.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	// 客户端重试：宽限期内重复提交旧 token 拿到同一个新 token 对，会话不受影响
+	retry, err := refresh(issued.RefreshToken)
+	if err != nil || *retry != *first {
+		t.Fatalf("宽限期内重试 = %+v, %v，期望 %+v", retry, err, first)
+	}
+	if ok, _ := sessions.Exists(ctx, session.ID); !ok {
+		t.Fatal("宽限期内重试不应撤销会话")
+	}
+	mail.expectNoMail(t)
+
+	// 宽限期过后旧 token 再次出现视为被盗用，撤销会话并通知用户
+	mr.FastForward(15 * time.Second)
+	if _, err := refresh(issued.RefreshToken); err == nil || err.Error() != "refresh token已被使用过，会话已失效，请重新登录" {
+		t.Fatalf("宽限期后重复使用 err = %v", err)
+	}
+	if ok, _ := sessions.Exists(ctx, session.ID); ok {
+		t.Fatal("重复使用后会话仍存在")
+	}
+	mail.expectMail(t, "refresh_token_reuse", user.Email)
+	if _, err := refresh(first.RefreshToken); err == nil {
+		t.Fatal("会话撤销后新 token 也应失效")
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE 算法标识
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// 认证器数据标志位
+const (
+	authFlagUserPresent  = 0x01
+	authFlagUserVerified = 0x04
+	authFlagAttested     = 0x40
+	authFlagExtensions   = 0x80
+)
+
+// rsaPublicExponent RS256 凭证唯一接受的公钥指数 65537
+const rsaPublicExponent = 65537
+
+// cborMaxDepth 嵌套层数上限，防止恶意输入耗尽栈
+const cborMaxDepth = 16
+
+var errInvalidCBOR = errors.New("invalid cbor")
+
+// authenticatorData 解析后的认证器数据
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    map[any]any // COSE_Key
+}
+
+// parseAuthenticatorData 解析认证器数据；包含凭证数据（AT 标志）时一并解析凭证ID与 COSE 公钥
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("认证器数据长度不足")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+	if ad.flags&authFlagAttested != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("凭证数据长度不足")
+		}
+		ad.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("凭证ID长度不足")
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+		key, n, err := cborDecode(rest, 0)
+		if err != nil {
+			return nil, errors.New("凭证公钥格式错误")
+		}
+		m, ok := key.(map[any]any)
+		if !ok {
+			return nil, errors.New("凭证公钥格式错误")
+		}
+		ad.publicKey = m
+		rest = rest[n:]
+	}
+	if ad.flags&authFlagExtensions != 0 {
+		_, n, err := cborDecode(rest, 0)
+		if err != nil {
+			return nil, errors.New("扩展数据格式错误")
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("认证器数据包含多余字节")
+	}
+	return ad, nil
+}
+
+// parseCOSEKey 把 COSE_Key 转换为公钥，返回 COSE 算法标识
+func parseCOSEKey(m map[any]any) (crypto.PublicKey, int, error) {
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == coseAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("不支持的EC公钥")
+		}
+		point := append([]byte{0x04}, append(append([]byte{}, x...), y...)...)
+		// 由 crypto/ecdh 校验坐标位于曲线上
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, 0, errors.New("EC公钥无效")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, coseAlgES256, nil
+	case kty == 1 && alg == coseAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("不支持的OKP公钥")
+		}
+		return ed25519.PublicKey(x), coseAlgEdDSA, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("不支持的RSA公钥")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		// 认证器均使用 F4；其他指数（尤其是 e<3 或偶数）要么不安全，要么构不成有效的 RSA 公钥
+		if exp != rsaPublicExponent {
+			return nil, 0, errors.New("不支持的RSA公钥指数")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, coseAlgRS256, nil
+	default:
+		return nil, 0, fmt.Errorf("不支持的公钥算法: kty=%d alg=%d", kty, alg)
+	}
+}
+
+// verifyWebAuthnSignature 校验断言签名，签名内容为 authenticatorData || SHA-256(clientDataJSON)
+func verifyWebAuthnSignature(publicKeyDER []byte, alg int, authData, clientDataJSON, signature []byte) error {
+	pub, err := x509.ParsePKIXPublicKey(publicKeyDER)
+	if err != nil {
+		return fmt.Errorf("解析公钥失败: %w", err)
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case coseAlgES256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok || !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return errors.New("签名无效")
+		}
+	case coseAlgEdDSA:
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(key, signed, signature) {
+			return errors.New("签名无效")
+		}
+	case coseAlgRS256:
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return errors.New("签名无效")
+		}
+	default:
+		return errors.New("不支持的签名算法")
+	}
+	return nil
+}
+
+// cborDecode 解码一个 CBOR 数据项（RFC 8949 的确定长度子集），返回值与消耗的字节数
+// 整数统一为 int64，字节串为 []byte，文本为 string，数组为 []any，映射为 map[any]any
+func cborDecode(data []byte, depth int) (any, int, error) {
+	if depth > cborMaxDepth || len(data) == 0 {
+		return nil, 0, errInvalidCBOR
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	arg, n, err := cborArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, 0, errInvalidCBOR
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, 0, errInvalidCBOR
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errInvalidCBOR
+		}
+		end := n + int(arg)
+		if major == 2 {
+			return append([]byte{}, data[n:end]...), end, nil
+		}
+		return string(data[n:end]), end, nil
+	case 4:
+		if arg > uint64(len(data)) {
+			return nil, 0, errInvalidCBOR
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, m, err := cborDecode(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, v)
+			n += m
+		}
+		return items, n, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, 0, errInvalidCBOR
+		}
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, kn, err := cborDecode(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += kn
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errInvalidCBOR
+			}
+			v, vn, err := cborDecode(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += vn
+			m[k] = v
+		}
+		return m, n, nil
+	case 6:
+		// 标签：忽略标签号，返回被标记的数据项
+		v, m, err := cborDecode(data[n:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return v, n + m, nil
+	default:
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22, 23:
+			return nil, 1, nil
+		}
+		return nil, 0, errInvalidCBOR
+	}
+}
+
+// cborArgument 读取数据项头部的参数，不支持不定长编码
+func cborArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(data) >= 2:
+		return uint64(data[1]), 2, nil
+	case info == 25 && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26 && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27 && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	default:
+		return 0, 0, errInvalidCBOR
+	}
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// cborEncode 测试用的 CBOR 编码器，覆盖认证器会产生的数据类型；映射按键的编码排序
+func cborEncode(v any) []byte {
+	switch x := v.(type) {
+	case int:
+		return cborEncode(int64(x))
+	case int64:
+		if x >= 0 {
+			return cborHead(0, uint64(x))
+		}
+		return cborHead(1, uint64(-1-x))
+	case []byte:
+		return append(cborHead(2, uint64(len(x))), x...)
+	case string:
+		return append(cborHead(3, uint64(len(x))), x...)
+	case []any:
+		out := cborHead(4, uint64(len(x)))
+		for _, item := range x {
+			out = append(out, cborEncode(item)...)
+		}
+		return out
+	case map[any]any:
+		entries := make([][]byte, 0, len(x))
+		for k, item := range x {
+			entries = append(entries, append(cborEncode(k), cborEncode(item)...))
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i], entries[j]) < 0 })
+		out := cborHead(5, uint64(len(x)))
+		for _, e := range entries {
+			out = append(out, e...)
+		}
+		return out
+	case bool:
+		if x {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	default:
+		panic("cborEncode: 不支持的类型")
+	}
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
+
+// softAuthenticator 软件实现的认证器，用于生成注册与登录响应
+type softAuthenticator struct {
+	alg       int
+	key       crypto.Signer
+	credID    []byte
+	signCount uint32
+}
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKey     *rsa.PrivateKey
+)
+
+// sharedRSAKey RSA 密钥生成较慢，各测试共用一把 2048 位密钥
+func sharedRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testRSAKeyOnce.Do(func() {
+		var err error
+		if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatalf("生成RSA密钥失败: %v", err)
+		}
+	})
+	return testRSAKey
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+	a := &softAuthenticator{alg: alg, credID: make([]byte, 16)}
+	if _, err := rand.Read(a.credID); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	var err error
+	switch alg {
+	case coseAlgES256:
+		a.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case coseAlgEdDSA:
+		_, a.key, err = ed25519.GenerateKey(rand.Reader)
+	case coseAlgRS256:
+		a.key = sharedRSAKey(t)
+	}
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	return a
+}
+
+// coseKey 公钥的 COSE_Key 表示
+func (a *softAuthenticator) coseKey() map[any]any {
+	switch k := a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return map[any]any{int64(1): int64(2), int64(3): int64(coseAlgES256), int64(-1): int64(1),
+			int64(-2): k.X.FillBytes(make([]byte, 32)), int64(-3): k.Y.FillBytes(make([]byte, 32))}
+	case ed25519.PublicKey:
+		return map[any]any{int64(1): int64(1), int64(3): int64(coseAlgEdDSA), int64(-1): int64(6), int64(-2): []byte(k)}
+	case *rsa.PublicKey:
+		return map[any]any{int64(1): int64(3), int64(3): int64(coseAlgRS256),
+			int64(-1): k.N.Bytes(), int64(-2): big.NewInt(int64(k.E)).Bytes()}
+	}
+	return nil
+}
+
+// attestedCredentialData AAGUID || 凭证ID长度 || 凭证ID || COSE 公钥
+func (a *softAuthenticator) attestedCredentialData(coseKey map[any]any) []byte {
+	out := make([]byte, 16)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(a.credID)))
+	out = append(out, a.credID...)
+	return append(out, cborEncode(coseKey)...)
+}
+
+// sign 按 WebAuthn 规则对 authenticatorData || SHA-256(clientDataJSON) 签名
+func (a *softAuthenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	t.Helper()
+	clientHash := sha256.Sum256(clientDataJSON)
+	msg := append(append([]byte{}, authData...), clientHash[:]...)
+	var sig []byte
+	var err error
+	if a.alg == coseAlgEdDSA {
+		sig, err = a.key.Sign(rand.Reader, msg, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(msg)
+		sig, err = a.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	return sig
+}
+
+// buildAuthData rpIdHash || flags || signCount || 附加数据
+func buildAuthData(rpID string, flags byte, signCount uint32, rest ...[]byte) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	out := append(hash[:], flags)
+	out = binary.BigEndian.AppendUint32(out, signCount)
+	for _, r := range rest {
+		out = append(out, r...)
+	}
+	return out
+}
+
+func TestCBORDecode(t *testing.T) {
+	nested := bytes.Repeat([]byte{0x81}, cborMaxDepth+2)
+	nested = append(nested, 0x00)
+
+	tests := []struct {
+		name string
+		data []byte
+		want any
+		n    int
+		err  bool
+	}{
+		{"正整数", cborEncode(1000), int64(1000), 3, false},
+		{"负整数", cborEncode(-257), int64(-257), 3, false},
+		{"字节串", cborEncode([]byte{1, 2}), []byte{1, 2}, 3, false},
+		{"文本", cborEncode("fmt"), "fmt", 4, false},
+		{"数组", cborEncode([]any{int64(1), "a"}), []any{int64(1), "a"}, 4, false},
+		{"映射", cborEncode(map[any]any{"k": true}), map[any]any{"k": true}, 4, false},
+		{"标签", []byte{0xc2, 0x41, 0x01}, []byte{0x01}, 3, false},
+		{"null", []byte{0xf6}, nil, 1, false},
+		{"只解析第一个数据项", []byte{0x01, 0x02}, int64(1), 1, false},
+		{"空输入", nil, nil, 0, true},
+		{"字节串被截断", []byte{0x45, 0x01, 0x02}, nil, 0, true},
+		{"长度头被截断", []byte{0x19, 0x01}, nil, 0, true},
+		{"不定长映射", []byte{0xbf, 0x01, 0x02, 0xff}, nil, 0, true},
+		{"数组元素缺失", []byte{0x82, 0x01}, nil, 0, true},
+		{"数组长度超出输入", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, 0, true},
+		{"映射键为字节串", []byte{0xa1, 0x41, 0x00, 0x01}, nil, 0, true},
+		{"映射值缺失", []byte{0xa1, 0x01}, nil, 0, true},
+		{"负整数溢出", []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, 0, true},
+		{"嵌套过深", nested, nil, 0, true},
+		{"浮点数", []byte{0xf9, 0x3c, 0x00}, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := cborDecode(tt.data, 0)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, 期望出错 %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if n != tt.n || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("得到 %#v (%d 字节)，期望 %#v (%d 字节)", got, n, tt.want, tt.n)
+			}
+		})
+	}
+}
+
+func TestParseAuthenticatorData(t *testing.T) {
+	a := newSoftAuthenticator(t, coseAlgES256)
+	attested := a.attestedCredentialData(a.coseKey())
+	ext := cborEncode(map[any]any{"credProps": true})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		attested bool
+	}{
+		{"仅基本字段", buildAuthData("example.com", authFlagUserPresent, 7), false, false},
+		{"含凭证数据", buildAuthData("example.com", authFlagUserPresent|authFlagAttested, 0, attested), false, true},
+		{"含凭证数据与扩展", buildAuthData("example.com", authFlagUserPresent|authFlagAttested|authFlagExtensions, 0, attested, ext), false, true},
+		{"长度不足", make([]byte, 36), true, false},
+		{"多余字节", buildAuthData("example.com", authFlagUserPresent, 0, []byte{0}), true, false},
+		{"声明凭证数据但缺失", buildAuthData("example.com", authFlagAttested, 0), true, false},
+		{"凭证ID被截断", buildAuthData("example.com", authFlagAttested, 0, attested[:20]), true, false},
+		{"公钥 CBOR 损坏", buildAuthData("example.com", authFlagAttested, 0, attested[:len(attested)-5]), true, false},
+		{"公钥不是映射", buildAuthData("example.com", authFlagAttested, 0, attested[:34], cborEncode("key")), true, false},
+		{"扩展 CBOR 损坏", buildAuthData("example.com", authFlagExtensions, 0, []byte{0xa1}), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ad, err := parseAuthenticatorData(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, 期望出错 %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			rpHash := sha256.Sum256([]byte("example.com"))
+			if !bytes.Equal(ad.rpIDHash, rpHash[:]) {
+				t.Fatal("rpIdHash 解析错误")
+			}
+			if tt.attested != (ad.publicKey != nil) || (tt.attested && !bytes.Equal(ad.credentialID, a.credID)) {
+				t.Fatalf("凭证数据解析错误: id=%x key=%v", ad.credentialID, ad.publicKey)
+			}
+		})
+	}
+	if ad, _ := parseAuthenticatorData(buildAuthData("example.com", authFlagUserPresent, 7)); ad.signCount != 7 {
+		t.Fatalf("signCount = %d", ad.signCount)
+	}
+}
+
+func TestParseCOSEKey(t *testing.T) {
+	es := newSoftAuthenticator(t, coseAlgES256)
+	ed := newSoftAuthenticator(t, coseAlgEdDSA)
+	rs := newSoftAuthenticator(t, coseAlgRS256)
+
+	withField := func(m map[any]any, k int64, v any) map[any]any {
+		out := make(map[any]any, len(m))
+		for key, val := range m {
+			out[key] = val
+		}
+		out[k] = v
+		return out
+	}
+	offCurve := make([]byte, 32)
+	offCurve[31] = 1
+
+	tests := []struct {
+		name    string
+		key     map[any]any
+		wantAlg int
+		wantErr bool
+	}{
+		{"ES256", es.coseKey(), coseAlgES256, false},
+		{"EdDSA", ed.coseKey(), coseAlgEdDSA, false},
+		{"RS256", rs.coseKey(), coseAlgRS256, false},
+		{"EC 点不在曲线上", withField(es.coseKey(), -3, offCurve), 0, true},
+		{"EC 曲线不支持", withField(es.coseKey(), -1, int64(2)), 0, true},
+		{"EC 坐标长度错误", withField(es.coseKey(), -2, []byte{1}), 0, true},
+		{"OKP 曲线不支持", withField(ed.coseKey(), -1, int64(4)), 0, true},
+		{"RSA 指数为 3", withField(rs.coseKey(), -2, []byte{0x03}), 0, true},
+		{"RSA 指数为 1", withField(rs.coseKey(), -2, []byte{0x01}), 0, true},
+		{"RSA 指数为偶数", withField(rs.coseKey(), -2, []byte{0x01, 0x00, 0x00}), 0, true},
+		{"RSA 其他奇数指数", withField(rs.coseKey(), -2, []byte{0x01, 0x00, 0x03}), 0, true},
+		{"RSA 指数为空", withField(rs.coseKey(), -2, []byte{}), 0, true},
+		{"RSA 模数过短", withField(rs.coseKey(), -1, make([]byte, 128)), 0, true},
+		{"算法与密钥类型不符", withField(es.coseKey(), 3, int64(coseAlgRS256)), 0, true},
+		{"缺少字段", map[any]any{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub, alg, err := parseCOSEKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, 期望出错 %v", err, tt.wantErr)
+			}
+			if err == nil && (alg != tt.wantAlg || pub == nil) {
+				t.Fatalf("alg = %d pub = %v", alg, pub)
+			}
+		})
+	}
+}
+
+func TestVerifyWebAuthnSignature(t *testing.T) {
+	clientData := []byte(`{"type":"webauthn.get","challenge":"abc","origin":"https://example.com"}`)
+	authData := buildAuthData("example.com", authFlagUserPresent|authFlagUserVerified, 1)
+
+	for name, alg := range map[string]int{"ES256": coseAlgES256, "EdDSA": coseAlgEdDSA, "RS256": coseAlgRS256} {
+		a := newSoftAuthenticator(t, alg)
+		der, err := x509.MarshalPKIXPublicKey(a.key.Public())
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey: %v", err)
+		}
+		sig := a.sign(t, authData, clientData)
+		tamperedSig := append([]byte{}, sig...)
+		tamperedSig[len(tamperedSig)-1] ^= 0x01
+		tamperedAuth := append([]byte{}, authData...)
+		tamperedAuth[len(tamperedAuth)-1]++
+		otherKey := newSoftAuthenticator(t, coseAlgES256)
+		otherDER, _ := x509.MarshalPKIXPublicKey(otherKey.key.Public())
+
+		tests := []struct {
+			name       string
+			der        []byte
+			alg        int
+			authData   []byte
+			clientData []byte
+			sig        []byte
+			ok         bool
+		}{
+			{"有效签名", der, alg, authData, clientData, sig, true},
+			{"签名被篡改", der, alg, authData, clientData, tamperedSig, false},
+			{"认证器数据被篡改", der, alg, tamperedAuth, clientData, sig, false},
+			{"clientData 被篡改", der, alg, authData, append([]byte{' '}, clientData...), sig, false},
+			{"公钥与算法不符", otherDER, alg, authData, clientData, sig, false},
+			{"公钥 DER 损坏", der[:10], alg, authData, clientData, sig, false},
+			{"未知算法", der, -35, authData, clientData, sig, false},
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				err := verifyWebAuthnSignature(tt.der, tt.alg, tt.authData, tt.clientData, tt.sig)
+				if (err == nil) != tt.ok {
+					t.Fatalf("err = %v, 期望通过 %v", err, tt.ok)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxPasskeysPerUser 每个用户可注册的通行密钥数量上限
+const maxPasskeysPerUser = 10
+
+// WebAuthnService 通行密钥注册与登录（WebAuthn Level 2）
+// 要求用户验证（UV），不校验证明声明（attestation 为 none）
+// 挑战一次性有效，保存在 CodeRepository 中（webauthn_register / webauthn_login 用途）
+type WebAuthnService interface {
+	// BeginRegistration 生成注册选项
+	BeginRegistration(ctx context.Context, userID uuid.UUID) (*model.PublicKeyCredentialCreationOptions, error)
+	// FinishRegistration 校验认证器响应并保存凭证
+	FinishRegistration(ctx context.Context, userID uuid.UUID, req *model.PasskeyRegisterFinishRequest) (*model.PasskeyResponse, error)
+	// ListPasskeys 列出用户的通行密钥
+	ListPasskeys(userID uuid.UUID) ([]*model.PasskeyResponse, error)
+	// DeletePasskey 删除通行密钥
+	DeletePasskey(ctx context.Context, userID, id uuid.UUID) error
+	// BeginLogin 生成登录挑战；指定用户名时仅允许该用户的凭证
+	BeginLogin(ctx context.Context, req *model.PasskeyLoginBeginRequest) (*model.PasskeyLoginBeginResponse, error)
+	// FinishLogin 校验断言签名，返回凭证所属用户；不检查账户状态
+	FinishLogin(ctx context.Context, req *model.PasskeyLoginFinishRequest) (*model.User, error)
+}
+
+type webAuthnService struct {
+	credRepo   repository.WebAuthnCredentialRepository
+	userRepo   repository.UserRepository
+	codeRepo   repository.CodeRepository
+	userLogSvc UserActionLogService
+	cfg        *config.WebAuthnConfig
+}
+
+// NewWebAuthnService 创建通行密钥服务实例
+func NewWebAuthnService(credRepo repository.WebAuthnCredentialRepository, userRepo repository.UserRepository, codeRepo repository.CodeRepository, userLogSvc UserActionLogService, cfg *config.WebAuthnConfig) WebAuthnService {
+	return &webAuthnService{
+		credRepo:   credRepo,
+		userRepo:   userRepo,
+		codeRepo:   codeRepo,
+		userLogSvc: userLogSvc,
+		cfg:        cfg,
+	}
+}
+
+// collectedClientData 浏览器生成的 clientDataJSON
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (s *webAuthnService) BeginRegistration(ctx context.Context, userID uuid.UUID) (*model.PublicKeyCredentialCreationOptions, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	creds, err := s.credRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) >= maxPasskeysPerUser {
+		return nil, errors.New("通行密钥数量已达上限")
+	}
+
+	challenge, err := newWebAuthnChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("生成挑战失败: %w", err)
+	}
+	if err := s.codeRepo.Set(ctx, repository.CodePurposeWebAuthnRegister, userID.String(), challenge, s.timeout()); err != nil {
+		return nil, fmt.Errorf("保存注册会话失败: %w", err)
+	}
+
+	displayName := user.Nickname
+	if displayName == "" {
+		displayName = user.Username
+	}
+	return &model.PublicKeyCredentialCreationOptions{
+		Challenge: challenge,
+		RP:        model.PublicKeyCredentialRpEntity{ID: s.cfg.RPID, Name: s.cfg.RPName},
+		User: model.PublicKeyCredentialUserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(user.ID[:]),
+			Name:        user.Username,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []model.PublicKeyCredentialParameters{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgEdDSA},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            s.timeout().Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(creds),
+		AuthenticatorSelection: model.AuthenticatorSelectionCriteria{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+func (s *webAuthnService) FinishRegistration(ctx context.Context, userID uuid.UUID, req *model.PasskeyRegisterFinishRequest) (*model.PasskeyResponse, error) {
+	key := userID.String()
+	// 挑战只能使用一次：原子地取出并删除，并发提交的同一响应只有一个能拿到挑战
+	challenge, err := s.codeRepo.Consume(ctx, repository.CodePurposeWebAuthnRegister, key)
+	if err != nil {
+		return nil, fmt.Errorf("获取注册会话失败: %w", err)
+	}
+	if challenge == "" {
+		return nil, errors.New("注册会话已过期，请重新开始")
+	}
+
+	clientDataJSON, err := decodeBase64URL(req.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	if err := s.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attObj, err := decodeBase64URL(req.Credential.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	decoded, _, err := cborDecode(attObj, 0)
+	if err != nil {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	att, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	if err := s.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.publicKey == nil {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+	rawID, err := decodeBase64URL(req.Credential.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.credentialID) {
+		return nil, errors.New("通行密钥数据格式错误")
+	}
+
+	pub, alg, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, errors.New("不支持的通行密钥算法")
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("编码公钥失败: %w", err)
+	}
+
+	if _, err := s.credRepo.GetByCredentialID(authData.credentialID); err == nil {
+		return nil, errors.New("该通行密钥已注册")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询通行密钥失败: %w", err)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "通行密钥"
+	}
+	cred := &model.WebAuthnCredential{
+		ID:           uuid.New(),
+		UserID:       userID,
+		CredentialID: authData.credentialID,
+		PublicKey:    der,
+		Algorithm:    alg,
+		SignCount:    int64(authData.signCount),
+		AAGUID:       formatAAGUID(authData.aaguid),
+		Transports:   strings.Join(req.Credential.Response.Transports, ","),
+		Name:         name,
+	}
+	if err := s.credRepo.Create(cred); err != nil {
+		return nil, fmt.Errorf("保存通行密钥失败: %w", err)
+	}
+	s.logAction(ctx, userID, "passkey_registered", fmt.Sprintf("passkey:%s name:%s", cred.ID, cred.Name))
+	return toPasskeyResponse(cred), nil
+}
+
+func (s *webAuthnService) ListPasskeys(userID uuid.UUID) ([]*model.PasskeyResponse, error) {
+	creds, err := s.credRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*model.PasskeyResponse, 0, len(creds))
+	for _, c := range creds {
+		res = append(res, toPasskeyResponse(c))
+	}
+	return res, nil
+}
+
+func (s *webAuthnService) DeletePasskey(ctx context.Context, userID, id uuid.UUID) error {
+	ok, err := s.credRepo.Delete(userID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("通行密钥不存在")
+	}
+	s.logAction(ctx, userID, "passkey_deleted", fmt.Sprintf("passkey:%s", id))
+	return nil
+}
+
+// BeginLogin 用户名不存在或未注册通行密钥时返回与可发现凭证相同的选项，避免暴露账户信息
+func (s *webAuthnService) BeginLogin(ctx context.Context, req *model.PasskeyLoginBeginRequest) (*model.PasskeyLoginBeginResponse, error) {
+	var boundUser string
+	var allow []model.PublicKeyCredentialDescriptor
+	if username := strings.TrimSpace(req.Username); username != "" {
+		user, err := s.userRepo.GetByUsername(username)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("查询用户失败: %w", err)
+		}
+		if user != nil {
+			creds, err := s.credRepo.ListByUser(user.ID)
+			if err != nil {
+				return nil, err
+			}
+			if len(creds) > 0 {
+				boundUser = user.ID.String()
+				allow = credentialDescriptors(creds)
+			}
+		}
+	}
+
+	challenge, err := newWebAuthnChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("生成挑战失败: %w", err)
+	}
+	sessionID := uuid.New()
+	if err := s.codeRepo.Set(ctx, repository.CodePurposeWebAuthnLogin, sessionID.String(), challenge+":"+boundUser, s.timeout()); err != nil {
+		return nil, fmt.Errorf("保存登录会话失败: %w", err)
+	}
+	if allow == nil {
+		allow = []model.PublicKeyCredentialDescriptor{}
+	}
+	return &model.PasskeyLoginBeginResponse{
+		SessionID: sessionID.String(),
+		PublicKey: model.PublicKeyCredentialRequestOptions{
+			Challenge:        challenge,
+			RPID:             s.cfg.RPID,
+			AllowCredentials: allow,
+			UserVerification: "required",
+			Timeout:          s.timeout().Milliseconds(),
+		},
+	}, nil
+}
+
+func (s *webAuthnService) FinishLogin(ctx context.Context, req *model.PasskeyLoginFinishRequest) (*model.User, error) {
+	session, err := s.codeRepo.Consume(ctx, repository.CodePurposeWebAuthnLogin, req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取登录会话失败: %w", err)
+	}
+	if session == "" {
+		return nil, errors.New("登录会话已过期，请重新开始")
+	}
+	challenge, boundUser, _ := strings.Cut(session, ":")
+
+	rawID, err := decodeBase64URL(req.Credential.RawID)
+	if err != nil {
+		return nil, errors.New("通行密钥验证失败")
+	}
+	cred, err := s.credRepo.GetByCredentialID(rawID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("通行密钥验证失败")
+		}
+		return nil, fmt.Errorf("查询通行密钥失败: %w", err)
+	}
+	if boundUser != "" && boundUser != cred.UserID.String() {
+		return nil, errors.New("通行密钥验证失败")
+	}
+	// 可发现凭证登录时认证器返回 userHandle，必须与凭证所属用户一致
+	if req.Credential.Response.UserHandle != "" {
+		handle, err := decodeBase64URL(req.Credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(handle, cred.UserID[:]) {
+			return nil, errors.New("通行密钥验证失败")
+		}
+	}
+
+	clientDataJSON, err := decodeBase64URL(req.Credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.New("通行密钥验证失败")
+	}
+	if err := s.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+	rawAuthData, err := decodeBase64URL(req.Credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errors.New("通行密钥验证失败")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, errors.New("通行密钥验证失败")
+	}
+	if err := s.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	signature, err := decodeBase64URL(req.Credential.Response.Signature)
+	if err != nil {
+		return nil, errors.New("通行密钥验证失败")
+	}
+	if err := verifyWebAuthnSignature(cred.PublicKey, cred.Algorithm, rawAuthData, clientDataJSON, signature); err != nil {
+		return nil, errors.New("通行密钥验证失败")
+	}
+
+	// 签名计数回退说明凭证可能被克隆；计数始终为0的认证器（多数同步通行密钥）不做检查
+	if authData.signCount != 0 || cred.SignCount != 0 {
+		if int64(authData.signCount) <= cred.SignCount {
+			s.logAction(ctx, cred.UserID, "passkey_clone_suspected", fmt.Sprintf("passkey:%s stored:%d received:%d", cred.ID, cred.SignCount, authData.signCount))
+			return nil, errors.New("通行密钥验证失败")
+		}
+	}
+	if err := s.credRepo.UpdateSignCount(cred.ID, int64(authData.signCount), time.Now()); err != nil {
+		log.Printf("更新通行密钥签名计数失败: %v", err)
+	}
+
+	user, err := s.userRepo.GetByID(cred.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("通行密钥验证失败")
+		}
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return user, nil
+}
+
+// verifyClientData 校验类型、挑战与来源
+func (s *webAuthnService) verifyClientData(raw []byte, typ, challenge string) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return errors.New("通行密钥数据格式错误")
+	}
+	if cd.Type != typ {
+		return errors.New("通行密钥数据类型错误")
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return errors.New("通行密钥挑战不匹配")
+	}
+	if cd.CrossOrigin || !slices.Contains(s.cfg.Origins, cd.Origin) {
+		return errors.New("通行密钥来源不受信任")
+	}
+	return nil
+}
+
+// verifyAuthenticatorData 校验依赖方ID哈希与用户在场、用户验证标志
+func (s *webAuthnService) verifyAuthenticatorData(ad *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(s.cfg.RPID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return errors.New("通行密钥依赖方不匹配")
+	}
+	if ad.flags&authFlagUserPresent == 0 || ad.flags&authFlagUserVerified == 0 {
+		return errors.New("通行密钥未完成用户验证")
+	}
+	return nil
+}
+
+func (s *webAuthnService) timeout() time.Duration {
+	if s.cfg.TimeoutSeconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(s.cfg.TimeoutSeconds) * time.Second
+}
+
+func (s *webAuthnService) logAction(ctx context.Context, userID uuid.UUID, action, details string) {
+	_ = s.userLogSvc.Create(ctx, &model.UserActionLog{
+		UserID:  &userID,
+		Action:  action,
+		Details: details,
+	})
+}
+
+// newWebAuthnChallenge 生成32字节随机挑战（base64url）
+func newWebAuthnChallenge() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// decodeBase64URL 兼容带填充与不带填充的 base64url
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func credentialDescriptors(creds []*model.WebAuthnCredential) []model.PublicKeyCredentialDescriptor {
+	res := make([]model.PublicKeyCredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		res = append(res, model.PublicKeyCredentialDescriptor{
+			Type:       "public-key",
+			ID:         base64.RawURLEncoding.EncodeToString(c.CredentialID),
+			Transports: splitTransports(c.Transports),
+		})
+	}
+	return res
+}
+
+func splitTransports(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func toPasskeyResponse(c *model.WebAuthnCredential) *model.PasskeyResponse {
+	return &model.PasskeyResponse{
+		ID:           c.ID,
+		Name:         c.Name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(c.CredentialID),
+		Transports:   splitTransports(c.Transports),
+		LastUsedAt:   c.LastUsedAt,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// formatAAGUID 以 UUID 形式记录认证器型号标识
+func formatAAGUID(b []byte) string {
+	id, err := uuid.FromBytes(b)
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
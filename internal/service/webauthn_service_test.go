@@ -0,0 +1,469 @@
+package service
+
+import (
+	"backend/internal/config"
+	"backend/internal/model"
+	"backend/internal/repository"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// fakeCredRepo 内存中的通行密钥表
+type fakeCredRepo struct {
+	creds map[string]*model.WebAuthnCredential // 凭证ID -> 凭证
+}
+
+func (r *fakeCredRepo) Create(cred *model.WebAuthnCredential) error {
+	cp := *cred
+	r.creds[string(cred.CredentialID)] = &cp
+	return nil
+}
+
+func (r *fakeCredRepo) GetByCredentialID(credentialID []byte) (*model.WebAuthnCredential, error) {
+	c, ok := r.creds[string(credentialID)]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (r *fakeCredRepo) ListByUser(userID uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	var out []*model.WebAuthnCredential
+	for _, c := range r.creds {
+		if c.UserID == userID {
+			cp := *c
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeCredRepo) UpdateSignCount(id uuid.UUID, signCount int64, usedAt time.Time) error {
+	for _, c := range r.creds {
+		if c.ID == id {
+			c.SignCount, c.LastUsedAt = signCount, &usedAt
+		}
+	}
+	return nil
+}
+
+func (r *fakeCredRepo) Delete(userID, id uuid.UUID) (bool, error) {
+	for k, c := range r.creds {
+		if c.ID == id && c.UserID == userID {
+			delete(r.creds, k)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type webAuthnFixture struct {
+	svc   WebAuthnService
+	creds *fakeCredRepo
+	logs  *fakeUserLogService
+	user  *model.User
+}
+
+func newWebAuthnFixture(t *testing.T) *webAuthnFixture {
+	t.Helper()
+	_, rdb := newTestRedis(t)
+	f := &webAuthnFixture{
+		creds: &fakeCredRepo{creds: make(map[string]*model.WebAuthnCredential)},
+		logs:  &fakeUserLogService{},
+		user:  &model.User{ID: uuid.New(), Username: "alice", Status: "active"},
+	}
+	f.svc = NewWebAuthnService(f.creds, newFakeUserRepo(f.user), repository.NewCodeRepository(rdb), f.logs,
+		&config.WebAuthnConfig{RPID: testRPID, RPName: "Test", Origins: []string{testOrigin}})
+	return f
+}
+
+// clientDataJSON 浏览器生成的客户端数据
+func clientDataJSON(typ, challenge, origin string, crossOrigin bool) []byte {
+	raw, _ := json.Marshal(collectedClientData{Type: typ, Challenge: challenge, Origin: origin, CrossOrigin: crossOrigin})
+	return raw
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// registration 认证器注册响应中可被篡改的部分
+type registration struct {
+	typ, challenge, origin string
+	crossOrigin            bool
+	rpID                   string
+	flags                  byte
+	coseKey                map[any]any
+	rawID                  []byte
+	// attObj 非空时直接作为 attestationObject
+	attObj []byte
+}
+
+func (a *softAuthenticator) registration(challenge string) *registration {
+	return &registration{
+		typ: "webauthn.create", challenge: challenge, origin: testOrigin, rpID: testRPID,
+		flags:   authFlagUserPresent | authFlagUserVerified | authFlagAttested,
+		coseKey: a.coseKey(), rawID: a.credID,
+	}
+}
+
+func (a *softAuthenticator) registerRequest(r *registration) *model.PasskeyRegisterFinishRequest {
+	attObj := r.attObj
+	if attObj == nil {
+		authData := buildAuthData(r.rpID, r.flags, a.signCount, a.attestedCredentialData(r.coseKey))
+		attObj = cborEncode(map[any]any{"fmt": "none", "attStmt": map[any]any{}, "authData": authData})
+	}
+	return &model.PasskeyRegisterFinishRequest{
+		Name: "测试密钥",
+		Credential: model.PasskeyAttestation{
+			ID: b64(r.rawID), RawID: b64(r.rawID), Type: "public-key",
+			Response: model.PasskeyAttestationResponse{
+				ClientDataJSON:    b64(clientDataJSON(r.typ, r.challenge, r.origin, r.crossOrigin)),
+				AttestationObject: b64(attObj),
+				Transports:        []string{"internal"},
+			},
+		},
+	}
+}
+
+// register 完成一次正常注册
+func (f *webAuthnFixture) register(t *testing.T, a *softAuthenticator) {
+	t.Helper()
+	ctx := context.Background()
+	opts, err := f.svc.BeginRegistration(ctx, f.user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if _, err := f.svc.FinishRegistration(ctx, f.user.ID, a.registerRequest(a.registration(opts.Challenge))); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	es := newSoftAuthenticator(t, coseAlgES256)
+	tests := []struct {
+		name    string
+		alg     int
+		mutate  func(r *registration)
+		wantErr string
+	}{
+		{"ES256", coseAlgES256, nil, ""},
+		{"EdDSA", coseAlgEdDSA, nil, ""},
+		{"RS256", coseAlgRS256, nil, ""},
+		{"挑战被篡改", coseAlgES256, func(r *registration) { r.challenge = b64([]byte("forged")) }, "通行密钥挑战不匹配"},
+		{"类型错误", coseAlgES256, func(r *registration) { r.typ = "webauthn.get" }, "通行密钥数据类型错误"},
+		{"来源不受信任", coseAlgES256, func(r *registration) { r.origin = "https://evil.example" }, "通行密钥来源不受信任"},
+		{"跨源嵌入", coseAlgES256, func(r *registration) { r.crossOrigin = true }, "通行密钥来源不受信任"},
+		{"rpIdHash 不符", coseAlgES256, func(r *registration) { r.rpID = "evil.example" }, "通行密钥依赖方不匹配"},
+		{"缺少 UP 标志", coseAlgES256, func(r *registration) { r.flags &^= authFlagUserPresent }, "通行密钥未完成用户验证"},
+		{"缺少 UV 标志", coseAlgES256, func(r *registration) { r.flags &^= authFlagUserVerified }, "通行密钥未完成用户验证"},
+		{"缺少凭证数据", coseAlgES256, func(r *registration) {
+			authData := buildAuthData(testRPID, authFlagUserPresent|authFlagUserVerified, 0)
+			r.attObj = cborEncode(map[any]any{"fmt": "none", "attStmt": map[any]any{}, "authData": authData})
+		}, "通行密钥数据格式错误"},
+		{"rawId 与凭证ID不符", coseAlgES256, func(r *registration) { r.rawID = []byte("another-id") }, "通行密钥数据格式错误"},
+		{"attestationObject 不是 CBOR", coseAlgES256, func(r *registration) { r.attObj = []byte{0xbf, 0x00} }, "通行密钥数据格式错误"},
+		{"attestationObject 被截断", coseAlgES256, func(r *registration) {
+			full := cborEncode(map[any]any{"fmt": "none", "authData": buildAuthData(testRPID, r.flags, 0, es.attestedCredentialData(r.coseKey))})
+			r.attObj = full[:len(full)-10]
+		}, "通行密钥数据格式错误"},
+		{"authData 类型错误", coseAlgES256, func(r *registration) {
+			r.attObj = cborEncode(map[any]any{"fmt": "none", "authData": "text"})
+		}, "通行密钥数据格式错误"},
+		{"RSA 指数为 3", coseAlgRS256, func(r *registration) { r.coseKey[int64(-2)] = []byte{0x03} }, "不支持的通行密钥算法"},
+		{"RSA 指数为偶数", coseAlgRS256, func(r *registration) { r.coseKey[int64(-2)] = []byte{0x01, 0x00, 0x00} }, "不支持的通行密钥算法"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newWebAuthnFixture(t)
+			a := newSoftAuthenticator(t, tt.alg)
+			a.signCount = 3
+			opts, err := f.svc.BeginRegistration(ctx, f.user.ID)
+			if err != nil {
+				t.Fatalf("BeginRegistration: %v", err)
+			}
+			r := a.registration(opts.Challenge)
+			if tt.mutate != nil {
+				tt.mutate(r)
+			}
+			resp, err := f.svc.FinishRegistration(ctx, f.user.ID, a.registerRequest(r))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v，期望 %s", err, tt.wantErr)
+				}
+				if len(f.creds.creds) != 0 {
+					t.Fatal("校验失败时不应保存凭证")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FinishRegistration: %v", err)
+			}
+			cred, ok := f.creds.creds[string(a.credID)]
+			if !ok || cred.UserID != f.user.ID || cred.Algorithm != tt.alg || cred.SignCount != int64(a.signCount) {
+				t.Fatalf("保存的凭证 = %+v", cred)
+			}
+			if resp.CredentialID != b64(a.credID) || resp.Name != "测试密钥" {
+				t.Fatalf("响应 = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegistrationChallengeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t, coseAlgES256)
+	opts, err := f.svc.BeginRegistration(ctx, f.user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+
+	// 挑战在校验前即被取走，即使本次响应无效也不能再用
+	bad := a.registration(opts.Challenge)
+	bad.origin = "https://evil.example"
+	if _, err := f.svc.FinishRegistration(ctx, f.user.ID, a.registerRequest(bad)); err == nil {
+		t.Fatal("来源错误的响应应被拒绝")
+	}
+	_, err = f.svc.FinishRegistration(ctx, f.user.ID, a.registerRequest(a.registration(opts.Challenge)))
+	if err == nil || err.Error() != "注册会话已过期，请重新开始" {
+		t.Fatalf("重复使用挑战返回 %v", err)
+	}
+}
+
+func TestWebAuthnRegistrationRejectsDuplicateCredential(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t, coseAlgEdDSA)
+	f.register(t, a)
+
+	ctx := context.Background()
+	opts, err := f.svc.BeginRegistration(ctx, f.user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	if len(opts.ExcludeCredentials) != 1 || opts.ExcludeCredentials[0].ID != b64(a.credID) {
+		t.Fatalf("ExcludeCredentials = %+v", opts.ExcludeCredentials)
+	}
+	_, err = f.svc.FinishRegistration(ctx, f.user.ID, a.registerRequest(a.registration(opts.Challenge)))
+	if err == nil || err.Error() != "该通行密钥已注册" {
+		t.Fatalf("重复注册返回 %v", err)
+	}
+}
+
+// assertion 认证器登录响应中可被篡改的部分
+type assertion struct {
+	typ, challenge, origin string
+	rpID                   string
+	flags                  byte
+	signCount              uint32
+	userHandle             []byte
+	// tamper 在签名之后修改认证器数据或签名
+	tamperAuthData, tamperSignature bool
+}
+
+func (a *softAuthenticator) assertion(challenge string, userID uuid.UUID) *assertion {
+	a.signCount++
+	return &assertion{
+		typ: "webauthn.get", challenge: challenge, origin: testOrigin, rpID: testRPID,
+		flags: authFlagUserPresent | authFlagUserVerified, signCount: a.signCount, userHandle: userID[:],
+	}
+}
+
+func (a *softAuthenticator) loginRequest(t *testing.T, sessionID string, as *assertion) *model.PasskeyLoginFinishRequest {
+	t.Helper()
+	authData := buildAuthData(as.rpID, as.flags, as.signCount)
+	clientData := clientDataJSON(as.typ, as.challenge, as.origin, false)
+	sig := a.sign(t, authData, clientData)
+	if as.tamperAuthData {
+		authData[len(authData)-1] ^= 0x01
+	}
+	if as.tamperSignature {
+		sig[len(sig)/2] ^= 0x01
+	}
+	return &model.PasskeyLoginFinishRequest{
+		SessionID: sessionID,
+		Credential: model.PasskeyAssertion{
+			ID: b64(a.credID), RawID: b64(a.credID), Type: "public-key",
+			Response: model.PasskeyAssertionResponse{
+				ClientDataJSON:    b64(clientData),
+				AuthenticatorData: b64(authData),
+				Signature:         b64(sig),
+				UserHandle:        b64(as.userHandle),
+			},
+		},
+	}
+}
+
+func (f *webAuthnFixture) beginLogin(t *testing.T, username string) *model.PasskeyLoginBeginResponse {
+	t.Helper()
+	begin, err := f.svc.BeginLogin(context.Background(), &model.PasskeyLoginBeginRequest{Username: username})
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	return begin
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     int
+		mutate  func(as *assertion)
+		wantErr string
+	}{
+		{"ES256", coseAlgES256, nil, ""},
+		{"EdDSA", coseAlgEdDSA, nil, ""},
+		{"RS256", coseAlgRS256, nil, ""},
+		{"签名被篡改", coseAlgES256, func(as *assertion) { as.tamperSignature = true }, "通行密钥验证失败"},
+		{"认证器数据被篡改", coseAlgEdDSA, func(as *assertion) { as.tamperAuthData = true }, "通行密钥验证失败"},
+		{"挑战不符", coseAlgES256, func(as *assertion) { as.challenge = b64([]byte("forged")) }, "通行密钥挑战不匹配"},
+		{"类型错误", coseAlgES256, func(as *assertion) { as.typ = "webauthn.create" }, "通行密钥数据类型错误"},
+		{"来源不受信任", coseAlgES256, func(as *assertion) { as.origin = "https://evil.example" }, "通行密钥来源不受信任"},
+		{"rpIdHash 不符", coseAlgES256, func(as *assertion) { as.rpID = "evil.example" }, "通行密钥依赖方不匹配"},
+		{"缺少 UP 标志", coseAlgES256, func(as *assertion) { as.flags &^= authFlagUserPresent }, "通行密钥未完成用户验证"},
+		{"缺少 UV 标志", coseAlgES256, func(as *assertion) { as.flags &^= authFlagUserVerified }, "通行密钥未完成用户验证"},
+		{"userHandle 不符", coseAlgES256, func(as *assertion) { other := uuid.New(); as.userHandle = other[:] }, "通行密钥验证失败"},
+		{"签名计数回退", coseAlgES256, func(as *assertion) { as.signCount = 1 }, "通行密钥验证失败"},
+		{"签名计数未增加", coseAlgES256, func(as *assertion) { as.signCount-- }, "通行密钥验证失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWebAuthnFixture(t)
+			a := newSoftAuthenticator(t, tt.alg)
+			a.signCount = 5
+			f.register(t, a)
+
+			begin := f.beginLogin(t, "")
+			as := a.assertion(begin.PublicKey.Challenge, f.user.ID)
+			if tt.mutate != nil {
+				tt.mutate(as)
+			}
+			user, err := f.svc.FinishLogin(context.Background(), a.loginRequest(t, begin.SessionID, as))
+			stored := f.creds.creds[string(a.credID)]
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v，期望 %s", err, tt.wantErr)
+				}
+				if stored.SignCount != 5 || stored.LastUsedAt != nil {
+					t.Fatalf("验证失败时不应更新签名计数: %+v", stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FinishLogin: %v", err)
+			}
+			if user.ID != f.user.ID {
+				t.Fatalf("登录用户 = %s", user.ID)
+			}
+			if stored.SignCount != int64(as.signCount) || stored.LastUsedAt == nil {
+				t.Fatalf("签名计数未更新: %+v", stored)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLoginSignCountRegressionIsLogged(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t, coseAlgES256)
+	a.signCount = 10
+	f.register(t, a)
+
+	begin := f.beginLogin(t, "alice")
+	as := a.assertion(begin.PublicKey.Challenge, f.user.ID)
+	as.signCount = 4
+	if _, err := f.svc.FinishLogin(context.Background(), a.loginRequest(t, begin.SessionID, as)); err == nil {
+		t.Fatal("签名计数回退应被拒绝")
+	}
+	if len(f.logs.actions) != 2 || f.logs.actions[1] != "passkey_clone_suspected" {
+		t.Fatalf("日志 = %v", f.logs.actions)
+	}
+}
+
+func TestWebAuthnLoginZeroSignCount(t *testing.T) {
+	// 同步通行密钥的签名计数始终为 0，不做回退检查
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t, coseAlgEdDSA)
+	f.register(t, a)
+
+	for i := 0; i < 2; i++ {
+		begin := f.beginLogin(t, "")
+		as := a.assertion(begin.PublicKey.Challenge, f.user.ID)
+		as.signCount = 0
+		if _, err := f.svc.FinishLogin(context.Background(), a.loginRequest(t, begin.SessionID, as)); err != nil {
+			t.Fatalf("第 %d 次登录: %v", i+1, err)
+		}
+	}
+}
+
+func TestWebAuthnLoginBoundToUsername(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	mine := newSoftAuthenticator(t, coseAlgES256)
+	f.register(t, mine)
+
+	// 另一个用户的凭证不能完成绑定到 alice 的登录会话
+	other := &model.User{ID: uuid.New(), Username: "bob", Status: "active"}
+	theirs := newSoftAuthenticator(t, coseAlgES256)
+	_ = f.creds.Create(&model.WebAuthnCredential{ID: uuid.New(), UserID: other.ID, CredentialID: theirs.credID, Algorithm: coseAlgES256})
+
+	begin := f.beginLogin(t, "alice")
+	if len(begin.PublicKey.AllowCredentials) != 1 || begin.PublicKey.AllowCredentials[0].ID != b64(mine.credID) {
+		t.Fatalf("AllowCredentials = %+v", begin.PublicKey.AllowCredentials)
+	}
+	as := theirs.assertion(begin.PublicKey.Challenge, other.ID)
+	if _, err := f.svc.FinishLogin(context.Background(), theirs.loginRequest(t, begin.SessionID, as)); err == nil || err.Error() != "通行密钥验证失败" {
+		t.Fatalf("其他用户的凭证返回 %v", err)
+	}
+
+	// 不存在的用户名返回与可发现凭证相同的选项
+	if unknown := f.beginLogin(t, "nobody"); len(unknown.PublicKey.AllowCredentials) != 0 {
+		t.Fatalf("未知用户名 AllowCredentials = %+v", unknown.PublicKey.AllowCredentials)
+	}
+}
+
+func TestWebAuthnLoginSessionIsSingleUse(t *testing.T) {
+	f := newWebAuthnFixture(t)
+	a := newSoftAuthenticator(t, coseAlgES256)
+	f.register(t, a)
+	begin := f.beginLogin(t, "")
+
+	// 并发提交同一响应，只有一个请求能取走挑战
+	var wg sync.WaitGroup
+	results := make(chan error, 8)
+	for i := 0; i < cap(results); i++ {
+		req := a.loginRequest(t, begin.SessionID, a.assertion(begin.PublicKey.Challenge, f.user.ID))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := f.svc.FinishLogin(context.Background(), req)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var succeeded int
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case err.Error() != "登录会话已过期，请重新开始":
+			t.Errorf("意外错误: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d 个请求使用了同一个挑战", succeeded)
+	}
+}